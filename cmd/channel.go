@@ -2,10 +2,19 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/hako/durafmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/history"
+	"github.com/wmw64/rekoda/internal/recorder"
+	"github.com/wmw64/rekoda/internal/twitch"
 )
 
 var (
@@ -26,10 +35,19 @@ var channelCmd = NewChannelCmd()
 
 // NewAddCmd represents the channel command
 func NewAddCmd() *cobra.Command {
-	return &cobra.Command{
+	var (
+		quality, streamsDir, template, postProcess, ads, token string
+		pollInterval, restartWindow                            time.Duration
+		disabled                                               bool
+		tags, set                                              []string
+	)
+
+	cmd := &cobra.Command{
 		Use:   "add",
 		Short: "Add channels to record",
-		Long:  "Add channels to record",
+		Long: `Add channels to record. Flags apply to every channel added,
+any other per-channel key may be given with --set key=value, see 'rekoda channel set'.`,
+		Example: "  rekoda channel add rwxrob --quality worst --tag coding --set segment_retry.attempts=6",
 		//Args:  cobra.MinimumNArgs(1),
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 1 {
@@ -38,10 +56,42 @@ func NewAddCmd() *cobra.Command {
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			addChannels(args)
-			return nil
+			var pairs []string
+			flags := cmd.Flags()
+			for flag, key := range map[string]string{"quality": "quality", "streams-dir": "streams_dir", "template": "file_template",
+				"post-process": "post_process", "ads": "ads", "token": "token"} {
+				if flags.Changed(flag) {
+					v, _ := flags.GetString(flag)
+					pairs = append(pairs, key+"="+v)
+				}
+			}
+			if flags.Changed("poll-interval") {
+				pairs = append(pairs, "poll_interval="+pollInterval.String())
+			}
+			if flags.Changed("restart-window") {
+				pairs = append(pairs, "restart_window="+restartWindow.String())
+			}
+			if disabled {
+				pairs = append(pairs, "enabled=false")
+			}
+			if len(tags) > 0 {
+				pairs = append(pairs, "tags="+strings.Join(tags, ","))
+			}
+			return addChannels(args, append(pairs, set...))
 		},
 	}
+	cmd.Flags().StringVar(&quality, "quality", "best", "Quality to record: "+strings.Join(twitch.Qualities, ", "))
+	cmd.Flags().StringVar(&streamsDir, "streams-dir", "", "Directory channel directory is created in")
+	cmd.Flags().StringVar(&template, "template", "", "File name template, placeholders: {user} {quality} {date} {time}")
+	cmd.Flags().StringVar(&postProcess, "post-process", "", "Command run once file is closed")
+	cmd.Flags().StringVar(&ads, "ads", "", "What to do with ads: keep, skip or separate")
+	cmd.Flags().StringVar(&token, "token", "", "Name of OAuth token to record with, see 'rekoda token'")
+	cmd.Flags().DurationVar(&pollInterval, "poll-interval", 0, "How often to check if channel went online")
+	cmd.Flags().DurationVar(&restartWindow, "restart-window", 0, "How long to wait for stream to come back before closing file")
+	cmd.Flags().BoolVar(&disabled, "disabled", false, "Add channel without recording it yet")
+	cmd.Flags().StringSliceVar(&tags, "tag", nil, "Label channel, may be repeated")
+	cmd.Flags().StringArrayVar(&set, "set", nil, "Set any per-channel key, e.g. proxy.urls=socks5://host:1080, may be repeated")
+	return cmd
 }
 
 var addCmd = NewAddCmd()
@@ -54,8 +104,7 @@ func NewRemoveCmd() *cobra.Command {
 		Long:  "Remove channels from config",
 		//Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			removeChannels(args)
-			return nil
+			return removeChannels(args)
 		},
 	}
 }
@@ -91,8 +140,7 @@ func NewDisableCmd() *cobra.Command {
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			disableChannels(args)
-			return nil
+			return disableChannels(args)
 		},
 	}
 }
@@ -112,14 +160,69 @@ func NewEnableCmd() *cobra.Command {
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			enableChannels(args)
-			return nil
+			return enableChannels(args)
 		},
 	}
 }
 
 var enableCmd = NewEnableCmd()
 
+// NewStatsCmd represents the channel stats command
+func NewStatsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stats <name>",
+		Short: "Show when channel usually goes live",
+		Long:  "Show observed online and offline times of channel and poll interval learned from them",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return channelStats(cmd.OutOrStdout(), args[0])
+		},
+	}
+}
+
+var statsCmd = NewStatsCmd()
+
+// NewSetCmd represents the channel set command
+func NewSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set <name> key=value...",
+		Short: "Change settings of a channel",
+		Long: `Change settings of a channel, checking them before config file is written.
+Keys of nested tables are dotted, lists are comma separated and an empty value removes the key,
+so channel follows [defaults] again. Run 'rekoda channel show <name>' to see every key.`,
+		Example: `  rekoda channel set rwxrob quality=worst ads=skip
+  rekoda channel set rwxrob segment_retry.attempts=6 proxy.urls=socks5://seoul.example.com:1080
+  rekoda channel set rwxrob poll_interval=`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setChannel(args[0], args[1:])
+		},
+	}
+}
+
+var setCmd = NewSetCmd()
+
+// NewShowCmd represents the channel show command
+func NewShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <name>",
+		Short: "Show settings of a channel",
+		Long:  "Show every setting of a channel and where its value comes from: channel entry, [defaults] or built-in default",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := config.InitConfig()
+			ch, ok := findChannel(c, args[0])
+			if !ok {
+				return fmt.Errorf("There is no channel '%v' in config", args[0])
+			}
+			showChannel(cmd.OutOrStdout(), c, ch)
+			return nil
+		},
+	}
+}
+
+var showCmd = NewShowCmd()
+
 func init() {
 	rootCmd.AddCommand(channelCmd)
 	channelCmd.AddCommand(addCmd)
@@ -127,76 +230,80 @@ func init() {
 	channelCmd.AddCommand(listCmd)
 	channelCmd.AddCommand(disableCmd)
 	channelCmd.AddCommand(enableCmd)
+	channelCmd.AddCommand(statsCmd)
+	channelCmd.AddCommand(setCmd)
+	channelCmd.AddCommand(showCmd)
 }
 
-func addChannels(list []string) {
+func addChannels(list []string, pairs []string) error {
 	c := config.InitConfig()
 
-	for _, v := range list {
-		// NYI: Check if channel not banned/valid
+	return c.Update(func(c *config.Config) error {
+		for _, v := range list {
+			// NYI: Check if channel not banned/valid
 
-		// Check if channel already exists in config
-		if c.IsChannelInConfig(v) {
-			log.WithField("general", "CLI").Warnf("Skip! '%v' is already added in config", v)
-			continue
-		}
-		log.WithField("general", "CLI").Tracef("Trying to add '%v' in config", v)
-		channel := config.Channels{
-			User:    v,
-			ID:      123,
-			Enabled: true,
-			Quality: "best",
+			// Check if channel already exists in config
+			if c.IsChannelInConfig(v) {
+				log.WithField("general", "CLI").Warnf("Skip! '%v' is already added in config", v)
+				continue
+			}
+			log.WithField("general", "CLI").Tracef("Trying to add '%v' in config", v)
+			channel := config.NewChannel(v)
+			if err := applyPairs(&channel, pairs); err != nil {
+				return err
+			}
+			if err := channel.Validate(); err != nil {
+				return fmt.Errorf("channel '%v': %w", v, err)
+			}
+			c.Channels = append(c.Channels, channel)
+			log.WithField("general", "CLI").Infof("Channel added '%v' in config file", v)
 		}
-		c.Channels = append(c.Channels, channel)
-		log.WithField("general", "CLI").Infof("Channel added '%v' in config file", v)
-	}
-	if err := c.Save(); err != nil {
-		panic(err)
-	}
+		return nil
+	})
 }
 
-func removeChannels(list []string) {
+func removeChannels(list []string) error {
 	c := config.InitConfig()
 
-	for _, v := range list {
-		c.Channels = removeSliceByName(c.Channels, v)
-		log.WithField("general", "CLI").Infof("Channel '%v' removed from config file", v)
-	}
-	if err := c.Save(); err != nil {
-		panic(err)
-	}
+	return c.Update(func(c *config.Config) error {
+		for _, v := range list {
+			c.Channels = removeSliceByName(c.Channels, v)
+			log.WithField("general", "CLI").Infof("Channel '%v' removed from config file", v)
+		}
+		return nil
+	})
 }
 
-func disableChannels(list []string) {
+func disableChannels(list []string) error {
 	c := config.InitConfig()
 
-	for _, v := range list {
-		for i, u := range c.Channels {
-			if u.User == v {
-				log.WithField("general", "CLI").Infof("Found! %v trying to disable it", u.User)
-				c.Channels[i].Enabled = false
+	return c.Update(func(c *config.Config) error {
+		for _, v := range list {
+			for i, u := range c.Channels {
+				if u.User == v {
+					log.WithField("general", "CLI").Infof("Found! %v trying to disable it", u.User)
+					c.Channels[i].Enabled = false
+				}
 			}
 		}
-	}
-	if err := c.Save(); err != nil {
-		panic(err)
-	}
+		return nil
+	})
 }
 
-func enableChannels(list []string) {
+func enableChannels(list []string) error {
 	c := config.InitConfig()
 
-	for _, v := range list {
-		for i, u := range c.Channels {
-			if u.User == v {
-				log.WithField("general", "CLI").Infof("Found! '%v' trying to enable it", u.User)
-				c.Channels[i].Enabled = true
+	return c.Update(func(c *config.Config) error {
+		for _, v := range list {
+			for i, u := range c.Channels {
+				if u.User == v {
+					log.WithField("general", "CLI").Infof("Found! '%v' trying to enable it", u.User)
+					c.Channels[i].Enabled = true
+				}
 			}
 		}
-	}
-	if err := c.Save(); err != nil {
-		panic(err)
-	}
+		return nil
+	})
 }
 
 func listChannels() {
@@ -208,6 +315,106 @@ func listChannels() {
 	ctxLog.Info(rec)
 }
 
+// applyPairs sets key=value pairs on channel entry
+func applyPairs(ch *config.Channels, pairs []string) error {
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("'%v' is not key=value", pair)
+		}
+		key = strings.TrimSpace(key)
+		if key == "user" {
+			return errors.New("channel can't be renamed, remove it and add again")
+		}
+		if err := config.SetField(ch, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findChannel returns channel entry by name, case insensitive
+func findChannel(c *config.Config, name string) (config.Channels, bool) {
+	for _, v := range c.Channels {
+		if strings.EqualFold(v.User, name) {
+			return v, true
+		}
+	}
+	return config.Channels{}, false
+}
+
+func setChannel(name string, pairs []string) error {
+	c := config.InitConfig()
+
+	return c.Update(func(c *config.Config) error {
+		for i, v := range c.Channels {
+			if !strings.EqualFold(v.User, name) {
+				continue
+			}
+			if err := applyPairs(&v, pairs); err != nil {
+				return err
+			}
+			if err := v.Validate(); err != nil {
+				return fmt.Errorf("channel '%v': %w", v.User, err)
+			}
+			c.Channels[i] = v
+			log.WithField("general", "CLI").Infof("Channel '%v' updated: %v", v.User, strings.Join(pairs, " "))
+			return nil
+		}
+		return fmt.Errorf("There is no channel '%v' in config", name)
+	})
+}
+
+// showChannel writes every key of channel with its value and where it comes from
+func showChannel(w io.Writer, c *config.Config, ch config.Channels) {
+	settingKeys := make(map[string]bool)
+	for _, k := range config.Keys(&config.Settings{}) {
+		settingKeys[k] = true
+	}
+	for _, f := range config.Fields(&ch) {
+		if !settingKeys[f.Key] {
+			fmt.Fprintf(w, "%v = %v\n", f.Key, f.Value)
+		}
+	}
+
+	overrides, defaults, base := ch.Settings, c.Defaults, c.BaseSettings()
+	layers := []struct {
+		source string
+		fields []config.Field
+	}{{"channel", config.Fields(&overrides)}, {"[defaults]", config.Fields(&defaults)}, {"built-in", config.Fields(&base)}}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, key := range config.Keys(&config.Settings{}) {
+		for _, l := range layers {
+			if f, ok := fieldByKey(l.fields, key); ok {
+				value := f.Value
+				if f.Secret {
+					value = mask(value)
+				}
+				fmt.Fprintf(tw, "%v = %v\t# %v\n", key, value, l.source)
+				break
+			}
+		}
+	}
+	tw.Flush()
+}
+
+func fieldByKey(fields []config.Field, key string) (config.Field, bool) {
+	for _, f := range fields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return config.Field{}, false
+}
+
+// mask hides secret value, keeping empty ones visible
+func mask(v string) string {
+	if v == "" || v == "''" {
+		return v
+	}
+	return "'********'"
+}
+
 func removeSliceByName(s []config.Channels, r string) []config.Channels {
 	for i, v := range s {
 		if v.User == r {
@@ -216,3 +423,76 @@ func removeSliceByName(s []config.Channels, r string) []config.Channels {
 	}
 	return s
 }
+
+func channelStats(w io.Writer, name string) error {
+	c := config.InitConfig()
+
+	h, err := history.NewStore(c.HistoryDir()).Get(name)
+	if err != nil {
+		return err
+	}
+	u := config.Channels{User: name}
+	for _, v := range c.Channels {
+		if strings.EqualFold(v.User, name) {
+			u = v
+		}
+	}
+	r := recorder.New()
+	r.UseHistory(c.HistoryDir())
+	printStats(w, h, c.Settings(u), r.PollInterval(c, u, time.Now()), time.Now())
+	return nil
+}
+
+// printStats writes summary of channel's history and a weekday by hour grid of when it went live
+func printStats(w io.Writer, h history.History, st config.ChannelSettings, interval time.Duration, now time.Time) {
+	stats := h.Stats(now)
+	fmt.Fprintf(w, "Channel:        %v\n", h.Channel)
+	if stats.Sessions == 0 {
+		fmt.Fprintln(w, "Nothing observed yet, history is collected while 'rekoda rec' runs")
+		return
+	}
+	last := "still live"
+	if !stats.Last.End.IsZero() {
+		last = stats.Last.End.In(time.Local).Format("2006-01-02 15:04")
+	}
+	fmt.Fprintf(w, "Sessions:       %v since %v\n", stats.Sessions, stats.First.In(time.Local).Format("2006-01-02"))
+	fmt.Fprintf(w, "Average length: %v\n", durafmt.Parse(stats.Average).LimitFirstN(2))
+	fmt.Fprintf(w, "Last session:   %v - %v\n", stats.Last.Start.In(time.Local).Format("2006-01-02 15:04"), last)
+
+	var usual []string
+	for _, slot := range stats.Usual(5) {
+		usual = append(usual, fmt.Sprintf("%v %02d:00 (%vx)", slot.Weekday.String()[:3], slot.Hour, slot.Count))
+	}
+	if len(usual) == 0 {
+		usual = append(usual, "no regular times yet")
+	}
+	fmt.Fprintf(w, "Usually live:   %v\n", strings.Join(usual, ", "))
+
+	switch {
+	case !st.LearnSchedule:
+		fmt.Fprintf(w, "Poll interval:  %v (learning disabled)\n", interval)
+	case stats.Sessions < history.MinSessions:
+		fmt.Fprintf(w, "Poll interval:  %v (learning after %v sessions)\n", interval, history.MinSessions)
+	default:
+		fmt.Fprintf(w, "Poll interval:  %v now (learned, %v to %v)\n", interval, st.MinPollInterval, st.MaxPollInterval)
+	}
+
+	fmt.Fprintln(w, "\nSessions started by hour, local time:")
+	fmt.Fprint(w, "    ")
+	for hour := 0; hour < 24; hour++ {
+		fmt.Fprintf(w, "%3d", hour)
+	}
+	fmt.Fprintln(w)
+	for d := time.Monday; d < time.Monday+7; d++ {
+		wd := d % 7
+		fmt.Fprintf(w, "%v ", wd.String()[:3])
+		for _, count := range stats.Starts[wd] {
+			if count == 0 {
+				fmt.Fprint(w, "  .")
+			} else {
+				fmt.Fprintf(w, "%3d", count)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
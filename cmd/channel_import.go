@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/twitch"
+	conf "github.com/wmw64/rekoda/pkg/config/toml"
+)
+
+// followsScope is what Helix wants to list channels user follows
+const followsScope = "user:read:follows"
+
+// NewExportCmd represents the channel export command
+func NewExportCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "export [file]",
+		Short: "Write channels with their settings to JSON, CSV or TOML",
+		Long: `Write every channel with its per-channel settings to file, or stdout if none is given.
+Format is taken from file extension unless --format is given, TOML is written to stdout by default.
+Import the list on another box with 'rekoda channel import'.`,
+		Example: `  rekoda channel export channels.csv
+  rekoda channel export --format json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := config.InitConfig()
+			if len(args) == 0 {
+				if format == "" {
+					format = config.FormatTOML
+				}
+				return config.ExportChannels(cmd.OutOrStdout(), c.Channels, format)
+			}
+			if format == "" {
+				format = config.FormatOf(args[0])
+			}
+			var buf bytes.Buffer
+			if err := config.ExportChannels(&buf, c.Channels, format); err != nil {
+				return err
+			}
+			if err := conf.WriteFile(args[0], buf.Bytes(), config.ExportPerm(c.Channels)); err != nil {
+				return err
+			}
+			log.WithField("general", "CLI").Infof("Exported %v channel(s) to %v", len(c.Channels), args[0])
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "", "json, csv or toml")
+	return cmd
+}
+
+var exportCmd = NewExportCmd()
+
+// NewImportCmd represents the channel import command
+func NewImportCmd() *cobra.Command {
+	var (
+		format, strategy, followed, endpoint string
+		dryRun                               bool
+		set                                  []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Add channels from JSON, CSV or TOML list, or followed channels of an account",
+		Long: `Add channels from a list written by 'rekoda channel export', '-' reads it from stdin.
+JSON may also be a plain list of names, CSV needs a 'user' column and empty cells leave keys as they are.
+Channels already in config are handled by --strategy:
+  skip       keep them as they are (default)
+  overwrite  replace them with imported ones
+  merge      set keys imported ones state, keep the rest
+Every channel is checked before config file is written, nothing is written if any is invalid.
+
+--followed imports channels followed by the account of a saved OAuth token (see 'rekoda token'),
+token needs the user:read:follows scope. Helix endpoint is helix_endpoint in [twitch].`,
+		Example: `  rekoda channel import channels.csv --strategy merge --dry-run
+  rekoda channel import --followed main --set enabled=false`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if followed == "" && len(args) != 1 {
+				return errors.New("requires a file, or --followed")
+			}
+			if followed != "" && len(args) > 0 {
+				return errors.New("give either a file or --followed")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := config.InitConfig()
+			var entries []config.ChannelEntry
+			var err error
+			if followed != "" {
+				if endpoint == "" {
+					endpoint = c.Twitch.HelixEndpoint
+				}
+				entries, err = followedChannels(c, followed, endpoint)
+			} else {
+				entries, err = readChannelList(cmd.InOrStdin(), args[0], format)
+			}
+			if err != nil {
+				return err
+			}
+			for i := range entries {
+				for _, pair := range set {
+					key, value, ok := strings.Cut(pair, "=")
+					if !ok {
+						return fmt.Errorf("'%v' is not key=value", pair)
+					}
+					entries[i].Fields = append(entries[i].Fields, config.Field{Key: strings.TrimSpace(key), Value: value})
+				}
+			}
+
+			if dryRun {
+				_, changes, err := config.ImportChannels(c.Channels, entries, strategy)
+				if err != nil {
+					return err
+				}
+				printImport(cmd.OutOrStdout(), changes)
+				fmt.Fprintln(cmd.OutOrStdout(), "Dry run, config file left as it is")
+				return nil
+			}
+			var changes []config.ImportChange
+			if err := c.Update(func(c *config.Config) error {
+				list, ch, err := config.ImportChannels(c.Channels, entries, strategy)
+				if err != nil {
+					return err
+				}
+				c.Channels, changes = list, ch
+				return nil
+			}); err != nil {
+				return err
+			}
+			printImport(cmd.OutOrStdout(), changes)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "", "json, csv or toml, taken from file extension by default")
+	cmd.Flags().StringVar(&strategy, "strategy", config.ImportSkip, "What to do with channels already in config: skip, overwrite or merge")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would change without writing config file")
+	cmd.Flags().StringVar(&followed, "followed", "", "Import channels followed by account of this saved token")
+	cmd.Flags().StringVar(&endpoint, "helix-endpoint", "", "Helix API endpoint for --followed, overrides helix_endpoint of [twitch]")
+	cmd.Flags().StringArrayVar(&set, "set", nil, "Set key=value on every imported channel, may be repeated")
+	return cmd
+}
+
+var importCmd = NewImportCmd()
+
+func init() {
+	channelCmd.AddCommand(exportCmd)
+	channelCmd.AddCommand(importCmd)
+}
+
+// readChannelList reads channel list file, '-' is stdin
+func readChannelList(stdin io.Reader, path, format string) ([]config.ChannelEntry, error) {
+	if format == "" {
+		format = config.FormatOf(path)
+	}
+	if format == "" {
+		return nil, fmt.Errorf("can't tell format of '%v', use --format", path)
+	}
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	entries, err := config.ReadChannels(r, format)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return entries, nil
+}
+
+// followedChannels lists channels followed by account of saved token
+func followedChannels(c *config.Config, name, endpoint string) ([]config.ChannelEntry, error) {
+	tokens, err := config.LoadTokens(c.TokensFile())
+	if err != nil {
+		return nil, err
+	}
+	token, ok := tokens[name]
+	if !ok {
+		return nil, fmt.Errorf("%w '%v', save it with 'rekoda token set %v'", errNoToken, name, name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	tc := twitch.NewClient(http.DefaultClient, c.Twitch.GQLEndpoint, c.Twitch.ClientID)
+	tc.Token = token
+	if endpoint != "" {
+		tc.HelixEndpoint = strings.TrimSuffix(endpoint, "/")
+	}
+	info, err := tc.Validate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("token '%v': %w", name, err)
+	}
+	if !hasScope(info.Scopes, followsScope) {
+		return nil, fmt.Errorf("token '%v' lacks %v scope needed to list followed channels", name, followsScope)
+	}
+	tc.ClientID = info.ClientID // Helix only accepts token with client id it was issued to
+
+	logins, err := tc.Followed(ctx, info.UserID)
+	if err != nil {
+		return nil, err
+	}
+	log.WithField("general", "CLI").Infof("%v follows %v channel(s)", info.Login, len(logins))
+	entries := make([]config.ChannelEntry, len(logins))
+	for i, login := range logins {
+		entries[i] = config.ChannelEntry{User: login}
+	}
+	return entries, nil
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// printImport writes what import does with every channel
+func printImport(w io.Writer, changes []config.ImportChange) {
+	counts := make(map[string]int)
+	for _, ch := range changes {
+		counts[ch.Action]++
+		switch ch.Action {
+		case config.ActionAdd:
+			fmt.Fprintf(w, "+ %v\n", ch.User)
+		case config.ActionUpdate:
+			fmt.Fprintf(w, "~ %v\n", ch.User)
+		case config.ActionSkip:
+			fmt.Fprintf(w, "  %v (already in config, skipped)\n", ch.User)
+			continue
+		default:
+			continue
+		}
+		for _, d := range ch.Diff {
+			if d.Secret {
+				d.Old, d.New = mask(d.Old), mask(d.New)
+			}
+			switch {
+			case d.Old == "":
+				fmt.Fprintf(w, "    + %v = %v\n", d.Key, d.New)
+			case d.New == "":
+				fmt.Fprintf(w, "    - %v = %v\n", d.Key, d.Old)
+			default:
+				fmt.Fprintf(w, "    ~ %v = %v -> %v\n", d.Key, d.Old, d.New)
+			}
+		}
+	}
+	fmt.Fprintf(w, "%v added, %v updated, %v unchanged, %v skipped\n",
+		counts[config.ActionAdd], counts[config.ActionUpdate], counts[config.ActionUnchanged], counts[config.ActionSkip])
+}
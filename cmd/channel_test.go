@@ -1,9 +1,15 @@
 package cmd
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/history"
 )
 
 func TestNewChannelCmd(t *testing.T) {
@@ -81,3 +87,97 @@ func TestEnableCmd(t *testing.T) {
 	}
 	assert.Equal(t, "enable", c.Name())
 }
+
+func TestPrintStats(t *testing.T) {
+	start := time.Date(2021, 9, 6, 13, 0, 0, 0, time.Local) // Monday
+	h := history.History{Channel: "rwxrob", Sessions: []history.Session{
+		{Start: start, End: start.Add(3 * time.Hour)},
+		{Start: start.AddDate(0, 0, 7), End: start.AddDate(0, 0, 7).Add(3 * time.Hour)},
+	}}
+	buf := new(bytes.Buffer)
+	printStats(buf, h, config.DefaultSettings, time.Minute, start.AddDate(0, 0, 8))
+
+	out := buf.String()
+	assert.Contains(t, out, "Sessions:       2 since 2021-09-06")
+	assert.Contains(t, out, "Average length: 3 hours")
+	assert.Contains(t, out, "Usually live:   Mon 13:00 (2x)")
+	assert.Contains(t, out, "learning after 5 sessions")
+	assert.Regexp(t, `Mon (  \.){13}  2(  \.){10}\n`, out)
+
+	buf.Reset()
+	printStats(buf, history.History{Channel: "sodapoppin"}, config.DefaultSettings, time.Minute, start)
+	assert.Contains(t, buf.String(), "Nothing observed yet")
+}
+
+func TestShowChannel(t *testing.T) {
+	c := &config.Config{StreamsDir: "/srv/streams"}
+	c.Defaults.FileTemplate = strPtr("{user}_{date}")
+	ch := config.Channels{User: "rwxrob", Enabled: true, Quality: "best"}
+	assert.NoError(t, applyPairs(&ch, []string{"ads=skip", "proxy.password=hunter2", "tags=coding"}))
+	assert.Error(t, applyPairs(&ch, []string{"user=sodapoppin"}))
+	assert.Error(t, applyPairs(&ch, []string{"ads"}))
+
+	buf := new(bytes.Buffer)
+	showChannel(buf, c, ch)
+	out := buf.String()
+	assert.Contains(t, out, "tags = ['coding']")
+	assert.Regexp(t, `ads = 'skip'\s+# channel`, out)
+	assert.Regexp(t, `file_template = '\{user\}_\{date\}'\s+# \[defaults\]`, out)
+	assert.Regexp(t, `streams_dir = '/srv/streams'\s+# built-in`, out)
+	assert.Contains(t, out, "proxy.password = '********'")
+	assert.NotContains(t, out, "hunter2")
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestPrintImport(t *testing.T) {
+	buf := new(bytes.Buffer)
+	printImport(buf, []config.ImportChange{
+		{User: "xqc", Action: config.ActionAdd, Diff: []config.FieldChange{{Key: "quality", New: "'best'"}}},
+		{User: "rwxrob", Action: config.ActionUpdate, Diff: []config.FieldChange{{Key: "proxy.password", Old: "'a'", New: "'b'", Secret: true}}},
+		{User: "sodapoppin", Action: config.ActionSkip},
+	})
+	out := buf.String()
+	assert.Contains(t, out, "+ xqc\n    + quality = 'best'\n")
+	assert.Contains(t, out, "~ proxy.password = '********' -> '********'")
+	assert.Contains(t, out, "1 added, 1 updated, 0 unchanged, 1 skipped")
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "rekoda.toml"), filepath.Join(dir, "other.toml")
+	assert.NoError(t, os.WriteFile(src, []byte("version = 3\n[[channels]]\n  user = 'rwxrob'\n  quality = 'best'\n  enabled = true\n  poll_interval = '30s'\n"+
+		"[[channels]]\n  user = 'xqc'\n  quality = 'worst'\n  enabled = false\n"), 0644))
+	want := &config.Config{ConfigFile: src}
+	assert.NoError(t, want.Load())
+
+	defer func(path string, stdout *os.File) { config.FlagConfigFile, os.Stdout = path, stdout }(config.FlagConfigFile, os.Stdout)
+	for _, format := range []string{config.FormatTOML, config.FormatCSV, config.FormatJSON} {
+		// Exported list is piped from stdout, nothing else may be written there
+		out, err := os.Create(filepath.Join(dir, "channels."+format))
+		assert.NoError(t, err)
+		os.Stdout = out
+		config.FlagConfigFile = src
+		export := NewExportCmd()
+		export.SetOut(os.Stdout)
+		export.SetArgs([]string{"--format", format})
+		assert.NoError(t, export.Execute())
+		out.Close()
+
+		in, err := os.Open(out.Name())
+		assert.NoError(t, err)
+		os.Stdout = os.NewFile(0, os.DevNull)
+		assert.NoError(t, os.WriteFile(dst, []byte("version = 3\n"), 0644))
+		config.FlagConfigFile = dst
+		imp := NewImportCmd()
+		imp.SetIn(in)
+		imp.SetOut(new(bytes.Buffer))
+		imp.SetArgs([]string{"-", "--format", format})
+		assert.NoError(t, imp.Execute(), format)
+		in.Close()
+
+		got := &config.Config{ConfigFile: dst}
+		assert.NoError(t, got.Load())
+		assert.Equal(t, want.Channels, got.Channels, format)
+	}
+}
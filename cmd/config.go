@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/wmw64/rekoda/internal/config"
+)
+
+// NewConfigCmd represents the config command
+func NewConfigCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "config",
+		Short: "Manage your config file",
+		Long: `Manage your config file: show effective settings, check it, get or set global keys and upgrade it to current schema version.
+Channels are managed with 'rekoda channel'.`,
+	}
+}
+
+var configCmd = NewConfigCmd()
+
+// NewConfigMigrateCmd represents the config migrate command
+func NewConfigMigrateCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade config file to current schema version",
+		Long: `Upgrade config file to current schema version keeping a timestamped backup of the original next to it.
+Rekoda does it automatically on start, use --dry-run to preview the result without writing anything.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return migrateConfig(cmd, dryRun)
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print migrated config file instead of writing it")
+	return cmd
+}
+
+var configMigrateCmd = NewConfigMigrateCmd()
+
+// NewConfigShowCmd represents the config show command
+func NewConfigShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show",
+		Short: "Show effective settings and where they come from",
+		Long: `Show every global setting with its effective value and where it comes from:
+built-in default, config file, environment variable or flag. Secrets are masked.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := config.InitConfig()
+			printSettings(cmd.OutOrStdout(), c.Effective())
+			return nil
+		},
+	}
+}
+
+var configShowCmd = NewConfigShowCmd()
+
+// NewConfigValidateCmd represents the config validate command
+func NewConfigValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Check config file, exit non-zero if anything is wrong",
+		Long: `Check config file: syntax, unknown keys, values out of range, invalid channels and
+streams directories which can't be written. Exits non-zero on any problem, so deployments may be gated on it.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := &config.Config{}
+			c.AutomaticEnv(log.WithField("general", "INIT"))
+			cmd.SilenceUsage = true
+			return validateConfig(cmd.OutOrStdout(), c)
+		},
+	}
+}
+
+var configValidateCmd = NewConfigValidateCmd()
+
+// NewConfigGetCmd represents the config get command
+func NewConfigGetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "get <key>",
+		Short:   "Print effective value of a global key",
+		Example: "  rekoda config get defaults.poll_interval",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := config.InitConfig()
+			for _, s := range c.Effective() {
+				if s.Key == args[0] {
+					fmt.Fprintln(cmd.OutOrStdout(), s.Text())
+					return nil
+				}
+			}
+			return fmt.Errorf("unknown key '%v', see 'rekoda config show'", args[0])
+		},
+	}
+}
+
+var configGetCmd = NewConfigGetCmd()
+
+// NewConfigSetCmd represents the config set command
+func NewConfigSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set key=value...",
+		Short: "Change global keys of config file",
+		Long: `Change global keys of config file, checking them before it is written.
+Keys of nested tables are dotted, lists are comma separated and an empty value removes optional keys.
+Channels are changed with 'rekoda channel set'.`,
+		Example: `  rekoda config set defaults.poll_interval=30s scheduler.workers=20
+  rekoda config set defaults.ads=`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setConfig(config.InitConfig(), args)
+		},
+	}
+}
+
+var configSetCmd = NewConfigSetCmd()
+
+// NewConfigPathCmd represents the config path command
+func NewConfigPathCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "path",
+		Short: "Print path of config file in use",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			c := &config.Config{}
+			c.AutomaticEnv(log.WithField("general", "INIT"))
+			fmt.Fprintln(cmd.OutOrStdout(), c.ConfigFile)
+		},
+	}
+}
+
+var configPathCmd = NewConfigPathCmd()
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configPathCmd)
+}
+
+// printSettings writes settings with their sources, runtime ones last
+func printSettings(w io.Writer, settings []config.Setting) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	runtime := false
+	for _, s := range settings {
+		if s.Runtime && !runtime {
+			runtime = true
+			fmt.Fprintln(tw, "\n# Set by flags and environment only")
+		}
+		value := s.Value
+		if s.Secret {
+			value = mask(value)
+		}
+		fmt.Fprintf(tw, "%v = %v\t# %v\n", s.Key, value, s.Source)
+	}
+	tw.Flush()
+}
+
+// validateConfig reports every problem of config file, failing if there's any
+func validateConfig(w io.Writer, c *config.Config) error {
+	if err := c.Peek(); err != nil {
+		return fmt.Errorf("config file '%v' is invalid: %w", c.ConfigFile, err)
+	}
+	problems := append(c.Problems(), c.DirProblems()...)
+	for _, p := range problems {
+		fmt.Fprintf(w, "✗ %v\n", p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("config file '%v' has %v problem(s)", c.ConfigFile, len(problems))
+	}
+	fmt.Fprintf(w, "✓ Config file '%v' is valid\n", c.ConfigFile)
+	return nil
+}
+
+// setConfig sets global keys, refusing changes which make config invalid
+func setConfig(c *config.Config, pairs []string) error {
+	ctxLog := log.WithField("general", "CLI")
+	runtime := make(map[string]bool)
+	for _, s := range c.Effective() {
+		runtime[s.Key] = s.Runtime
+	}
+
+	return c.Update(func(c *config.Config) error {
+		before := make(map[string]bool)
+		for _, p := range c.Problems() {
+			before[p] = true
+		}
+		for _, pair := range pairs {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("'%v' is not key=value", pair)
+			}
+			key = strings.TrimSpace(key)
+			switch {
+			case runtime[key]:
+				return fmt.Errorf("'%v' is set by flag or environment only, see 'rekoda --help'", key)
+			case key == "version":
+				return errors.New("version is changed by 'rekoda config migrate' only")
+			case key == "channels" || strings.HasPrefix(key, "channels."):
+				return errors.New("channels are changed by 'rekoda channel set'")
+			}
+			if err := config.SetField(c, key, value); err != nil {
+				return err
+			}
+			if key == "streams_dir" && config.FlagStreamsDir+config.EnvStreamsDir != "" {
+				ctxLog.Warn("streams_dir is saved, but --output flag or REKODA_STREAMS_DIR env still takes precedence")
+			}
+		}
+		var problems []string
+		for _, p := range c.Problems() {
+			if !before[p] {
+				problems = append(problems, p)
+			}
+		}
+		if len(problems) > 0 {
+			return errors.New(strings.Join(problems, "; "))
+		}
+		ctxLog.Infof("Config file updated: %v", strings.Join(pairs, " "))
+		return nil
+	})
+}
+
+func migrateConfig(cmd *cobra.Command, dryRun bool) error {
+	ctxLog := log.WithField("general", "CLI")
+
+	// Resolve config path only, loading it would migrate it right away
+	c := &config.Config{}
+	c.AutomaticEnv(log.WithField("general", "INIT"))
+
+	out, from, backup, err := config.MigrateFile(c.ConfigFile, dryRun)
+	if err != nil {
+		return err
+	}
+	if from == config.CurrentVersion {
+		ctxLog.Infof("Config file '%v' is up to date (version %v)", c.ConfigFile, from)
+		return nil
+	}
+	if dryRun {
+		ctxLog.Infof("Config file '%v' would be upgraded from version %v to %v:", c.ConfigFile, from, config.CurrentVersion)
+		fmt.Fprint(cmd.OutOrStdout(), string(out))
+		return nil
+	}
+	ctxLog.Infof("Config file '%v' upgraded from version %v to %v, backup saved: %v", c.ConfigFile, from, config.CurrentVersion, backup)
+	return nil
+}
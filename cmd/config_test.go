@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/config"
+)
+
+func TestNewConfigMigrateCmd(t *testing.T) {
+	configCmd := NewConfigCmd()
+	migrateCmd := NewConfigMigrateCmd()
+
+	configCmd.AddCommand(migrateCmd)
+	c, out, err := ExecuteCommandC(configCmd, "migrate", "--dry-run")
+	if err != nil {
+		t.Error(err, out)
+	}
+	assert.Equal(t, "migrate", c.Name())
+}
+
+func TestValidateConfig(t *testing.T) {
+	c := &config.Config{ConfigFile: filepath.Join(t.TempDir(), "rekoda.toml")}
+	assert.NoError(t, os.WriteFile(c.ConfigFile, []byte("version = 3\nstreams_dir = '"+t.TempDir()+"'\n"), 0644))
+	buf := new(bytes.Buffer)
+	assert.NoError(t, validateConfig(buf, c))
+	assert.Contains(t, buf.String(), "is valid")
+
+	assert.NoError(t, os.WriteFile(c.ConfigFile, []byte("version = 3\n[[channels]]\n  user = 'rwxrob'\n  quality = '1080p'\n"), 0644))
+	buf.Reset()
+	assert.Error(t, validateConfig(buf, c))
+	assert.Contains(t, buf.String(), "✗ channel 'rwxrob': quality '1080p'")
+
+	assert.NoError(t, os.WriteFile(c.ConfigFile, []byte("version = "), 0644))
+	assert.Error(t, validateConfig(buf, c))
+}
+
+func TestPrintSettings(t *testing.T) {
+	buf := new(bytes.Buffer)
+	printSettings(buf, []config.Setting{
+		{Field: config.Field{Key: "eventsub.secret", Value: "'hunter2'", Secret: true}, Source: config.SourceFile},
+		{Field: config.Field{Key: "log_level", Value: "'debug'"}, Source: config.SourceEnv, Runtime: true},
+	})
+	assert.Equal(t, "eventsub.secret = '********'  # file\n\n# Set by flags and environment only\nlog_level = 'debug'  # env\n", buf.String())
+}
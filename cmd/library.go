@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/library"
+)
+
+// NewLibraryCmd represents the library command
+func NewLibraryCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "library",
+		Short: "Find recordings: list, search, show or rebuild catalog",
+		Long: `Find recordings in catalog of every recording, kept in library.json next to config file.
+Recorder adds recordings as it writes them: channel, start and end, duration, size, titles and games,
+gaps, post-processing and where the file is. 'rekoda library rebuild' fills it from sidecars of recordings.`,
+	}
+}
+
+var libraryCmd = NewLibraryCmd()
+
+// libraryFilter holds filter flags shared by list and search
+type libraryFilter struct {
+	library.Filter
+	since, until string
+	asJSON       bool
+}
+
+func (f *libraryFilter) flags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.Channel, "channel", "", "Only recordings of this channel")
+	cmd.Flags().StringVar(&f.since, "since", "", "Only recordings started on this date or later, e.g. 2021-09-08")
+	cmd.Flags().StringVar(&f.until, "until", "", "Only recordings started on this date or earlier")
+	cmd.Flags().StringVar(&f.Game, "game", "", "Only recordings with game played containing this")
+	cmd.Flags().StringVar(&f.Tag, "tag", "", "Only recordings of channels with this tag")
+	cmd.Flags().BoolVar(&f.asJSON, "json", false, "Print JSON")
+}
+
+// filter returns filter with dates parsed
+func (f *libraryFilter) filter() (library.Filter, error) {
+	var err error
+	if f.Since, err = parseDate(f.since, false); err != nil {
+		return f.Filter, fmt.Errorf("--since: %w", err)
+	}
+	if f.Until, err = parseDate(f.until, true); err != nil {
+		return f.Filter, fmt.Errorf("--until: %w", err)
+	}
+	return f.Filter, nil
+}
+
+// NewLibraryListCmd represents the library list command
+func NewLibraryListCmd() *cobra.Command {
+	var f libraryFilter
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List recordings, the oldest first",
+		Example: `  rekoda library list --channel rwxrob --since 2021-09-01
+  rekoda library list --game "Just Chatting" --json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := f.filter()
+			if err != nil {
+				return err
+			}
+			return listRecordings(cmd.OutOrStdout(), config.InitConfig(), filter, f.asJSON)
+		},
+	}
+	f.flags(cmd)
+	return cmd
+}
+
+// NewLibrarySearchCmd represents the library search command
+func NewLibrarySearchCmd() *cobra.Command {
+	var f libraryFilter
+
+	cmd := &cobra.Command{
+		Use:     "search <text>",
+		Short:   "Find recordings with text in title, game, channel or file name",
+		Example: `  rekoda library search "speedrun" --since 2021-01-01 --until 2021-06-30`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := f.filter()
+			if err != nil {
+				return err
+			}
+			filter.Text = args[0]
+			return listRecordings(cmd.OutOrStdout(), config.InitConfig(), filter, f.asJSON)
+		},
+	}
+	f.flags(cmd)
+	return cmd
+}
+
+// NewLibraryShowCmd represents the library show command
+func NewLibraryShowCmd() *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "show <id-or-file>",
+		Short: "Show everything known about recording",
+		Long:  "Show recording by its ID, as printed by 'rekoda library list', a unique beginning of it, file name or path.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := libraryEntries(config.InitConfig())
+			if err != nil {
+				return err
+			}
+			e, err := library.Find(entries, args[0])
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(e)
+			}
+			showRecording(cmd.OutOrStdout(), e)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print JSON")
+	return cmd
+}
+
+// NewLibraryRebuildCmd represents the library rebuild command
+func NewLibraryRebuildCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rebuild [dir]...",
+		Short: "Rebuild catalog from sidecars of recordings",
+		Long: `Replace catalog with recordings found by their sidecars in streams dirs of config file and dirs given,
+e.g. after moving recordings around or into an archive. Recordings without sidecar named <user>_<date>_<time>.ts
+are listed too, with duration read from the file, which is saved as their sidecar once they're left unmodified.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := config.InitConfig()
+			dirs := append(c.StreamsDirs(), args...)
+			n, err := library.Open(c.LibraryFile()).Rebuild(dirs...)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Found %v recording(s) in %v\n", n, strings.Join(dirs, ", "))
+			return nil
+		},
+	}
+}
+
+var (
+	libraryListCmd    = NewLibraryListCmd()
+	librarySearchCmd  = NewLibrarySearchCmd()
+	libraryShowCmd    = NewLibraryShowCmd()
+	libraryRebuildCmd = NewLibraryRebuildCmd()
+)
+
+func init() {
+	rootCmd.AddCommand(libraryCmd)
+	libraryCmd.AddCommand(libraryListCmd)
+	libraryCmd.AddCommand(librarySearchCmd)
+	libraryCmd.AddCommand(libraryShowCmd)
+	libraryCmd.AddCommand(libraryRebuildCmd)
+}
+
+// libraryEntries reads catalog, building it from streams dirs first if there's none yet
+func libraryEntries(c *config.Config) ([]library.Entry, error) {
+	lib := library.Open(c.LibraryFile())
+	if !lib.Exists() {
+		if _, err := lib.Rebuild(c.StreamsDirs()...); err != nil {
+			return nil, err
+		}
+	}
+	return lib.Entries()
+}
+
+func listRecordings(w io.Writer, c *config.Config, f library.Filter, asJSON bool) error {
+	entries, err := libraryEntries(c)
+	if err != nil {
+		return err
+	}
+	found := library.Search(entries, f)
+	if asJSON {
+		if found == nil {
+			found = []library.Entry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(found)
+	}
+	if len(found) == 0 {
+		return errors.New("no recordings found")
+	}
+	printRecordings(w, found)
+	return nil
+}
+
+// printRecordings writes table of recordings
+func printRecordings(w io.Writer, entries []library.Entry) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCHANNEL\tSTARTED\tDURATION\tSIZE\tGAME\tTITLE")
+	for _, e := range entries {
+		game := strings.Join(e.Games, ", ")
+		if game == "" {
+			game = "-"
+		}
+		title := e.Title()
+		if n := len(e.Titles); n > 1 {
+			title = fmt.Sprintf("%v (+%v more)", title, n-1)
+		}
+		if title == "" {
+			title = "-"
+		}
+		duration := e.Duration().Round(time.Second).String()
+		if e.Ended.IsZero() {
+			duration += " (recording)"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", e.ID, e.Channel, e.Started.Local().Format("2006-01-02 15:04"), duration, humanize.Bytes(uint64(e.Size)), game, title)
+	}
+	tw.Flush()
+}
+
+// showRecording writes everything catalog knows about recording
+func showRecording(w io.Writer, e library.Entry) {
+	location := e.Path
+	if _, err := os.Stat(e.Path); err != nil {
+		location += " (missing, see 'rekoda library rebuild')"
+	}
+	ended := "still recording"
+	if !e.Ended.IsZero() {
+		ended = e.Ended.Local().Format("2006-01-02 15:04:05")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID:\t%v\n", e.ID)
+	fmt.Fprintf(tw, "Channel:\t%v\n", e.Channel)
+	fmt.Fprintf(tw, "File:\t%v\n", location)
+	fmt.Fprintf(tw, "Quality:\t%v\n", e.Quality)
+	if len(e.Tags) > 0 {
+		fmt.Fprintf(tw, "Tags:\t%v\n", strings.Join(e.Tags, ", "))
+	}
+	fmt.Fprintf(tw, "Started:\t%v\n", e.Started.Local().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(tw, "Ended:\t%v\n", ended)
+	fmt.Fprintf(tw, "Duration:\t%v\n", e.Duration().Round(time.Second))
+	fmt.Fprintf(tw, "Size:\t%v\n", humanize.Bytes(uint64(e.Size)))
+	gaps := "none"
+	if e.Gaps > 0 {
+		gaps = fmt.Sprintf("%v, %v missing", e.Gaps, time.Duration(e.GapSeconds*float64(time.Second)).Round(time.Second))
+	}
+	fmt.Fprintf(tw, "Gaps:\t%v\n", gaps)
+	post := "-"
+	if p := e.PostProcess; p != nil {
+		post = "ok: " + p.Command
+		if p.Error != "" {
+			post = fmt.Sprintf("failed: %v: %v", p.Command, p.Error)
+		}
+	}
+	fmt.Fprintf(tw, "Post-processing:\t%v\n", post)
+	tw.Flush()
+
+	if len(e.Titles) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nTitles:")
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, t := range e.Titles {
+		offset := t.At.Sub(e.Started).Round(time.Second)
+		if offset < 0 {
+			offset = 0
+		}
+		fmt.Fprintf(tw, "  %v\t%v\t%v\n", offset, t.Game, t.Title)
+	}
+	tw.Flush()
+}
+
+// parseDate reads date, optionally with time, in local time zone. Date alone as end of range covers the whole day
+func parseDate(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("'%v' is not a date like 2021-09-08 or 2021-09-08 12:57", s)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
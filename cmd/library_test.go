@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/library"
+	"github.com/wmw64/rekoda/internal/sidecar"
+)
+
+func TestParseDate(t *testing.T) {
+	d, err := parseDate("2021-09-08", false)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 9, 8, 0, 0, 0, 0, time.Local), d)
+	d, err = parseDate("2021-09-08", true) // The whole day
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 9, 9, 0, 0, 0, 0, time.Local), d)
+	d, err = parseDate("2021-09-08 12:57", true)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 9, 8, 12, 57, 0, 0, time.Local), d)
+	d, err = parseDate("", false)
+	assert.NoError(t, err)
+	assert.True(t, d.IsZero())
+	_, err = parseDate("yesterday", false)
+	assert.Error(t, err)
+}
+
+func TestPrintRecordings(t *testing.T) {
+	start := time.Date(2021, 9, 8, 12, 57, 6, 0, time.Local)
+	e := library.Entry{
+		ID: "0123456789", Channel: "rwxrob", Path: "/nowhere/rwxrob.ts", Quality: "best", Started: start, Ended: start.Add(time.Hour),
+		Seconds: 3600, Size: 2700000000, Gaps: 1, GapSeconds: 2, Games: []string{"Science & Technology", "Just Chatting"},
+		Titles: []sidecar.Title{
+			{At: start, Title: "Coding", Game: "Science & Technology"},
+			{At: start.Add(30 * time.Minute), Title: "Q&A", Game: "Just Chatting"},
+		},
+		PostProcess: &sidecar.PostProcess{Command: "ffmpeg -i rwxrob.ts", Error: "exit status 1"},
+	}
+
+	var out bytes.Buffer
+	printRecordings(&out, []library.Entry{e})
+	assert.Regexp(t, `0123456789\s+rwxrob\s+2021-09-08 12:57\s+1h0m0s\s+2.7 GB\s+Science & Technology, Just Chatting\s+Coding \(\+1 more\)\n`, out.String())
+
+	out.Reset()
+	showRecording(&out, e)
+	assert.Contains(t, out.String(), "/nowhere/rwxrob.ts (missing, see 'rekoda library rebuild')")
+	assert.Regexp(t, `Gaps:\s+1, 2s missing`, out.String())
+	assert.Regexp(t, `Post-processing:\s+failed: ffmpeg -i rwxrob.ts: exit status 1`, out.String())
+	assert.Regexp(t, `30m0s\s+Just Chatting\s+Q&A`, out.String())
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/library"
+	"github.com/wmw64/rekoda/internal/merge"
+	"github.com/wmw64/rekoda/internal/sidecar"
+)
+
+// NewMergeCmd represents the merge command
+func NewMergeCmd() *cobra.Command {
+	var (
+		window         time.Duration
+		channel        string
+		dryRun, remove bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "merge [dir]...",
+		Short: "Merge recordings of one broadcast split into several files",
+		Long: `Merge recordings of one broadcast, split when stream was down longer than restart window or rekoda was
+restarted, into one file next to the first of them, named after it with _merged. Recordings found in streams dirs
+of config file and dirs given are of one broadcast if their sidecars have the same broadcast ID or one started
+within --window after the other ended. Recordings without sidecar named <user>_<date>_<time>.ts are merged too,
+started when their name says. Files are joined packet by packet, marking where timestamps start over,
+and sidecar of merged recording combines theirs, stream being down becomes a gap.
+
+Broadcasts already merged are skipped. Merged file is a copy of the parts, taking as much disk space again until
+they're deleted, e.g. by --remove. Set merge = true in [defaults] or a channel to merge broadcast once merge window
+passes after its recording is closed.`,
+		Example: `  rekoda merge --dry-run
+  rekoda merge /archive/rwxrob --window 1h --remove`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := config.InitConfig()
+			if !cmd.Flags().Changed("window") {
+				window = c.Settings(config.Channels{}).MergeWindow
+			}
+			dirs := append(c.StreamsDirs(), args...)
+			parts, err := merge.Parts(dirs...)
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+			var groups [][]merge.Part
+			for _, g := range merge.Group(parts, window) {
+				if channel == "" || strings.EqualFold(g[0].Rec.Channel, channel) {
+					groups = append(groups, g)
+				}
+			}
+			if len(groups) == 0 {
+				return errors.New("no broadcasts split into several recordings found in " + strings.Join(dirs, ", "))
+			}
+			return mergeGroups(cmd.OutOrStdout(), library.Open(c.LibraryFile()), groups, dryRun, remove)
+		},
+	}
+	cmd.Flags().DurationVar(&window, "window", 0, "Longest break between recordings of one broadcast, merge_window of config file by default")
+	cmd.Flags().StringVar(&channel, "channel", "", "Only recordings of this channel")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List recordings which would be merged, merge nothing")
+	cmd.Flags().BoolVar(&remove, "remove", false, "Delete recordings and their sidecars once merged")
+	return cmd
+}
+
+var mergeCmd = NewMergeCmd()
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+}
+
+// mergeGroups merges recordings of each broadcast, keeping library up to date
+func mergeGroups(w io.Writer, lib *library.Library, groups [][]merge.Part, dryRun, remove bool) error {
+	failed := 0
+	for _, g := range groups {
+		out := merge.Output(g)
+		printGroup(w, g, out)
+		switch {
+		case dryRun:
+			continue
+		case merge.Merged(g, out):
+			fmt.Fprintln(w, "  already merged")
+		default:
+			m, err := merge.Merge(g, out)
+			if err != nil {
+				fmt.Fprintf(w, "  failed: %v\n", err)
+				failed++
+				continue
+			}
+			if err := lib.Update(library.NewEntry(out, m)); err != nil {
+				return err
+			}
+			fmt.Fprintln(w, "  merged")
+		}
+		if remove {
+			if err := removeParts(lib, g); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "  removed %v recording(s)\n", len(g))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v broadcast(s) couldn't be merged", failed, len(groups))
+	}
+	return nil
+}
+
+// printGroup writes broadcast merged into out, followed by its recordings
+func printGroup(w io.Writer, g []merge.Part, out string) {
+	first, last := g[0], g[len(g)-1]
+	var seconds float64
+	for _, p := range g {
+		seconds += p.Rec.Seconds
+	}
+	span := last.End().Sub(first.Rec.Started)
+	recorded := time.Duration(seconds * float64(time.Second))
+	fmt.Fprintf(w, "%v %v: %v recordings, %v of %v recorded -> %v\n", first.Rec.Channel, first.Rec.Started.Local().Format("2006-01-02 15:04"),
+		len(g), recorded.Round(time.Second), span.Round(time.Second), out)
+	for i, p := range g {
+		down := ""
+		if i > 0 {
+			down = fmt.Sprintf(", after %v down", p.Rec.Started.Sub(g[i-1].End()).Round(time.Second))
+		}
+		fmt.Fprintf(w, "  %v  %v%v\n", filepath.Base(p.Path), time.Duration(p.Rec.Seconds*float64(time.Second)).Round(time.Second), down)
+	}
+}
+
+// removeParts deletes recordings merged and their sidecars, dropping them from library
+func removeParts(lib *library.Library, g []merge.Part) error {
+	var ids []string
+	for _, p := range g {
+		for _, path := range []string{p.Path, sidecar.Path(p.Path)} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		ids = append(ids, library.NewEntry(p.Path, p.Rec).ID)
+	}
+	return lib.Remove(ids...)
+}
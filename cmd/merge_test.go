@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/library"
+	"github.com/wmw64/rekoda/internal/merge"
+	"github.com/wmw64/rekoda/internal/sidecar"
+)
+
+func TestMergeGroups(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2021, 9, 8, 12, 57, 0, 0, time.Local)
+	var g []merge.Part
+	for i, name := range []string{"rwxrob_1.ts", "rwxrob_2.ts"} {
+		started := start.Add(time.Duration(i) * 90 * time.Minute)
+		p := merge.Part{Path: filepath.Join(dir, name), Rec: sidecar.Recording{Channel: "rwxrob", File: name, Started: started, Ended: started.Add(time.Hour), Seconds: 3600}}
+		assert.NoError(t, os.WriteFile(p.Path, []byte{0x47, 0x1F, 0xFF, 0x10}, 0644))
+		assert.NoError(t, p.Rec.Save(sidecar.Path(p.Path)))
+		g = append(g, p)
+	}
+	lib := library.Open(filepath.Join(dir, "library.json"))
+	out := filepath.Join(dir, "rwxrob_1_merged.ts")
+
+	var buf bytes.Buffer
+	assert.NoError(t, mergeGroups(&buf, lib, [][]merge.Part{g}, true, true))
+	assert.Equal(t, `rwxrob 2021-09-08 12:57: 2 recordings, 2h0m0s of 2h30m0s recorded -> `+out+`
+  rwxrob_1.ts  1h0m0s
+  rwxrob_2.ts  1h0m0s, after 30m0s down
+`, buf.String())
+	assert.NoFileExists(t, out)
+
+	buf.Reset()
+	assert.NoError(t, mergeGroups(&buf, lib, [][]merge.Part{g}, false, false))
+	assert.Contains(t, buf.String(), "  merged\n")
+	assert.FileExists(t, out)
+	entries, err := lib.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	buf.Reset()
+	assert.NoError(t, mergeGroups(&buf, lib, [][]merge.Part{g}, false, true))
+	assert.Contains(t, buf.String(), "  already merged\n  removed 2 recording(s)\n")
+	assert.NoFileExists(t, g[0].Path)
+	assert.NoFileExists(t, sidecar.Path(g[1].Path))
+	assert.FileExists(t, out)
+}
@@ -1,20 +1,82 @@
 package cmd
 
 import (
+	"errors"
+	"time"
+
 	"github.com/spf13/cobra"
+	"github.com/wmw64/rekoda/internal/config"
 	"github.com/wmw64/rekoda/internal/recorder"
 )
 
 // recCmd represents the rec command
 func NewRecCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "rec",
+	var opts recorder.Options
+	var once recorder.OneShot
+	var restartWindow time.Duration
+	var pipeBuffer int
+
+	cmd := &cobra.Command{
+		Use:   "rec [channel-or-url] [quality]",
 		Short: "Start recording streams",
-		Long:  ``,
-		Run: func(cmd *cobra.Command, args []string) {
-			recorder.Start()
+		Long: `Record every enabled channel of config file, or only the one stream named, leaving config file as it is.
+
+Channel is given by its name or twitch.tv URL and recorded in quality of the channel in config file, best if it's not there:
+  rekoda rec rwxrob
+  rekoda rec https://www.twitch.tv/rwxrob audio_only --file event.ts --duration 2h
+  rekoda rec rwxrob --wait --restart-window 0
+  rekoda rec rwxrob -O - | mpv -
+  rekoda rec rwxrob -O /tmp/rwxrob.fifo --tee
+
+-O streams into FIFO or standard output instead of file, --tee or --file writes file as well. Player falling
+behind never holds up file: once over --pipe-buffer of stream is waiting for it, the oldest segments are dropped,
+what it doesn't take within 10 seconds after the stream is over is dropped too.
+Logs go to standard error while streaming into standard output.
+
+It exits once the stream ends and doesn't come back during restart window, --duration passes or <Ctrl>+<C> is pressed.`,
+		Args: cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				for _, name := range []string{"file", "duration", "wait", "restart-window", "pipe", "tee", "pipe-buffer"} {
+					if cmd.Flags().Changed(name) {
+						return errors.New("--" + name + " is only used when recording one channel, name it")
+					}
+				}
+				recorder.Start(opts)
+				return nil
+			}
+			if opts.TUI {
+				return errors.New("--tui shows channels of config file, it can't be used when recording one channel")
+			}
+			once.Target = args[0]
+			if len(args) > 1 {
+				once.Quality = args[1]
+			}
+			if cmd.Flags().Changed("restart-window") {
+				once.RestartWindow = &restartWindow
+			}
+			if once.Tee && once.Pipe == "" {
+				return errors.New("--tee writes file besides --pipe, it's only used with it")
+			}
+			if pipeBuffer < 1 {
+				return errors.New("--pipe-buffer must be at least 1 MB")
+			}
+			once.PipeBuffer = pipeBuffer << 20
+			cmd.SilenceUsage = true
+			return recorder.RecordOnce(once)
 		},
 	}
+	cmd.Flags().StringVar(&config.FlagPidFile, "pidfile", "", "Write process id to this file while recording")
+	cmd.Flags().BoolVar(&config.FlagSessionLog, "session-log", false, "Write a dedicated log file next to each recording")
+	cmd.Flags().BoolVar(&opts.TUI, "tui", false, "Show dashboard of channels instead of logs, see 'rekoda top'")
+	cmd.Flags().StringVarP(&once.File, "file", "f", "", "Write the one channel into this file instead of streams dir")
+	cmd.Flags().DurationVar(&once.Duration, "duration", 0, "Close file of the one channel after recording this long, e.g. 2h30m")
+	cmd.Flags().BoolVar(&once.Wait, "wait", false, "Wait for the one channel to go live instead of failing when it's offline")
+	cmd.Flags().DurationVar(&restartWindow, "restart-window", 0, "Wait this long for the one channel to come back after stream ends, 0 to exit at once")
+	cmd.Flags().StringVarP(&once.Pipe, "pipe", "O", "", "Stream the one channel into this FIFO, - for standard output")
+	cmd.Flags().BoolVar(&once.Tee, "tee", false, "Write file as well when streaming with --pipe")
+	cmd.Flags().IntVar(&pipeBuffer, "pipe-buffer", 64, "Megabytes of stream kept for slow --pipe consumer before dropping segments")
+	return cmd
 }
 
 var recCmd = NewRecCmd()
@@ -17,28 +17,6 @@ func NewRootCmd() *cobra.Command {
 
 var rootCmd = NewRootCmd()
 
-type Config struct {
-	Title    string `toml:"title"`
-	Version  int    `toml:"version"`
-	Channels struct {
-		Reckful struct {
-			ID      int64  `toml:"id"`
-			Enabled bool   `toml:"enabled"`
-			Quality string `toml:"quality"`
-		} `toml:"reckful"`
-	} `toml:"channels"`
-	Tokens struct {
-		Telegram struct {
-			LogChannelEnabled bool   `toml:"log_channel_enabled"`
-			LogChannelID      int    `toml:"log_channel_id"`
-			BotToken          string `toml:"bot_token"`
-		} `toml:"telegram"`
-		Twitch struct {
-			ClientID string `toml:"client_id"`
-		} `toml:"twitch"`
-	} `toml:"tokens"`
-}
-
 func Execute() {
 	cobra.CheckErr(rootCmd.Execute())
 }
@@ -48,7 +26,11 @@ func init() {
 	//	cobra.OnInitialize(config.InitConfig)
 
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
-	rootCmd.PersistentFlags().StringVarP(&config.FlagLogLevel, "verbose", "v", "", "Set log level: trace, debug, info (default is 'info')")
+	rootCmd.PersistentFlags().StringVarP(&config.FlagLogLevel, "verbose", "v", "", "Set log level: trace, debug, info, warn, error (default is 'info')")
+	rootCmd.PersistentFlags().StringVar(&config.FlagLogFormat, "log-format", "", "Set log format: text, json (default is 'text')")
+	rootCmd.PersistentFlags().StringVar(&config.FlagLogFile, "log-file", "", "Also write log to this file, rotated by size")
+	rootCmd.PersistentFlags().IntVar(&config.FlagLogMaxSize, "log-max-size", config.FlagLogMaxSize, "Rotate log file after it grows over this many megabytes")
+	rootCmd.PersistentFlags().IntVar(&config.FlagLogBackups, "log-max-backups", config.FlagLogBackups, "Amount of rotated log files to keep")
 	rootCmd.PersistentFlags().StringVarP(&config.FlagConfigFile, "config", "c", "", "Custom config file (default is $HOME/rekoda/rekoda.toml)")
 	rootCmd.PersistentFlags().StringVarP(&config.FlagStreamsDir, "output", "o", "", "Custom stream directory to download (default is $HOME/rekoda/streams)")
 	// rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
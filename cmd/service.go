@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/wmw64/rekoda/internal/config"
+)
+
+const unitName = "rekoda.service"
+
+// unitTemplate is systemd unit running recorder in notify mode with watchdog and sandboxing enabled
+var unitTemplate = template.Must(template.New("unit").Funcs(template.FuncMap{"quote": systemdQuote}).Parse(`[Unit]
+Description=Rekoda - Automatic Twitch Recorder
+Documentation=https://github.com/wmw64/rekoda
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart={{quote .Exec}} rec --config {{quote .ConfigFile}} --output {{quote .StreamsDir}}
+Restart=on-failure
+RestartSec=10
+WatchdogSec=5min
+TimeoutStopSec=30
+{{- if .User}}
+User={{.User}}
+{{- end}}
+
+# Hardening
+NoNewPrivileges=yes
+PrivateTmp=yes
+ProtectSystem=strict
+ProtectHome=read-only
+ReadWritePaths={{quote .ConfigDir}} {{quote .StreamsDir}}
+{{- if not .UserUnit}}
+PrivateDevices=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectControlGroups=yes
+ProtectClock=yes
+RestrictNamespaces=yes
+RestrictRealtime=yes
+RestrictSUIDSGID=yes
+LockPersonality=yes
+MemoryDenyWriteExecute=yes
+SystemCallArchitectures=native
+{{- end}}
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6
+UMask=0027
+
+[Install]
+WantedBy={{if .UserUnit}}default.target{{else}}multi-user.target{{end}}
+`))
+
+type unitFile struct {
+	Exec       string
+	ConfigFile string
+	ConfigDir  string
+	StreamsDir string
+	User       string
+	UserUnit   bool
+}
+
+// systemdQuote makes path a single word of unit file: '%' would start a specifier, spaces, quotes
+// and backslashes need double quotes with C-style escapes
+func systemdQuote(path string) string {
+	path = strings.ReplaceAll(path, "%", "%%")
+	if !strings.ContainsAny(path, " \t\"'\\") {
+		return path
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(path) + `"`
+}
+
+// renderUnit returns contents of rekoda.service for given paths
+func renderUnit(u unitFile) (string, error) {
+	var buf bytes.Buffer
+	if err := unitTemplate.Execute(&buf, u); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// NewServiceCmd represents the service command
+func NewServiceCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "service",
+		Short: "Manage systemd service running recorder",
+		Long:  "Manage systemd service running 'rekoda rec' in the background with readiness and watchdog support.",
+	}
+}
+
+var serviceCmd = NewServiceCmd()
+
+// NewServiceInstallCmd represents the service install command
+func NewServiceInstallCmd() *cobra.Command {
+	var userUnit, printOnly bool
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Write systemd unit file for current config",
+		Long: `Write systemd unit file running recorder with current config file and streams directory.
+By default unit is installed system-wide into /etc/systemd/system, use --user for a user unit.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return installService(cmd, userUnit, printOnly, output)
+		},
+	}
+	cmd.Flags().BoolVar(&userUnit, "user", false, "Install user unit into ~/.config/systemd/user instead of system-wide one")
+	cmd.Flags().BoolVar(&printOnly, "print", false, "Print unit file to stdout instead of writing it")
+	cmd.Flags().StringVar(&output, "unit-file", "", "Custom unit file path")
+	return cmd
+}
+
+var serviceInstallCmd = NewServiceInstallCmd()
+
+func init() {
+	rootCmd.AddCommand(serviceCmd)
+	serviceCmd.AddCommand(serviceInstallCmd)
+}
+
+func installService(cmd *cobra.Command, userUnit, printOnly bool, output string) error {
+	ctxLog := log.WithField("general", "CLI")
+	c := config.InitConfig()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	u := unitFile{Exec: exe, UserUnit: userUnit}
+	if u.ConfigFile, err = filepath.Abs(c.ConfigFile); err != nil {
+		return err
+	}
+	if u.StreamsDir, err = filepath.Abs(c.StreamsDir); err != nil {
+		return err
+	}
+	u.ConfigDir = filepath.Dir(u.ConfigFile)
+	if !userUnit {
+		current, err := user.Current()
+		if err != nil {
+			return err
+		}
+		u.User = current.Username
+	}
+
+	unit, err := renderUnit(u)
+	if err != nil {
+		return err
+	}
+	if printOnly {
+		fmt.Fprint(cmd.OutOrStdout(), unit)
+		return nil
+	}
+
+	if output == "" {
+		output = "/etc/systemd/system/" + unitName
+		if userUnit {
+			home, err := homedir.Dir()
+			if err != nil {
+				return err
+			}
+			output = filepath.Join(home, ".config", "systemd", "user", unitName)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(u.StreamsDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(output, []byte(unit), 0644); err != nil {
+		return err
+	}
+	ctxLog.Infof("Unit file written: %v", output)
+
+	systemctl := "systemctl"
+	if userUnit {
+		systemctl += " --user"
+	}
+	ctxLog.Infof("Start it with: %[1]v daemon-reload && %[1]v enable --now %[2]v", systemctl, unitName)
+	return nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderUnit(t *testing.T) {
+	unit, err := renderUnit(unitFile{
+		Exec:       "/usr/local/bin/rekoda",
+		ConfigFile: "/home/wmw/rekoda/rekoda.toml",
+		ConfigDir:  "/home/wmw/rekoda",
+		StreamsDir: "/srv/streams",
+		User:       "wmw",
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, unit, "Type=notify\n")
+	assert.Contains(t, unit, "ExecStart=/usr/local/bin/rekoda rec --config /home/wmw/rekoda/rekoda.toml --output /srv/streams\n")
+	assert.Contains(t, unit, "User=wmw\n")
+	assert.Contains(t, unit, "ReadWritePaths=/home/wmw/rekoda /srv/streams\n")
+	assert.Contains(t, unit, "ProtectKernelModules=yes\n")
+	assert.Contains(t, unit, "WantedBy=multi-user.target\n")
+}
+
+func TestRenderUnitQuotesPaths(t *testing.T) {
+	unit, err := renderUnit(unitFile{
+		Exec:       "/usr/local/bin/rekoda",
+		ConfigFile: "/home/John Doe/rekoda/rekoda.toml",
+		ConfigDir:  "/home/John Doe/rekoda",
+		StreamsDir: `/srv/100% "live"`,
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, unit, `ExecStart=/usr/local/bin/rekoda rec --config "/home/John Doe/rekoda/rekoda.toml" --output "/srv/100%% \"live\""`+"\n")
+	assert.Contains(t, unit, `ReadWritePaths="/home/John Doe/rekoda" "/srv/100%% \"live\""`+"\n")
+}
+
+func TestRenderUserUnit(t *testing.T) {
+	unit, err := renderUnit(unitFile{
+		Exec:       "/usr/local/bin/rekoda",
+		ConfigFile: "/home/wmw/rekoda/rekoda.toml",
+		ConfigDir:  "/home/wmw/rekoda",
+		StreamsDir: "/home/wmw/rekoda/streams",
+		UserUnit:   true,
+	})
+	assert.NoError(t, err)
+	assert.NotContains(t, unit, "User=")
+	assert.NotContains(t, unit, "ProtectKernelModules")
+	assert.Contains(t, unit, "WantedBy=default.target\n")
+}
+
+func TestNewServiceInstallCmd(t *testing.T) {
+	serviceCmd := NewServiceCmd()
+	installCmd := NewServiceInstallCmd()
+
+	serviceCmd.AddCommand(installCmd)
+	c, out, err := ExecuteCommandC(serviceCmd, "install", "--user", "--print")
+	if err != nil {
+		t.Error(err, out)
+	}
+	assert.Equal(t, "install", c.Name())
+	assert.Contains(t, out, "[Service]")
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/control"
+)
+
+// NewStatusCmd represents the status command
+func NewStatusCmd() *cobra.Command {
+	var watch, asJSON bool
+	var interval time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "status [channel]...",
+		Short: "Show what running recorder is doing",
+		Long: `Ask running 'rekoda rec' through its control socket what it's doing with every channel:
+state, current file, elapsed time, size, bitrate, last segment and the last error.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := config.InitConfig().SocketFile()
+			show := func() error {
+				st, err := control.Get(path)
+				if err != nil {
+					return err
+				}
+				st.Channels = filterStatus(st.Channels, args)
+				if asJSON {
+					return printStatusJSON(cmd.OutOrStdout(), st, watch)
+				}
+				if watch {
+					fmt.Fprint(cmd.OutOrStdout(), "\033[H\033[2J") // Clear screen
+				}
+				printStatus(cmd.OutOrStdout(), st, time.Now())
+				return nil
+			}
+
+			if err := show(); err != nil || !watch {
+				return err
+			}
+			for range time.Tick(interval) {
+				if err := show(); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "Keep refreshing until interrupted")
+	cmd.Flags().DurationVar(&interval, "interval", 2*time.Second, "How often to refresh with --watch")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print JSON, one document per refresh with --watch")
+	return cmd
+}
+
+var statusCmd = NewStatusCmd()
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
+
+// filterStatus keeps only named channels, all of them if none are named
+func filterStatus(list []control.ChannelStatus, names []string) []control.ChannelStatus {
+	if len(names) == 0 {
+		return list
+	}
+	var out []control.ChannelStatus
+	for _, s := range list {
+		for _, name := range names {
+			if strings.EqualFold(s.Channel, name) {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+func printStatusJSON(w io.Writer, st control.Status, compact bool) error {
+	enc := json.NewEncoder(w)
+	if !compact {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(st)
+}
+
+// printStatus writes table of channels with what recorder is doing with each of them
+func printStatus(w io.Writer, st control.Status, now time.Time) {
+	recording := 0
+	for _, s := range st.Channels {
+		if active(s.State) {
+			recording++
+		}
+	}
+	fmt.Fprintf(w, "Recorder (pid %v) up %v, recording %v of %v channel(s)\n\n", st.PID, ago(now, st.Started), recording, len(st.Channels))
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHANNEL\tSTATE\tFILE\tELAPSED\tSIZE\tBITRATE\tLAST SEGMENT\tERROR")
+	for _, s := range st.Channels {
+		file, elapsed, size, bitrate, last := "-", "-", "-", "-", "-"
+		if s.File != "" {
+			file = filepath.Base(s.File)
+		}
+		if active(s.State) {
+			elapsed = ago(now, s.Started)
+			size = humanize.Bytes(s.Bytes)
+			if b := s.Bitrate(); b > 0 {
+				bitrate = fmt.Sprintf("%.1f Mbps", b/1e6)
+			}
+			if !s.LastSegment.IsZero() {
+				last = ago(now, s.LastSegment) + " ago"
+			}
+		} else if !s.NextCheck.IsZero() {
+			last = "next check in " + ago(s.NextCheck, now)
+		}
+		errText := "-"
+		if s.Error != "" {
+			errText = fmt.Sprintf("%v (%v ago)", s.Error, ago(now, s.ErrorAt))
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", s.Channel, s.State, file, elapsed, size, bitrate, last, errText)
+	}
+	tw.Flush()
+}
+
+// active reports whether channel in state is being recorded
+func active(state string) bool {
+	return state == control.StateRecording || state == control.StateRestart
+}
+
+// ago formats time between t and now rounded to seconds, e.g. 1h2m3s
+func ago(now, t time.Time) string {
+	d := now.Sub(t).Round(time.Second)
+	if d < 0 {
+		d = 0
+	}
+	return d.String()
+}
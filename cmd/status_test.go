@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/control"
+)
+
+func TestPrintStatus(t *testing.T) {
+	now := time.Date(2021, 9, 8, 14, 0, 0, 0, time.UTC)
+	st := control.Status{PID: 42, Started: now.Add(-2 * time.Hour), Channels: []control.ChannelStatus{
+		{
+			Channel: "rwxrob", State: control.StateRecording, File: "/srv/streams/rwxrob/rwxrob_2021-09-08_12-57-06.ts",
+			Started: now.Add(-time.Hour), Bytes: 2700000000, Recorded: time.Hour, LastSegment: now.Add(-2 * time.Second),
+		},
+		{
+			Channel: "sodapoppin", State: control.StateOffline, NextCheck: now.Add(20 * time.Second),
+			Error: "playlist: usher: received HTTP 500", ErrorAt: now.Add(-5 * time.Minute),
+		},
+		{Channel: "xqc", State: control.StateStopped},
+	}}
+
+	var out bytes.Buffer
+	printStatus(&out, st, now)
+	assert.Contains(t, out.String(), "Recorder (pid 42) up 2h0m0s, recording 1 of 3 channel(s)\n")
+	assert.Regexp(t, `rwxrob\s+recording\s+rwxrob_2021-09-08_12-57-06.ts\s+1h0m0s\s+2.7 GB\s+6.0 Mbps\s+2s ago\s+-\n`, out.String())
+	assert.Regexp(t, `sodapoppin\s+offline\s+-\s+-\s+-\s+-\s+next check in 20s\s+playlist: usher: received HTTP 500 \(5m0s ago\)\n`, out.String())
+
+	assert.Regexp(t, `xqc\s+stopped\s+-\s+-\s+-\s+-\s+-\s+-\n`, out.String())
+
+	assert.Len(t, filterStatus(st.Channels, []string{"RWXROB"}), 1)
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/twitch"
+)
+
+var errNoToken = errors.New("No token given on stdin")
+
+// validateFunc looks up account token belongs to
+type validateFunc func(token string) (twitch.TokenInfo, error)
+
+// NewTokenCmd represents the token command
+func NewTokenCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "token",
+		Short: "Manage OAuth tokens: set, list or remove",
+		Long: `Manage named OAuth tokens of twitch accounts used for ad-free and subscriber-only playback.
+Tokens are kept in tokens.toml next to config file, channels refer to them by name with 'token = "<name>"'.`,
+	}
+}
+
+var tokenCmd = NewTokenCmd()
+
+// NewTokenSetCmd represents the token set command
+func NewTokenSetCmd() *cobra.Command {
+	var noValidate bool
+
+	cmd := &cobra.Command{
+		Use:   "set <name>",
+		Short: "Save OAuth token read from stdin",
+		Long: `Save OAuth token read from stdin under a name, so it never ends up in shell history.
+Token is the 'auth-token' cookie of twitch.tv, it's validated before saving unless --no-validate is given.`,
+		Example: "  rekoda token set main < token.txt",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := config.InitConfig()
+			validate := validateToken(c)
+			if noValidate {
+				validate = nil
+			}
+			return setToken(cmd.InOrStdin(), c.TokensFile(), args[0], validate)
+		},
+	}
+	cmd.Flags().BoolVar(&noValidate, "no-validate", false, "Save token without checking it with twitch")
+	return cmd
+}
+
+var tokenSetCmd = NewTokenSetCmd()
+
+// NewTokenListCmd represents the token list command
+func NewTokenListCmd() *cobra.Command {
+	var noValidate bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List saved OAuth tokens",
+		Long:  "List names of saved OAuth tokens with account and expiry of each of them",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := config.InitConfig()
+			validate := validateToken(c)
+			if noValidate {
+				validate = nil
+			}
+			return listTokens(cmd.OutOrStdout(), c.TokensFile(), validate)
+		},
+	}
+	cmd.Flags().BoolVar(&noValidate, "no-validate", false, "Only list names without asking twitch about tokens")
+	return cmd
+}
+
+var tokenListCmd = NewTokenListCmd()
+
+// NewTokenRemoveCmd represents the token remove command
+func NewTokenRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <name>...",
+		Short: "Remove saved OAuth tokens",
+		Long:  "Remove saved OAuth tokens, channels using them are recorded anonymously",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("You need to specify at least one token name")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return removeTokens(config.InitConfig().TokensFile(), args)
+		},
+	}
+}
+
+var tokenRemoveCmd = NewTokenRemoveCmd()
+
+func init() {
+	rootCmd.AddCommand(tokenCmd)
+	tokenCmd.AddCommand(tokenSetCmd)
+	tokenCmd.AddCommand(tokenListCmd)
+	tokenCmd.AddCommand(tokenRemoveCmd)
+}
+
+// validateToken checks tokens with twitch using client id rekoda plays streams with
+func validateToken(c *config.Config) validateFunc {
+	return func(token string) (twitch.TokenInfo, error) {
+		tc := twitch.NewClient(http.DefaultClient, c.Twitch.GQLEndpoint, c.Twitch.ClientID)
+		tc.Token = token
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return tc.Validate(ctx)
+	}
+}
+
+func setToken(r io.Reader, path, name string, validate validateFunc) error {
+	ctxLog := log.WithField("general", "CLI")
+	s := bufio.NewScanner(r)
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return err
+		}
+		return errNoToken
+	}
+	token := twitch.NormalizeToken(s.Text())
+	if token == "" {
+		return errNoToken
+	}
+
+	if validate != nil {
+		info, err := validate(token)
+		if err != nil {
+			return fmt.Errorf("token was not saved: %w", err)
+		}
+		ctxLog.Infof("Token belongs to %v", info.Login)
+		if info.ExpiresIn > 0 {
+			ctxLog.Warnf("Token expires in %v", info.ExpiresIn.Round(time.Minute))
+		}
+	}
+
+	if err := config.UpdateTokens(path, func(tokens map[string]string) error {
+		tokens[name] = token
+		return nil
+	}); err != nil {
+		return err
+	}
+	ctxLog.Infof("Token '%v' saved in %v. Use it with token = '%v' in [defaults] or a channel", name, path, name)
+	return nil
+}
+
+func listTokens(w io.Writer, path string, validate validateFunc) error {
+	tokens, err := config.LoadTokens(path)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(tokens))
+	for name := range tokens {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if validate == nil {
+		fmt.Fprintln(tw, "NAME")
+	} else {
+		fmt.Fprintln(tw, "NAME\tACCOUNT\tEXPIRES")
+	}
+	for _, name := range names {
+		if validate == nil {
+			fmt.Fprintln(tw, name)
+			continue
+		}
+		info, err := validate(tokens[name])
+		switch {
+		case errors.Is(err, twitch.ErrInvalidToken):
+			fmt.Fprintf(tw, "%v\t-\tinvalid\n", name)
+		case err != nil:
+			fmt.Fprintf(tw, "%v\t-\t%v\n", name, err)
+		case info.ExpiresIn == 0:
+			fmt.Fprintf(tw, "%v\t%v\tnever\n", name, info.Login)
+		default:
+			fmt.Fprintf(tw, "%v\t%v\tin %v\n", name, info.Login, info.ExpiresIn.Round(time.Minute))
+		}
+	}
+	return tw.Flush()
+}
+
+func removeTokens(path string, names []string) error {
+	return config.UpdateTokens(path, func(tokens map[string]string) error {
+		for _, name := range names {
+			if _, ok := tokens[name]; !ok {
+				log.WithField("general", "CLI").Warnf("Skip! There is no token '%v'", name)
+				continue
+			}
+			delete(tokens, name)
+			log.WithField("general", "CLI").Infof("Token '%v' removed", name)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/twitch"
+)
+
+func TestTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.toml")
+	validate := func(token string) (twitch.TokenInfo, error) {
+		if token != "abc123" {
+			return twitch.TokenInfo{}, twitch.ErrInvalidToken
+		}
+		return twitch.TokenInfo{Login: "wmw"}, nil
+	}
+
+	assert.ErrorIs(t, setToken(strings.NewReader(""), path, "main", validate), errNoToken)
+	assert.ErrorIs(t, setToken(strings.NewReader("oauth:revoked\n"), path, "main", validate), twitch.ErrInvalidToken)
+	assert.NoError(t, setToken(strings.NewReader("oauth:abc123\n"), path, "main", validate))
+	assert.NoError(t, setToken(strings.NewReader("old\n"), path, "alt", nil))
+
+	var out bytes.Buffer
+	assert.NoError(t, listTokens(&out, path, validate))
+	assert.Regexp(t, `alt\s+-\s+invalid\nmain\s+wmw\s+never\n`, out.String())
+
+	assert.NoError(t, removeTokens(path, []string{"alt", "missing"}))
+	tokens, err := config.LoadTokens(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"main": "abc123"}, tokens)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/control"
+	"github.com/wmw64/rekoda/internal/tui"
+)
+
+// NewTopCmd represents the top command
+func NewTopCmd() *cobra.Command {
+	var interval time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "top",
+		Short: "Show dashboard of running recorder",
+		Long: `Show full-screen dashboard of running 'rekoda rec', one row per channel with state,
+elapsed time, size, bitrate, health and the last error.
+
+Keys: ↑/↓ or j/k select channel, s starts recording it, x stops it,
+e enables or disables it in config file, r refreshes, q quits.
+When stdout is not a terminal, status is printed once as 'rekoda status' does.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := config.InitConfig().SocketFile()
+			if !tui.IsTerminal(os.Stdin.Fd()) || !tui.IsTerminal(os.Stdout.Fd()) {
+				st, err := control.Get(path)
+				if err != nil {
+					return err
+				}
+				printStatus(cmd.OutOrStdout(), st, time.Now())
+				return nil
+			}
+			if _, err := control.Get(path); err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+			src := tui.Source{
+				Status: func() (control.Status, error) { return control.Get(path) },
+				Act:    func(channel, action string) error { return control.Do(path, channel, action) },
+			}
+			return tui.Run(ctx, os.Stdin, os.Stdout, src, interval)
+		},
+	}
+	cmd.Flags().DurationVar(&interval, "interval", time.Second, "How often to refresh")
+	return cmd
+}
+
+var topCmd = NewTopCmd()
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+}
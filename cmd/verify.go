@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/verify"
+	"github.com/wmw64/rekoda/pkg/mpegts"
+)
+
+// NewVerifyCmd represents the verify command
+func NewVerifyCmd() *cobra.Command {
+	var o verify.Options
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "verify [path]...",
+		Short: "Check recordings for corruption",
+		Long: `Check recordings, streams dirs of config file if no files or dirs are given: MPEG-TS packets, continuity
+counters, PAT and PMT, timestamps jumping and what's left at the end. Recording is compared with its sidecar,
+if there's one: duration and whether it was closed. Discontinuities are fine where sidecar says segments were
+left out, gaps or ads removed, and in ads files.
+
+Exits with 1 if any recording has problems. --repair cuts off partial packet or garbage recording ends with,
+as left by recorder killed mid-write. Recordings still being written, with no end in sidecar and changed
+within 15 minutes, are never cut.`,
+		Example: `  rekoda verify
+  rekoda verify /archive/rwxrob --workers 8
+  rekoda verify rwxrob_2021-09-08.ts --repair`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			paths := args
+			if len(paths) == 0 {
+				for _, dir := range config.InitConfig().StreamsDirs() {
+					if _, err := os.Stat(dir); err == nil {
+						paths = append(paths, dir)
+					}
+				}
+			}
+			files, err := verify.Files(paths...)
+			if err != nil {
+				return err
+			}
+			if len(files) == 0 {
+				return errors.New("no recordings found")
+			}
+
+			results := []verify.Result{}
+			failed := 0
+			verify.Run(files, o, func(r verify.Result) {
+				if r.Failed {
+					failed++
+				}
+				if asJSON {
+					results = append(results, r)
+				} else {
+					printVerified(cmd.OutOrStdout(), r)
+				}
+			})
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(results); err != nil {
+					return err
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%v of %v recording(s) have problems", failed, len(files))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print JSON")
+	cmd.Flags().BoolVar(&o.Repair, "repair", false, "Truncate recordings ending with partial packet or garbage")
+	cmd.Flags().IntVar(&o.Workers, "workers", runtime.NumCPU(), "Recordings checked at once")
+	return cmd
+}
+
+var verifyCmd = NewVerifyCmd()
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// printVerified writes line of recording checked, followed by what was found indented
+func printVerified(w io.Writer, r verify.Result) {
+	mark := "✓"
+	if r.Failed {
+		mark = "✗"
+	}
+	if r.Error != "" && r.Packets == 0 {
+		fmt.Fprintf(w, "%v %v: %v\n", mark, r.Path, r.Error)
+		return
+	}
+	fmt.Fprintf(w, "%v %v  %v, %v\n", mark, r.Path, r.Duration().Round(time.Second), humanize.Bytes(uint64(r.Size)))
+	if r.Error != "" {
+		fmt.Fprintf(w, "    error: %v\n", r.Error)
+	}
+	for _, p := range r.Problems {
+		fmt.Fprintf(w, "    %v: %v\n", p.Kind, p)
+	}
+	var kinds []string
+	for kind, n := range r.Counts {
+		if n > mpegts.MaxProblems {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "    %v: %v more\n", kind, r.Counts[kind]-mpegts.MaxProblems)
+	}
+	for _, s := range r.Warnings {
+		fmt.Fprintf(w, "    sidecar: %v\n", s)
+	}
+	for _, s := range r.Notes {
+		fmt.Fprintf(w, "    note: %v\n", s)
+	}
+}
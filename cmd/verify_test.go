@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/verify"
+	"github.com/wmw64/rekoda/pkg/mpegts"
+)
+
+func TestPrintVerified(t *testing.T) {
+	var out bytes.Buffer
+	r := verify.Result{Path: "rwxrob.ts", Report: mpegts.Report{Size: 2700000000, Packets: 14361702, Duration: time.Hour}}
+	printVerified(&out, r)
+	assert.Equal(t, "✓ rwxrob.ts  1h0m0s, 2.7 GB\n", out.String())
+
+	out.Reset()
+	r.Failed = true
+	r.Problems = []mpegts.Problem{{Offset: 376, Kind: mpegts.ProblemContinuity, Message: "continuity counter of PID 256 jumped from 1 to 3, 1 packet(s) lost"}}
+	r.Counts = map[string]int{mpegts.ProblemContinuity: mpegts.MaxProblems + 5}
+	r.Warnings = []string{"1h0m0s of media found, sidecar says 2h0m0s"}
+	printVerified(&out, r)
+	assert.Equal(t, `✗ rwxrob.ts  1h0m0s, 2.7 GB
+    continuity: at byte 376: continuity counter of PID 256 jumped from 1 to 3, 1 packet(s) lost
+    continuity: 5 more
+    sidecar: 1h0m0s of media found, sidecar says 2h0m0s
+`, out.String())
+
+	out.Reset()
+	printVerified(&out, verify.Result{Path: "gone.ts", Error: "open gone.ts: no such file or directory", Failed: true})
+	assert.Equal(t, "✗ gone.ts: open gone.ts: no such file or directory\n", out.String())
+}
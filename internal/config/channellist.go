@@ -0,0 +1,402 @@
+package config
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	conf "github.com/wmw64/rekoda/pkg/config/toml"
+)
+
+// Formats channel lists are exported to and imported from
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatTOML = "toml"
+)
+
+// Strategies of importing channels which are already in config
+const (
+	ImportSkip      = "skip"      // Keep channel in config as it is
+	ImportOverwrite = "overwrite" // Replace channel with imported one
+	ImportMerge     = "merge"     // Set keys stated by imported channel, keep the rest
+)
+
+// Actions ImportChannels takes on a channel
+const (
+	ActionAdd       = "add"
+	ActionUpdate    = "update"
+	ActionSkip      = "skip"
+	ActionUnchanged = "unchanged"
+)
+
+// FormatOf returns format of channel list file by its extension, empty if unknown
+func FormatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".csv":
+		return FormatCSV
+	case ".toml":
+		return FormatTOML
+	}
+	return ""
+}
+
+// NewChannel returns entry of channel added with default settings
+func NewChannel(user string) Channels {
+	return Channels{User: user, ID: 123, Enabled: true, Quality: "best"}
+}
+
+// ChannelEntry is channel read from a channel list: keys it states with values as SetField takes them
+type ChannelEntry struct {
+	User   string
+	Fields []Field
+}
+
+// Apply sets keys of entry on channel
+func (e ChannelEntry) Apply(ch *Channels) error {
+	for _, f := range e.Fields {
+		if err := SetField(ch, f.Key, f.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FieldChange is key of channel changed by import, empty Old or New means key was not set
+type FieldChange struct {
+	Key, Old, New string
+	Secret        bool
+}
+
+// ImportChange is what ImportChannels does with a channel
+type ImportChange struct {
+	User   string
+	Action string
+	Diff   []FieldChange
+}
+
+// ImportChannels merges entries into channel list, returning the new list and what changed.
+// Nothing is returned if any resulting channel is invalid
+func ImportChannels(list []Channels, entries []ChannelEntry, strategy string) ([]Channels, []ImportChange, error) {
+	switch strategy {
+	case ImportSkip, ImportOverwrite, ImportMerge:
+	default:
+		return nil, nil, fmt.Errorf("unknown strategy '%v', must be one of %v, %v, %v", strategy, ImportSkip, ImportOverwrite, ImportMerge)
+	}
+
+	result := append([]Channels(nil), list...)
+	var changes []ImportChange
+	var problems []string
+	for _, e := range entries {
+		i := -1
+		for n, ch := range result {
+			if strings.EqualFold(ch.User, e.User) {
+				i = n
+				break
+			}
+		}
+		if i >= 0 && strategy == ImportSkip {
+			changes = append(changes, ImportChange{User: result[i].User, Action: ActionSkip})
+			continue
+		}
+
+		var old, ch Channels
+		switch {
+		case i < 0:
+			ch = NewChannel(e.User)
+		case strategy == ImportOverwrite:
+			old, ch = result[i], NewChannel(result[i].User)
+		default:
+			old, ch = result[i], copyChannel(result[i])
+		}
+		if err := e.Apply(&ch); err != nil {
+			problems = append(problems, fmt.Sprintf("channel '%v': %v", e.User, err))
+			continue
+		}
+		if i >= 0 {
+			ch.User = old.User // Names differing in case only are the same channel
+		}
+		if err := ch.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("channel '%v': %v", e.User, err))
+			continue
+		}
+
+		if i < 0 {
+			result = append(result, ch)
+			changes = append(changes, ImportChange{User: ch.User, Action: ActionAdd, Diff: diffFields(nil, Fields(&ch))})
+			continue
+		}
+		result[i] = ch
+		c := ImportChange{User: ch.User, Action: ActionUnchanged, Diff: diffFields(Fields(&old), Fields(&ch))}
+		if len(c.Diff) > 0 {
+			c.Action = ActionUpdate
+		}
+		changes = append(changes, c)
+	}
+	if len(problems) > 0 {
+		return nil, nil, errors.New(strings.Join(problems, "\n"))
+	}
+	return result, changes, nil
+}
+
+// copyChannel returns channel which shares no pointers with ch, so setting its keys leaves ch as it is
+func copyChannel(ch Channels) Channels {
+	c := Channels{User: ch.User, ID: ch.ID, Enabled: ch.Enabled, Quality: ch.Quality}
+	for _, f := range Fields(&ch) {
+		SetField(&c, f.Key, f.Text())
+	}
+	return c
+}
+
+// diffFields lists keys whose values differ
+func diffFields(old, new []Field) []FieldChange {
+	values := make(map[string]string, len(old))
+	for _, f := range old {
+		values[f.Key] = f.Value
+	}
+	var diff []FieldChange
+	for _, f := range new {
+		if v, ok := values[f.Key]; !ok || v != f.Value {
+			diff = append(diff, FieldChange{Key: f.Key, Old: v, New: f.Value, Secret: f.Secret})
+		}
+		delete(values, f.Key)
+	}
+	for _, f := range old {
+		if v, ok := values[f.Key]; ok {
+			diff = append(diff, FieldChange{Key: f.Key, Old: v, Secret: f.Secret})
+		}
+	}
+	return diff
+}
+
+// ExportChannels writes channels with every key they state
+func ExportChannels(w io.Writer, list []Channels, format string) error {
+	switch format {
+	case FormatTOML:
+		b, err := conf.Marshal(struct {
+			Channels []Channels `toml:"channels"`
+		}{list})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	case FormatJSON:
+		out := make([]map[string]interface{}, 0, len(list))
+		for _, ch := range list {
+			m := make(map[string]interface{})
+			for _, f := range Fields(&ch) {
+				var v struct{ V interface{} }
+				if err := conf.Unmarshal([]byte("V = "+f.Value), &v); err != nil {
+					return fmt.Errorf("%v: %w", f.Key, err)
+				}
+				nest(m, strings.Split(f.Key, "."), v.V)
+			}
+			out = append(out, m)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case FormatCSV:
+		columns := []string{"user"}
+		seen := map[string]bool{"user": true}
+		rows := make([]map[string]string, 0, len(list))
+		for _, ch := range list {
+			row := make(map[string]string)
+			for _, f := range Fields(&ch) {
+				row[f.Key] = f.Text()
+				if !seen[f.Key] {
+					seen[f.Key] = true
+					columns = append(columns, f.Key)
+				}
+			}
+			rows = append(rows, row)
+		}
+		cw := csv.NewWriter(w)
+		cw.Write(columns)
+		for _, row := range rows {
+			record := make([]string, len(columns))
+			for i, col := range columns {
+				record[i] = row[col]
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown format '%v', must be one of %v, %v, %v", format, FormatJSON, FormatCSV, FormatTOML)
+}
+
+// ExportPerm returns permissions of exported channel list file, only owner may read it once it holds any secrets
+func ExportPerm(list []Channels) os.FileMode {
+	if hasSecrets(reflect.ValueOf(list)) {
+		return 0600
+	}
+	return 0644
+}
+
+// nest sets value in nested maps by dotted key parts
+func nest(m map[string]interface{}, parts []string, v interface{}) {
+	for _, p := range parts[:len(parts)-1] {
+		sub, ok := m[p].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			m[p] = sub
+		}
+		m = sub
+	}
+	m[parts[len(parts)-1]] = v
+}
+
+// fieldText turns TOML formatted value into text SetField takes, e.g. ['a', 'b'] into a,b
+func fieldText(v string) string {
+	var doc struct{ V interface{} }
+	if err := conf.Unmarshal([]byte("V = "+v), &doc); err != nil {
+		return v
+	}
+	return valueText(doc.V)
+}
+
+// ReadChannels reads channel list written by ExportChannels, JSON may also be a list of names
+func ReadChannels(r io.Reader, format string) ([]ChannelEntry, error) {
+	var tables []interface{}
+	switch format {
+	case FormatTOML:
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		var v struct {
+			Channels []interface{} `toml:"channels"`
+		}
+		if err := conf.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+		tables = v.Channels
+	case FormatJSON:
+		dec := json.NewDecoder(r)
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		if m, ok := v.(map[string]interface{}); ok { // {"channels": [...]} as in config file
+			v = m["channels"]
+		}
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, errors.New("expected a list of channels")
+		}
+		tables = list
+	case FormatCSV:
+		return readCSV(r)
+	default:
+		return nil, fmt.Errorf("unknown format '%v', must be one of %v, %v, %v", format, FormatJSON, FormatCSV, FormatTOML)
+	}
+
+	entries := make([]ChannelEntry, 0, len(tables))
+	for n, t := range tables {
+		var e ChannelEntry
+		switch t := t.(type) {
+		case string:
+			e.User = t
+		case map[string]interface{}:
+			flatten(t, "", &e.Fields)
+			for i, f := range e.Fields {
+				if f.Key == "user" {
+					e.User = f.Value
+					e.Fields = append(e.Fields[:i], e.Fields[i+1:]...)
+					break
+				}
+			}
+		}
+		if e.User = strings.TrimSpace(e.User); e.User == "" {
+			return nil, fmt.Errorf("channel #%v: user is required", n+1)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// flatten turns nested tables into dotted keys with values as SetField takes them
+func flatten(m map[string]interface{}, prefix string, fields *[]Field) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if sub, ok := m[k].(map[string]interface{}); ok {
+			flatten(sub, prefix+k+".", fields)
+			continue
+		}
+		*fields = append(*fields, Field{Key: prefix + k, Value: valueText(m[k])})
+	}
+}
+
+func valueText(v interface{}) string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	if len(list) == 0 {
+		return "[]"
+	}
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
+
+func readCSV(r io.Reader) ([]ChannelEntry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	header := records[0]
+	user := -1
+	for i, col := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(col, "\ufeff")) // Spreadsheets may start file with BOM
+		if header[i] == "user" {
+			user = i
+		}
+	}
+	if user < 0 {
+		return nil, errors.New("no 'user' column")
+	}
+
+	entries := make([]ChannelEntry, 0, len(records)-1)
+	for n, record := range records[1:] {
+		var e ChannelEntry
+		for i, cell := range record {
+			if i >= len(header) || strings.TrimSpace(cell) == "" { // Empty cell leaves key as it is
+				continue
+			}
+			if i == user {
+				e.User = strings.TrimSpace(cell)
+				continue
+			}
+			e.Fields = append(e.Fields, Field{Key: header[i], Value: cell})
+		}
+		if e.User == "" {
+			return nil, fmt.Errorf("line %v: user is required", n+2)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testChannels(t *testing.T) []Channels {
+	rwxrob := NewChannel("rwxrob")
+	assert.NoError(t, SetField(&rwxrob, "tags", "coding,linux"))
+	assert.NoError(t, SetField(&rwxrob, "poll_interval", "30s"))
+	assert.NoError(t, SetField(&rwxrob, "segment_retry.attempts", "6"))
+	soda := NewChannel("sodapoppin")
+	soda.Enabled = false
+	return []Channels{rwxrob, soda}
+}
+
+func TestExportImportChannels(t *testing.T) {
+	list := testChannels(t)
+	for _, format := range []string{FormatJSON, FormatCSV, FormatTOML} {
+		var buf bytes.Buffer
+		assert.NoError(t, ExportChannels(&buf, list, format), format)
+		entries, err := ReadChannels(&buf, format)
+		assert.NoError(t, err, format)
+
+		got, changes, err := ImportChannels(nil, entries, ImportSkip)
+		assert.NoError(t, err, format)
+		assert.Equal(t, list, got, format)
+		assert.Len(t, changes, 2)
+		assert.Equal(t, ActionAdd, changes[0].Action)
+
+		// Importing the same list again changes nothing
+		_, changes, err = ImportChannels(list, entries, ImportOverwrite)
+		assert.NoError(t, err, format)
+		assert.Equal(t, ActionUnchanged, changes[0].Action, format)
+	}
+
+	entries, err := ReadChannels(strings.NewReader(`["rwxrob", {"user": "xqc", "quality": "worst"}]`), FormatJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, []ChannelEntry{{User: "rwxrob"}, {User: "xqc", Fields: []Field{{Key: "quality", Value: "worst"}}}}, entries)
+
+	_, err = ReadChannels(strings.NewReader("quality\nbest\n"), FormatCSV)
+	assert.Error(t, err)
+}
+
+func TestExportImportQuotes(t *testing.T) {
+	ch := NewChannel("rwxrob")
+	postProcess := `sh -c 'echo it''s, "done"' C:\streams\{name}`
+	fileTemplate := `{user}\{date}, 'part'.ts`
+	assert.NoError(t, SetField(&ch, "post_process", postProcess))
+	assert.NoError(t, SetField(&ch, "file_template", fileTemplate))
+	assert.Equal(t, postProcess, *ch.PostProcess, "quotes given are part of value")
+	list := []Channels{ch}
+
+	for _, format := range []string{FormatJSON, FormatCSV, FormatTOML} {
+		var buf bytes.Buffer
+		assert.NoError(t, ExportChannels(&buf, list, format), format)
+		entries, err := ReadChannels(&buf, format)
+		assert.NoError(t, err, format)
+		got, _, err := ImportChannels(nil, entries, ImportSkip)
+		assert.NoError(t, err, format)
+		assert.Equal(t, list, got, format)
+	}
+
+	v, ok, err := GetField(&ch, "post_process")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, `"sh -c 'echo it''s, \"done\"' C:\\streams\\{name}"`, v)
+	for _, f := range Fields(&ch) {
+		if f.Key == "file_template" {
+			assert.Equal(t, fileTemplate, f.Text())
+		}
+	}
+	merged, _, err := ImportChannels(list, []ChannelEntry{{User: "rwxrob", Fields: []Field{{Key: "quality", Value: "worst"}}}}, ImportMerge)
+	assert.NoError(t, err)
+	assert.Equal(t, postProcess, *merged[0].PostProcess)
+}
+
+func TestImportStrategies(t *testing.T) {
+	list := testChannels(t)
+	entries := []ChannelEntry{{User: "RWXROB", Fields: []Field{{Key: "quality", Value: "worst"}}}}
+
+	got, changes, err := ImportChannels(list, entries, ImportSkip)
+	assert.NoError(t, err)
+	assert.Equal(t, list, got)
+	assert.Equal(t, ActionSkip, changes[0].Action)
+
+	got, changes, err = ImportChannels(list, entries, ImportMerge)
+	assert.NoError(t, err)
+	assert.Equal(t, "rwxrob", got[0].User)
+	assert.Equal(t, "worst", got[0].Quality)
+	assert.Equal(t, 30.0, got[0].PollInterval.Seconds())
+	assert.Equal(t, []FieldChange{{Key: "quality", Old: "'best'", New: "'worst'"}}, changes[0].Diff)
+	assert.Equal(t, "best", list[0].Quality, "existing list is left as it is")
+
+	got, changes, err = ImportChannels(list, entries, ImportOverwrite)
+	assert.NoError(t, err)
+	assert.Nil(t, got[0].PollInterval)
+	assert.Equal(t, ActionUpdate, changes[0].Action)
+	assert.Contains(t, changes[0].Diff, FieldChange{Key: "poll_interval", Old: "'30s'"})
+
+	_, _, err = ImportChannels(list, []ChannelEntry{{User: "xqc", Fields: []Field{{Key: "ads", Value: "block"}}}}, ImportMerge)
+	assert.Error(t, err)
+	_, _, err = ImportChannels(list, entries, "replace")
+	assert.Error(t, err)
+}
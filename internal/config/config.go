@@ -1,16 +1,25 @@
 package config
 
 import (
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
+	"strconv"
 
 	"github.com/mitchellh/go-homedir"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/wmw64/rekoda/internal/logging"
 	conf "github.com/wmw64/rekoda/pkg/config/toml"
+	"github.com/wmw64/rekoda/pkg/logfile"
 )
 
-const ConfigFile = "rekoda.toml"
+const (
+	ConfigFile   = "rekoda.toml"
+	defaultTitle = "Rekoda configuration file"
+)
 
 var (
 	sep            = string(os.PathSeparator)
@@ -23,32 +32,65 @@ var (
 	FlagConfigFile = ""
 	FlagConfigDir  = ""
 	FlagStreamsDir = ""
-	EnvLogLevel    = os.Getenv("REKODA_LOG_LEVEL") // Options: trace, debug, info (default)
+	EnvLogLevel    = os.Getenv("REKODA_LOG_LEVEL") // Options: trace, debug, info (default), warn, error
 	FlagLogLevel   = ""
+	EnvLogFormat   = os.Getenv("REKODA_LOG_FORMAT") // Options: text (default), json
+	FlagLogFormat  = ""
+	EnvLogFile     = os.Getenv("REKODA_LOG_FILE")
+	FlagLogFile    = ""
+	FlagLogMaxSize = 10 // Megabytes
+	FlagLogBackups = 5
+	EnvSessionLog  = os.Getenv("REKODA_SESSION_LOG")
+	FlagSessionLog = false
+	EnvPidFile     = os.Getenv("REKODA_PID_FILE")
+	FlagPidFile    = ""
+
+	logFile *logfile.Rotator // Opened once per process, InitConfig may run several times
+
+	ErrConflict = errors.New("config file was changed by someone else since it was loaded")
 )
 
 type Config struct {
-	Title      string     `toml:"title"`
-	Version    int        `toml:"version"`
-	ConfigDir  string     `toml:"config_dir"`
-	ConfigFile string     `toml:"config_file"`
-	StreamsDir string     `toml:"streams_dir"`
-	Channels   []Channels `toml:"channels"`
+	Title      string         `toml:"title"`
+	Version    int            `toml:"version"`
+	ConfigDir  string         `toml:"-"`
+	ConfigFile string         `toml:"-"`
+	StreamsDir string         `toml:"streams_dir"`
+	PidFile    string         `toml:"-"`
+	LogFormat  string         `toml:"-"`
+	SessionLog bool           `toml:"-"`
+	Scheduler  Scheduler      `toml:"scheduler"`
+	Breaker    CircuitBreaker `toml:"circuit_breaker"`
+	Twitch     Twitch         `toml:"twitch"`
+	EventSub   EventSub       `toml:"eventsub"`
+	Defaults   Settings       `toml:"defaults"`
+	Channels   []Channels     `toml:"channels"`
+
+	loaded bool     // Config was read from or written to ConfigFile
+	sum    [32]byte // Checksum of ConfigFile contents at that moment, used to detect concurrent changes
+
+	file           map[string]interface{} // ConfigFile as read, tells which keys it states
+	fileStreamsDir string                 // streams_dir as stated in ConfigFile
+	outputDir      string                 // --output flag or REKODA_STREAMS_DIR env, takes precedence over streams_dir of file
+	outputFrom     string                 // SourceFlag or SourceEnv
 }
 
 type Channels struct {
-	Enabled bool   `toml:"enabled"`
-	User    string `toml:"user"`
-	ID      int64  `toml:"id"`
-	Quality string `toml:"quality"`
+	Enabled bool      `toml:"enabled"`
+	User    string    `toml:"user"`
+	ID      int64     `toml:"id"`
+	Quality string    `toml:"quality"`
+	Tags    *[]string `toml:"tags"` // Free-form labels, kept in metadata of recordings
+
+	Settings // Optional overrides of [defaults], their keys sit right in channel's table
 }
 
 var ConfigStruct Config
 
 // MakeDefaultConfStruct initializes default conf struct
 func (c *Config) MakeDefaultConfStruct() {
-	c.Title = "Rekoda configuration file"
-	c.Version = 1
+	c.Title = defaultTitle
+	c.Version = CurrentVersion
 	c.ConfigDir = configDir
 	c.StreamsDir = streamsDir
 	c.Channels = []Channels{
@@ -70,10 +112,12 @@ func InitConfig() *Config {
 
 	// At this step config file should be ready, we open it
 	ctxLog.Debugf("Trying to open config file: %s", c.ConfigFile)
-	c.StreamsDir = c.ConfigDir + sep + "streams"
-	ctxLog.Tracef("Config streams dir: '%v'", c.StreamsDir)
-	c.Channels = nil // Clear before load to prevent dublicates
-	err := c.Load()
+	unlock, err := conf.Lock(c.ConfigFile)
+	if err != nil {
+		ctxLog.Fatalf("Failed to lock config file '%v': '%v'", c.ConfigFile, err)
+	}
+	err = c.Load()
+	unlock()
 	if err != nil {
 		ctxLog.Fatalf("Config file '%v' is invalid or wrong file. '%v'", c.ConfigFile, err)
 	}
@@ -84,45 +128,87 @@ func InitConfig() *Config {
 }
 
 func (c *Config) AutomaticEnv(ctxLog *log.Entry) {
+	c.SetLogFormat(ctxLog)
+	c.SetLogFile(ctxLog)
 	c.SetLogLevel(ctxLog)
 	c.SetConfFile(ctxLog)
 	c.SetStreamsDir(ctxLog)
+	c.SetPidFile(ctxLog)
 }
 
+// SetLogLevel sets log level from --verbose flag or 'REKODA_LOG_LEVEL' env, info is default
 func (c *Config) SetLogLevel(ctxLog *log.Entry) {
+	level := EnvLogLevel
 	if FlagLogLevel != "" {
-		switch FlagLogLevel {
-		case "trace":
-			ctxLog.Info("Log level: trace")
-			log.SetLevel(log.TraceLevel)
-		case "debug":
-			ctxLog.Info("Log level: debug")
-			log.SetLevel(log.DebugLevel)
-		default:
-			ctxLog.Info("Log level: info (default)")
-			log.SetLevel(log.InfoLevel)
-		}
+		level = FlagLogLevel
 	}
 
-	if FlagLogLevel == "" && EnvLogLevel != "" {
-		switch EnvLogLevel {
-		case "trace":
-			ctxLog.Info("Log level: trace")
-			log.SetLevel(log.TraceLevel)
-		case "debug":
-			ctxLog.Info("Log level: debug")
-			log.SetLevel(log.DebugLevel)
-		default:
-			ctxLog.Info("Log level: info (default)")
-			log.SetLevel(log.InfoLevel)
-		}
-	}
-	if FlagLogLevel == "" && EnvLogLevel == "" {
+	switch level {
+	case "trace":
+		ctxLog.Info("Log level: trace")
+		log.SetLevel(log.TraceLevel)
+	case "debug":
+		ctxLog.Info("Log level: debug")
+		log.SetLevel(log.DebugLevel)
+	case "warn", "warning":
+		log.SetLevel(log.WarnLevel)
+	case "error":
+		log.SetLevel(log.ErrorLevel)
+	default:
 		ctxLog.Info("Log level: info (default)")
 		log.SetLevel(log.InfoLevel)
 	}
 }
 
+// SetLogFormat switches log output between human readable text and JSON via --log-format flag or 'REKODA_LOG_FORMAT' env,
+// log is written to stderr
+func (c *Config) SetLogFormat(ctxLog *log.Entry) {
+	c.LogFormat = EnvLogFormat
+	if FlagLogFormat != "" {
+		c.LogFormat = FlagLogFormat
+	}
+	if c.LogFormat == "" {
+		c.LogFormat = logging.FormatText
+	}
+
+	formatter, err := logging.NewFormatter(c.LogFormat, true)
+	if err != nil {
+		ctxLog.Fatal(err)
+	}
+	log.SetFormatter(formatter)
+	// Log goes to stderr, standard output is left for what commands print, e.g. exported channels or JSON
+	log.SetOutput(os.Stderr)
+
+	c.SessionLog = FlagSessionLog
+	if !FlagSessionLog && EnvSessionLog != "" {
+		enabled, err := strconv.ParseBool(EnvSessionLog)
+		if err != nil {
+			ctxLog.Fatalf("Invalid REKODA_SESSION_LOG environment: '%v'", err)
+		}
+		c.SessionLog = enabled
+	}
+}
+
+// SetLogFile duplicates log into rotating file stated via --log-file flag or 'REKODA_LOG_FILE' env
+func (c *Config) SetLogFile(ctxLog *log.Entry) {
+	path := EnvLogFile
+	if FlagLogFile != "" {
+		path = FlagLogFile
+	}
+	if path == "" || logFile != nil {
+		return
+	}
+
+	var err error
+	logFile, err = logfile.New(path, int64(FlagLogMaxSize)*1024*1024, FlagLogBackups)
+	if err != nil {
+		ctxLog.Fatalf("Failed to open log file '%v': '%v'", path, err)
+	}
+	formatter, _ := logging.NewFormatter(c.LogFormat, false)
+	log.AddHook(&logging.WriterHook{Writer: logFile, Formatter: formatter})
+	ctxLog.Infof("Writing log to file: %v", path)
+}
+
 func (c *Config) SetConfFile(ctxLog *log.Entry) {
 	// Find OS-specific home directory. Prepare configDir, configFilePath.
 	homeDir, err := homedir.Dir()
@@ -176,33 +262,169 @@ func (c *Config) SetStreamsDir(ctxLog *log.Entry) {
 	// Set custom output dir if stated
 	if FlagStreamsDir != "" {
 		ctxLog.Infof("Using custom --output folder: '%v'", FlagStreamsDir)
-		c.StreamsDir = FlagStreamsDir
+		c.StreamsDir, c.outputDir, c.outputFrom = FlagStreamsDir, FlagStreamsDir, SourceFlag
 	}
 
 	// Set custom conf dir via 'REKODA_STREAMS_DIR' env
 	if FlagStreamsDir == "" && EnvStreamsDir != "" {
-		c.StreamsDir = EnvStreamsDir
+		c.StreamsDir, c.outputDir, c.outputFrom = EnvStreamsDir, EnvStreamsDir, SourceEnv
 		ctxLog.Infof("Using REKODA_STREAMS_DIR environment: '%v'", EnvStreamsDir)
 	}
 }
 
-// Save writes current Config struct into rekoda.toml file
+// SetPidFile sets path of pidfile written by recorder, flag takes precedence over 'REKODA_PID_FILE' env
+func (c *Config) SetPidFile(ctxLog *log.Entry) {
+	if FlagPidFile != "" {
+		c.PidFile = FlagPidFile
+	}
+	if FlagPidFile == "" && EnvPidFile != "" {
+		c.PidFile = EnvPidFile
+		ctxLog.Infof("Using REKODA_PID_FILE environment: '%v'", EnvPidFile)
+	}
+}
+
+// Save atomically writes current Config struct into rekoda.toml file.
+// Fails with ErrConflict if file was changed since it was loaded, use Update for read-modify-write
 func (c *Config) Save() error {
-	// log.Println(ConfigStruct.Channels)
-	if err := conf.Save(c.ConfigFile, &c); err != nil {
+	if c.loaded {
+		b, err := os.ReadFile(c.ConfigFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if sha256.Sum256(b) != c.sum {
+			return ErrConflict
+		}
+	}
+
+	out := c
+	if c.outputDir != "" && c.StreamsDir == c.outputDir { // Flag and env are not written to file
+		cp := *c
+		cp.StreamsDir = c.fileStreamsDir
+		out = &cp
+	}
+	b, err := conf.Marshal(out)
+	if err != nil {
+		return err
+	}
+	if err := conf.WriteFile(c.ConfigFile, b, c.perm()); err != nil {
 		return err
 	}
-	// conf.Load(configFilePath, &ConfigStruct)
+	c.loaded, c.sum = true, sha256.Sum256(b)
 	return nil
 }
 
-// Load reads back from rekoda.toml file and unmarshal int Config struct
+// Update locks config file, loads its current contents, applies fn and saves the result.
+// Use it for every change so concurrent rekoda processes don't lose each other's updates
+func (c *Config) Update(fn func(c *Config) error) error {
+	unlock, err := conf.Lock(c.ConfigFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := c.Load(); err != nil {
+		return err
+	}
+	if err := fn(c); err != nil {
+		return err
+	}
+	return c.Save()
+}
+
+// perm returns config file permissions, only owner may read it once it holds any secrets
+func (c *Config) perm() os.FileMode {
+	if hasSecrets(reflect.ValueOf(c)) {
+		return 0600
+	}
+	return 0644
+}
+
+// hasSecrets reports whether v holds any non-empty field tagged `secret:"true"`
+func hasSecrets(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return !v.IsNil() && hasSecrets(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if f.Tag.Get("secret") == "true" && !v.Field(i).IsZero() {
+				return true
+			}
+			if hasSecrets(v.Field(i)) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if hasSecrets(v.Index(i)) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if hasSecrets(iter.Value()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Load reads back from rekoda.toml file and unmarshal int Config struct.
+// Files written with older schema version are upgraded in place first
 func (c *Config) Load() error {
-	// log.Printf("ConfigFilePath: '%v' \n c: '%v'", ConfigFilePath, c)
-	err := conf.Load(c.ConfigFile, c)
+	b, from, backup, err := MigrateFile(c.ConfigFile, false)
 	if err != nil {
 		return err
 	}
+	if from < CurrentVersion {
+		log.WithField("general", "INIT").Infof("Config file upgraded from version %v to %v, backup saved: %v", from, CurrentVersion, backup)
+	}
+
+	if err := c.parse(b); err != nil {
+		return err
+	}
+	c.loaded, c.sum = true, sha256.Sum256(b)
+	return nil
+}
+
+// Peek reads config file like Load without upgrading it on disk, for checking it only
+func (c *Config) Peek() error {
+	b, _, _, err := MigrateFile(c.ConfigFile, true)
+	if err != nil {
+		return err
+	}
+	return c.parse(b)
+}
+
+// parse decodes config file contents, streams directory stated by flag or env wins over the file
+func (c *Config) parse(b []byte) error {
+	c.Channels = nil // Clear before load to prevent dublicates
+	c.Scheduler = Scheduler{}
+	c.Breaker = CircuitBreaker{}
+	c.Twitch = Twitch{}
+	c.EventSub = EventSub{}
+	c.Defaults = Settings{}
+	c.StreamsDir = ""
+	if err := c.unmarshal(b); err != nil {
+		return err
+	}
+	c.file = nil
+	if err := conf.Unmarshal(b, &c.file); err != nil {
+		return err
+	}
+
+	c.fileStreamsDir = c.StreamsDir
+	if c.StreamsDir == "" {
+		c.StreamsDir = c.ConfigDir + sep + "streams"
+	}
+	if c.outputDir != "" {
+		c.StreamsDir = c.outputDir
+	}
 	return nil
 }
 
@@ -1,9 +1,14 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,18 +17,21 @@ func TestMakeDefaultConfStruct(t *testing.T) {
 	c.MakeDefaultConfStruct()
 	want := &Config{
 		Title:      "Rekoda configuration file",
-		Version:    1,
-		StreamsDir: "streams",
+		Version:    CurrentVersion,
+		ConfigDir:  c.ConfigDir,
+		ConfigFile: c.ConfigFile,
+		StreamsDir: c.StreamsDir,
+		LogFormat:  c.LogFormat,
 		Channels: []Channels{
 			{
 				Enabled: false,
-				User:    "reckful",
+				User:    "test",
 				ID:      999999999999,
 				Quality: "best",
 			},
 		},
 	}
-	if !cmp.Equal(c, want) {
+	if !cmp.Equal(c, want, cmpopts.IgnoreUnexported(Config{})) {
 		t.Errorf("got: '%v'\n wanted: '%v'", c, want)
 	}
 
@@ -36,6 +44,22 @@ func TestInitConfig(t *testing.T) {
 	assert.Equal(t, want, c.Title)
 }
 
+func TestInitConfigKeepsStdout(t *testing.T) {
+	// Commands print config values, exported channels and JSON to stdout, log must not get in between
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	assert.NoError(t, err)
+	defer func(stdout *os.File) { os.Stdout = stdout }(os.Stdout)
+	os.Stdout = out
+	log.WithField("general", "INIT").Info("Before config is read")
+	InitConfig()
+	log.WithField("general", "CLI").Info("After config is read")
+	os.Stdout.Close()
+
+	b, err := os.ReadFile(out.Name())
+	assert.NoError(t, err)
+	assert.Empty(t, string(b))
+}
+
 func TestSave(t *testing.T) {
 	c := InitConfig()
 	err := c.Save()
@@ -60,3 +84,48 @@ func TestIsChannelInConfig(t *testing.T) {
 	c := InitConfig()
 	assert.Equal(t, !c.IsChannelInConfig("reckful"), true)
 }
+
+func TestUpdate(t *testing.T) {
+	c := InitConfig()
+	other := InitConfig()
+
+	assert.NoError(t, other.Update(func(c *Config) error {
+		c.Channels = append(c.Channels, Channels{User: "rwxrob", Quality: "best"})
+		return nil
+	}))
+
+	// Stale copy must not overwrite changes made in between
+	assert.ErrorIs(t, c.Save(), ErrConflict)
+
+	assert.NoError(t, c.Update(func(c *Config) error {
+		assert.True(t, c.IsChannelInConfig("rwxrob"))
+		c.Channels = removeChannel(c.Channels, "rwxrob")
+		return nil
+	}))
+	assert.False(t, InitConfig().IsChannelInConfig("rwxrob"))
+}
+
+func TestHasSecrets(t *testing.T) {
+	type proxy struct {
+		URL      string `toml:"url"`
+		Password string `toml:"password" secret:"true"`
+	}
+	type settings struct {
+		Proxies []proxy `toml:"proxies"`
+		Token   *string `toml:"token" secret:"true"`
+	}
+
+	assert.False(t, hasSecrets(reflect.ValueOf(&settings{Proxies: []proxy{{URL: "http://proxy:3128"}}})))
+	assert.True(t, hasSecrets(reflect.ValueOf(&settings{Proxies: []proxy{{Password: "hunter2"}}})))
+	token := "oauth"
+	assert.True(t, hasSecrets(reflect.ValueOf(settings{Token: &token})))
+}
+
+func removeChannel(s []Channels, user string) []Channels {
+	for i, v := range s {
+		if v.User == user {
+			return append(s[:i], s[i+1:]...)
+		}
+	}
+	return s
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"strconv"
+
+	"github.com/wmw64/rekoda/internal/twitch"
+)
+
+// Sources of effective values
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Setting is effective value of global key and where it comes from
+type Setting struct {
+	Field
+	Source  string
+	Runtime bool // Set by flag or env only, never kept in config file
+}
+
+// Effective lists every global key with its effective value, keys of config file first.
+// Channels are left out, see 'rekoda channel show'
+func (c *Config) Effective() []Setting {
+	stated := c.fileKeys()
+	builtin := c.builtin()
+	own, defaults := Fields(c), Fields(&builtin)
+
+	var settings []Setting
+	for _, key := range Keys(&Config{}) {
+		switch f, ok := findField(own, key); {
+		case key == "streams_dir" && c.outputDir != "":
+			settings = append(settings, Setting{Field: Field{Key: key, Value: formatString(c.StreamsDir)}, Source: c.outputFrom})
+		case ok && stated[key] && !(f.Value == "''" && hasDefault(defaults, key)): // Empty strings mean defaults
+			settings = append(settings, Setting{Field: f, Source: SourceFile})
+		default:
+			if f, ok := findField(defaults, key); ok {
+				settings = append(settings, Setting{Field: f, Source: SourceDefault})
+			}
+		}
+	}
+	return append(settings, c.runtime()...)
+}
+
+// fileKeys returns keys stated in config file, dotted for nested tables
+func (c *Config) fileKeys() map[string]bool {
+	var fields []Field
+	flatten(c.file, "", &fields)
+	keys := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		keys[f.Key] = true
+	}
+	return keys
+}
+
+// builtin returns config used for keys config file doesn't state
+func (c *Config) builtin() Config {
+	workers, rate, jitter := Scheduler{}.Get()
+	threshold, cooldown, maxCooldown := CircuitBreaker{}.Get()
+	return Config{
+		Title:      defaultTitle,
+		Version:    CurrentVersion,
+		StreamsDir: c.ConfigDir + sep + "streams",
+		Scheduler:  Scheduler{Workers: &workers, Rate: &rate, Jitter: &jitter},
+		Breaker:    CircuitBreaker{Threshold: &threshold, Cooldown: D(cooldown), MaxCooldown: D(maxCooldown)},
+		Twitch:     Twitch{GQLEndpoint: twitch.DefaultGQLEndpoint, ClientID: twitch.DefaultClientID, HelixEndpoint: twitch.DefaultHelixEndpoint},
+		Defaults:   c.BaseSettings(),
+	}
+}
+
+// runtime lists keys set by flags and env only
+func (c *Config) runtime() []Setting {
+	source := func(flag, env string) string {
+		switch {
+		case flag != "":
+			return SourceFlag
+		case env != "":
+			return SourceEnv
+		}
+		return SourceDefault
+	}
+	level := EnvLogLevel
+	if FlagLogLevel != "" {
+		level = FlagLogLevel
+	}
+	if level == "" {
+		level = "info"
+	}
+	sessionFlag := ""
+	if FlagSessionLog {
+		sessionFlag = "true"
+	}
+
+	settings := []Setting{
+		{Field: Field{Key: "config_file", Value: formatString(c.ConfigFile)}, Source: source(FlagConfigFile, EnvConfigFile)},
+		{Field: Field{Key: "log_level", Value: formatString(level)}, Source: source(FlagLogLevel, EnvLogLevel)},
+		{Field: Field{Key: "log_format", Value: formatString(c.LogFormat)}, Source: source(FlagLogFormat, EnvLogFormat)},
+		{Field: Field{Key: "log_file", Value: formatString(firstSet(FlagLogFile, EnvLogFile))}, Source: source(FlagLogFile, EnvLogFile)},
+		{Field: Field{Key: "session_log", Value: strconv.FormatBool(c.SessionLog)}, Source: source(sessionFlag, EnvSessionLog)},
+		{Field: Field{Key: "pid_file", Value: formatString(c.PidFile)}, Source: source(FlagPidFile, EnvPidFile)},
+	}
+	for i := range settings {
+		settings[i].Runtime = true
+	}
+	return settings
+}
+
+func firstSet(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func hasDefault(defaults []Field, key string) bool {
+	f, ok := findField(defaults, key)
+	return ok && f.Value != "''"
+}
+
+func findField(fields []Field, key string) (Field, bool) {
+	for _, f := range fields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamsDirOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rekoda.toml")
+	assert.NoError(t, os.WriteFile(path, []byte(configWithOverrides), 0644))
+
+	c := &Config{ConfigFile: path, outputDir: "/mnt/flag", outputFrom: SourceFlag}
+	assert.NoError(t, c.Load())
+	assert.Equal(t, "/mnt/flag", c.StreamsDir, "flag wins over file")
+
+	settings := c.Effective()
+	assert.Contains(t, settings, Setting{Field: Field{Key: "streams_dir", Value: "'/mnt/flag'"}, Source: SourceFlag})
+	assert.Contains(t, settings, Setting{Field: Field{Key: "defaults.poll_interval", Value: "'2m'"}, Source: SourceFile})
+	assert.Contains(t, settings, Setting{Field: Field{Key: "defaults.restart_interval", Value: "'30s'"}, Source: SourceDefault})
+	assert.Contains(t, settings, Setting{Field: Field{Key: "scheduler.workers", Value: "8"}, Source: SourceDefault})
+
+	// Flag is not written to file
+	assert.NoError(t, c.Update(func(c *Config) error { return nil }))
+	assert.NoError(t, c.Load())
+	assert.Equal(t, "/srv/streams", c.fileStreamsDir)
+}
+
+func TestProblems(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.parse([]byte(configWithOverrides)))
+	assert.Empty(t, c.Problems())
+
+	assert.NoError(t, c.parse([]byte(`colour = 'red'
+[scheduler]
+  workers = 0
+[defaults]
+  ads = 'block'
+[[channels]]
+  user = 'rwxrob'
+  quality = '1080p'
+  qualty = 'best'
+[[channels]]
+  user = 'RWXROB'
+  quality = 'best'
+`)))
+	assert.Equal(t, []string{
+		"unknown key 'colour'",
+		"scheduler.workers must be at least 1",
+		"defaults.ads 'block' must be one of keep, skip, separate",
+		"channel 'rwxrob': unknown key 'qualty'",
+		"channel 'rwxrob': quality '1080p' must be one of best, worst, audio_only",
+		"channel 'RWXROB' is listed more than once",
+	}, c.Problems())
+}
+
+func TestDirProblems(t *testing.T) {
+	dir := t.TempDir()
+	c := &Config{StreamsDir: filepath.Join(dir, "streams", "not", "yet", "created")}
+	assert.Empty(t, c.DirProblems())
+
+	file := filepath.Join(dir, "file")
+	assert.NoError(t, os.WriteFile(file, nil, 0644))
+	c.StreamsDir = file
+	assert.Len(t, c.DirProblems(), 1)
+}
@@ -0,0 +1,298 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Field is key of config file with its value, keys of nested tables are dotted, e.g. segment_retry.attempts
+type Field struct {
+	Key    string
+	Value  string // TOML formatted, e.g. 'best', 2 or ['a', 'b']
+	Secret bool
+}
+
+// Text returns value as SetField takes it, e.g. a,b for ['a', 'b'] and it's for "it's"
+func (f Field) Text() string {
+	return fieldText(f.Value)
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// isTable reports whether type is nested table rather than a value, Duration is a value
+func isTable(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(textUnmarshaler)
+}
+
+// isEmbedded reports whether struct field is embedded table whose keys belong to the outer one, e.g. Settings of Channels
+func isEmbedded(f reflect.StructField) bool {
+	return f.Anonymous && f.Tag.Get("toml") == "" && isTable(f.Type)
+}
+
+// tomlKey returns key of struct field, empty for fields not in config file
+func tomlKey(f reflect.StructField) string {
+	key := strings.Split(f.Tag.Get("toml"), ",")[0]
+	if key == "-" || f.PkgPath != "" {
+		return ""
+	}
+	return key
+}
+
+// Fields flattens struct pointed to by v into keys which are set, nil pointers are left out
+func Fields(v interface{}) []Field {
+	var fields []Field
+	collectFields(reflect.ValueOf(v).Elem(), "", false, &fields)
+	return fields
+}
+
+func collectFields(v reflect.Value, prefix string, secret bool, fields *[]Field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if isEmbedded(t.Field(i)) {
+			collectFields(v.Field(i), prefix, secret, fields)
+			continue
+		}
+		key := tomlKey(t.Field(i))
+		if key == "" {
+			continue
+		}
+		fv := v.Field(i)
+		isSecret := secret || t.Field(i).Tag.Get("secret") == "true"
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		switch {
+		case isTable(fv.Type()):
+			collectFields(fv, prefix+key+".", isSecret, fields)
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Struct, fv.Kind() == reflect.Map:
+			continue // Arrays of tables, e.g. [[channels]], have keys of their own
+		default:
+			*fields = append(*fields, Field{Key: prefix + key, Value: formatValue(fv), Secret: isSecret})
+		}
+	}
+}
+
+// formatValue formats value the way it's written in TOML
+func formatValue(v reflect.Value) string {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, _ := m.MarshalText()
+		return formatString(string(b))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return formatString(v.String())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatValue(v.Index(i))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// formatString writes s as TOML literal string, or as basic string with escapes when it holds quote or control characters
+func formatString(s string) string {
+	literal := !strings.Contains(s, "'")
+	for _, r := range s {
+		if r < 0x20 && r != '\t' || r == 0x7f {
+			literal = false
+		}
+	}
+	if literal {
+		return "'" + s + "'"
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"', r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// Keys lists every key of struct pointed to by v, sorted
+func Keys(v interface{}) []string {
+	var keys []string
+	collectKeys(reflect.TypeOf(v).Elem(), "", &keys)
+	sort.Strings(keys)
+	return keys
+}
+
+func collectKeys(t reflect.Type, prefix string, keys *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		if isEmbedded(t.Field(i)) {
+			collectKeys(t.Field(i).Type, prefix, keys)
+			continue
+		}
+		key := tomlKey(t.Field(i))
+		if key == "" {
+			continue
+		}
+		ft := t.Field(i).Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		switch {
+		case isTable(ft):
+			collectKeys(ft, prefix+key+".", keys)
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct, ft.Kind() == reflect.Map:
+		default:
+			*keys = append(*keys, prefix+key)
+		}
+	}
+}
+
+// GetField returns value of key in struct pointed to by v, ok is false when it's not set
+func GetField(v interface{}, key string) (value string, ok bool, err error) {
+	for _, f := range Fields(v) {
+		if f.Key == key {
+			return f.Value, true, nil
+		}
+	}
+	for _, k := range Keys(v) {
+		if k == key {
+			return "", false, nil
+		}
+	}
+	return "", false, fmt.Errorf("unknown key '%v'", key)
+}
+
+// SetField sets key of struct pointed to by v from text, creating nested tables on the way.
+// Lists are comma separated, '[]' is an empty list. Empty text unsets optional key
+func SetField(v interface{}, key, text string) error {
+	target := reflect.ValueOf(v).Elem()
+	parts := strings.Split(key, ".")
+	for n, part := range parts {
+		fv, ok := fieldByKey(target, part)
+		if !ok {
+			break
+		}
+		ft := fv.Type()
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		last := n == len(parts)-1
+		if isTable(ft) == last { // Tables need a key inside, values can't have one
+			break
+		}
+		if last {
+			if err := setValue(fv, text); err != nil {
+				return fmt.Errorf("%v: %w", key, err)
+			}
+			return nil
+		}
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				fv.Set(reflect.New(ft))
+			}
+			fv = fv.Elem()
+		}
+		target = fv
+	}
+	return fmt.Errorf("unknown key '%v'", key)
+}
+
+// fieldByKey returns field of struct with TOML key
+func fieldByKey(v reflect.Value, key string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if isEmbedded(v.Type().Field(i)) {
+			if fv, ok := fieldByKey(v.Field(i), key); ok {
+				return fv, true
+			}
+			continue
+		}
+		if tomlKey(v.Type().Field(i)) == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setValue parses text into field, pointer fields are set to nil by empty text
+func setValue(fv reflect.Value, text string) error {
+	text = strings.TrimSpace(text)
+	if fv.Kind() == reflect.Ptr {
+		if text == "" {
+			fv.Set(reflect.Zero(fv.Type()))
+			return nil
+		}
+		p := reflect.New(fv.Type().Elem())
+		if err := parseValue(p.Elem(), text); err != nil {
+			return err
+		}
+		fv.Set(p)
+		return nil
+	}
+	if text == "" && fv.Kind() != reflect.String && fv.Kind() != reflect.Slice {
+		return fmt.Errorf("value is required")
+	}
+	return parseValue(fv, text)
+}
+
+func parseValue(v reflect.Value, text string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(text))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("'%v' is not true or false", text)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return fmt.Errorf("'%v' is not a whole number", text)
+		}
+		v.SetInt(i)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("'%v' is not a number", text)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "["), "]")
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			e := reflect.New(v.Type().Elem()).Elem()
+			if err := parseValue(e, item); err != nil {
+				return err
+			}
+			list = reflect.Append(list, e)
+		}
+		v.Set(list)
+	default:
+		return fmt.Errorf("can't set %v", v.Type())
+	}
+	return nil
+}
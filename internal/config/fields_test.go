@@ -0,0 +1,56 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetField(t *testing.T) {
+	ch := Channels{User: "rwxrob", Enabled: true, Quality: "best"}
+	assert.NoError(t, SetField(&ch, "quality", "worst"))
+	assert.NoError(t, SetField(&ch, "enabled", "false"))
+	assert.NoError(t, SetField(&ch, "tags", "coding, linux"))
+	assert.NoError(t, SetField(&ch, "poll_interval", "30s"))
+	assert.NoError(t, SetField(&ch, "segment_retry.attempts", "6"))
+	assert.NoError(t, SetField(&ch, "proxy.urls", "socks5://seoul.example.com:1080"))
+
+	assert.Equal(t, "worst", ch.Quality)
+	assert.False(t, ch.Enabled)
+	assert.Equal(t, []string{"coding", "linux"}, *ch.Tags)
+	assert.Equal(t, 30*time.Second, ch.PollInterval.Duration)
+	assert.Equal(t, 6, *ch.SegmentRetry.Attempts)
+
+	v, ok, err := GetField(&ch, "proxy.urls")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "['socks5://seoul.example.com:1080']", v)
+
+	// Empty value unsets override
+	assert.NoError(t, SetField(&ch, "poll_interval", ""))
+	_, ok, err = GetField(&ch, "poll_interval")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.Error(t, SetField(&ch, "colour", "red"))
+	assert.Error(t, SetField(&ch, "segment_retry", "6"))
+	assert.Error(t, SetField(&ch, "segment_retry.attempts", "six"))
+	_, _, err = GetField(&ch, "colour")
+	assert.Error(t, err)
+	assert.Contains(t, Keys(&Settings{}), "proxy.username")
+}
+
+func TestValidateChannel(t *testing.T) {
+	ch := Channels{User: "rwxrob", Quality: "best"}
+	assert.NoError(t, ch.Validate())
+
+	ch.Quality = "1080p"
+	assert.NoError(t, SetField(&ch, "ads", "block"))
+	assert.NoError(t, SetField(&ch, "api_retry.attempts", "0"))
+	err := ch.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "quality '1080p'")
+	assert.Contains(t, err.Error(), "ads 'block'")
+	assert.Contains(t, err.Error(), "api_retry.attempts must be at least 1")
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	conf "github.com/wmw64/rekoda/pkg/config/toml"
+)
+
+// CurrentVersion is config schema version written by this build of rekoda.
+// Bump it together with adding migration from previous version to migrations
+const CurrentVersion = 3
+
+// migrations upgrade raw config file contents from version stated by key to the next one
+var migrations = map[int]func(raw map[string]interface{}) error{
+	1: migrateV1,
+	2: migrateV2,
+}
+
+// NewerVersionError is returned for config files written by newer rekoda
+type NewerVersionError struct {
+	Version int
+}
+
+func (e NewerVersionError) Error() string {
+	return fmt.Sprintf("config file version %v is newer than supported version %v, please upgrade rekoda", e.Version, CurrentVersion)
+}
+
+// migrateV1 drops 'config_dir' and 'config_file' which are always derived at runtime
+// and went stale once file was moved, and fills missing channel quality with default one
+func migrateV1(raw map[string]interface{}) error {
+	delete(raw, "config_dir")
+	delete(raw, "config_file")
+
+	channels, _ := raw["channels"].([]interface{})
+	for i, v := range channels {
+		ch, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("channel #%v is not a table", i+1)
+		}
+		if q, _ := ch["quality"].(string); q == "" {
+			ch["quality"] = "best"
+		}
+	}
+	return nil
+}
+
+// migrateV2 splits single 'retry' table of [defaults] and channels into separate 'playlist_retry',
+// 'segment_retry' and 'api_retry' policies, 'delay' becomes their 'base_delay'
+func migrateV2(raw map[string]interface{}) error {
+	split := func(table map[string]interface{}) {
+		old, ok := table["retry"].(map[string]interface{})
+		if !ok {
+			return
+		}
+		delete(table, "retry")
+		for _, key := range []string{"playlist_retry", "segment_retry", "api_retry"} {
+			p := make(map[string]interface{})
+			if v, ok := old["attempts"]; ok {
+				p["attempts"] = v
+			}
+			if v, ok := old["delay"]; ok {
+				p["base_delay"] = v
+			}
+			table[key] = p
+		}
+	}
+
+	if defaults, ok := raw["defaults"].(map[string]interface{}); ok {
+		split(defaults)
+	}
+	channels, _ := raw["channels"].([]interface{})
+	for i, v := range channels {
+		ch, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("channel #%v is not a table", i+1)
+		}
+		split(ch)
+	}
+	return nil
+}
+
+// Migrate upgrades config file contents to CurrentVersion.
+// Returns contents re-encoded in current schema and version file was written with
+func Migrate(b []byte) ([]byte, int, error) {
+	raw := make(map[string]interface{})
+	if err := conf.Unmarshal(b, &raw); err != nil {
+		return nil, 0, err
+	}
+
+	// Files written before versioning were never anything but version 1
+	from := 1
+	if v, ok := raw["version"]; ok {
+		n, ok := v.(int64)
+		if !ok || n < 1 {
+			return nil, 0, fmt.Errorf("invalid config version '%v'", v)
+		}
+		from = int(n)
+	}
+	if from > CurrentVersion {
+		return nil, from, NewerVersionError{from}
+	}
+	if from == CurrentVersion {
+		return b, from, nil
+	}
+
+	for v := from; v < CurrentVersion; v++ {
+		migrate, ok := migrations[v]
+		if !ok {
+			return nil, from, fmt.Errorf("no migration from config version %v", v)
+		}
+		if err := migrate(raw); err != nil {
+			return nil, from, fmt.Errorf("migrating config from version %v: %w", v, err)
+		}
+	}
+	raw["version"] = CurrentVersion
+
+	// Round trip through Config struct so migrated file looks exactly like the one rekoda saves
+	tmp, err := conf.Marshal(raw)
+	if err != nil {
+		return nil, from, err
+	}
+	c := &Config{}
+	unknown, err := conf.UnknownKeys(tmp, c)
+	if err != nil {
+		return nil, from, err
+	}
+	if len(unknown) > 0 {
+		return nil, from, fmt.Errorf("config keys %v are unknown and would be lost by migration, fix or remove them first", strings.Join(unknown, ", "))
+	}
+	out, err := conf.Marshal(c)
+	if err != nil {
+		return nil, from, err
+	}
+	return out, from, nil
+}
+
+// MigrateFile upgrades config file in place keeping a timestamped backup of the original next to it.
+// With dryRun nothing is written. Returns migrated contents, original version and backup path if one was made
+func MigrateFile(path string, dryRun bool) ([]byte, int, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	out, from, err := Migrate(b)
+	if err != nil || from == CurrentVersion || dryRun {
+		return out, from, "", err
+	}
+
+	backup := fmt.Sprintf("%v.v%v-%v.bak", path, from, time.Now().Format("20060102-150405"))
+	if err := conf.WriteFile(backup, b, 0600); err != nil {
+		return nil, from, "", fmt.Errorf("failed to backup config: %w", err)
+	}
+	if err := conf.WriteFile(path, out, info.Mode().Perm()); err != nil {
+		return nil, from, backup, err
+	}
+	return out, from, backup, nil
+}
+
+func (c *Config) unmarshal(b []byte) error {
+	return conf.Unmarshal(b, c)
+}
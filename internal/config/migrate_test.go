@@ -0,0 +1,125 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const configV1 = `title = 'Rekoda configuration file'
+version = 1
+config_dir = '/home/wmw/rekoda'
+config_file = '/home/wmw/rekoda/rekoda.toml'
+streams_dir = '/srv/streams'
+
+[[channels]]
+  enabled = true
+  user = 'rwxrob'
+  id = 123
+
+[[channels]]
+  enabled = false
+  user = 'sodapoppin'
+  id = 123
+  quality = 'worst'
+`
+
+func TestMigrate(t *testing.T) {
+	out, from, err := Migrate([]byte(configV1))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, from)
+	assert.NotContains(t, string(out), "config_dir")
+	assert.NotContains(t, string(out), "config_file")
+
+	c := &Config{}
+	assert.NoError(t, c.unmarshal(out))
+	assert.Equal(t, CurrentVersion, c.Version)
+	assert.Equal(t, "/srv/streams", c.StreamsDir)
+	assert.Equal(t, "best", c.Channels[0].Quality)
+	assert.Equal(t, "worst", c.Channels[1].Quality)
+
+	// Current version is left untouched
+	again, from, err := Migrate(out)
+	assert.NoError(t, err)
+	assert.Equal(t, CurrentVersion, from)
+	assert.Equal(t, out, again)
+}
+
+func TestMigrateV2Retry(t *testing.T) {
+	const configV2 = `version = 2
+
+[defaults]
+  [defaults.retry]
+    attempts = 6
+    delay = '2s'
+
+[[channels]]
+  enabled = true
+  user = 'rwxrob'
+  quality = 'best'
+  [channels.retry]
+    attempts = 2
+`
+	out, from, err := Migrate([]byte(configV2))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, from)
+
+	c := &Config{}
+	assert.NoError(t, c.unmarshal(out))
+	assert.NotContains(t, string(out), "[defaults.retry]")
+	for _, p := range []*RetryPolicy{c.Defaults.PlaylistRetry, c.Defaults.SegmentRetry, c.Defaults.APIRetry} {
+		assert.Equal(t, 6, *p.Attempts)
+		assert.Equal(t, 2*time.Second, p.BaseDelay.Duration)
+	}
+	assert.Equal(t, 2, *c.Channels[0].SegmentRetry.Attempts)
+	assert.Nil(t, c.Channels[0].SegmentRetry.BaseDelay)
+
+	st := c.Settings(c.Channels[0])
+	assert.Equal(t, 2, st.Retry.Playlist.Attempts)
+	assert.Equal(t, 2*time.Second, st.Retry.Playlist.BaseDelay)
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	_, from, err := Migrate([]byte("version = 99\n"))
+	assert.ErrorAs(t, err, &NewerVersionError{})
+	assert.Equal(t, 99, from)
+}
+
+func TestMigrateFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rekoda.toml")
+	assert.NoError(t, os.WriteFile(path, []byte(configV1), 0644))
+
+	_, from, backup, err := MigrateFile(path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, from)
+	assert.Empty(t, backup)
+	b, _ := os.ReadFile(path)
+	assert.Equal(t, configV1, string(b), "dry run must not write")
+
+	out, _, backup, err := MigrateFile(path, false)
+	assert.NoError(t, err)
+	b, _ = os.ReadFile(backup)
+	assert.Equal(t, configV1, string(b))
+	b, _ = os.ReadFile(path)
+	assert.Equal(t, string(out), string(b))
+}
+
+func TestMigrateUnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rekoda.toml")
+	typo := strings.Replace(configV1, "[[channels]]", "[[channels]]\n    qualty = 'best'", 1)
+	assert.NoError(t, os.WriteFile(path, []byte(typo), 0644))
+
+	_, _, backup, err := MigrateFile(path, false)
+	assert.ErrorContains(t, err, "channels.qualty")
+	assert.Empty(t, backup)
+	b, _ := os.ReadFile(path)
+	assert.Equal(t, typo, string(b), "file with unknown keys must be left as is")
+	matches, _ := filepath.Glob(path + ".*.bak")
+	assert.Empty(t, matches)
+}
@@ -0,0 +1,393 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wmw64/rekoda/pkg/retry"
+)
+
+// Duration is time.Duration written in config file as human readable string, e.g. '10m' or '30s'
+type Duration struct {
+	time.Duration
+}
+
+// D makes Duration pointer, handy for optional settings
+func D(d time.Duration) *Duration {
+	return &Duration{d}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (d Duration) MarshalText() ([]byte, error) {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return fmt.Errorf("duration '%v' must not be negative", string(b))
+	}
+	d.Duration = v
+	return nil
+}
+
+// RetryPolicy is how failed requests are repeated, all keys are optional. See retry.Policy
+type RetryPolicy struct {
+	Attempts  *int      `toml:"attempts"`
+	BaseDelay *Duration `toml:"base_delay"` // Upper bound of random delay after first failure, doubled after every next one
+	MaxDelay  *Duration `toml:"max_delay"`
+	Budget    *Duration `toml:"budget"`   // Total time all attempts may take
+	RetryOn   *[]int    `toml:"retry_on"` // Response status codes worth retrying, transport errors always are
+}
+
+// apply overrides policy with keys stated
+func (r *RetryPolicy) apply(p *retry.Policy) {
+	if r == nil {
+		return
+	}
+	if r.Attempts != nil && *r.Attempts > 0 {
+		p.Attempts = *r.Attempts
+	}
+	if r.BaseDelay != nil {
+		p.BaseDelay = r.BaseDelay.Duration
+	}
+	if r.MaxDelay != nil {
+		p.MaxDelay = r.MaxDelay.Duration
+	}
+	if r.Budget != nil {
+		p.Budget = r.Budget.Duration
+	}
+	if r.RetryOn != nil {
+		p.RetryOn = append([]int(nil), *r.RetryOn...)
+	}
+}
+
+// Proxy is where channel's requests go out through, all keys are optional.
+// Without any proxy set, HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are used
+type Proxy struct {
+	URLs     *[]string `toml:"urls"`     // http://, https://, socks5:// or socks5h:// proxies, several are used round-robin. Empty list means direct
+	NoProxy  *[]string `toml:"no_proxy"` // Hosts, domains with their subdomains, IPs and CIDRs going direct
+	Username *string   `toml:"username"` // Credentials of proxies without their own
+	Password *string   `toml:"password" secret:"true"`
+}
+
+// ProxySettings are effective proxy settings, Set is false when neither channel nor [defaults] states proxies
+type ProxySettings struct {
+	Set      bool
+	URLs     []string
+	NoProxy  []string
+	Username string
+	Password string
+}
+
+// Key identifies proxy settings, channels with equal ones share HTTP client
+func (p ProxySettings) Key() string {
+	if !p.Set {
+		return "env"
+	}
+	return strings.Join([]string{strings.Join(p.URLs, ","), strings.Join(p.NoProxy, ","), p.Username, p.Password}, "|")
+}
+
+// apply overrides settings with keys stated
+func (p *Proxy) apply(s *ProxySettings) {
+	if p == nil {
+		return
+	}
+	if p.URLs != nil {
+		s.Set = true
+		s.URLs = append([]string(nil), *p.URLs...)
+	}
+	if p.NoProxy != nil {
+		s.NoProxy = append([]string(nil), *p.NoProxy...)
+	}
+	if p.Username != nil {
+		s.Username = *p.Username
+	}
+	if p.Password != nil {
+		s.Password = *p.Password
+	}
+}
+
+// RetryPolicies are effective retry policies
+type RetryPolicies struct {
+	Playlist retry.Policy
+	Segment  retry.Policy
+	API      retry.Policy
+}
+
+// Settings are recording settings every channel may override, all keys are optional.
+// Precedence: [[channels]] entry, then [defaults] section, then DefaultSettings
+type Settings struct {
+	RestartWindow   *Duration    `toml:"restart_window"`   // How long to wait for stream to come back before closing file
+	RestartInterval *Duration    `toml:"restart_interval"` // How often to check if stream came back
+	PollInterval    *Duration    `toml:"poll_interval"`    // How often to check if channel went online
+	LearnSchedule   *bool        `toml:"learn_schedule"`   // Poll between min and max interval depending on when channel usually goes live
+	MinPollInterval *Duration    `toml:"min_poll_interval"`
+	MaxPollInterval *Duration    `toml:"max_poll_interval"`
+	StreamsDir      *string      `toml:"streams_dir"`   // Channel directory is created inside
+	FileTemplate    *string      `toml:"file_template"` // Placeholders: {user} {quality} {date} {time}
+	PostProcess     *string      `toml:"post_process"`  // Command run once file is closed. Placeholders: {file} {dir} {name} {user}
+	PlaylistRetry   *RetryPolicy `toml:"playlist_retry"`
+	SegmentRetry    *RetryPolicy `toml:"segment_retry"`
+	APIRetry        *RetryPolicy `toml:"api_retry"` // Status lookups and EventSub, only [defaults] one is used
+	Proxy           *Proxy       `toml:"proxy"`
+	Token           *string      `toml:"token"`        // Name of OAuth token in tokens file playback is authenticated with, empty for anonymous
+	Ads             *string      `toml:"ads"`          // What to do with ad segments twitch stitches into stream: keep, skip or separate
+	Merge           *bool        `toml:"merge"`        // Merge recordings of one broadcast split by stream going down once it's over
+	MergeWindow     *Duration    `toml:"merge_window"` // Longest break between recordings of one broadcast
+}
+
+// ChannelSettings are effective settings of a channel
+type ChannelSettings struct {
+	RestartWindow   time.Duration
+	RestartInterval time.Duration
+	PollInterval    time.Duration
+	PollIntervalSet bool // poll_interval is stated by channel or [defaults], learned interval never exceeds it
+	LearnSchedule   bool
+	MinPollInterval time.Duration
+	MaxPollInterval time.Duration
+	StreamsDir      string
+	FileTemplate    string
+	PostProcess     string
+	Retry           RetryPolicies
+	Proxy           ProxySettings
+	Token           string
+	Ads             string
+	Merge           bool
+	MergeWindow     time.Duration
+}
+
+// Ad handling modes, see Settings.Ads
+const (
+	AdsKeep     = "keep"     // Write ads into recording like any other segment
+	AdsSkip     = "skip"     // Don't download ads at all
+	AdsSeparate = "separate" // Write ads into their own file next to recording
+)
+
+// DefaultSettings are used for anything neither channel nor [defaults] section states
+var DefaultSettings = ChannelSettings{
+	RestartWindow:   10 * time.Minute,
+	RestartInterval: 30 * time.Second,
+	PollInterval:    1 * time.Minute,
+	LearnSchedule:   true,
+	MinPollInterval: 30 * time.Second,
+	MaxPollInterval: 5 * time.Minute,
+	FileTemplate:    "{user}_{date}_{time}.ts",
+	Ads:             AdsKeep,
+	MergeWindow:     30 * time.Minute,
+	Retry: RetryPolicies{
+		Playlist: retry.Policy{Attempts: 4, BaseDelay: 1 * time.Second, MaxDelay: 10 * time.Second, Budget: 30 * time.Second, RetryOn: retry.DefaultRetryOn},
+		Segment:  retry.Policy{Attempts: 4, BaseDelay: 500 * time.Millisecond, MaxDelay: 5 * time.Second, Budget: 20 * time.Second, RetryOn: retry.DefaultRetryOn},
+		API:      retry.Policy{Attempts: 3, BaseDelay: 1 * time.Second, MaxDelay: 10 * time.Second, Budget: 30 * time.Second, RetryOn: retry.DefaultRetryOn},
+	},
+}
+
+// BaseSettings returns settings used for anything [defaults] doesn't state: DefaultSettings and streams directory
+func (c *Config) BaseSettings() Settings {
+	d := DefaultSettings
+	streamsDir := c.StreamsDir
+	policy := func(p retry.Policy) *RetryPolicy {
+		retryOn := append([]int(nil), p.RetryOn...)
+		return &RetryPolicy{Attempts: &p.Attempts, BaseDelay: D(p.BaseDelay), MaxDelay: D(p.MaxDelay), Budget: D(p.Budget), RetryOn: &retryOn}
+	}
+	return Settings{
+		RestartWindow:   D(d.RestartWindow),
+		RestartInterval: D(d.RestartInterval),
+		PollInterval:    D(d.PollInterval),
+		LearnSchedule:   &d.LearnSchedule,
+		MinPollInterval: D(d.MinPollInterval),
+		MaxPollInterval: D(d.MaxPollInterval),
+		StreamsDir:      &streamsDir,
+		FileTemplate:    &d.FileTemplate,
+		PostProcess:     &d.PostProcess,
+		PlaylistRetry:   policy(d.Retry.Playlist),
+		SegmentRetry:    policy(d.Retry.Segment),
+		APIRetry:        policy(d.Retry.API),
+		Token:           &d.Token,
+		Ads:             &d.Ads,
+		Merge:           &d.Merge,
+		MergeWindow:     D(d.MergeWindow),
+	}
+}
+
+// Settings resolves effective settings of channel
+func (c *Config) Settings(ch Channels) ChannelSettings {
+	s := DefaultSettings
+	s.StreamsDir = c.StreamsDir
+	for _, o := range []Settings{c.Defaults, ch.Settings} {
+		if o.RestartWindow != nil {
+			s.RestartWindow = o.RestartWindow.Duration
+		}
+		if o.RestartInterval != nil && o.RestartInterval.Duration > 0 {
+			s.RestartInterval = o.RestartInterval.Duration
+		}
+		if o.PollInterval != nil && o.PollInterval.Duration > 0 {
+			s.PollInterval = o.PollInterval.Duration
+			s.PollIntervalSet = true
+		}
+		if o.LearnSchedule != nil {
+			s.LearnSchedule = *o.LearnSchedule
+		}
+		if o.MinPollInterval != nil && o.MinPollInterval.Duration > 0 {
+			s.MinPollInterval = o.MinPollInterval.Duration
+		}
+		if o.MaxPollInterval != nil && o.MaxPollInterval.Duration > 0 {
+			s.MaxPollInterval = o.MaxPollInterval.Duration
+		}
+		if o.StreamsDir != nil && *o.StreamsDir != "" {
+			s.StreamsDir = *o.StreamsDir
+		}
+		if o.FileTemplate != nil && *o.FileTemplate != "" {
+			s.FileTemplate = *o.FileTemplate
+		}
+		if o.PostProcess != nil {
+			s.PostProcess = *o.PostProcess
+		}
+		o.PlaylistRetry.apply(&s.Retry.Playlist)
+		o.SegmentRetry.apply(&s.Retry.Segment)
+		o.APIRetry.apply(&s.Retry.API)
+		o.Proxy.apply(&s.Proxy)
+		if o.Token != nil {
+			s.Token = *o.Token
+		}
+		if o.Ads != nil && ValidAds(*o.Ads) {
+			s.Ads = *o.Ads
+		}
+		if o.Merge != nil {
+			s.Merge = *o.Merge
+		}
+		if o.MergeWindow != nil && o.MergeWindow.Duration > 0 {
+			s.MergeWindow = o.MergeWindow.Duration
+		}
+	}
+	return s
+}
+
+// ValidAds reports whether mode is one of ad handling modes
+func ValidAds(mode string) bool {
+	return mode == AdsKeep || mode == AdsSkip || mode == AdsSeparate
+}
+
+// SocketFile is unix socket running recorder answers 'rekoda status' on, inside dir only owner may enter
+func (c *Config) SocketFile() string {
+	return filepath.Join(filepath.Dir(c.ConfigFile), "run", "rekoda.sock")
+}
+
+// LibraryFile is catalog of every recording, see 'rekoda library'
+func (c *Config) LibraryFile() string {
+	return filepath.Join(filepath.Dir(c.ConfigFile), "library.json")
+}
+
+// StreamsDirs lists streams dirs of [defaults] and every channel, where recordings are looked for
+func (c *Config) StreamsDirs() []string {
+	dirs := []string{c.Settings(Channels{}).StreamsDir}
+	seen := map[string]bool{dirs[0]: true}
+	for _, ch := range c.Channels {
+		if dir := c.Settings(ch).StreamsDir; !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// HistoryDir is where observed online and offline times of channels are kept
+func (c *Config) HistoryDir() string {
+	return filepath.Join(filepath.Dir(c.ConfigFile), "history")
+}
+
+// FileName renders file template for recording started at t
+func (s ChannelSettings) FileName(ch Channels, t time.Time) string {
+	return strings.NewReplacer(
+		"{user}", ch.User,
+		"{quality}", ch.Quality,
+		"{date}", t.Format("2006-01-02"),
+		"{time}", t.Format("15-04-05"),
+	).Replace(s.FileTemplate)
+}
+
+// PostProcessCommand splits post-processing command into arguments and fills placeholders for recorded file
+func (s ChannelSettings) PostProcessCommand(ch Channels, file string) []string {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	r := strings.NewReplacer("{file}", file, "{dir}", filepath.Dir(file), "{name}", name, "{user}", ch.User)
+
+	args := strings.Fields(s.PostProcess)
+	for i, v := range args {
+		args[i] = r.Replace(v)
+	}
+	return args
+}
+
+// Scheduler tunes how channels are checked for going online, all keys are optional
+type Scheduler struct {
+	Workers *int     `toml:"workers"` // Checks running at the same time
+	Rate    *float64 `toml:"rate"`    // Batches of checks started per second across all channels, each one is a single status request
+	Jitter  *float64 `toml:"jitter"`  // Fraction of poll interval every check is randomly moved by
+}
+
+// Get returns scheduler settings falling back to defaults: 8 workers, 2 batches per second, 10% jitter
+func (s Scheduler) Get() (workers int, rate, jitter float64) {
+	workers, rate, jitter = 8, 2, 0.1
+	if s.Workers != nil && *s.Workers > 0 {
+		workers = *s.Workers
+	}
+	if s.Rate != nil && *s.Rate > 0 {
+		rate = *s.Rate
+	}
+	if s.Jitter != nil && *s.Jitter >= 0 && *s.Jitter < 1 {
+		jitter = *s.Jitter
+	}
+	return workers, rate, jitter
+}
+
+// CircuitBreaker tunes per-host circuit breaker shared by all channels, all keys are optional
+type CircuitBreaker struct {
+	Threshold   *int      `toml:"threshold"`    // Failures in a row opening host's circuit, 0 disables breaker
+	Cooldown    *Duration `toml:"cooldown"`     // How long requests to failing host wait before one probe is let through
+	MaxCooldown *Duration `toml:"max_cooldown"` // Cooldown doubles after every failed probe up to this
+}
+
+// Get returns circuit breaker settings falling back to defaults: 5 failures, 15s cooldown growing up to 2m
+func (b CircuitBreaker) Get() (threshold int, cooldown, maxCooldown time.Duration) {
+	threshold, cooldown, maxCooldown = 5, 15*time.Second, 2*time.Minute
+	if b.Threshold != nil && *b.Threshold >= 0 {
+		threshold = *b.Threshold
+	}
+	if b.Cooldown != nil && b.Cooldown.Duration > 0 {
+		cooldown = b.Cooldown.Duration
+	}
+	if b.MaxCooldown != nil && b.MaxCooldown.Duration > 0 {
+		maxCooldown = b.MaxCooldown.Duration
+	}
+	return threshold, cooldown, maxCooldown
+}
+
+// Twitch is where channel status is looked up, empty keys mean defaults of twitch.tv website
+type Twitch struct {
+	GQLEndpoint   string `toml:"gql_endpoint"`
+	ClientID      string `toml:"client_id"`
+	HelixEndpoint string `toml:"helix_endpoint"` // Public API, 'channel import --followed' lists follows through it
+}
+
+// EventSub is webhook receiver notified by twitch the moment channels go live, polling stays as fallback.
+// It needs an application registered at dev.twitch.tv and public https callback URL forwarded to Listen
+type EventSub struct {
+	Listen       string `toml:"listen"`                      // Address receiver listens on, e.g. ':8080'. Empty disables EventSub
+	Callback     string `toml:"callback"`                    // Public https URL twitch sends notifications to
+	Secret       string `toml:"secret" secret:"true"`        // Signs notifications, generated on first start if empty
+	ClientID     string `toml:"client_id"`                   // Of registered application
+	ClientSecret string `toml:"client_secret" secret:"true"` // Of registered application
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	conf "github.com/wmw64/rekoda/pkg/config/toml"
+)
+
+const configWithOverrides = `title = 'Rekoda configuration file'
+version = 3
+streams_dir = '/srv/streams'
+
+[defaults]
+  restart_window = '20m'
+  poll_interval = '2m'
+  max_poll_interval = '10m'
+  post_process = 'ffmpeg -i {file} -c copy {dir}/{name}.mp4'
+  merge = true
+
+[[channels]]
+  enabled = true
+  user = 'rwxrob'
+  quality = 'best'
+  poll_interval = '10s'
+  learn_schedule = false
+  streams_dir = '/mnt/archive'
+  file_template = '{date}/{user}_{time}.ts'
+  ads = 'skip'
+  merge = false
+  merge_window = '1h'
+
+  [channels.segment_retry]
+    attempts = 2
+    base_delay = '500ms'
+    retry_on = [503]
+
+[[channels]]
+  enabled = true
+  user = 'sodapoppin'
+  quality = 'best'
+`
+
+func TestSettings(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.unmarshal([]byte(configWithOverrides)))
+
+	rwxrob := c.Settings(c.Channels[0])
+	assert.Equal(t, 20*time.Minute, rwxrob.RestartWindow)
+	assert.Equal(t, DefaultSettings.RestartInterval, rwxrob.RestartInterval)
+	assert.Equal(t, 10*time.Second, rwxrob.PollInterval)
+	assert.False(t, rwxrob.LearnSchedule)
+	assert.Equal(t, "/mnt/archive", rwxrob.StreamsDir)
+	assert.Equal(t, AdsSkip, rwxrob.Ads)
+	assert.False(t, rwxrob.Merge)
+	assert.Equal(t, time.Hour, rwxrob.MergeWindow)
+	assert.Equal(t, 2, rwxrob.Retry.Segment.Attempts)
+	assert.Equal(t, 500*time.Millisecond, rwxrob.Retry.Segment.BaseDelay)
+	assert.Equal(t, DefaultSettings.Retry.Segment.MaxDelay, rwxrob.Retry.Segment.MaxDelay)
+	assert.Equal(t, []int{503}, rwxrob.Retry.Segment.RetryOn)
+	assert.Equal(t, DefaultSettings.Retry.Playlist, rwxrob.Retry.Playlist)
+
+	soda := c.Settings(c.Channels[1])
+	assert.Equal(t, 2*time.Minute, soda.PollInterval)
+	assert.True(t, soda.LearnSchedule)
+	assert.Equal(t, DefaultSettings.MinPollInterval, soda.MinPollInterval)
+	assert.Equal(t, 10*time.Minute, soda.MaxPollInterval)
+	assert.Equal(t, "/srv/streams", soda.StreamsDir)
+	assert.Equal(t, DefaultSettings.FileTemplate, soda.FileTemplate)
+	assert.Equal(t, AdsKeep, soda.Ads)
+	assert.True(t, soda.Merge)
+	assert.Equal(t, DefaultSettings.MergeWindow, soda.MergeWindow)
+	assert.Equal(t, DefaultSettings.Retry, soda.Retry)
+}
+
+func TestSettingsRoundTrip(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.unmarshal([]byte(configWithOverrides)))
+	b, err := conf.Marshal(c)
+	assert.NoError(t, err)
+	// Unset overrides are not written, so they keep following [defaults]
+	assert.NotContains(t, string(b), "restart_interval")
+	// Overrides embedded in channel are keys of its own table
+	assert.Contains(t, string(b), "quality = 'best'\npoll_interval = '10s'\n")
+	assert.NotContains(t, string(b), "Settings")
+
+	again := &Config{}
+	assert.NoError(t, again.unmarshal(b))
+	for i := range c.Channels {
+		assert.Equal(t, c.Settings(c.Channels[i]), again.Settings(again.Channels[i]))
+	}
+}
+
+func TestFileName(t *testing.T) {
+	s := DefaultSettings
+	ch := Channels{User: "rwxrob", Quality: "best"}
+	now := time.Date(2021, 9, 8, 12, 57, 6, 0, time.UTC)
+	assert.Equal(t, "rwxrob_2021-09-08_12-57-06.ts", s.FileName(ch, now))
+
+	s.FileTemplate = "{date}/{user}_{quality}_{time}.ts"
+	assert.Equal(t, "2021-09-08/rwxrob_best_12-57-06.ts", s.FileName(ch, now))
+}
+
+func TestPostProcessCommand(t *testing.T) {
+	s := DefaultSettings
+	s.PostProcess = "ffmpeg -i {file} -c copy {dir}/{name}.mp4"
+	args := s.PostProcessCommand(Channels{User: "rwxrob"}, "/srv/streams/rwxrob/rwxrob_2021-09-08_12-57-06.ts")
+	assert.Equal(t, []string{"ffmpeg", "-i", "/srv/streams/rwxrob/rwxrob_2021-09-08_12-57-06.ts", "-c", "copy", "/srv/streams/rwxrob/rwxrob_2021-09-08_12-57-06.mp4"}, args)
+}
+
+func TestDurationText(t *testing.T) {
+	for in, want := range map[time.Duration]string{10 * time.Minute: "10m", 90 * time.Second: "1m30s", 2 * time.Hour: "2h", 30 * time.Second: "30s"} {
+		b, err := Duration{in}.MarshalText()
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(b))
+
+		var d Duration
+		assert.NoError(t, d.UnmarshalText(b))
+		assert.Equal(t, in, d.Duration)
+	}
+	assert.Error(t, new(Duration).UnmarshalText([]byte("-1m")))
+}
+
+func TestProxySettings(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.unmarshal([]byte(`version = 3
+
+[defaults.proxy]
+  urls = ['http://egress.corp:3128', 'http://egress2.corp:3128']
+  no_proxy = ['.corp', '10.0.0.0/8']
+  username = 'rekoda'
+  password = 'hunter2'
+
+[[channels]]
+  enabled = true
+  user = 'rwxrob'
+  quality = 'best'
+
+[[channels]]
+  enabled = true
+  user = 'koreanstreamer'
+  quality = 'best'
+  [channels.proxy]
+    urls = ['socks5://seoul.example.com:1080']
+
+[[channels]]
+  enabled = true
+  user = 'sodapoppin'
+  quality = 'best'
+  [channels.proxy]
+    urls = []
+`)))
+
+	rwxrob := c.Settings(c.Channels[0]).Proxy
+	assert.True(t, rwxrob.Set)
+	assert.Len(t, rwxrob.URLs, 2)
+	assert.Equal(t, "hunter2", rwxrob.Password)
+
+	korean := c.Settings(c.Channels[1]).Proxy
+	assert.Equal(t, []string{"socks5://seoul.example.com:1080"}, korean.URLs)
+	assert.Equal(t, rwxrob.NoProxy, korean.NoProxy)
+	assert.NotEqual(t, rwxrob.Key(), korean.Key())
+
+	direct := c.Settings(c.Channels[2]).Proxy
+	assert.True(t, direct.Set)
+	assert.Empty(t, direct.URLs)
+
+	assert.False(t, (&Config{}).Settings(Channels{}).Proxy.Set, "environment is used without proxy settings")
+	assert.Equal(t, os.FileMode(0600), c.perm(), "proxy password is a secret")
+}
+
+func TestCircuitBreakerGet(t *testing.T) {
+	threshold, cooldown, maxCooldown := CircuitBreaker{}.Get()
+	assert.Equal(t, 5, threshold)
+	assert.Equal(t, 15*time.Second, cooldown)
+	assert.Equal(t, 2*time.Minute, maxCooldown)
+
+	c := &Config{}
+	assert.NoError(t, c.unmarshal([]byte("[circuit_breaker]\nthreshold = 0\ncooldown = '1m'\n")))
+	threshold, cooldown, _ = c.Breaker.Get()
+	assert.Equal(t, 0, threshold)
+	assert.Equal(t, time.Minute, cooldown)
+}
+
+func TestSchedulerGet(t *testing.T) {
+	workers, rate, jitter := Scheduler{}.Get()
+	assert.Equal(t, 8, workers)
+	assert.Equal(t, 2.0, rate)
+	assert.Equal(t, 0.1, jitter)
+
+	c := &Config{}
+	assert.NoError(t, c.unmarshal([]byte("[scheduler]\nworkers = 32\nrate = 10.0\njitter = 0.0\n")))
+	workers, rate, jitter = c.Scheduler.Get()
+	assert.Equal(t, 32, workers)
+	assert.Equal(t, 10.0, rate)
+	assert.Equal(t, 0.0, jitter)
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	conf "github.com/wmw64/rekoda/pkg/config/toml"
+)
+
+// TokensFile is where OAuth tokens are kept, away from config file so it may be shared or backed up safely
+func (c *Config) TokensFile() string {
+	return filepath.Join(filepath.Dir(c.ConfigFile), "tokens.toml")
+}
+
+// tokensFile is contents of TokensFile
+type tokensFile struct {
+	Tokens map[string]string `toml:"tokens"`
+}
+
+// LoadTokens reads named OAuth tokens, missing file has none
+func LoadTokens(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f tokensFile
+	if err := conf.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	if f.Tokens == nil {
+		f.Tokens = map[string]string{}
+	}
+	return f.Tokens, nil
+}
+
+// UpdateTokens changes named OAuth tokens under file lock, file is readable by owner only
+func UpdateTokens(path string, fn func(tokens map[string]string) error) error {
+	unlock, err := conf.Lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tokens, err := LoadTokens(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(tokens); err != nil {
+		return err
+	}
+	b, err := conf.Marshal(tokensFile{Tokens: tokens})
+	if err != nil {
+		return err
+	}
+	return conf.WriteFile(path, b, 0600)
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.toml")
+	tokens, err := LoadTokens(path)
+	assert.NoError(t, err)
+	assert.Empty(t, tokens, "missing file has no tokens")
+
+	assert.NoError(t, UpdateTokens(path, func(tokens map[string]string) error {
+		tokens["main"] = "abc123"
+		return nil
+	}))
+	tokens, err = LoadTokens(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"main": "abc123"}, tokens)
+
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	}
+}
+
+func TestTokenSetting(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.unmarshal([]byte(`version = 3
+
+[defaults]
+  token = 'main'
+
+[[channels]]
+  enabled = true
+  user = 'rwxrob'
+  quality = 'best'
+
+[[channels]]
+  enabled = true
+  user = 'subonly'
+  quality = 'best'
+  token = 'alt'
+`)))
+	assert.Equal(t, "main", c.Settings(c.Channels[0]).Token)
+	assert.Equal(t, "alt", c.Settings(c.Channels[1]).Token)
+	assert.Equal(t, "/srv/rekoda/tokens.toml", filepath.ToSlash((&Config{ConfigFile: "/srv/rekoda/rekoda.toml"}).TokensFile()))
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wmw64/rekoda/internal/twitch"
+	"github.com/wmw64/rekoda/pkg/proxy"
+)
+
+// Validate checks channel entry, returning every problem found
+func (ch Channels) Validate() error {
+	var problems []string
+	if ch.User == "" {
+		problems = append(problems, "user is required")
+	}
+	if !validQuality(ch.Quality) {
+		problems = append(problems, fmt.Sprintf("quality '%v' must be one of %v", ch.Quality, strings.Join(twitch.Qualities, ", ")))
+	}
+	problems = append(problems, ch.Settings.problems()...)
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validQuality(q string) bool {
+	for _, v := range twitch.Qualities {
+		if q == v {
+			return true
+		}
+	}
+	return false
+}
+
+// problems lists settings stated which make no sense
+func (s Settings) problems() []string {
+	var problems []string
+	if s.Ads != nil && !ValidAds(*s.Ads) {
+		problems = append(problems, fmt.Sprintf("ads '%v' must be one of %v, %v, %v", *s.Ads, AdsKeep, AdsSkip, AdsSeparate))
+	}
+	if s.FileTemplate != nil && strings.TrimSpace(*s.FileTemplate) == "" {
+		problems = append(problems, "file_template must not be empty")
+	}
+	if s.MinPollInterval != nil && s.MaxPollInterval != nil && s.MinPollInterval.Duration > s.MaxPollInterval.Duration {
+		problems = append(problems, "min_poll_interval must not be longer than max_poll_interval")
+	}
+	for _, v := range []struct {
+		key string
+		r   *RetryPolicy
+	}{{"playlist_retry", s.PlaylistRetry}, {"segment_retry", s.SegmentRetry}, {"api_retry", s.APIRetry}} {
+		key, r := v.key, v.r
+		if r == nil {
+			continue
+		}
+		if r.Attempts != nil && *r.Attempts < 1 {
+			problems = append(problems, key+".attempts must be at least 1")
+		}
+		if r.RetryOn != nil {
+			for _, code := range *r.RetryOn {
+				if http.StatusText(code) == "" && (code < 100 || code > 599) {
+					problems = append(problems, fmt.Sprintf("%v.retry_on: %v is not an HTTP status code", key, code))
+				}
+			}
+		}
+	}
+	if p := s.Proxy; p != nil {
+		var urls, noProxy []string
+		var username, password string
+		if p.URLs != nil {
+			urls = *p.URLs
+		}
+		if p.NoProxy != nil {
+			noProxy = *p.NoProxy
+		}
+		if p.Username != nil {
+			username = *p.Username
+		}
+		if p.Password != nil {
+			password = *p.Password
+		}
+		if _, err := proxy.New(urls, noProxy, username, password); err != nil {
+			problems = append(problems, "proxy: "+err.Error())
+		}
+	}
+	return problems
+}
+
+// Problems lists everything wrong with config: unknown keys, values out of range and invalid channels
+func (c *Config) Problems() []string {
+	var problems []string
+	known := make(map[string]bool)
+	for _, k := range Keys(&Config{}) {
+		known[k] = true
+	}
+	for _, k := range sortedKeys(c.fileKeys()) {
+		if !known[k] && k != "channels" {
+			problems = append(problems, fmt.Sprintf("unknown key '%v'", k))
+		}
+	}
+
+	s, b := c.Scheduler, c.Breaker
+	if s.Workers != nil && *s.Workers < 1 {
+		problems = append(problems, "scheduler.workers must be at least 1")
+	}
+	if s.Rate != nil && *s.Rate <= 0 {
+		problems = append(problems, "scheduler.rate must be above 0")
+	}
+	if s.Jitter != nil && (*s.Jitter < 0 || *s.Jitter >= 1) {
+		problems = append(problems, "scheduler.jitter must be from 0 up to 1")
+	}
+	if b.Threshold != nil && *b.Threshold < 0 {
+		problems = append(problems, "circuit_breaker.threshold must not be negative, 0 disables breaker")
+	}
+	if b.Cooldown != nil && b.MaxCooldown != nil && b.Cooldown.Duration > b.MaxCooldown.Duration {
+		problems = append(problems, "circuit_breaker.cooldown must not be longer than max_cooldown")
+	}
+	if es := c.EventSub; es.Listen != "" {
+		if es.Callback == "" || es.ClientID == "" || es.ClientSecret == "" {
+			problems = append(problems, "eventsub needs callback, client_id and client_secret once listen is set")
+		}
+		if es.Callback != "" && !strings.HasPrefix(es.Callback, "https://") {
+			problems = append(problems, "eventsub.callback must be https URL")
+		}
+	}
+	for _, p := range c.Defaults.problems() {
+		problems = append(problems, "defaults."+p)
+	}
+
+	knownChannel := make(map[string]bool)
+	for _, k := range Keys(&Channels{}) {
+		knownChannel[k] = true
+	}
+	tables, _ := c.file["channels"].([]interface{})
+	seen := make(map[string]bool)
+	for i, ch := range c.Channels {
+		name := ch.User
+		if name == "" {
+			name = fmt.Sprintf("#%v", i+1)
+		}
+		if i < len(tables) {
+			if t, ok := tables[i].(map[string]interface{}); ok {
+				var fields []Field
+				flatten(t, "", &fields)
+				for _, f := range fields {
+					if !knownChannel[f.Key] {
+						problems = append(problems, fmt.Sprintf("channel '%v': unknown key '%v'", name, f.Key))
+					}
+				}
+			}
+		}
+		if err := ch.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("channel '%v': %v", name, err))
+		}
+		if lower := strings.ToLower(ch.User); ch.User != "" && seen[lower] {
+			problems = append(problems, fmt.Sprintf("channel '%v' is listed more than once", name))
+		} else {
+			seen[lower] = true
+		}
+	}
+	return problems
+}
+
+// DirProblems lists directories recordings go to which can't be written.
+// Missing directories are created on first recording, so their nearest existing parent must be writable
+func (c *Config) DirProblems() []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	add := func(dir string) {
+		if dir != "" && !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	add(c.StreamsDir)
+	for _, ch := range c.Channels {
+		if ch.Enabled {
+			add(c.Settings(ch).StreamsDir)
+		}
+	}
+
+	var problems []string
+	for _, dir := range dirs {
+		if err := checkWritable(dir); err != nil {
+			problems = append(problems, fmt.Sprintf("streams directory '%v' is not writable: %v", dir, err))
+		}
+	}
+	return problems
+}
+
+func checkWritable(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return errors.New("not a directory")
+			}
+			break
+		}
+		parent := filepath.Dir(dir)
+		if !os.IsNotExist(err) || parent == dir {
+			return err
+		}
+		dir = parent
+	}
+	f, err := os.CreateTemp(dir, ".rekoda-write-test-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
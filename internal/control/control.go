@@ -0,0 +1,171 @@
+// Package control is local channel running recorder is asked what it's doing through.
+// Recorder serves JSON over HTTP on a unix socket only its owner may connect to
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Channel states
+const (
+	StateOffline   = "offline"   // Waiting for channel to go live
+	StateRecording = "recording" // Writing stream into file
+	StateRestart   = "restart"   // Stream ended, waiting for it to come back into the same file
+	StateStopped   = "stopped"   // Stopped by hand, not recorded until started again
+	StateDisabled  = "disabled"  // Disabled in config file
+)
+
+// Actions recorder takes on a channel when asked
+const (
+	ActionStart   = "start"   // Check right away, recording it if live
+	ActionStop    = "stop"    // Close file and hold channel until started again
+	ActionEnable  = "enable"  // Enable in config file and start checking it
+	ActionDisable = "disable" // Stop it and disable in config file
+)
+
+// ChannelStatus is what recorder is doing with a channel
+type ChannelStatus struct {
+	Channel     string        `json:"channel"`
+	State       string        `json:"state"`
+	File        string        `json:"file,omitempty"`    // Being written, or the last one written
+	Started     time.Time     `json:"started,omitempty"` // When file was opened
+	Bytes       uint64        `json:"bytes"`
+	Recorded    time.Duration `json:"recorded"` // Media time written
+	Segments    int           `json:"segments"`
+	Gaps        int           `json:"gaps"`
+	LastSegment time.Time     `json:"last_segment,omitempty"`
+	LastCheck   time.Time     `json:"last_check,omitempty"`
+	NextCheck   time.Time     `json:"next_check,omitempty"`
+	Error       string        `json:"error,omitempty"` // Last error
+	ErrorAt     time.Time     `json:"error_at,omitempty"`
+}
+
+// Bitrate returns average bitrate of file being written in bits per second
+func (s ChannelStatus) Bitrate() float64 {
+	if s.Recorded <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) * 8 / s.Recorded.Seconds()
+}
+
+// Status is what running recorder is doing
+type Status struct {
+	PID      int             `json:"pid"`
+	Started  time.Time       `json:"started"`
+	Channels []ChannelStatus `json:"channels"`
+}
+
+// ErrNotRunning is returned when nothing listens on control socket
+var ErrNotRunning = errors.New("recorder is not running")
+
+// Serve answers status requests and takes actions on unix socket at path until returned server is closed.
+// Socket left behind by crashed recorder is replaced, one of running recorder is not.
+// Only owner may enter directory of socket, so nobody else can connect before socket's own mode is set
+func Serve(path string, status func() Status, act func(channel, action string) error) (*http.Server, error) {
+	if _, err := Get(path); err == nil {
+		return nil, fmt.Errorf("another recorder is already running, socket %v", path)
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status())
+	})
+	mux.HandleFunc("/channels/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		channel, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/channels/"), "/")
+		if channel == "" || action == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := act(channel, action); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go srv.Serve(ln)
+	return srv, nil
+}
+
+// Get asks recorder listening on unix socket at path what it's doing
+func Get(path string) (Status, error) {
+	var st Status
+	res, err := client(path).Get("http://rekoda/status")
+	if err != nil {
+		return st, dialError(path, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return st, fmt.Errorf("control: received HTTP %v", res.StatusCode)
+	}
+	err = json.NewDecoder(res.Body).Decode(&st)
+	return st, err
+}
+
+// Do asks recorder listening on unix socket at path to take action on channel
+func Do(path, channel, action string) error {
+	res, err := client(path).Post("http://rekoda/channels/"+url.PathEscape(channel)+"/"+action, "", nil)
+	if err != nil {
+		return dialError(path, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%v %v: %v", action, channel, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func dialError(path string, err error) error {
+	var op *net.OpError
+	if errors.As(err, &op) && op.Op == "dial" {
+		return fmt.Errorf("%w: no one listens on %v", ErrNotRunning, path)
+	}
+	return err
+}
+
+func client(path string) *http.Client {
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
@@ -0,0 +1,56 @@
+package control
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServe(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "run")
+	path := filepath.Join(dir, "rekoda.sock")
+	_, err := Get(path)
+	assert.ErrorIs(t, err, ErrNotRunning)
+
+	started := time.Date(2021, 9, 8, 12, 57, 6, 0, time.UTC)
+	want := Status{PID: 42, Started: started, Channels: []ChannelStatus{
+		{Channel: "rwxrob", State: StateRecording, File: "rwxrob.ts", Started: started, Bytes: 1000000, Recorded: 4 * time.Second},
+	}}
+	var acted []string
+	act := func(channel, action string) error {
+		if channel == "xqc" {
+			return errors.New("channel 'xqc' is not in config")
+		}
+		acted = append(acted, channel+" "+action)
+		return nil
+	}
+	srv, err := Serve(path, func() Status { return want }, act)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+		fi, err = os.Stat(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+	}
+
+	got, err := Get(path)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, 2000000.0, got.Channels[0].Bitrate())
+
+	assert.NoError(t, Do(path, "rwxrob", ActionStop))
+	assert.Equal(t, []string{"rwxrob stop"}, acted)
+	assert.EqualError(t, Do(path, "xqc", ActionStart), "start xqc: channel 'xqc' is not in config")
+
+	_, err = Serve(path, func() Status { return want }, act)
+	assert.Error(t, err, "socket of running recorder is not replaced")
+}
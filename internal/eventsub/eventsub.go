@@ -0,0 +1,155 @@
+package eventsub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// Subscription types rekoda listens to
+const (
+	StreamOnline  = "stream.online"
+	StreamOffline = "stream.offline"
+)
+
+// Message types of Twitch-Eventsub-Message-Type header
+const (
+	MessageVerification = "webhook_callback_verification"
+	MessageNotification = "notification"
+	MessageRevocation   = "revocation"
+)
+
+// MaxAge is how old message may be before it's rejected as replayed
+const MaxAge = 10 * time.Minute
+
+// Subscription is EventSub subscription as twitch describes it
+type Subscription struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Version   string    `json:"version"`
+	Status    string    `json:"status"`
+	Condition Condition `json:"condition"`
+	Transport Transport `json:"transport"`
+}
+
+type Condition struct {
+	BroadcasterUserID string `json:"broadcaster_user_id"`
+}
+
+type Transport struct {
+	Method   string `json:"method"`
+	Callback string `json:"callback"`
+	Secret   string `json:"secret,omitempty"`
+}
+
+// Event is payload of stream.online and stream.offline notifications
+type Event struct {
+	Type                 string `json:"-"` // Subscription type event was sent for
+	ID                   string `json:"id"`
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	StreamType           string `json:"type"` // live, playlist, watch_party, premiere, rerun; online events only
+	StartedAt            string `json:"started_at"`
+}
+
+// Handler receives EventSub webhook messages: answers challenges, verifies signatures
+// and hands notifications and revocations over to callbacks. Every message is handled once
+type Handler struct {
+	Secret    []byte
+	OnEvent   func(Event)
+	OnRevoked func(Subscription)
+
+	seen *lru.Cache
+	now  func() time.Time
+}
+
+// NewHandler returns handler verifying messages with secret
+func NewHandler(secret string, onEvent func(Event), onRevoked func(Subscription)) *Handler {
+	seen, _ := lru.New(4096)
+	return &Handler{Secret: []byte(secret), OnEvent: onEvent, OnRevoked: onRevoked, seen: seen, now: time.Now}
+}
+
+// Sign returns value of Twitch-Eventsub-Message-Signature header for message
+func Sign(secret []byte, id, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id + timestamp))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type message struct {
+	Challenge    string          `json:"challenge"`
+	Subscription Subscription    `json:"subscription"`
+	Event        json.RawMessage `json:"event"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	id := r.Header.Get("Twitch-Eventsub-Message-Id")
+	timestamp := r.Header.Get("Twitch-Eventsub-Message-Timestamp")
+	signature := r.Header.Get("Twitch-Eventsub-Message-Signature")
+	if id == "" || !hmac.Equal([]byte(signature), []byte(Sign(h.Secret, id, timestamp, body))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	sent, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil || h.now().Sub(sent) > MaxAge {
+		http.Error(w, "message too old", http.StatusForbidden)
+		return
+	}
+
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	switch typ := r.Header.Get("Twitch-Eventsub-Message-Type"); typ {
+	case MessageVerification:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", strconv.Itoa(len(msg.Challenge)))
+		io.WriteString(w, msg.Challenge)
+		return
+	case MessageNotification, MessageRevocation:
+		// Twitch resends messages it got no answer for in time, acknowledge them again but act only once
+		if seen, _ := h.seen.ContainsOrAdd(id, nil); seen {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if typ == MessageRevocation {
+			if h.OnRevoked != nil {
+				h.OnRevoked(msg.Subscription)
+			}
+			break
+		}
+		var e Event
+		if err := json.Unmarshal(msg.Event, &e); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		e.Type = msg.Subscription.Type
+		if h.OnEvent != nil {
+			h.OnEvent(e)
+		}
+	default:
+		http.Error(w, "unknown message type", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,152 @@
+package eventsub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "s3cr3t-s3cr3t"
+
+// post sends locally signed fake message to handler
+func post(h http.Handler, typ, id string, sent time.Time, body string, secret string) *httptest.ResponseRecorder {
+	ts := sent.UTC().Format(time.RFC3339Nano)
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Twitch-Eventsub-Message-Id", id)
+	req.Header.Set("Twitch-Eventsub-Message-Timestamp", ts)
+	req.Header.Set("Twitch-Eventsub-Message-Type", typ)
+	req.Header.Set("Twitch-Eventsub-Message-Signature", Sign([]byte(secret), id, ts, []byte(body)))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+const onlineBody = `{
+  "subscription": {"id": "f1c2a387", "type": "stream.online", "version": "1", "status": "enabled",
+    "condition": {"broadcaster_user_id": "1337"}, "transport": {"method": "webhook", "callback": "https://example.com/eventsub"}},
+  "event": {"id": "9001", "broadcaster_user_id": "1337", "broadcaster_user_login": "rwxrob", "type": "live", "started_at": "2021-09-08T12:57:04Z"}
+}`
+
+func TestHandlerChallenge(t *testing.T) {
+	h := NewHandler(testSecret, nil, nil)
+	w := post(h, MessageVerification, "m1", time.Now(), `{"challenge":"pogchamp-kappa-360noscope-vohiyo","subscription":{}}`, testSecret)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "pogchamp-kappa-360noscope-vohiyo", w.Body.String())
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+}
+
+func TestHandlerNotification(t *testing.T) {
+	var events []Event
+	h := NewHandler(testSecret, func(e Event) { events = append(events, e) }, nil)
+
+	w := post(h, MessageNotification, "m1", time.Now(), onlineBody, testSecret)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, StreamOnline, events[0].Type)
+		assert.Equal(t, "rwxrob", events[0].BroadcasterUserLogin)
+		assert.Equal(t, "1337", events[0].BroadcasterUserID)
+	}
+
+	// Retried delivery is acknowledged but handled once
+	w = post(h, MessageNotification, "m1", time.Now(), onlineBody, testSecret)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Len(t, events, 1)
+}
+
+func TestHandlerRejects(t *testing.T) {
+	called := false
+	h := NewHandler(testSecret, func(Event) { called = true }, nil)
+
+	assert.Equal(t, http.StatusForbidden, post(h, MessageNotification, "m1", time.Now(), onlineBody, "wrong-secret").Code)
+	assert.Equal(t, http.StatusForbidden, post(h, MessageNotification, "m2", time.Now().Add(-MaxAge-time.Minute), onlineBody, testSecret).Code)
+	assert.Equal(t, http.StatusBadRequest, post(h, "unknown", "m3", time.Now(), onlineBody, testSecret).Code)
+
+	// Body changed after signing
+	req := httptest.NewRequest("POST", "/", strings.NewReader(strings.Replace(onlineBody, "rwxrob", "sodapoppin", 1)))
+	ts := time.Now().UTC().Format(time.RFC3339Nano)
+	req.Header.Set("Twitch-Eventsub-Message-Id", "m4")
+	req.Header.Set("Twitch-Eventsub-Message-Timestamp", ts)
+	req.Header.Set("Twitch-Eventsub-Message-Type", MessageNotification)
+	req.Header.Set("Twitch-Eventsub-Message-Signature", Sign([]byte(testSecret), "m4", ts, []byte(onlineBody)))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.False(t, called)
+}
+
+func TestHandlerRevocation(t *testing.T) {
+	var revoked []Subscription
+	h := NewHandler(testSecret, nil, func(s Subscription) { revoked = append(revoked, s) })
+
+	body := `{"subscription": {"id": "f1c2a387", "type": "stream.online", "version": "1", "status": "authorization_revoked",
+	  "condition": {"broadcaster_user_id": "1337"}, "transport": {"method": "webhook", "callback": "https://example.com/eventsub"}}}`
+	assert.Equal(t, http.StatusNoContent, post(h, MessageRevocation, "m1", time.Now(), body, testSecret).Code)
+	if assert.Len(t, revoked, 1) {
+		assert.Equal(t, "authorization_revoked", revoked[0].Status)
+		assert.Equal(t, "1337", revoked[0].Condition.BroadcasterUserID)
+	}
+}
+
+func TestSync(t *testing.T) {
+	existing := []Subscription{
+		{ID: "keep", Type: StreamOnline, Status: "enabled", Condition: Condition{"1"}, Transport: Transport{Callback: "https://example.com/eventsub"}},
+		{ID: "failed", Type: StreamOffline, Status: "notification_failures_exceeded", Condition: Condition{"1"}, Transport: Transport{Callback: "https://example.com/eventsub"}},
+		{ID: "stale", Type: StreamOnline, Status: "enabled", Condition: Condition{"99"}, Transport: Transport{Callback: "https://example.com/eventsub"}},
+		{ID: "foreign", Type: StreamOnline, Status: "enabled", Condition: Condition{"2"}, Transport: Transport{Callback: "https://other.example.com"}},
+	}
+	var created []Subscription
+	var deleted []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+		w.Write([]byte(`{"access_token":"app-token","expires_in":3600}`))
+	})
+	mux.HandleFunc("/helix/eventsub/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer app-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "client", r.Header.Get("Client-Id"))
+		switch r.Method {
+		case "GET":
+			// Two pages
+			if r.URL.Query().Get("after") == "" {
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": existing[:2], "pagination": map[string]string{"cursor": "next"}})
+			} else {
+				json.NewEncoder(w).Encode(map[string]interface{}{"data": existing[2:], "pagination": map[string]string{}})
+			}
+		case "POST":
+			var s Subscription
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&s))
+			created = append(created, s)
+			w.WriteHeader(http.StatusAccepted)
+		case "DELETE":
+			deleted = append(deleted, r.URL.Query().Get("id"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), "client", "client-secret", "https://example.com/eventsub", testSecret)
+	c.APIBase, c.AuthBase = srv.URL+"/helix", srv.URL+"/oauth2"
+
+	n, d, err := c.Sync(context.Background(), []string{"1", "2"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 2, d)
+	assert.ElementsMatch(t, []string{"failed", "stale"}, deleted)
+
+	got := make([]string, 0, len(created))
+	for _, s := range created {
+		assert.Equal(t, "webhook", s.Transport.Method)
+		assert.Equal(t, testSecret, s.Transport.Secret)
+		got = append(got, s.Type+"/"+s.Condition.BroadcasterUserID)
+	}
+	assert.ElementsMatch(t, []string{"stream.offline/1", "stream.online/2", "stream.offline/2"}, got)
+}
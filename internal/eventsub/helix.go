@@ -0,0 +1,230 @@
+package eventsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAPIBase  = "https://api.twitch.tv/helix"
+	DefaultAuthBase = "https://id.twitch.tv/oauth2"
+)
+
+// Client manages webhook subscriptions through Helix API using app access token of registered application
+type Client struct {
+	HTTP         *http.Client
+	ClientID     string
+	ClientSecret string
+	Callback     string // Public https URL notifications are sent to
+	Secret       string // Signs notifications, 10-100 characters
+	APIBase      string
+	AuthBase     string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewClient returns client talking to default Helix and OAuth endpoints
+func NewClient(httpClient *http.Client, clientID, clientSecret, callback, secret string) *Client {
+	return &Client{
+		HTTP:         httpClient,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Callback:     callback,
+		Secret:       secret,
+		APIBase:      DefaultAPIBase,
+		AuthBase:     DefaultAuthBase,
+	}
+}
+
+// appToken returns cached app access token, requesting a new one once it's about to expire
+func (c *Client) appToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Until(c.expires) > time.Minute {
+		return c.token, nil
+	}
+
+	form := url.Values{"client_id": {c.ClientID}, "client_secret": {c.ClientSecret}, "grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.AuthBase+"/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("app token: received HTTP %v", res.StatusCode)
+	}
+	var t struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+		return "", fmt.Errorf("app token: %w", err)
+	}
+	c.token, c.expires = t.AccessToken, time.Now().Add(time.Duration(t.ExpiresIn)*time.Second)
+	return c.token, nil
+}
+
+// helix makes authorized API request, decoding response into v if it's not nil
+func (c *Client) helix(ctx context.Context, method, path string, body, v interface{}, want int) error {
+	token, err := c.appToken(ctx)
+	if err != nil {
+		return err
+	}
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.APIBase+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Client-Id", c.ClientID)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != want {
+		var e struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(res.Body).Decode(&e)
+		return fmt.Errorf("%v %v: received HTTP %v %v", method, path, res.StatusCode, e.Message)
+	}
+	if v != nil {
+		return json.NewDecoder(res.Body).Decode(v)
+	}
+	return nil
+}
+
+// UserIDs returns user id of every existing login, keyed by lowercase login
+func (c *Client) UserIDs(ctx context.Context, logins []string) (map[string]string, error) {
+	ids := make(map[string]string, len(logins))
+	for len(logins) > 0 {
+		n := len(logins)
+		if n > 100 {
+			n = 100
+		}
+		q := url.Values{"login": logins[:n]}
+		var res struct {
+			Data []struct {
+				ID    string `json:"id"`
+				Login string `json:"login"`
+			} `json:"data"`
+		}
+		if err := c.helix(ctx, "GET", "/users?"+q.Encode(), nil, &res, http.StatusOK); err != nil {
+			return nil, err
+		}
+		for _, u := range res.Data {
+			ids[strings.ToLower(u.Login)] = u.ID
+		}
+		logins = logins[n:]
+	}
+	return ids, nil
+}
+
+// Subscriptions returns every subscription of application
+func (c *Client) Subscriptions(ctx context.Context) ([]Subscription, error) {
+	var subs []Subscription
+	cursor := ""
+	for {
+		path := "/eventsub/subscriptions"
+		if cursor != "" {
+			path += "?after=" + url.QueryEscape(cursor)
+		}
+		var res struct {
+			Data       []Subscription `json:"data"`
+			Pagination struct {
+				Cursor string `json:"cursor"`
+			} `json:"pagination"`
+		}
+		if err := c.helix(ctx, "GET", path, nil, &res, http.StatusOK); err != nil {
+			return nil, err
+		}
+		subs = append(subs, res.Data...)
+		if res.Pagination.Cursor == "" || len(res.Data) == 0 {
+			return subs, nil
+		}
+		cursor = res.Pagination.Cursor
+	}
+}
+
+// Subscribe creates webhook subscription of type for broadcaster, twitch verifies callback before it's enabled
+func (c *Client) Subscribe(ctx context.Context, typ, userID string) error {
+	sub := Subscription{
+		Type:      typ,
+		Version:   "1",
+		Condition: Condition{BroadcasterUserID: userID},
+		Transport: Transport{Method: "webhook", Callback: c.Callback, Secret: c.Secret},
+	}
+	return c.helix(ctx, "POST", "/eventsub/subscriptions", sub, nil, http.StatusAccepted)
+}
+
+// Unsubscribe deletes subscription
+func (c *Client) Unsubscribe(ctx context.Context, id string) error {
+	return c.helix(ctx, "DELETE", "/eventsub/subscriptions?id="+url.QueryEscape(id), nil, nil, http.StatusNoContent)
+}
+
+// Sync makes sure there are working stream.online and stream.offline subscriptions for every user id
+// and no others sent to our callback. With keep false existing ones are recreated, e.g. when secret changed.
+// Returns how many subscriptions were created and deleted
+func (c *Client) Sync(ctx context.Context, userIDs []string, keep bool) (created, deleted int, err error) {
+	want := make(map[string]bool)
+	for _, id := range userIDs {
+		want[StreamOnline+"/"+id] = true
+		want[StreamOffline+"/"+id] = true
+	}
+
+	subs, err := c.Subscriptions(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, s := range subs {
+		if s.Transport.Callback != c.Callback {
+			continue // Somebody else's
+		}
+		key := s.Type + "/" + s.Condition.BroadcasterUserID
+		working := s.Status == "enabled" || s.Status == "webhook_callback_verification_pending"
+		if keep && working && want[key] {
+			delete(want, key)
+			continue
+		}
+		if err := c.Unsubscribe(ctx, s.ID); err != nil {
+			return created, deleted, err
+		}
+		deleted++
+	}
+
+	for key := range want {
+		typ, id, _ := strings.Cut(key, "/")
+		if err := c.Subscribe(ctx, typ, id); err != nil {
+			return created, deleted, err
+		}
+		created++
+	}
+	return created, deleted, nil
+}
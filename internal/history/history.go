@@ -0,0 +1,330 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	conf "github.com/wmw64/rekoda/pkg/config/toml"
+)
+
+const (
+	// MaxSessions is how many of the latest sessions are kept per channel
+	MaxSessions = 500
+	// MinSessions is how many sessions must be observed before schedule is trusted
+	MinSessions = 5
+	// Window is how close to usual start time channel counts as about to go live
+	Window = 45 * time.Minute
+)
+
+// Session is one observed broadcast, End is zero while channel is live
+type Session struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Seen  time.Time `json:"seen,omitempty"` // Last time channel was seen live, while End is zero
+}
+
+// Duration returns how long session lasted, or has lasted so far
+func (s Session) Duration(now time.Time) time.Duration {
+	if s.End.IsZero() {
+		return now.Sub(s.Start)
+	}
+	return s.End.Sub(s.Start)
+}
+
+// History is observed online and offline times of a channel
+type History struct {
+	Channel  string    `json:"channel"`
+	Sessions []Session `json:"sessions"` // Oldest first
+}
+
+// Store keeps history of every channel in its own JSON file inside Dir
+type Store struct {
+	Dir string
+
+	mu       sync.Mutex
+	channels map[string]*History
+}
+
+// NewStore returns store keeping files in dir, which is created on first write
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir, channels: make(map[string]*History)}
+}
+
+func (s *Store) path(channel string) string {
+	return filepath.Join(s.Dir, strings.ToLower(channel)+".json")
+}
+
+// load returns cached history of channel reading its file first time, s.mu must be held
+func (s *Store) load(channel string) (*History, error) {
+	key := strings.ToLower(channel)
+	if h, ok := s.channels[key]; ok {
+		return h, nil
+	}
+	h := &History{Channel: channel}
+	b, err := os.ReadFile(s.path(channel))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, h); err != nil {
+			return nil, err
+		}
+	}
+	s.channels[key] = h
+	return h, nil
+}
+
+// save writes history of channel atomically, s.mu must be held
+func (s *Store) save(h *History) error {
+	if len(h.Sessions) > MaxSessions {
+		h.Sessions = h.Sessions[len(h.Sessions)-MaxSessions:]
+	}
+	b, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0777); err != nil {
+		return err
+	}
+	return conf.WriteFile(s.path(h.Channel), b, 0644)
+}
+
+// Get returns copy of channel's history
+func (s *Store) Get(channel string) (History, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, err := s.load(channel)
+	if err != nil {
+		return History{Channel: channel}, err
+	}
+	return History{Channel: h.Channel, Sessions: append([]Session(nil), h.Sessions...)}, nil
+}
+
+// Online records channel went live at t, unless it's already live
+func (s *Store) Online(channel string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, err := s.load(channel)
+	if err != nil {
+		return err
+	}
+	if n := len(h.Sessions); n > 0 && h.Sessions[n-1].End.IsZero() {
+		return nil
+	}
+	h.Sessions = append(h.Sessions, Session{Start: t.UTC()})
+	return s.save(h)
+}
+
+// Offline records channel went offline at t, ending its live session
+func (s *Store) Offline(channel string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, err := s.load(channel)
+	if err != nil {
+		return err
+	}
+	n := len(h.Sessions)
+	if n == 0 || !h.Sessions[n-1].End.IsZero() {
+		return nil
+	}
+	end(&h.Sessions[n-1], t)
+	return s.save(h)
+}
+
+// Seen records channel was seen still live at t, so its session can be ended there if rekoda dies
+func (s *Store) Seen(channel string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, err := s.load(channel)
+	if err != nil {
+		return err
+	}
+	n := len(h.Sessions)
+	if n == 0 || !h.Sessions[n-1].End.IsZero() {
+		return nil
+	}
+	h.Sessions[n-1].Seen = t.UTC()
+	return s.save(h)
+}
+
+// Close ends every live session at t, for shutting down while channels are being recorded
+func (s *Store) Close(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []string
+	for _, h := range s.channels {
+		n := len(h.Sessions)
+		if n == 0 || !h.Sessions[n-1].End.IsZero() {
+			continue
+		}
+		end(&h.Sessions[n-1], t)
+		if err := s.save(h); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Recover ends sessions left live by rekoda which didn't shut down cleanly at the last time they were seen live.
+// Call it on start, before any channel is checked
+func (s *Store) Recover() error {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range files {
+		h, err := s.load(strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			return err
+		}
+		n := len(h.Sessions)
+		if n == 0 || !h.Sessions[n-1].End.IsZero() {
+			continue
+		}
+		last := &h.Sessions[n-1]
+		end(last, last.Seen)
+		if err := s.save(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// end ends session at t, not before it started
+func end(s *Session, t time.Time) {
+	if t.Before(s.Start) {
+		t = s.Start
+	}
+	s.End, s.Seen = t.UTC(), time.Time{}
+}
+
+// Likelihood estimates how likely channel goes live around t, from 0 to 1.
+// It's the bigger of how often channel started near this time of day per observed day
+// and near this time of week per observed week
+func (h History) Likelihood(t time.Time) float64 {
+	if len(h.Sessions) == 0 {
+		return 0
+	}
+	t = t.In(time.Local)
+	observed := t.Sub(h.Sessions[0].Start)
+	days := math.Max(1, observed.Hours()/24)
+	weeks := math.Max(1, days/7)
+
+	const day, week = 24 * time.Hour, 7 * 24 * time.Hour
+	var daily, weekly float64
+	for _, s := range h.Sessions {
+		start := s.Start.In(time.Local)
+		if distance(sinceMidnight(start), sinceMidnight(t), day) <= Window {
+			daily++
+		}
+		if distance(sinceWeekStart(start), sinceWeekStart(t), week) <= Window {
+			weekly++
+		}
+	}
+	return math.Min(1, math.Max(daily/days, weekly/weeks))
+}
+
+// PollInterval returns how long to wait before next check at now: close to min around usual start times
+// and close to max otherwise, waking early for upcoming windows. Zero while history is too short to trust
+func (h History) PollInterval(now time.Time, min, max time.Duration) time.Duration {
+	if len(h.Sessions) < MinSessions || min <= 0 || max < min {
+		return 0
+	}
+	at := func(t time.Time) time.Duration {
+		p := math.Min(1, 2*h.Likelihood(t)) // Starting every other day at this time is as regular as it gets
+		return max - time.Duration(p*float64(max-min))
+	}
+
+	// Check no later than the interval some moment before it asks for
+	d := at(now)
+	for s := time.Minute; s < d; s += time.Minute {
+		if v := s + at(now.Add(s)); v < d {
+			d = v
+		}
+	}
+	return d
+}
+
+// Stats summarizes history
+type Stats struct {
+	Sessions int
+	First    time.Time
+	Last     Session
+	Average  time.Duration
+	Starts   [7][24]int // Sessions started per weekday and hour, local time
+}
+
+// Stats returns summary of history at now
+func (h History) Stats(now time.Time) Stats {
+	st := Stats{Sessions: len(h.Sessions)}
+	if st.Sessions == 0 {
+		return st
+	}
+	st.First = h.Sessions[0].Start
+	st.Last = h.Sessions[st.Sessions-1]
+
+	var total time.Duration
+	for _, s := range h.Sessions {
+		total += s.Duration(now)
+		start := s.Start.In(time.Local)
+		st.Starts[start.Weekday()][start.Hour()]++
+	}
+	st.Average = total / time.Duration(st.Sessions)
+	return st
+}
+
+// Slot is hour of week channel usually goes live at
+type Slot struct {
+	Weekday time.Weekday
+	Hour    int
+	Count   int
+}
+
+// Usual returns up to n hours of week channel went live at at least twice, most frequent first
+func (st Stats) Usual(n int) []Slot {
+	var slots []Slot
+	for d := range st.Starts {
+		for hour, count := range st.Starts[d] {
+			if count >= 2 {
+				slots = append(slots, Slot{time.Weekday(d), hour, count})
+			}
+		}
+	}
+	sort.SliceStable(slots, func(i, j int) bool { return slots[i].Count > slots[j].Count })
+	if len(slots) > n {
+		slots = slots[:n]
+	}
+	return slots
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+func sinceWeekStart(t time.Time) time.Duration {
+	return time.Duration(t.Weekday())*24*time.Hour + sinceMidnight(t)
+}
+
+// distance between two points on a cycle of length period
+func distance(a, b, period time.Duration) time.Duration {
+	d := a - b
+	if d < 0 {
+		d = -d
+	}
+	if period-d < d {
+		return period - d
+	}
+	return d
+}
@@ -0,0 +1,119 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// regular returns history of channel streaming 3 hours every day at 13:00 for n days up to now
+func regular(now time.Time, n int) History {
+	h := History{Channel: "rwxrob"}
+	for i := n; i > 0; i-- {
+		day := now.AddDate(0, 0, -i)
+		start := time.Date(day.Year(), day.Month(), day.Day(), 13, 0, 0, 0, time.Local)
+		h.Sessions = append(h.Sessions, Session{Start: start, End: start.Add(3 * time.Hour)})
+	}
+	return h
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(dir)
+	start := time.Date(2021, 9, 8, 13, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, s.Online("RWXROB", start))
+	assert.NoError(t, s.Online("rwxrob", start.Add(time.Minute))) // Still the same session
+	assert.NoError(t, s.Offline("rwxrob", start.Add(3*time.Hour)))
+	assert.NoError(t, s.Offline("rwxrob", start.Add(4*time.Hour))) // Nothing to end
+
+	h, err := NewStore(dir).Get("rwxrob")
+	assert.NoError(t, err)
+	assert.Equal(t, []Session{{Start: start, End: start.Add(3 * time.Hour)}}, h.Sessions)
+
+	empty, err := s.Get("sodapoppin")
+	assert.NoError(t, err)
+	assert.Empty(t, empty.Sessions)
+}
+
+func TestStoreOpenSessions(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2021, 9, 8, 13, 0, 0, 0, time.UTC)
+
+	// Killed while recording: session ends when channel was last seen live
+	s := NewStore(dir)
+	assert.NoError(t, s.Online("rwxrob", start))
+	assert.NoError(t, s.Seen("rwxrob", start.Add(time.Hour)))
+	assert.NoError(t, s.Online("sodapoppin", start)) // Never seen again, ends where it started
+
+	s = NewStore(dir)
+	assert.NoError(t, s.Recover())
+	h, err := NewStore(dir).Get("rwxrob")
+	assert.NoError(t, err)
+	assert.Equal(t, []Session{{Start: start, End: start.Add(time.Hour)}}, h.Sessions)
+	h, err = NewStore(dir).Get("sodapoppin")
+	assert.NoError(t, err)
+	assert.Equal(t, []Session{{Start: start, End: start}}, h.Sessions)
+
+	// Shut down while recording
+	assert.NoError(t, s.Online("rwxrob", start.Add(2*time.Hour)))
+	assert.NoError(t, s.Close(start.Add(3*time.Hour)))
+	assert.NoError(t, s.Seen("rwxrob", start.Add(4*time.Hour))) // Nothing live
+	h, err = NewStore(dir).Get("rwxrob")
+	assert.NoError(t, err)
+	assert.Equal(t, Session{Start: start.Add(2 * time.Hour), End: start.Add(3 * time.Hour)}, h.Sessions[1])
+}
+
+func TestStoreTrims(t *testing.T) {
+	s := NewStore(t.TempDir())
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < MaxSessions+10; i++ {
+		assert.NoError(t, s.Online("rwxrob", start.Add(time.Duration(i)*time.Hour)))
+		assert.NoError(t, s.Offline("rwxrob", start.Add(time.Duration(i)*time.Hour+time.Minute)))
+	}
+	h, err := NewStore(s.Dir).Get("rwxrob")
+	assert.NoError(t, err)
+	assert.Len(t, h.Sessions, MaxSessions)
+	assert.Equal(t, start.Add(10*time.Hour), h.Sessions[0].Start)
+}
+
+func TestPollInterval(t *testing.T) {
+	now := time.Date(2021, 9, 8, 0, 0, 0, 0, time.Local)
+	h := regular(now, 14)
+	min, max := 30*time.Second, 5*time.Minute
+	at := func(hour, minute int) time.Time {
+		return time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, time.Local)
+	}
+
+	assert.Equal(t, min, h.PollInterval(at(13, 0), min, max))
+	assert.Equal(t, min, h.PollInterval(at(12, 20), min, max))
+	assert.Equal(t, max, h.PollInterval(at(4, 0), min, max))
+
+	// Wakes up in time for usual start instead of sleeping through it
+	d := h.PollInterval(at(12, 12), min, max)
+	assert.Less(t, d, max)
+	assert.False(t, at(12, 12).Add(d).After(at(12, 15).Add(min)))
+
+	// Too little history to trust
+	assert.Equal(t, time.Duration(0), regular(now, MinSessions-1).PollInterval(at(13, 0), min, max))
+}
+
+func TestStats(t *testing.T) {
+	now := time.Date(2021, 9, 8, 0, 0, 0, 0, time.Local)
+	h := regular(now, 14)
+	h.Sessions = append(h.Sessions, Session{Start: now.Add(-time.Hour)})
+
+	st := h.Stats(now)
+	assert.Equal(t, 15, st.Sessions)
+	assert.True(t, st.Last.End.IsZero())
+	assert.Equal(t, 2, st.Starts[time.Monday][13])
+	assert.Equal(t, (14*3*time.Hour+time.Hour)/15, st.Average)
+
+	usual := st.Usual(3)
+	assert.Len(t, usual, 3)
+	for _, slot := range usual {
+		assert.Equal(t, 13, slot.Hour)
+		assert.Equal(t, 2, slot.Count)
+	}
+}
@@ -0,0 +1,281 @@
+// Package library keeps catalog of every recording in one JSON file, filled from sidecars of recordings
+// or, for recordings without one, from their names and contents
+package library
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wmw64/rekoda/internal/sidecar"
+	conf "github.com/wmw64/rekoda/pkg/config/toml"
+)
+
+// Entry is recording in catalog
+type Entry struct {
+	ID          string               `json:"id"`   // Stays the same when recording is moved
+	Path        string               `json:"path"` // Where recording is
+	Channel     string               `json:"channel"`
+	Quality     string               `json:"quality"`
+	Tags        []string             `json:"tags,omitempty"`
+	Started     time.Time            `json:"started"`
+	Ended       time.Time            `json:"ended"` // Zero while recording
+	Seconds     float64              `json:"seconds"`
+	Size        int64                `json:"size"`
+	Titles      []sidecar.Title      `json:"titles,omitempty"`
+	Games       []string             `json:"games,omitempty"`
+	Gaps        int                  `json:"gaps"`
+	GapSeconds  float64              `json:"gap_seconds"`
+	PostProcess *sidecar.PostProcess `json:"post_process,omitempty"`
+	Parts       []string             `json:"parts,omitempty"` // Recordings merged into this one
+}
+
+// Duration returns media time recorded
+func (e Entry) Duration() time.Duration {
+	return time.Duration(e.Seconds * float64(time.Second))
+}
+
+// Title returns the first title of stream, empty if none was seen
+func (e Entry) Title() string {
+	if len(e.Titles) == 0 {
+		return ""
+	}
+	return e.Titles[0].Title
+}
+
+// ID returns identifier of recording of channel started at t
+func ID(channel string, started time.Time) string {
+	sum := sha1.Sum([]byte(strings.ToLower(channel) + " " + started.UTC().Format(time.RFC3339)))
+	return hex.EncodeToString(sum[:])[:10]
+}
+
+// NewEntry returns entry of recording at path with its sidecar, size is taken from file
+func NewEntry(path string, rec sidecar.Recording) Entry {
+	e := Entry{
+		ID:          ID(rec.Channel, rec.Started),
+		Path:        path,
+		Channel:     rec.Channel,
+		Quality:     rec.Quality,
+		Tags:        rec.Tags,
+		Started:     rec.Started,
+		Ended:       rec.Ended,
+		Seconds:     rec.Seconds,
+		Titles:      rec.Titles,
+		Games:       rec.Games(),
+		Gaps:        len(rec.Gaps),
+		PostProcess: rec.PostProcess,
+		Parts:       rec.Parts,
+	}
+	if len(rec.Parts) > 0 { // Starts with its first part, which may still be around
+		e.ID = ID(rec.Channel+" merged", rec.Started)
+	}
+	for _, g := range rec.Gaps {
+		e.GapSeconds += g.Seconds
+	}
+	if fi, err := os.Stat(path); err == nil {
+		e.Size = fi.Size()
+	}
+	return e
+}
+
+// Library is catalog file, shared by every rekoda process through advisory lock
+type Library struct {
+	Path string
+}
+
+// Open returns library kept in file at path, which is created on first write
+func Open(path string) *Library {
+	return &Library{Path: path}
+}
+
+// Exists reports whether catalog was written yet
+func (l *Library) Exists() bool {
+	_, err := os.Stat(l.Path)
+	return err == nil
+}
+
+// Entries returns every recording in catalog, the oldest first
+func (l *Library) Entries() ([]Entry, error) {
+	b, err := os.ReadFile(l.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	err = json.Unmarshal(b, &entries)
+	return entries, err
+}
+
+// Update adds recording to catalog or replaces entry of it
+func (l *Library) Update(e Entry) error {
+	return l.change(func(entries []Entry) []Entry {
+		for i := range entries {
+			if entries[i].ID == e.ID {
+				entries[i] = e
+				return entries
+			}
+		}
+		return append(entries, e)
+	})
+}
+
+// Remove drops recordings from catalog
+func (l *Library) Remove(ids ...string) error {
+	drop := make(map[string]bool)
+	for _, id := range ids {
+		drop[id] = true
+	}
+	return l.change(func(entries []Entry) []Entry {
+		kept := entries[:0]
+		for _, e := range entries {
+			if !drop[e.ID] {
+				kept = append(kept, e)
+			}
+		}
+		return kept
+	})
+}
+
+// Rebuild replaces catalog with recordings sidecars in dirs are found for, returning how many there are
+func (l *Library) Rebuild(dirs ...string) (int, error) {
+	found, err := Scan(dirs...)
+	if err != nil {
+		return 0, err
+	}
+	return len(found), l.change(func([]Entry) []Entry { return found })
+}
+
+func (l *Library) change(fn func(entries []Entry) []Entry) error {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0777); err != nil {
+		return err
+	}
+	unlock, err := conf.Lock(l.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := l.Entries()
+	if err != nil {
+		return err
+	}
+	entries = fn(entries)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Started.Before(entries[j].Started) })
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return conf.WriteFile(l.Path, b, 0644)
+}
+
+// Scan finds recordings in dirs by their sidecars, or by their names if they have none, skipping ones whose file is gone.
+// Dirs which don't exist are skipped, each recording is listed once even if dirs overlap
+func Scan(dirs ...string) ([]Entry, error) {
+	found, err := sidecar.Find(dirs...)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	seen := make(map[string]bool)
+	for _, f := range found {
+		e := NewEntry(f.Path, f.Rec)
+		if !seen[e.ID] {
+			seen[e.ID] = true
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Started.Before(entries[j].Started) })
+	return entries, nil
+}
+
+// Filter picks recordings, zero fields match everything
+type Filter struct {
+	Channel string
+	Since   time.Time // Started at or after
+	Until   time.Time // Started before
+	Game    string    // Part of any game played, case-insensitive
+	Text    string    // Part of any title, game, channel or file name, case-insensitive
+	Tag     string
+}
+
+// Match reports whether recording passes filter
+func (f Filter) Match(e Entry) bool {
+	switch {
+	case f.Channel != "" && !strings.EqualFold(f.Channel, e.Channel):
+		return false
+	case !f.Since.IsZero() && e.Started.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Started.Before(f.Until):
+		return false
+	case f.Tag != "" && !hasTag(e.Tags, f.Tag):
+		return false
+	case f.Game != "" && !containsAny(e.Games, f.Game):
+		return false
+	}
+	if f.Text == "" {
+		return true
+	}
+	texts := []string{e.Channel, filepath.Base(e.Path)}
+	for _, t := range e.Titles {
+		texts = append(texts, t.Title, t.Game)
+	}
+	return containsAny(texts, f.Text)
+}
+
+// Search returns recordings passing filter
+func Search(entries []Entry, f Filter) []Entry {
+	var found []Entry
+	for _, e := range entries {
+		if f.Match(e) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// Find returns recording by its ID, its unique prefix, file name or path
+func Find(entries []Entry, key string) (Entry, error) {
+	var found []Entry
+	for _, e := range entries {
+		switch {
+		case e.ID == key, e.Path == key, filepath.Base(e.Path) == key:
+			return e, nil
+		case strings.HasPrefix(e.ID, key):
+			found = append(found, e)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Entry{}, errors.New("no recording '" + key + "' in library")
+	case 1:
+		return found[0], nil
+	}
+	return Entry{}, errors.New("'" + key + "' matches more than one recording, give more of its ID")
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(texts []string, part string) bool {
+	part = strings.ToLower(part)
+	for _, t := range texts {
+		if strings.Contains(strings.ToLower(t), part) {
+			return true
+		}
+	}
+	return false
+}
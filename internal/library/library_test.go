@@ -0,0 +1,134 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/sidecar"
+)
+
+// writeRecording writes recording with its sidecar into dir
+func writeRecording(t *testing.T, dir string, rec sidecar.Recording) string {
+	path := filepath.Join(dir, rec.Channel, rec.File)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0777))
+	assert.NoError(t, os.WriteFile(path, make([]byte, 188), 0644))
+	assert.NoError(t, rec.Save(sidecar.Path(path)))
+	return path
+}
+
+func TestRebuildAndUpdate(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2021, 9, 8, 12, 57, 6, 0, time.UTC)
+	rec := sidecar.Recording{Channel: "rwxrob", Quality: "best", File: "rwxrob_2021-09-08.ts", Started: start, Seconds: 3600,
+		Gaps: []sidecar.Gap{{At: start, Seconds: 2}, {At: start, Seconds: 4}}}
+	rec.AddTitle(start, "Coding", "Science & Technology")
+	writeRecording(t, dir, rec)
+	writeRecording(t, dir, sidecar.Recording{Channel: "xqc", File: "xqc_2021-09-07.ts", Started: start.AddDate(0, 0, -1)})
+	gone := sidecar.Recording{Channel: "xqc", File: "xqc_2021-09-01.ts", Started: start.AddDate(0, 0, -7)}
+	assert.NoError(t, os.Remove(writeRecording(t, dir, gone)))
+	os.WriteFile(filepath.Join(dir, "other.json"), []byte(`{"a": 1}`), 0644)
+
+	lib := Open(filepath.Join(t.TempDir(), "library.json"))
+	assert.False(t, lib.Exists())
+	n, err := lib.Rebuild(dir, dir, filepath.Join(dir, "nowhere"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	entries, err := lib.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, "xqc", entries[0].Channel)
+	e := entries[1]
+	assert.Equal(t, ID("RWXROB", start), e.ID)
+	assert.Equal(t, filepath.Join(dir, "rwxrob", "rwxrob_2021-09-08.ts"), e.Path)
+	assert.Equal(t, int64(188), e.Size)
+	assert.Equal(t, time.Hour, e.Duration())
+	assert.Equal(t, []string{"Science & Technology"}, e.Games)
+	assert.Equal(t, 2, e.Gaps)
+	assert.Equal(t, 6.0, e.GapSeconds)
+
+	// Moved recording keeps its ID
+	rec.AddTitle(start.Add(time.Hour), "Chatting", "Just Chatting")
+	rec.PostProcess = &sidecar.PostProcess{Command: "mv", Finished: start.Add(2 * time.Hour)}
+	assert.NoError(t, lib.Update(NewEntry("/archive/rwxrob_2021-09-08.ts", rec)))
+	assert.NoError(t, lib.Update(NewEntry("/archive/new.ts", sidecar.Recording{Channel: "rwxrob", File: "new.ts", Started: start.Add(24 * time.Hour)})))
+	entries, err = lib.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "/archive/rwxrob_2021-09-08.ts", entries[1].Path)
+	assert.Equal(t, []string{"Science & Technology", "Just Chatting"}, entries[1].Games)
+	assert.Equal(t, "mv", entries[1].PostProcess.Command)
+	assert.Equal(t, "new.ts", filepath.Base(entries[2].Path))
+
+	// Merged recording is kept apart from its first part
+	merged := rec
+	merged.Parts = []string{"rwxrob_2021-09-08.ts", "rwxrob_2021-09-08_2.ts"}
+	assert.NoError(t, lib.Update(NewEntry("/archive/rwxrob_2021-09-08_merged.ts", merged)))
+	assert.NoError(t, lib.Remove(e.ID, "nowhere"))
+	entries, err = lib.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "/archive/rwxrob_2021-09-08_merged.ts", entries[1].Path)
+	assert.NotEqual(t, e.ID, entries[1].ID)
+}
+
+func TestScanWithoutSidecar(t *testing.T) {
+	dir := t.TempDir()
+	segment, err := os.ReadFile(filepath.Join("..", "recorder", "testdata", "segment.ts"))
+	assert.NoError(t, err)
+	path := filepath.Join(dir, "foo", "foo_2021-09-08_12-57-06.ts")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0777))
+	assert.NoError(t, os.WriteFile(path, segment, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "foo", "clip.ts"), segment, 0644)) // Not named by default template
+	writeRecording(t, dir, sidecar.Recording{Channel: "bar", File: "bar_2021-09-07_10-00-00.ts", Started: time.Date(2021, 9, 7, 10, 0, 0, 0, time.UTC)})
+
+	entries, err := Scan(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	e := entries[1]
+	assert.Equal(t, "foo", e.Channel)
+	assert.Equal(t, path, e.Path)
+	assert.Equal(t, time.Date(2021, 9, 8, 12, 57, 6, 0, time.Local), e.Started)
+	assert.Equal(t, int64(len(segment)), e.Size)
+	assert.Equal(t, time.Second, e.Duration().Round(time.Second))
+	assert.Equal(t, e.Started.Add(e.Duration()), e.Ended)
+}
+
+func TestSearch(t *testing.T) {
+	start := time.Date(2021, 9, 8, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{ID: "aaa111", Channel: "rwxrob", Path: "/s/rwxrob/a.ts", Started: start, Tags: []string{"tech"},
+			Titles: []sidecar.Title{{Title: "Coding Go"}, {Title: "Q&A", Game: "Just Chatting"}}, Games: []string{"Just Chatting"}},
+		{ID: "aab222", Channel: "xqc", Path: "/s/xqc/b.ts", Started: start.Add(48 * time.Hour),
+			Titles: []sidecar.Title{{Title: "Speedrun", Game: "Minecraft"}}, Games: []string{"Minecraft"}},
+	}
+	ids := func(f Filter) []string {
+		var ids []string
+		for _, e := range Search(entries, f) {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"aaa111", "aab222"}, ids(Filter{}))
+	assert.Equal(t, []string{"aaa111"}, ids(Filter{Channel: "RWXROB"}))
+	assert.Equal(t, []string{"aab222"}, ids(Filter{Since: start.Add(time.Hour)}))
+	assert.Equal(t, []string{"aaa111"}, ids(Filter{Until: start.Add(time.Hour)}))
+	assert.Equal(t, []string{"aab222"}, ids(Filter{Game: "minec"}))
+	assert.Equal(t, []string{"aaa111"}, ids(Filter{Tag: "Tech"}))
+	assert.Equal(t, []string{"aaa111"}, ids(Filter{Text: "q&a"}))
+	assert.Equal(t, []string{"aab222"}, ids(Filter{Text: "b.ts"}))
+	assert.Empty(t, ids(Filter{Text: "speedrun", Channel: "rwxrob"}))
+
+	e, err := Find(entries, "aab")
+	assert.NoError(t, err)
+	assert.Equal(t, "xqc", e.Channel)
+	e, err = Find(entries, "a.ts")
+	assert.NoError(t, err)
+	assert.Equal(t, "rwxrob", e.Channel)
+	_, err = Find(entries, "aa")
+	assert.Error(t, err)
+	_, err = Find(entries, "zzz")
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	nested "github.com/antonfisher/nested-logrus-formatter"
+	log "github.com/sirupsen/logrus"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Fields used across rekoda to tag log entries, JSON output uses them as keys
+var FieldsOrder = []string{"general", "func", "status", "channel", "file"}
+
+// NewFormatter returns formatter for stated format. Colors are only meant for terminals, log files go without them
+func NewFormatter(format string, colors bool) (log.Formatter, error) {
+	switch format {
+	case "", FormatText:
+		return &nested.Formatter{
+			TimestampFormat: "[2006 Jan 2, Monday][15:04:05 MST]",
+			HideKeys:        true,
+			NoColors:        !colors,
+			FieldsOrder:     FieldsOrder,
+		}, nil
+	case FormatJSON:
+		return &log.JSONFormatter{TimestampFormat: time.RFC3339Nano}, nil
+	}
+	return nil, fmt.Errorf("unknown log format '%v', options: %v, %v", format, FormatText, FormatJSON)
+}
+
+// SessionHook is logrus hook copying every entry tagged with recording's "file" field into that recording's own log file
+type SessionHook struct {
+	formatter log.Formatter
+
+	mu    sync.Mutex
+	files map[string]io.WriteCloser
+}
+
+// NewSessionHook returns hook writing entries with formatter
+func NewSessionHook(formatter log.Formatter) *SessionHook {
+	return &SessionHook{formatter: formatter, files: make(map[string]io.WriteCloser)}
+}
+
+// Levels implements log.Hook
+func (h *SessionHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements log.Hook
+func (h *SessionHook) Fire(entry *log.Entry) error {
+	name, ok := entry.Data["file"].(string)
+	if !ok {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.files[name]
+	if !ok {
+		return nil
+	}
+	b, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Open starts capturing entries tagged with name into log file at path. Nil hook means session logs are disabled
+func (h *SessionHook) Open(name, path string) error {
+	if h == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if old, ok := h.files[name]; ok {
+		old.Close()
+	}
+	h.files[name] = f
+	return nil
+}
+
+// Close stops capturing entries tagged with name and closes its log file
+func (h *SessionHook) Close(name string) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.files[name]
+	if !ok {
+		return nil
+	}
+	delete(h.files, name)
+	return w.Close()
+}
+
+// WriterHook is logrus hook writing entries into additional output with its own formatter,
+// used to log into files without terminal colors while stdout keeps them
+type WriterHook struct {
+	Writer    io.Writer
+	Formatter log.Formatter
+
+	mu sync.Mutex
+}
+
+// Levels implements log.Hook
+func (h *WriterHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements log.Hook
+func (h *WriterHook) Fire(entry *log.Entry) error {
+	b, err := h.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = h.Writer.Write(b)
+	return err
+}
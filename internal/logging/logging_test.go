@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFormatter(t *testing.T) {
+	_, err := NewFormatter("yaml", false)
+	assert.Error(t, err)
+
+	formatter, err := NewFormatter(FormatJSON, false)
+	assert.NoError(t, err)
+
+	logger := log.New()
+	buf := &bytes.Buffer{}
+	logger.SetOutput(buf)
+	logger.SetFormatter(formatter)
+	logger.WithField("general", "REC").WithField("channel", "rwxrob").Info("Went online")
+
+	var got map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "REC", got["general"])
+	assert.Equal(t, "rwxrob", got["channel"])
+	assert.Equal(t, "Went online", got["msg"])
+	assert.Equal(t, "info", got["level"])
+}
+
+func TestSessionHook(t *testing.T) {
+	formatter, _ := NewFormatter(FormatText, false)
+	hook := NewSessionHook(formatter)
+
+	logger := log.New()
+	logger.SetOutput(&bytes.Buffer{})
+	logger.AddHook(hook)
+
+	path := filepath.Join(t.TempDir(), "rwxrob", "rwxrob_2021-09-08_12-57-06.log")
+	assert.NoError(t, hook.Open("rwxrob_2021-09-08_12-57-06.ts", path))
+
+	logger.WithField("file", "rwxrob_2021-09-08_12-57-06.ts").Info("Written 830 kB")
+	logger.WithField("file", "sodapoppin_2021-09-08_12-57-04.ts").Info("Not mine")
+	logger.Info("Untagged")
+	assert.NoError(t, hook.Close("rwxrob_2021-09-08_12-57-06.ts"))
+	logger.WithField("file", "rwxrob_2021-09-08_12-57-06.ts").Info("After close")
+
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "Written 830 kB")
+	assert.NotContains(t, string(b), "Not mine")
+	assert.NotContains(t, string(b), "Untagged")
+	assert.NotContains(t, string(b), "After close")
+	assert.NotContains(t, string(b), "\x1b[")
+}
+
+func TestNilSessionHook(t *testing.T) {
+	var hook *SessionHook
+	assert.NoError(t, hook.Open("a.ts", filepath.Join(t.TempDir(), "a.log")))
+	assert.NoError(t, hook.Close("a.ts"))
+}
@@ -0,0 +1,214 @@
+// Package merge joins recordings of one broadcast, split when stream was down longer than restart window
+// or recorder was restarted
+package merge
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wmw64/rekoda/internal/sidecar"
+	"github.com/wmw64/rekoda/pkg/mpegts"
+)
+
+// Overlap is how far recording may seem to start before the previous one ended and still follow it,
+// as end of recording never closed is guessed from media time
+const Overlap = time.Minute
+
+// Part is recording with its sidecar
+type Part struct {
+	Path string
+	Rec  sidecar.Recording
+}
+
+// End returns when recording ended, guessed from media time if sidecar was never closed
+func (p Part) End() time.Time {
+	if !p.Rec.Ended.IsZero() {
+		return p.Rec.Ended
+	}
+	return p.Rec.Started.Add(time.Duration(p.Rec.Seconds * float64(time.Second)))
+}
+
+// Parts finds recordings in dirs like library does, leaving out merged ones. Recordings without sidecar
+// are described by their names and contents, see sidecar.Guess. Dirs which don't exist are skipped
+func Parts(dirs ...string) ([]Part, error) {
+	found, err := sidecar.Find(dirs...)
+	if err != nil {
+		return nil, err
+	}
+	var parts []Part
+	for _, f := range found {
+		if len(f.Rec.Parts) == 0 {
+			parts = append(parts, Part{Path: f.Path, Rec: f.Rec})
+		}
+	}
+	return parts, nil
+}
+
+// Group returns recordings of each broadcast split into several, the oldest first. Recordings of the same
+// channel are of one broadcast if they have the same broadcast ID or one started within window after the other ended
+func Group(parts []Part, window time.Duration) [][]Part {
+	sorted := append([]Part(nil), parts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := strings.ToLower(sorted[i].Rec.Channel), strings.ToLower(sorted[j].Rec.Channel)
+		if a != b {
+			return a < b
+		}
+		return sorted[i].Rec.Started.Before(sorted[j].Rec.Started)
+	})
+
+	var groups [][]Part
+	var cur []Part
+	for _, p := range sorted {
+		if len(cur) > 0 && follows(cur, p, window) {
+			cur = append(cur, p)
+			continue
+		}
+		if len(cur) > 1 {
+			groups = append(groups, cur)
+		}
+		cur = []Part{p}
+	}
+	if len(cur) > 1 {
+		groups = append(groups, cur)
+	}
+	return groups
+}
+
+// follows reports whether recording next continues broadcast recorded in group
+func follows(group []Part, next Part, window time.Duration) bool {
+	prev := group[len(group)-1]
+	if !strings.EqualFold(prev.Rec.Channel, next.Rec.Channel) {
+		return false
+	}
+	down := next.Rec.Started.Sub(prev.End())
+	if down < -Overlap {
+		return false // Recorded at the same time, e.g. by another rekoda
+	}
+	for _, p := range group {
+		if p.Rec.Broadcast != "" && p.Rec.Broadcast == next.Rec.Broadcast {
+			return true
+		}
+	}
+	return down <= window
+}
+
+// Output returns path merged recording of parts is written to: next to the first part, named after it
+func Output(parts []Part) string {
+	first := parts[0].Path
+	ext := filepath.Ext(first)
+	return strings.TrimSuffix(first, ext) + "_merged" + ext
+}
+
+// Merged reports whether recording at path already is merged from parts
+func Merged(parts []Part, path string) bool {
+	rec, err := sidecar.Load(sidecar.Path(path))
+	if err != nil || len(rec.Parts) != len(parts) {
+		return false
+	}
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	for i, p := range parts {
+		if rec.Parts[i] != filepath.Base(p.Path) {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge joins parts at packet level into recording at path, writing sidecar combining theirs next to it.
+// File is replaced only once it's complete
+func Merge(parts []Part, path string) (sidecar.Recording, error) {
+	rec := Combine(parts, filepath.Base(path))
+	tmp := path + ".merging"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return rec, err
+	}
+	defer os.Remove(tmp)
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	j := mpegts.NewJoiner(w)
+	for _, p := range parts {
+		if err := appendFile(j, p.Path); err != nil {
+			f.Close()
+			return rec, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return rec, err
+	}
+	if err := f.Close(); err != nil {
+		return rec, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return rec, err
+	}
+	return rec, rec.Save(sidecar.Path(path))
+}
+
+func appendFile(j *mpegts.Joiner, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := j.Append(f); err != nil {
+		return fmt.Errorf("%v: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// Combine returns sidecar of recording named file merged from parts. Offsets of changes are moved along,
+// stream being down between parts becomes gap
+func Combine(parts []Part, file string) sidecar.Recording {
+	first, last := parts[0].Rec, parts[len(parts)-1]
+	m := sidecar.Recording{
+		Channel: first.Channel,
+		Quality: first.Quality,
+		Tags:    first.Tags,
+		File:    file,
+		Started: first.Started,
+		Ended:   last.End(),
+		Video:   first.Video,
+		Audio:   first.Audio,
+	}
+	var offset float64
+	for i, p := range parts {
+		r := p.Rec
+		m.Parts = append(m.Parts, filepath.Base(p.Path))
+		if m.Broadcast == "" {
+			m.Broadcast = r.Broadcast
+		}
+		if i > 0 {
+			prev := parts[i-1]
+			if down := r.Started.Sub(prev.End()); down > 0 {
+				m.Gaps = append(m.Gaps, sidecar.Gap{At: prev.End(), Seconds: down.Seconds(), Reason: "stream was down"})
+			}
+			if prev.Rec.Video != nil && r.Video != nil && *prev.Rec.Video != *r.Video {
+				m.Changes = append(m.Changes, sidecar.Change{At: r.Started, Offset: offset, From: prev.Rec.Video.String(), To: r.Video.String()})
+			}
+			if prev.Rec.Audio != nil && r.Audio != nil && *prev.Rec.Audio != *r.Audio {
+				m.Changes = append(m.Changes, sidecar.Change{At: r.Started, Offset: offset, From: prev.Rec.Audio.String(), To: r.Audio.String()})
+			}
+		}
+		for _, c := range r.Changes {
+			c.Offset += offset
+			m.Changes = append(m.Changes, c)
+		}
+		m.AdBreaks = append(m.AdBreaks, r.AdBreaks...)
+		m.Gaps = append(m.Gaps, r.Gaps...)
+		for _, t := range r.Titles {
+			m.AddTitle(t.At, t.Title, t.Game)
+		}
+		offset += r.Seconds
+	}
+	m.Seconds = offset
+	return m
+}
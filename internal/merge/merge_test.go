@@ -0,0 +1,140 @@
+package merge
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/sidecar"
+	"github.com/wmw64/rekoda/pkg/mpegts"
+)
+
+var start = time.Date(2021, 9, 8, 12, 0, 0, 0, time.UTC)
+
+// part returns recording of channel between hours from start
+func part(channel, broadcast string, from, to float64) Part {
+	at := func(h float64) time.Time { return start.Add(time.Duration(h * float64(time.Hour))) }
+	name := channel + "_" + at(from).Format("15-04") + ".ts"
+	return Part{Path: "/s/" + channel + "/" + name, Rec: sidecar.Recording{Channel: channel, Broadcast: broadcast, File: name,
+		Started: at(from), Ended: at(to), Seconds: (to - from) * 3600}}
+}
+
+func names(parts []Part) []string {
+	var names []string
+	for _, p := range parts {
+		names = append(names, filepath.Base(p.Path))
+	}
+	return names
+}
+
+func TestGroup(t *testing.T) {
+	killed := part("rwxrob", "", 5.25, 6)
+	killed.Rec.Ended = time.Time{} // End guessed from media time
+	groups := Group([]Part{
+		part("rwxrob", "", 1.5, 2),
+		part("rwxrob", "1", 0, 1),
+		part("rwxrob", "1", 4, 4.5), // Down for two hours, but the same broadcast
+		part("xqc", "", 0.5, 3),     // Other channel
+		killed,
+		part("rwxrob", "", 6.25, 7),
+		part("rwxrob", "", 6.5, 8), // Recorded at the same time
+		part("rwxrob", "", 24, 25), // Next day
+	}, 30*time.Minute)
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, []string{"rwxrob_12-00.ts", "rwxrob_13-30.ts", "rwxrob_16-00.ts"}, names(groups[0]))
+		assert.Equal(t, []string{"rwxrob_17-15.ts", "rwxrob_18-15.ts"}, names(groups[1]))
+	}
+	assert.Equal(t, "/s/rwxrob/rwxrob_12-00_merged.ts", Output(groups[0]))
+}
+
+func TestCombine(t *testing.T) {
+	a, b := part("rwxrob", "1", 0, 1), part("rwxrob", "", 1.5, 2)
+	a.Rec.Video = &mpegts.VideoInfo{Codec: "h264", Width: 1920, Height: 1080, FrameRate: 60}
+	b.Rec.Video = &mpegts.VideoInfo{Codec: "h264", Width: 1280, Height: 720, FrameRate: 60}
+	a.Rec.AddTitle(start, "Coding", "Science & Technology")
+	b.Rec.AddTitle(b.Rec.Started, "Coding", "Science & Technology")
+	b.Rec.AddTitle(b.Rec.Started.Add(time.Minute), "Q&A", "Just Chatting")
+	b.Rec.Changes = []sidecar.Change{{Offset: 60, From: "aac 48000 Hz 2ch", To: "aac 44100 Hz 2ch"}}
+	b.Rec.Gaps = []sidecar.Gap{{At: b.Rec.Started, Seconds: 2, Reason: "404"}}
+
+	m := Combine([]Part{a, b}, "merged.ts")
+	assert.Equal(t, "merged.ts", m.File)
+	assert.Equal(t, "1", m.Broadcast)
+	assert.Equal(t, []string{"rwxrob_12-00.ts", "rwxrob_13-30.ts"}, m.Parts)
+	assert.Equal(t, start, m.Started)
+	assert.Equal(t, b.Rec.Ended, m.Ended)
+	assert.Equal(t, 5400.0, m.Seconds)
+	assert.Equal(t, []sidecar.Gap{{At: a.Rec.Ended, Seconds: 1800, Reason: "stream was down"}, b.Rec.Gaps[0]}, m.Gaps)
+	assert.Equal(t, []sidecar.Change{
+		{At: b.Rec.Started, Offset: 3600, From: "h264 1920x1080 60fps", To: "h264 1280x720 60fps"},
+		{Offset: 3660, From: "aac 48000 Hz 2ch", To: "aac 44100 Hz 2ch"},
+	}, m.Changes)
+	assert.Len(t, m.Titles, 2)
+}
+
+func TestMerge(t *testing.T) {
+	segment, err := os.ReadFile(filepath.Join("..", "recorder", "testdata", "segment.ts"))
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	var parts []Part
+	for _, p := range []Part{part("rwxrob", "", 0, 1), part("rwxrob", "", 1.5, 2)} {
+		p.Path = filepath.Join(dir, p.Rec.File)
+		p.Rec.Seconds = 1
+		assert.NoError(t, os.WriteFile(p.Path, append(segment, 0x47, 0, 0), 0644)) // Cut off mid-packet
+		assert.NoError(t, p.Rec.Save(sidecar.Path(p.Path)))
+		parts = append(parts, p)
+	}
+
+	found, err := Parts(dir, filepath.Join(dir, "nowhere"))
+	assert.NoError(t, err)
+	groups := Group(found, time.Hour)
+	assert.Len(t, groups, 1)
+	out := Output(groups[0])
+	assert.False(t, Merged(groups[0], out))
+	m, err := Merge(groups[0], out)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, m.Seconds)
+	assert.True(t, Merged(groups[0], out))
+
+	f, err := os.Open(out)
+	assert.NoError(t, err)
+	defer f.Close()
+	rep, err := mpegts.Scan(f)
+	assert.NoError(t, err)
+	assert.Empty(t, rep.Problems)
+	assert.Equal(t, int64(2*len(segment)), rep.Size)
+	assert.Equal(t, 2*time.Second, rep.Duration)
+	_, err = os.Stat(out + ".merging")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Merged recording isn't a part
+	found, err = Parts(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, names(parts), names(found))
+}
+
+func TestPartsWithoutSidecar(t *testing.T) {
+	segment, err := os.ReadFile(filepath.Join("..", "recorder", "testdata", "segment.ts"))
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	for _, name := range []string{"foo_2021-09-08_12-57-06.ts", "foo_2021-09-08_13-10-00.ts", "foo_2021-09-08_18-00-00.ts"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), segment, 0644))
+	}
+
+	found, err := Parts(dir)
+	assert.NoError(t, err)
+	assert.Len(t, found, 3)
+	groups := Group(found, 30*time.Minute)
+	assert.Len(t, groups, 1, "grouped by time in their names")
+	assert.Equal(t, []string{"foo_2021-09-08_12-57-06.ts", "foo_2021-09-08_13-10-00.ts"}, names(groups[0]))
+
+	m, err := Merge(groups[0], Output(groups[0]))
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", m.Channel)
+	assert.Equal(t, []string{"foo_2021-09-08_12-57-06.ts", "foo_2021-09-08_13-10-00.ts"}, m.Parts)
+	found, err = Parts(dir)
+	assert.NoError(t, err)
+	assert.Len(t, found, 3)
+}
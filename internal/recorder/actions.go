@@ -0,0 +1,191 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/control"
+	"github.com/wmw64/rekoda/internal/scheduler"
+)
+
+// errStopped closes file of recording stopped by hand
+var errStopped = errors.New("stopped by hand")
+
+// channelSet is channels being checked, changed by actions while scheduler reads it
+type channelSet struct {
+	mu sync.Mutex
+	m  map[string]config.Channels
+}
+
+func (s *channelSet) get(name string) (config.Channels, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch, ok := s.m[name]
+	return ch, ok
+}
+
+func (s *channelSet) set(ch config.Channels) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[ch.User] = ch
+}
+
+func (s *channelSet) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, name)
+}
+
+func (s *channelSet) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.m)
+}
+
+// watchStop returns channel closed once recording of channel is stopped by hand
+func (r *Recorder) watchStop(channel string) chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stops == nil {
+		r.stops = make(map[string]chan struct{})
+	}
+	stop := make(chan struct{})
+	r.stops[channel] = stop
+	return stop
+}
+
+// stopRecording closes file being written for channel, reporting whether there was one.
+// Closed channel is kept, so sleeps starting after it return at once
+func (r *Recorder) stopRecording(channel string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stop, ok := r.stops[channel]
+	if !ok {
+		return false
+	}
+	select {
+	case <-stop:
+		return false
+	default:
+		close(stop)
+		return true
+	}
+}
+
+// sleep waits for d, returning false early once recording of channel is stopped by hand
+func (r *Recorder) sleep(channel string, d time.Duration) bool {
+	r.mu.Lock()
+	stop := r.stops[channel]
+	r.mu.Unlock()
+	if stop == nil {
+		time.Sleep(d)
+		return true
+	}
+	select {
+	case <-stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// hold keeps channel from being recorded until it's started again
+func (r *Recorder) hold(channel string, held bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.held == nil {
+		r.held = make(map[string]bool)
+	}
+	if held {
+		r.held[channel] = true
+	} else {
+		delete(r.held, channel)
+	}
+}
+
+func (r *Recorder) isHeld(channel string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.held[channel]
+}
+
+// act takes action on channel asked through control socket
+func (r *Recorder) act(log *log.Entry, c *config.Config, sched *scheduler.Scheduler, channels *channelSet, name, action string) error {
+	ctxLog := log.WithField("channel", name)
+	_, checked := channels.get(name)
+	switch action {
+	case control.ActionStart:
+		if !checked {
+			return fmt.Errorf("channel '%v' is not checked, enable it first", name)
+		}
+		r.hold(name, false)
+		r.setState(name, func(s *control.ChannelStatus) {
+			if s.State == control.StateStopped {
+				s.State = control.StateOffline
+			}
+		})
+		sched.CheckNow(name)
+		ctxLog.Info("Started by hand, checking now")
+
+	case control.ActionStop:
+		if !checked {
+			return fmt.Errorf("channel '%v' is not checked", name)
+		}
+		r.hold(name, true)
+		r.stopRecording(name)
+		r.setState(name, func(s *control.ChannelStatus) { s.State = control.StateStopped })
+		ctxLog.Info("Stopped by hand, not recording it until started again")
+
+	case control.ActionDisable, control.ActionEnable:
+		enable := action == control.ActionEnable
+		ch, err := setEnabled(c, name, enable)
+		if err != nil {
+			return err
+		}
+		if !enable {
+			channels.remove(ch.User)
+			sched.Remove(ch.User)
+			r.hold(ch.User, false)
+			r.stopRecording(ch.User)
+			r.setState(ch.User, func(s *control.ChannelStatus) { s.State = control.StateDisabled })
+			ctxLog.Info("Disabled, config file updated")
+			return nil
+		}
+		if _, err := r.httpClient(c.Settings(ch).Proxy); err != nil {
+			return fmt.Errorf("invalid proxy settings: %w", err)
+		}
+		channels.set(ch)
+		r.hold(ch.User, false)
+		r.setState(ch.User, func(s *control.ChannelStatus) { s.State = control.StateOffline })
+		sched.Set(ch.User, r.PollInterval(c, ch, time.Now()))
+		sched.CheckNow(ch.User)
+		ctxLog.Info("Enabled, config file updated")
+
+	default:
+		return fmt.Errorf("unknown action '%v'", action)
+	}
+	return nil
+}
+
+// setEnabled enables or disables channel in config file. Copy of config is updated,
+// as the one recorder runs with is read by checks at the same time
+func setEnabled(c *config.Config, name string, enabled bool) (config.Channels, error) {
+	var ch config.Channels
+	cp := *c
+	err := cp.Update(func(c *config.Config) error {
+		for i, v := range c.Channels {
+			if strings.EqualFold(v.User, name) {
+				c.Channels[i].Enabled = enabled
+				ch = c.Channels[i]
+				return nil
+			}
+		}
+		return fmt.Errorf("There is no channel '%v' in config", name)
+	})
+	return ch, err
+}
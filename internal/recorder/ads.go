@@ -0,0 +1,68 @@
+package recorder
+
+import (
+	"time"
+
+	"github.com/grafov/m3u8"
+	log "github.com/sirupsen/logrus"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/sidecar"
+)
+
+// adTracker follows ad breaks of a recording, writing each of them into sidecar once it's over
+type adTracker struct {
+	rec  *recording
+	mode string // config.AdsKeep, AdsSkip or AdsSeparate
+
+	cur     *sidecar.AdBreak // Ad break going on right now
+	total   time.Duration    // Ads seen since recording started
+	removed time.Duration    // Ads left out of recording
+}
+
+// add counts ad segment, starting new ad break if it's the first one
+func (a *adTracker) add(log *log.Entry, seg *m3u8.MediaSegment) {
+	start := seg.ProgramDateTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+	if a.cur == nil {
+		a.cur = &sidecar.AdBreak{Start: start, Ads: a.mode}
+		log.Infof("Ad break started, ads are handled as '%v'", a.mode)
+	}
+	a.cur.Segments++
+	a.cur.Seconds += seg.Duration
+	a.cur.End = start.Add(time.Duration(seg.Duration * float64(time.Second)))
+}
+
+// end finishes ad break going on, if any, when first live segment after it shows up at t
+func (a *adTracker) end(log *log.Entry, t time.Time) {
+	if a.cur == nil {
+		return
+	}
+	b := *a.cur
+	a.cur = nil
+	if !t.IsZero() && b.End.After(t) {
+		b.End = t
+	}
+	a.total += b.Duration()
+	if a.mode != config.AdsKeep {
+		a.removed += b.Duration()
+	}
+	log.Infof("Ad break ended: %v of ads in %v segments (%v)", b.Duration().Round(time.Second), b.Segments, a.mode)
+	if a.rec != nil {
+		a.rec.update(log, func(m *sidecar.Recording) {
+			m.AdBreaks = append(m.AdBreaks, b)
+			if a.mode == config.AdsSeparate && m.AdsFile == "" {
+				m.AdsFile = adsPath(m.File)
+			}
+		})
+	}
+}
+
+// report logs how much ad time was seen and removed while recording
+func (a *adTracker) report(log *log.Entry) {
+	if a.total == 0 {
+		return
+	}
+	log.Infof("Ads seen: %v, removed from recording: %v", a.total.Round(time.Second), a.removed.Round(time.Second))
+}
@@ -0,0 +1,80 @@
+package recorder
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/twitch"
+	"github.com/wmw64/rekoda/pkg/proxy"
+	"github.com/wmw64/rekoda/pkg/retry"
+)
+
+// httpClient returns client going out through proxies of settings, channels with equal settings share it.
+// Without proxies set it's the default client honoring proxy environment variables
+func (r *Recorder) httpClient(p config.ProxySettings) (*http.Client, error) {
+	if !p.Set {
+		return r.Client, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if client, ok := r.clients[p.Key()]; ok {
+		return client, nil
+	}
+
+	pool, err := proxy.New(p.URLs, p.NoProxy, p.Username, p.Password)
+	if err != nil {
+		return nil, err
+	}
+	transport := r.Client.Transport.(*http.Transport).Clone()
+	transport.Proxy = pool.Proxy
+	client := &http.Client{Timeout: r.Client.Timeout, Transport: transport}
+	if r.clients == nil {
+		r.clients = make(map[string]*http.Client)
+	}
+	r.clients[p.Key()] = client
+	return client, nil
+}
+
+// twitchClient returns API client going out through proxies of settings, retried by API retry policy
+// and authenticated with OAuth token of settings if it's known and valid
+func (r *Recorder) twitchClient(st config.ChannelSettings) (*twitch.Client, error) {
+	client, err := r.httpClient(st.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := twitchClientKey(st)
+	if tc, ok := r.twitchClients[key]; ok {
+		return tc, nil
+	}
+	api := &http.Client{Timeout: 10 * time.Second, Transport: &retry.Transport{
+		Base:    client.Transport,
+		Policy:  st.Retry.API,
+		Breaker: r.breaker,
+	}}
+	tc := twitch.NewClient(api, r.twitch.GQLEndpoint, r.twitch.ClientID)
+	tc.Token = r.tokens[st.Token]
+	if r.twitchClients == nil {
+		r.twitchClients = make(map[string]*twitch.Client)
+	}
+	r.twitchClients[key] = tc
+	return tc, nil
+}
+
+func twitchClientKey(st config.ChannelSettings) string {
+	return st.Proxy.Key() + "|token:" + st.Token
+}
+
+// PlaylistURL looks up live media playlist of channel in its quality, going through channel's proxies
+func (r *Recorder) PlaylistURL(channel config.Channels, st config.ChannelSettings) (string, error) {
+	tc, err := r.twitchClient(st)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return tc.Playlist(ctx, channel.User, channel.Quality)
+}
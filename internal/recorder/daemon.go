@@ -0,0 +1,102 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmw64/rekoda/pkg/systemd"
+)
+
+// healthTimeout is how long poll loop or any writer goroutine may stay silent before recorder is considered stuck
+var healthTimeout = 3 * time.Minute
+
+// beat marks named goroutine as alive, used by watchdog health check
+func (r *Recorder) beat(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.beats[name] = time.Now()
+}
+
+// forget stops tracking named goroutine, usually invoked when it exits
+func (r *Recorder) forget(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.beats, name)
+}
+
+// Healthy returns error naming every goroutine which did not report in for longer than maxAge
+func (r *Recorder) Healthy(maxAge time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var stale []string
+	for name, t := range r.beats {
+		if time.Since(t) > maxAge {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		return fmt.Errorf("no activity for more than %v: %v", maxAge, strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+// Watchdog sends keepalives to systemd every half of interval as long as recorder is healthy.
+// Once health check fails keepalives stop and systemd restarts the service after WatchdogSec
+func (r *Recorder) Watchdog(interval time.Duration) {
+	ctxLog := log.WithField("general", "WATCHDOG")
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := r.Healthy(healthTimeout); err != nil {
+			ctxLog.Errorf("Health check failed, skipping keepalive: '%v'", err)
+			continue
+		}
+		if _, err := systemd.Notify(systemd.Watchdog); err != nil {
+			ctxLog.Errorf("Failed to send keepalive: '%v'", err)
+		}
+	}
+}
+
+// notifyStatus reports channels being recorded right now to systemd
+func (r *Recorder) notifyStatus() {
+	r.mu.Lock()
+	online := append([]string(nil), r.Online...)
+	r.mu.Unlock()
+
+	status := "Waiting for channels to come online"
+	if len(online) > 0 {
+		status = fmt.Sprintf("Recording %v channel(s): %v", len(online), strings.Join(online, ", "))
+	}
+	if _, err := systemd.Notify(systemd.Status(status)); err != nil {
+		log.WithField("general", "REC").Debugf("Failed to notify systemd: '%v'", err)
+	}
+}
+
+// WritePidFile writes current process id into file, creating parent directories if needed
+func WritePidFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
+
+// RemovePidFile removes pidfile only if it still belongs to current process
+func RemovePidFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(b)) != strconv.Itoa(os.Getpid()) {
+		return nil
+	}
+	return os.Remove(path)
+}
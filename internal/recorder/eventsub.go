@@ -0,0 +1,158 @@
+package recorder
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/eventsub"
+	"github.com/wmw64/rekoda/internal/scheduler"
+)
+
+// announceTTL is how long go-live notification lets check skip status lookup, which may lag behind for a while
+const announceTTL = 2 * time.Minute
+
+// StartEventSub starts webhook receiver and subscribes to go-live notifications of every enabled channel.
+// Notified channels are checked right away without waiting for their poll interval
+func (r *Recorder) StartEventSub(log *log.Entry, c *config.Config, sched *scheduler.Scheduler) error {
+	ctxLog := log.WithField("func", "EVENTSUB")
+	es := c.EventSub
+	if es.Callback == "" || es.ClientID == "" || es.ClientSecret == "" {
+		return errors.New("eventsub needs callback, client_id and client_secret")
+	}
+
+	// Existing subscriptions are only usable with the secret they were made with
+	keep := true
+	if es.Secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		es.Secret = hex.EncodeToString(b)
+		cp := *c // Live config is read by other goroutines, update a copy of it
+		if err := cp.Update(func(c *config.Config) error {
+			c.EventSub.Secret = es.Secret
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to save eventsub secret: %w", err)
+		}
+		ctxLog.Info("Generated EventSub secret and saved it to config file")
+		keep = false
+	}
+
+	users := make(map[string]config.Channels) // keyed by lowercase login as twitch sends it
+	for _, u := range c.Channels {
+		if u.Enabled {
+			users[strings.ToLower(u.User)] = u
+		}
+	}
+
+	h := eventsub.NewHandler(es.Secret, func(e eventsub.Event) {
+		u, ok := users[e.BroadcasterUserLogin]
+		if !ok {
+			ctxLog.Debugf("Notification %v for unknown channel %v", e.Type, e.BroadcasterUserLogin)
+			return
+		}
+		cLog := ctxLog.WithField("channel", u.User)
+		switch e.Type {
+		case eventsub.StreamOnline:
+			cLog.Info("Went live according to EventSub")
+			r.announce(u.User)
+			sched.CheckNow(u.User)
+		case eventsub.StreamOffline:
+			cLog.Info("Went offline according to EventSub")
+		}
+	}, func(s eventsub.Subscription) {
+		ctxLog.Warnf("Subscription %v for user id %v revoked (%v), falling back to polling", s.Type, s.Condition.BroadcasterUserID, s.Status)
+	})
+
+	ln, err := net.Listen("tcp", es.Listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil {
+			ctxLog.Errorf("Receiver stopped: '%v'", err)
+		}
+	}()
+	ctxLog.Infof("Receiving notifications on %v, callback %v", ln.Addr(), es.Callback)
+
+	// Twitch verifies callback while subscribing, so receiver must be up by then
+	def := c.Settings(config.Channels{})
+	def.Token = "" // Helix calls use app token of their own
+	api, err := r.twitchClient(def)
+	if err != nil {
+		return err
+	}
+	client := eventsub.NewClient(api.HTTP, es.ClientID, es.ClientSecret, es.Callback, es.Secret)
+	go r.subscribe(ctxLog, client, users, keep)
+	return nil
+}
+
+// subscribe looks up user ids of channels and syncs subscriptions. Ids stated in config file are not trusted,
+// 'channel add' used to fill them with a placeholder
+func (r *Recorder) subscribe(log *log.Entry, client *eventsub.Client, users map[string]config.Channels, keep bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	logins := make([]string, 0, len(users))
+	for login := range users {
+		logins = append(logins, login)
+	}
+	found, err := client.UserIDs(ctx, logins)
+	if err != nil {
+		log.Errorf("Failed to look up user ids: '%v', falling back to polling", err)
+		return
+	}
+	ids := make([]string, 0, len(found))
+	for _, login := range logins {
+		if id, ok := found[login]; ok {
+			ids = append(ids, id)
+		} else {
+			log.WithField("channel", users[login].User).Warn("Channel does not exist, not subscribing")
+		}
+	}
+
+	created, deleted, err := client.Sync(ctx, ids, keep)
+	if err != nil {
+		log.Errorf("Failed to subscribe: '%v', falling back to polling", err)
+		return
+	}
+	log.Infof("Subscribed to %v channel(s): %v subscription(s) created, %v removed", len(ids), created, deleted)
+}
+
+// announce lets next check of channel skip status lookup
+func (r *Recorder) announce(u string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.announced == nil {
+		r.announced = make(map[string]time.Time)
+	}
+	r.announced[u] = time.Now()
+}
+
+// wasAnnounced reports whether channel recently went live according to EventSub, forgetting it
+func (r *Recorder) wasAnnounced(u string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.announced[u]
+	delete(r.announced, u)
+	return ok && time.Since(t) < announceTTL
+}
+
+// isAnnounced is wasAnnounced which doesn't forget channel
+func (r *Recorder) isAnnounced(u string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.announced[u]
+	return ok && time.Since(t) < announceTTL
+}
@@ -0,0 +1,51 @@
+package recorder
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/wmw64/rekoda/internal/library"
+	"github.com/wmw64/rekoda/internal/twitch"
+)
+
+// UseLibrary makes recorder keep catalog of recordings in file at path
+func (r *Recorder) UseLibrary(path string) {
+	r.library = library.Open(path)
+}
+
+func (r *Recorder) addRecording(rec *recording) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.recordings == nil {
+		r.recordings = make(map[string]*recording)
+	}
+	r.recordings[rec.channel] = rec
+}
+
+func (r *Recorder) removeRecording(rec *recording) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.recordings[rec.channel] == rec {
+		delete(r.recordings, rec.channel)
+	}
+}
+
+// noteStream adds broadcast, title and game of live stream to recording of channel, if it's being recorded
+func (r *Recorder) noteStream(log *log.Entry, channel string, st twitch.Stream) {
+	r.mu.Lock()
+	rec := r.recordings[channel]
+	r.mu.Unlock()
+	if rec != nil {
+		rec.addStream(log, st)
+	}
+}
+
+// trackTitle looks up broadcast, title and game of channel being recorded, so their changes are kept in its sidecar
+func (r *Recorder) trackTitle(log *log.Entry, channel string) {
+	if r.status == nil {
+		return
+	}
+	st, err := r.status.Status(channel)
+	if err != nil || !st.Live {
+		return
+	}
+	r.noteStream(log, channel, st)
+}
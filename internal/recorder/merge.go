@@ -0,0 +1,82 @@
+package recorder
+
+import (
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/library"
+	"github.com/wmw64/rekoda/internal/merge"
+)
+
+// scheduleMerge merges recording just closed with recordings of the same broadcast before it in dir once merge window
+// passes without channel being recorded again, so broadcast is merged once rather than as each part is closed
+func (r *Recorder) scheduleMerge(log *log.Entry, channel string, st config.ChannelSettings, dir, fpath string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.merges == nil {
+		r.merges = make(map[string]*time.Timer)
+	}
+	var t *time.Timer
+	t = time.AfterFunc(st.MergeWindow, func() {
+		r.mu.Lock()
+		if r.merges[channel] != t {
+			r.mu.Unlock()
+			return // Channel was recorded again
+		}
+		delete(r.merges, channel)
+		r.mu.Unlock()
+		r.mergeBroadcast(log, st, dir, fpath)
+	})
+	r.merges[channel] = t
+}
+
+// cancelMerge stops merge of channel waiting for merge window to pass, recording starting again is merged
+// together with parts before it once it's closed
+func (r *Recorder) cancelMerge(channel string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.merges[channel]; ok {
+		t.Stop()
+		delete(r.merges, channel)
+	}
+}
+
+// dropMerges stops merges waiting for merge window to pass on shutdown, leaving them to 'rekoda merge'
+func (r *Recorder) dropMerges(log *log.Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for channel, t := range r.merges {
+		t.Stop()
+		log.WithField("channel", channel).Warn("Broadcast not merged yet, run 'rekoda merge' to merge it")
+	}
+	r.merges = nil
+}
+
+// mergeBroadcast merges recording with recordings of the same broadcast before it in dir, if there are any.
+// Parts are left as they are
+func (r *Recorder) mergeBroadcast(log *log.Entry, st config.ChannelSettings, dir, fpath string) {
+	parts, err := merge.Parts(dir)
+	if err != nil {
+		log.Errorf("Failed to find recordings to merge: '%v'", err)
+		return
+	}
+	for _, g := range merge.Group(parts, st.MergeWindow) {
+		if filepath.Clean(g[len(g)-1].Path) != filepath.Clean(fpath) {
+			continue
+		}
+		out := merge.Output(g)
+		log.Infof("Merging %v recordings of broadcast into %v", len(g), out)
+		m, err := merge.Merge(g, out)
+		if err != nil {
+			log.Errorf("Failed to merge recordings: '%v'", err)
+			return
+		}
+		if r.library != nil {
+			if err := r.library.Update(library.NewEntry(out, m)); err != nil {
+				log.Errorf("Failed to update library: '%v'", err)
+			}
+		}
+	}
+}
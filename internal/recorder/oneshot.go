@@ -0,0 +1,202 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/logging"
+	"github.com/wmw64/rekoda/internal/twitch"
+	"github.com/wmw64/rekoda/pkg/retry"
+)
+
+// OneShot is recording of a single channel which is not taken from config file, see 'rekoda rec <channel>'
+type OneShot struct {
+	Target        string         // Channel name or its twitch.tv URL
+	Quality       string         // Quality of channel in config file or best if empty
+	File          string         // Recording path, streams dir and file name template are used if empty
+	Duration      time.Duration  // Close file after recording this long, 0 for no limit
+	Wait          bool           // Wait for channel to go live instead of failing when it's offline
+	RestartWindow *time.Duration // Overrides restart window of channel if set
+	Pipe          string         // Stream into this FIFO or file too, PipeStdout for standard output
+	PipeBuffer    int            // Bytes queued for slow pipe consumer before segments are dropped
+	Tee           bool           // Write file as well when streaming into Pipe
+}
+
+var loginRe = regexp.MustCompile(`^[a-zA-Z0-9_]{1,25}$`)
+
+// ParseTarget returns channel name of channel name or its twitch.tv URL
+func ParseTarget(target string) (string, error) {
+	if loginRe.MatchString(target) {
+		return target, nil
+	}
+	s := target
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("'%v' is neither channel name nor URL: %w", target, err)
+	}
+	host := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(u.Hostname()), "www."), "m.")
+	if host != "twitch.tv" {
+		return "", fmt.Errorf("'%v' is not a twitch.tv URL", target)
+	}
+	name := strings.Trim(u.Path, "/")
+	if !loginRe.MatchString(name) || name == "videos" || strings.HasPrefix(name, "directory") {
+		return "", fmt.Errorf("'%v' is not a URL of a channel", target)
+	}
+	return name, nil
+}
+
+// RecordOnce records one stream of channel, leaving config file as it is. It returns once file is closed:
+// when stream ends and doesn't come back during restart window, max duration passes or <Ctrl>+<C> is pressed
+func RecordOnce(o OneShot) error {
+	ctxLog := log.WithField("general", "REC")
+	name, err := ParseTarget(o.Target)
+	if err != nil {
+		return err
+	}
+
+	c := config.InitConfig()
+	r := New()
+
+	// Channel in config file lends its settings
+	ch := config.NewChannel(name)
+	for _, u := range c.Channels {
+		if strings.EqualFold(u.User, name) {
+			ch = u
+			ctxLog.Debugf("Using settings of channel '%v' in config file", u.User)
+			break
+		}
+	}
+	if o.Quality != "" {
+		ch.Quality = o.Quality
+	}
+	if err := ch.Validate(); err != nil {
+		return err
+	}
+	st := c.Settings(ch)
+	if o.RestartWindow != nil {
+		st.RestartWindow = *o.RestartWindow
+	}
+	cLog := ctxLog.WithField("channel", ch.User)
+
+	if c.SessionLog {
+		formatter, err := logging.NewFormatter(c.LogFormat, false)
+		if err != nil {
+			return err
+		}
+		r.sessions = logging.NewSessionHook(formatter)
+		log.AddHook(r.sessions)
+	}
+	r.breaker = retry.NewBreaker(c.Breaker.Get())
+	r.twitch = c.Twitch
+	if err := r.LoadTokens(ctxLog, c); err != nil {
+		return fmt.Errorf("failed to read OAuth tokens: %w", err)
+	}
+	if _, err := r.httpClient(st.Proxy); err != nil {
+		return fmt.Errorf("invalid proxy settings: %w", err)
+	}
+	r.UseLibrary(c.LibraryFile())
+	def := c.Settings(config.Channels{})
+	def.Token = ""
+	if api, err := r.twitchClient(def); err == nil {
+		r.status = twitch.NewBatcher(api) // Title is followed for library
+	}
+
+	// First <Ctrl>+<C> closes file, the second one quits at once
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	var hlsURL string
+	for {
+		hlsURL, err = r.PlaylistURL(ch, st)
+		if err == nil {
+			break
+		}
+		switch {
+		case errors.Is(err, twitch.ErrRestricted):
+			return errors.New("stream is subscriber-only or geo-restricted. Set 'token' of an account allowed to watch it, see 'rekoda token set'")
+		case !errors.Is(err, twitch.ErrOffline):
+			return fmt.Errorf("failed to get m3u8 live playlist: %w", err)
+		case !o.Wait:
+			return fmt.Errorf("channel '%v' is offline, use --wait to wait for it to go live", ch.User)
+		}
+		cLog.Infof("Channel is offline, checking again in %v", st.PollInterval)
+		select {
+		case <-sig:
+			return errors.New("interrupted while waiting for channel to go live")
+		case <-time.After(st.PollInterval):
+		}
+	}
+
+	cLog.Info("🤩 Online! ")
+	cLog.Infof("Opening stream: %v", ch.Quality)
+	cLog.Debugf("URL: %v", hlsURL)
+	out := output{File: o.File}
+	if o.Pipe != "" {
+		// Consumer going away ends recording, unless file is written too
+		out.PipeOnly = !o.Tee && o.File == ""
+		signal.Ignore(syscall.SIGPIPE)
+		out.Pipe = openPipe(cLog, o.Pipe, o.PipeBuffer, func(err error) {
+			if out.PipeOnly {
+				cLog.Infof("Stopped streaming: '%v', closing", err)
+				r.stopRecording(ch.User)
+				return
+			}
+			cLog.Warnf("Stopped streaming: '%v', still writing file", err)
+		})
+		cLog.Infof("Streaming into %v", pipeName(o.Pipe))
+	}
+	done, err := r.record(cLog, st, ch, out, hlsURL)
+	if err != nil {
+		return err
+	}
+
+	r.trackTitle(cLog, ch.User)
+	titles := time.NewTicker(st.PollInterval)
+	defer titles.Stop()
+
+	var limit <-chan time.Time
+	if o.Duration > 0 {
+		limit = time.After(o.Duration)
+	}
+	interrupted := false
+	for {
+		select {
+		case <-titles.C:
+			r.trackTitle(cLog, ch.User)
+		case <-done:
+			cLog.Info("Recording finished")
+			return nil
+		case <-limit:
+			cLog.Infof("Recorded for %v, closing file", o.Duration)
+			r.stopRecording(ch.User)
+			limit = nil
+		case <-sig:
+			if interrupted {
+				return errors.New("interrupted before file was closed")
+			}
+			interrupted = true
+			cLog.Info("Interrupted! Closing file, press <Ctrl>+<C> again to quit at once")
+			r.stopRecording(ch.User)
+		}
+	}
+}
+
+func pipeName(path string) string {
+	if path == PipeStdout {
+		return "standard output"
+	}
+	return path
+}
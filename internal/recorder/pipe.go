@@ -0,0 +1,151 @@
+package recorder
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	log "github.com/sirupsen/logrus"
+)
+
+// PipeStdout is pipe path of standard output
+const PipeStdout = "-"
+
+// pipeDrain is how long closing pipe waits for consumer to take segments queued before it's abandoned
+const pipeDrain = 10 * time.Second
+
+// pipe streams segments into a consumer such as player or FIFO. Recording never waits for it:
+// segments are queued up to max bytes, the oldest ones are dropped once consumer falls that far behind
+type pipe struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   [][]byte
+	size    int // Bytes queued
+	max     int
+	dropped int
+	closed  bool // No more segments are coming
+	failed  bool // Consumer is gone
+	w       io.WriteCloser
+	drain   time.Duration
+	abandon chan struct{} // Closed once consumer is given up on, stops waiting for FIFO reader
+	done    chan struct{}
+	log     *log.Entry
+	onError func(err error)
+}
+
+// openPipe starts streaming into path, standard output for PipeStdout. FIFO is opened in background,
+// retrying until its other end is opened too. onError is called once consumer is gone
+func openPipe(log *log.Entry, path string, max int, onError func(err error)) *pipe {
+	open := func(abandon <-chan struct{}) (io.WriteCloser, error) {
+		if path == PipeStdout {
+			return os.Stdout, nil
+		}
+		return openWriter(path, abandon)
+	}
+	return newPipe(log.WithField("func", "PIPE"), open, max, onError)
+}
+
+func newPipe(log *log.Entry, open func(abandon <-chan struct{}) (io.WriteCloser, error), max int, onError func(err error)) *pipe {
+	p := &pipe{max: max, drain: pipeDrain, abandon: make(chan struct{}), done: make(chan struct{}), log: log, onError: onError}
+	p.cond = sync.NewCond(&p.mu)
+	go p.run(open)
+	return p
+}
+
+// Write queues segment, dropping the oldest ones queued if consumer is too slow
+func (p *pipe) Write(b []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.failed {
+		return
+	}
+	p.queue = append(p.queue, b)
+	p.size += len(b)
+	dropped := 0
+	for p.size > p.max && len(p.queue) > 1 {
+		p.size -= len(p.queue[0])
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		dropped++
+	}
+	if dropped > 0 {
+		p.dropped += dropped
+		p.log.Warnf("Consumer is more than %v behind, dropped %v segment(s), %v in total", humanize.Bytes(uint64(p.max)), dropped, p.dropped)
+	}
+	p.cond.Signal()
+}
+
+// Close writes segments queued and closes consumer's end. Consumer which doesn't take them within drain
+// is abandoned: segments left are dropped and its end is closed, which ends write it's stuck in
+func (p *pipe) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Signal()
+	p.mu.Unlock()
+	select {
+	case <-p.done:
+		return
+	case <-time.After(p.drain):
+	}
+
+	p.mu.Lock()
+	left := p.size
+	p.failed = true
+	p.queue, p.size = nil, 0
+	w := p.w
+	p.mu.Unlock()
+	close(p.abandon)
+	p.log.Warnf("Consumer took nothing for %v, dropped %v left and closed it", p.drain, humanize.Bytes(uint64(left)))
+	if w != nil {
+		w.Close()
+	}
+}
+
+func (p *pipe) run(open func(abandon <-chan struct{}) (io.WriteCloser, error)) {
+	defer close(p.done)
+	w, err := open(p.abandon)
+	if err != nil {
+		p.fail(err)
+		return
+	}
+	defer w.Close()
+	p.mu.Lock()
+	p.w = w
+	p.mu.Unlock()
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if len(p.queue) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		b := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.size -= len(b)
+		p.mu.Unlock()
+
+		if _, err := w.Write(b); err != nil {
+			p.fail(err)
+			return
+		}
+	}
+}
+
+func (p *pipe) fail(err error) {
+	p.mu.Lock()
+	if p.failed { // Abandoned
+		p.mu.Unlock()
+		return
+	}
+	p.failed = true
+	p.queue, p.size = nil, 0
+	p.mu.Unlock()
+	if p.onError != nil {
+		p.onError(err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9 || js || wasip1
+
+package recorder
+
+import (
+	"io"
+	"os"
+)
+
+// openWriter opens path for writing, there are no FIFOs to wait for
+func openWriter(path string, abandon <-chan struct{}) (io.WriteCloser, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
@@ -0,0 +1,107 @@
+package recorder
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowConsumer blocks every write until it's let go
+type slowConsumer struct {
+	bytes.Buffer
+	next   chan struct{}
+	err    error
+	closed bool
+}
+
+func (c *slowConsumer) Write(b []byte) (int, error) {
+	<-c.next
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.Buffer.Write(b)
+}
+
+func (c *slowConsumer) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestPipeDropsOldest(t *testing.T) {
+	c := &slowConsumer{next: make(chan struct{})}
+	p := newPipe(log.WithField("channel", "rwxrob"), func(<-chan struct{}) (io.WriteCloser, error) { return c, nil }, 4, nil)
+
+	p.Write([]byte("aa")) // Taken by consumer, which is stuck writing it
+	for {
+		p.mu.Lock()
+		taken := len(p.queue) == 0
+		p.mu.Unlock()
+		if taken {
+			break
+		}
+	}
+	p.Write([]byte("bb"))
+	p.Write([]byte("cc"))
+	p.Write([]byte("dd")) // Queue is over 4 bytes, bb goes
+	close(c.next)
+	p.Close()
+
+	assert.Equal(t, "aaccdd", c.String())
+	assert.Equal(t, 1, p.dropped)
+	assert.True(t, c.closed)
+}
+
+func TestPipeConsumerGone(t *testing.T) {
+	c := &slowConsumer{next: make(chan struct{}), err: errors.New("broken pipe")}
+	close(c.next)
+	var mu sync.Mutex
+	var gone error
+	p := newPipe(log.WithField("channel", "rwxrob"), func(<-chan struct{}) (io.WriteCloser, error) { return c, nil }, 1024, func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		gone = err
+	})
+	p.Write([]byte("aa"))
+	p.Close()
+	p.Write([]byte("bb")) // Ignored once closed
+
+	assert.EqualError(t, gone, "broken pipe")
+	assert.Empty(t, p.queue)
+
+	newPipe(log.WithField("channel", "rwxrob"), func(<-chan struct{}) (io.WriteCloser, error) { return nil, errors.New("no such fifo") }, 1024, func(err error) {
+		assert.EqualError(t, err, "no such fifo")
+	}).Close()
+}
+
+func TestPipeCloseAbandonsStuckConsumer(t *testing.T) {
+	c := &slowConsumer{next: make(chan struct{})}
+	p := newPipe(log.WithField("channel", "rwxrob"), func(<-chan struct{}) (io.WriteCloser, error) { return c, nil }, 1024, nil)
+	p.drain = 50 * time.Millisecond
+
+	p.Write([]byte("aa")) // Consumer is stuck writing it
+	p.Write([]byte("bb"))
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waits for stuck consumer")
+	}
+	p.mu.Lock()
+	assert.Empty(t, p.queue)
+	p.mu.Unlock()
+
+	close(c.next)
+	<-p.done
+	assert.True(t, c.closed)
+	assert.NotContains(t, c.String(), "bb")
+}
@@ -0,0 +1,27 @@
+//go:build !windows && !plan9 && !js && !wasip1
+
+package recorder
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// openWriter opens path for writing. FIFO nobody reads yet is opened again every now and then
+// instead of blocking, until reader comes or abandon is closed
+func openWriter(path string, abandon <-chan struct{}) (io.WriteCloser, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_NONBLOCK, 0644)
+		if !errors.Is(err, syscall.ENXIO) {
+			return f, err
+		}
+		select {
+		case <-abandon:
+			return nil, errors.New("nobody opened FIFO for reading")
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !windows && !plan9 && !js && !wasip1
+
+package recorder
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeFIFO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.fifo")
+	assert.NoError(t, syscall.Mkfifo(path, 0600))
+
+	// Nobody ever reads, closing gives up on FIFO
+	var gone error
+	p := openPipe(log.WithField("channel", "rwxrob"), path, 1024, func(err error) { gone = err })
+	p.drain = 50 * time.Millisecond
+	p.Write([]byte("aa"))
+	p.Close()
+	<-p.done
+	assert.NoError(t, gone, "abandoned consumer is not an error")
+
+	// Reader coming later gets everything
+	p = openPipe(log.WithField("channel", "rwxrob"), path, 1024, nil)
+	p.Write([]byte("aa"))
+	time.Sleep(300 * time.Millisecond)
+	r, err := os.Open(path)
+	assert.NoError(t, err)
+	defer r.Close()
+	p.Write([]byte("bb"))
+	p.Close()
+	b, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "aabb", string(b))
+}
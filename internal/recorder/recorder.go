@@ -1,14 +1,19 @@
 package recorder
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,23 +23,59 @@ import (
 	lru "github.com/hashicorp/golang-lru"
 	log "github.com/sirupsen/logrus"
 	"github.com/wmw64/rekoda/internal/config"
-	"github.com/wmw64/twitchpl"
+	"github.com/wmw64/rekoda/internal/control"
+	"github.com/wmw64/rekoda/internal/history"
+	"github.com/wmw64/rekoda/internal/library"
+	"github.com/wmw64/rekoda/internal/logging"
+	"github.com/wmw64/rekoda/internal/scheduler"
+	"github.com/wmw64/rekoda/internal/sidecar"
+	"github.com/wmw64/rekoda/internal/tui"
+	"github.com/wmw64/rekoda/internal/twitch"
+	"github.com/wmw64/rekoda/pkg/retry"
+	"github.com/wmw64/rekoda/pkg/systemd"
 )
 
 var (
-	USER_AGENT      = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:86.0) Gecko/20100101 Firefox/86.0"
-	backoffSchedule = []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 10 * time.Second}
+	USER_AGENT = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:86.0) Gecko/20100101 Firefox/86.0"
 )
 
 type Recorder struct {
 	Segments Segment
 	Online   []string
 	Client   *http.Client
+
+	mu        sync.Mutex
+	beats     map[string]time.Time // last activity of poll loop and writer goroutines
+	sessions  *logging.SessionHook // per-recording log files, nil when disabled
+	status    *twitch.Batcher      // live status lookups of all channels checked at about the same time
+	announced map[string]time.Time // channels EventSub said went live, see announce
+	history   *history.Store       // observed online and offline times, nil when not recording
+	library   *library.Library     // catalog of recordings, nil when not kept
+	breaker   *retry.Breaker       // shared by all requests, nil lets everything through
+
+	twitch        config.Twitch             // API endpoints
+	clients       map[string]*http.Client   // per proxy settings, see httpClient
+	twitchClients map[string]*twitch.Client // per proxy settings and token, see twitchClient
+	tokens        map[string]string         // valid OAuth tokens by name, see LoadTokens
+	states        map[string]*control.ChannelStatus
+	started       time.Time
+	stops         map[string]chan struct{} // closed to stop recording by hand, see act
+	held          map[string]bool          // stopped by hand, not recorded until started again
+	recordings    map[string]*recording    // being written by channel, see noteTitle
+	merges        map[string]*time.Timer   // broadcasts to merge by channel once merge window passes, see scheduleMerge
+	control       *http.Server             // answers on control socket, nil when it's not open
+	controlPath   string
+}
+
+// Options changes how recorder runs
+type Options struct {
+	TUI bool // Show dashboard instead of logs when stdout is a terminal
 }
 
 type Segment struct {
-	URI           string
-	totalDuration time.Duration
+	URI      string
+	duration time.Duration // Stated in playlist
+	Ad       bool          // Goes into ads file instead of recording
 }
 
 // New is used to create Recorder object and initializing http.Client
@@ -42,14 +83,17 @@ func New() *Recorder {
 	return &Recorder{
 		Client: &http.Client{Timeout: 5 * time.Second,
 			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
 				MaxIdleConnsPerHost: 100,
 				IdleConnTimeout:     90 * time.Second},
 		},
+		beats:   make(map[string]time.Time),
+		started: time.Now(),
 	}
 }
 
 // Start is main infinite loop function used to start recording channels and checking streams to come out live
-func Start() {
+func Start(opts Options) {
 	ctxLog := log.WithField("general", "REC")
 	ctxLog.Info("Recorder starting")
 
@@ -61,60 +105,276 @@ func Start() {
 		return
 	}
 
+	if c.SessionLog {
+		formatter, err := logging.NewFormatter(c.LogFormat, false)
+		if err != nil {
+			ctxLog.Error(err)
+			return
+		}
+		r.sessions = logging.NewSessionHook(formatter)
+		log.AddHook(r.sessions)
+	}
+
+	if c.PidFile != "" {
+		if err := WritePidFile(c.PidFile); err != nil {
+			ctxLog.Errorf("Failed to write pidfile: '%v'", err)
+			return
+		}
+		ctxLog.Debugf("Pidfile written: %v", c.PidFile)
+	}
+
+	// Dashboard takes over the terminal, log goes into it instead
+	dashboard := opts.TUI && tui.IsTerminal(os.Stdin.Fd()) && tui.IsTerminal(os.Stdout.Fd())
+	if opts.TUI && !dashboard {
+		ctxLog.Warn("Not a terminal, logging instead of showing dashboard")
+	}
+	var logs *tui.LogBuffer
+	if dashboard {
+		logs = tui.NewLogBuffer(100)
+		log.AddHook(logs)
+		log.SetOutput(io.Discard)
+	}
+
 	// Capture <Ctrl>+<C>
-	sig := make(chan os.Signal)
+	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	if !dashboard {
+		go func() {
+			<-sig
+			r.cleanup(c)
+			os.Exit(1)
+		}()
+	}
+
+	// Tell systemd we are up and keep its watchdog fed while poll loop and writers are alive
+	r.beat("poll")
+	if _, err := systemd.Notify(systemd.Ready); err != nil {
+		ctxLog.Errorf("Failed to notify systemd: '%v'", err)
+	}
+	r.notifyStatus()
+	if interval, err := systemd.WatchdogInterval(); err != nil {
+		ctxLog.Errorf("Invalid watchdog settings: '%v'", err)
+	} else if interval > 0 {
+		ctxLog.Debugf("Systemd watchdog enabled, timeout %v", interval)
+		go r.Watchdog(interval)
+	}
+
+	// Main cycle where all the magic happens ✨
+	// Every enabled channel is checked concurrently on its own poll interval
+	channels := &channelSet{m: make(map[string]config.Channels)}
+	r.breaker = retry.NewBreaker(c.Breaker.Get())
+	r.twitch = c.Twitch
+	if err := r.LoadTokens(ctxLog, c); err != nil {
+		ctxLog.Errorf("Failed to read OAuth tokens: '%v'", err)
+		return
+	}
+	go r.WatchTokens(ctxLog, c)
+
+	// Status lookups of all channels go through [defaults] proxies, anonymously as they need no token
+	def := c.Settings(config.Channels{})
+	def.Token = ""
+	api, err := r.twitchClient(def)
+	if err != nil {
+		ctxLog.Errorf("Invalid proxy settings in [defaults]: '%v'", err)
+		return
+	}
+	r.status = twitch.NewBatcher(api)
+	r.UseHistory(c.HistoryDir())
+	if err := r.history.Recover(); err != nil {
+		ctxLog.Errorf("Failed to end sessions left open in channel history: '%v'", err)
+	}
+	r.UseLibrary(c.LibraryFile())
+	sched := r.newScheduler(ctxLog, c, channels)
+	workers, rate, _ := c.Scheduler.Get()
+	sched.Heartbeat = func() { r.beat("poll") }
+	for _, u := range c.Channels {
+		if !u.Enabled {
+			r.setState(u.User, func(s *control.ChannelStatus) { s.State = control.StateDisabled })
+			continue
+		}
+		if _, err := r.httpClient(c.Settings(u).Proxy); err != nil {
+			ctxLog.WithField("channel", u.User).Errorf("Invalid proxy settings, not recording: '%v'", err)
+			continue
+		}
+		channels.set(u)
+		r.setState(u.User, func(s *control.ChannelStatus) {})
+		sched.Set(u.User, r.PollInterval(c, u, time.Now()))
+	}
+	ctxLog.Debugf("Checking %v channel(s) with %v workers, %v batches of checks per second at most", channels.len(), workers, rate)
+	if c.EventSub.Listen != "" {
+		if err := r.StartEventSub(ctxLog, c, sched); err != nil {
+			ctxLog.Errorf("Failed to start EventSub: '%v', relying on polling only", err)
+		}
+	}
+	act := func(channel, action string) error { return r.act(ctxLog, c, sched, channels, channel, action) }
+	r.ServeControl(ctxLog, c.SocketFile(), sched, act)
+	go r.ReportStaleness(ctxLog, sched)
+	if !dashboard {
+		sched.Run(nil)
+		return
+	}
+
+	go sched.Run(nil)
+	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
 		<-sig
-		cleanup()
-		os.Exit(1)
+		cancel()
 	}()
+	src := tui.Source{
+		Status: func() (control.Status, error) { return r.Status(sched), nil },
+		Act:    act,
+		Logs:   logs,
+	}
+	if err := tui.Run(ctx, os.Stdin, os.Stdout, src, time.Second); err != nil {
+		log.SetOutput(os.Stderr)
+		ctxLog.Errorf("Dashboard failed: '%v'", err)
+	}
+	log.SetOutput(os.Stderr)
+	r.cleanup(c)
+}
 
-	// Main cycle where all the magic happens ✨
-	for {
-		ctxLog.Debugf("Channels being recorded right now: %v", r.Online)
-		for _, u := range c.Channels {
-			defer recoverFromPanic()
-			ctxLog.Tracef("Checking %v", u.User)
-			if u.Enabled && !r.IsOnline(u.User) {
-				cLog := ctxLog.WithField("channel", u.User)
-				cLog.Info("Trying to get m3u8 live playlist")
-				pl, err := twitchpl.Get(u.User)
-				if err != nil {
-					cLog.Info("Channel is offline or banned.")
-					continue
-				}
-				cLog.Info("🤩 Went online! ")
-				switch u.Quality {
-				case "best":
-					cLog.Info("Opening stream: best quality")
-					url := pl.Best().AsURL()
-					cLog.Debugf("URL: %v", url)
-					r.Rec(cLog, c, u, url)
-				case "worst":
-					cLog.Info("Opening stream: worst quality")
-					url := pl.Worst().AsURL()
-					cLog.Debugf("URL: %v", url)
-					r.Rec(cLog, c, u, url)
-				case "audio_only":
-					cLog.Info("Opening stream: audio_only")
-					url := pl.Audio().AsURL()
-					cLog.Debugf("URL: %v", url)
-					r.Rec(cLog, c, u, url)
-
-				}
+// newScheduler returns scheduler checking channels of set. Status of channels checked at the same tick
+// is looked up with one request, channels being recorded or announced by EventSub need no lookup
+func (r *Recorder) newScheduler(log *log.Entry, c *config.Config, channels *channelSet) *scheduler.Scheduler {
+	workers, rate, jitter := c.Scheduler.Get()
+	var sched *scheduler.Scheduler
+	sched = scheduler.New(workers, rate, jitter, func(name string) {
+		u, ok := channels.get(name)
+		if !ok {
+			return // Disabled meanwhile
+		}
+		r.Check(log, c, u)
+		sched.Set(name, r.PollInterval(c, u, time.Now()))
+	})
+	sched.Batch = twitch.MaxLogins
+	sched.Prefetch = func(names []string) {
+		if r.status == nil {
+			return
+		}
+		var logins []string
+		for _, name := range names {
+			if !r.IsOnline(name) && !r.isHeld(name) && !r.isAnnounced(name) {
+				logins = append(logins, name)
 			}
-			time.Sleep(1 * time.Second)
 		}
-		ctxLog.Infof("Sleep for 1 minute")
-		time.Sleep(1 * time.Minute)
+		r.status.Prefetch(logins)
+	}
+	return sched
+}
+
+// Check looks if channel went online and starts recording it
+func (r *Recorder) Check(log *log.Entry, c *config.Config, u config.Channels) {
+	defer recoverFromPanic()
+	log.Tracef("Checking %v", u.User)
+	cLog := log.WithField("channel", u.User)
+	if r.IsOnline(u.User) {
+		r.recordSeen(cLog, u.User, time.Now())
+		r.trackTitle(cLog, u.User)
+		return
+	}
+	if r.isHeld(u.User) {
+		return
+	}
+
+	startedAt := time.Now()
+	var live twitch.Stream
+	if r.status != nil && !r.wasAnnounced(u.User) {
+		st, err := r.status.Status(u.User)
+		switch {
+		case err != nil:
+			cLog.Errorf("Failed to get live status: %v", err)
+			r.setError(u.User, fmt.Sprintf("live status: %v", err))
+			return
+		case !st.Exists:
+			cLog.Info("Channel does not exist or is banned.")
+			return
+		case !st.Live:
+			cLog.Debug("Channel is offline.")
+			return
+		}
+		cLog.Infof("Live: %v (%v)", st.Title, st.Game)
+		live = st
+		if !st.StartedAt.IsZero() {
+			startedAt = st.StartedAt
+		}
+	}
+
+	// Playlist is only requested for live channels
+	cLog.Info("Trying to get m3u8 live playlist")
+	url, err := r.PlaylistURL(u, c.Settings(u))
+	if errors.Is(err, twitch.ErrOffline) {
+		cLog.Info("Channel is offline or banned.")
+		return
+	}
+	if errors.Is(err, twitch.ErrRestricted) {
+		cLog.Error("Stream is subscriber-only or geo-restricted. Set 'token' of an account allowed to watch it, see 'rekoda token set'")
+		r.setError(u.User, err.Error())
+		return
+	}
+	if err != nil {
+		cLog.Errorf("Failed to get m3u8 live playlist: '%v'", err)
+		r.setError(u.User, fmt.Sprintf("playlist: %v", err))
+		return
 	}
+	cLog.Info("🤩 Went online! ")
+	r.recordOnline(cLog, u.User, startedAt)
+	cLog.Infof("Opening stream: %v", u.Quality)
+	cLog.Debugf("URL: %v", url)
+	r.Rec(cLog, c, u, url)
+	if live.Live {
+		r.noteStream(cLog, u.User, live)
+	} else {
+		r.trackTitle(cLog, u.User) // Announced by EventSub
+	}
+}
 
+// ReportStaleness logs every minute how long ago channels were checked, warning about ones checks fall behind for
+// and about hosts circuit breaker holds open
+func (r *Recorder) ReportStaleness(log *log.Entry, sched *scheduler.Scheduler) {
+	ctxLog := log.WithField("func", "SCHED")
+	for range time.Tick(1 * time.Minute) {
+		r.mu.Lock()
+		online := append([]string(nil), r.Online...)
+		r.mu.Unlock()
+		ctxLog.Debugf("Channels being recorded right now: %v", online)
+		if open := r.breaker.Open(); len(open) > 0 {
+			ctxLog.Warnf("Backing off failing hosts: %v", strings.Join(open, ", "))
+		}
+		for _, st := range sched.Status() {
+			if r.IsOnline(st.Name) {
+				continue
+			}
+			if st.Stale > 2*st.Interval+time.Minute {
+				ctxLog.WithField("channel", st.Name).Warnf("Last checked %v ago while poll interval is %v, checks are falling behind", st.Stale.Round(time.Second), st.Interval)
+				continue
+			}
+			ctxLog.WithField("channel", st.Name).Tracef("Last checked %v ago", st.Stale.Round(time.Second))
+		}
+	}
 }
 
 // Rec is used to create channel's foldera and to compose stream file name
 // then executes 2 goroutines with 1 shared channel to send data from one to another
 func (r *Recorder) Rec(log *log.Entry, c *config.Config, channel config.Channels, hlsURL string) {
+	if _, err := r.record(log, c.Settings(channel), channel, output{}, hlsURL); err != nil {
+		log.Error(err)
+	}
+}
+
+// output is where recording goes
+type output struct {
+	File     string // Composed of streams dir and file name template if empty
+	Pipe     *pipe  // Segments are streamed into it too if set
+	PipeOnly bool   // No file is written, just Pipe
+}
+
+// record writes stream as out says. Returned channel is closed once file is closed and post-processed
+func (r *Recorder) record(log *log.Entry, st config.ChannelSettings, channel config.Channels, out output, hlsURL string) (<-chan struct{}, error) {
+	// Marked before anything starts, so next check doesn't open second recording of channel
+	if !r.AddOnline(channel.User) {
+		return nil, fmt.Errorf("channel %v is being recorded already", channel.User)
+	}
+
 	// Get local time
 	now, err := TimeIn(time.Now(), "Local")
 	if err != nil {
@@ -123,68 +383,213 @@ func (r *Recorder) Rec(log *log.Entry, c *config.Config, channel config.Channels
 	log.Tracef("Local time: %v", now)
 
 	// Define file name
-	fname := fmt.Sprintf("%v_%v.ts", channel.User, now.Format("2006-01-02_15-04-05"))
+	fpath := out.File
+	if fpath == "" && !out.PipeOnly {
+		sep := string(os.PathSeparator)
+		fpath = st.StreamsDir + sep + channel.User + sep + filepath.FromSlash(st.FileName(channel, now))
+	}
+	fname := filepath.Base(fpath)
 	fLog := log.WithField("file", fname)
+	state := fpath
+	if out.PipeOnly {
+		fLog = log
+		state = "pipe"
+	}
 
 	// Create channel directory
-	sep := string(os.PathSeparator)
-	log.Trace("Trying to create channel directory")
-	channelDir := c.StreamsDir + sep + channel.User
-	if err := os.MkdirAll(channelDir, 0777); err != nil {
-		fLog.Error(err)
-		return
+	if !out.PipeOnly {
+		log.Trace("Trying to create channel directory")
+		channelDir := filepath.Dir(fpath)
+		if err := os.MkdirAll(channelDir, 0777); err != nil {
+			r.RemoveOnline(channel.User)
+			return nil, err
+		}
+		if err := r.sessions.Open(fname, strings.TrimSuffix(fpath, ".ts")+".log"); err != nil {
+			fLog.Errorf("Failed to open session log: '%v'", err)
+		}
+		fLog.Debugf("Stream directory: '%s'", channelDir)
+		fLog.Infof("Writing stream to file: %v", fpath)
 	}
-	filepath := channelDir + sep + fname
-	fLog.Debugf("Stream directory: '%s'", channelDir)
-	fLog.Infof("Writing stream to file: %v", filepath)
+
+	client, err := r.httpClient(st.Proxy)
+	if err != nil {
+		r.RemoveOnline(channel.User)
+		return nil, err
+	}
+
+	r.setState(channel.User, func(s *control.ChannelStatus) {
+		*s = control.ChannelStatus{Channel: s.Channel, State: control.StateRecording, File: state, Started: now, Error: s.Error, ErrorAt: s.ErrorAt}
+	})
+	if st.Merge && fpath != "" {
+		r.cancelMerge(channel.User) // Merged with this part once it's closed
+	}
+	rec := openRecording(fpath, channel.User, channel.Quality, now)
+	rec.lib = r.library
+	r.addRecording(rec)
+	rec.update(fLog, func(m *sidecar.Recording) {
+		if channel.Tags != nil {
+			m.Tags = *channel.Tags
+		}
+	})
 
 	dlc := make(chan *Segment, 1024)
-	go r.GetPlaylist(fLog, channel, hlsURL, dlc)
-	go r.DownloadSegment(fLog, filepath, dlc)
+	done := make(chan struct{})
+	stop := r.watchStop(channel.User)
+	playlistDone := make(chan struct{})
+	go func() {
+		defer close(playlistDone)
+		r.GetPlaylist(fLog, client, channel, st, hlsURL, rec, dlc, stop)
+	}()
+	go func() {
+		defer close(done)
+		defer func() { <-playlistDone }() // Channel is no longer online once done is closed
+		r.DownloadSegment(fLog, client, fpath, st.Retry.Segment, rec, dlc, out.Pipe)
+		r.removeRecording(rec)
+		if out.Pipe != nil {
+			out.Pipe.Close()
+		}
+		if st.Merge && fpath != "" {
+			dir := filepath.Join(st.StreamsDir, channel.User)
+			if out.File != "" {
+				dir = filepath.Dir(fpath)
+			}
+			r.scheduleMerge(fLog, channel.User, st, dir, fpath)
+		}
+		if st.PostProcess != "" && fpath != "" {
+			args := st.PostProcessCommand(channel, fpath)
+			err := r.PostProcess(fLog, args)
+			rec.update(fLog, func(m *sidecar.Recording) {
+				m.PostProcess = &sidecar.PostProcess{Command: strings.Join(args, " "), Finished: time.Now()}
+				if err != nil {
+					m.PostProcess.Error = err.Error()
+				}
+			})
+		}
+	}()
+	return done, nil
+}
+
+// PostProcess runs post-processing command for closed recording file
+func (r *Recorder) PostProcess(log *log.Entry, args []string) error {
+	ctxLog := log.WithField("func", "POST")
+	r.beat("post/" + args[0])
+	defer r.forget("post/" + args[0])
+
+	ctxLog.Infof("Running post-processing: %v", strings.Join(args, " "))
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if len(out) > 0 {
+		ctxLog.Debugf("Post-processing output: %s", out)
+	}
+	if err != nil {
+		ctxLog.Errorf("Post-processing failed: '%v'", err)
+		return err
+	}
+	ctxLog.Info("Post-processing finished")
+	return nil
 }
 
 // DownloadSegment is mainly used as a goroutine which accepts new .ts chunks to be downloaded from GetPlaylist() function and then merges them into local file.
+// Segments are streamed into p too if it's not nil, no file is written if fpath is empty.
 // Also updates and report total duration and bytes of current stream
-func (r *Recorder) DownloadSegment(log *log.Entry, filepath string, dlc chan *Segment) {
+func (r *Recorder) DownloadSegment(log *log.Entry, client *http.Client, fpath string, policy retry.Policy, rec *recording, dlc chan *Segment, p *pipe) {
 	defer recoverFromPanic()
 	ctxLog := log.WithField("status", "DOWNLOAD").WithField("func", "SEG")
+	name := "writer/" + fpath
+	if fpath == "" {
+		name = "writer/pipe/" + rec.channel
+	}
+	r.beat(name)
+	defer r.forget(name)
 	var totalBytes uint64 = 0
-	var bytes int64
-	var req *http.Request
-
-	out, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		ctxLog.Error(err)
+	media := &mediaTracker{}
+	defer media.save(ctxLog, rec)
+
+	var out *os.File
+	if fpath != "" {
+		defer r.sessions.Close(filepath.Base(fpath))
+		var err error
+		out, err = os.OpenFile(fpath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			ctxLog.Error(err)
+		}
+		defer out.Close()
 	}
-	defer out.Close()
+	var ads *os.File // Opened on first ad
+	defer func() {
+		if ads != nil {
+			ads.Close()
+		}
+	}()
 
-	for v := range dlc {
-		req, err = http.NewRequest("GET", v.URI, nil)
-		if err != nil {
-			ctxLog.Info(err)
+	// Idle writer keeps reporting in, only the one stuck on download or disk goes silent
+	idle := time.NewTicker(30 * time.Second)
+	defer idle.Stop()
+
+	for {
+		var v *Segment
+		select {
+		case <-idle.C:
+			r.beat(name)
+			continue
+		case seg, ok := <-dlc:
+			if !ok {
+				return
+			}
+			v = seg
 		}
-		res, err := r.doRequestWithRetries(req)
+
+		data, err := r.fetchSegment(ctxLog, client, v.URI, policy)
 		if err != nil {
-			ctxLog.Error(err)
+			ctxLog.Errorf("Skipping segment, recording has a gap of %v: '%v'", v.duration, err)
+			r.setState(rec.channel, func(s *control.ChannelStatus) {
+				s.Gaps++
+				s.Error, s.ErrorAt = fmt.Sprintf("segment: %v", err), time.Now()
+			})
+			rec.update(ctxLog, func(m *sidecar.Recording) {
+				m.Gaps = append(m.Gaps, sidecar.Gap{At: time.Now(), Seconds: v.duration.Seconds(), Reason: err.Error()})
+			})
+			r.beat(name)
 			continue
 		}
-
-		if res.StatusCode != 200 {
-			ctxLog.Errorf("Received HTTP %v for %v\n", res.StatusCode, v.URI)
-			res.Body.Close()
+		if v.Ad {
+			if fpath == "" {
+				continue // Ads file goes next to recording
+			}
+			if ads == nil {
+				if ads, err = os.OpenFile(adsPath(fpath), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+					ctxLog.Errorf("Failed to open ads file: '%v'", err)
+					ads = nil
+					continue
+				}
+			}
+			if _, err = ads.Write(data); err != nil {
+				ctxLog.Error(err)
+			}
+			r.beat(name)
 			continue
 		}
-		bytes, err = io.Copy(out, res.Body)
-		if err != nil {
-			ctxLog.Error(err)
+		n := len(data)
+		if p != nil {
+			p.Write(data)
+		}
+		if out != nil {
+			if n, err = out.Write(data); err != nil {
+				ctxLog.Error(err)
+			}
 		}
-		res.Body.Close()
 
-		totalBytes += uint64(bytes)
-		duration := durafmt.Parse(v.totalDuration).LimitFirstN(1).String()
-		// speed := uint64(v.totalDuration * time.Millisecond)
+		totalBytes += uint64(n)
+		media.add(ctxLog, rec, data, v.duration)
+		r.setState(rec.channel, func(s *control.ChannelStatus) {
+			s.Bytes = totalBytes
+			s.Recorded = media.recorded
+			s.Segments++
+			s.LastSegment = time.Now()
+		})
+		duration := durafmt.Parse(media.recorded).LimitFirstN(1).String()
 
 		ctxLog.Infof("Written %v (%v)", humanize.Bytes(totalBytes), duration)
+		r.beat(name)
 	}
 }
 
@@ -192,34 +597,65 @@ func (r *Recorder) DownloadSegment(log *log.Entry, filepath string, dlc chan *Se
 // then it parses and drops old chunks which are already downloaded.
 // If new chunks are present they are being sent to DownloadSegment() function via channel to be downloaded.
 // New chunks are marked as old after being sent by adding their unique filename in cache.
-// When m3u8 live playlist link is expired (usually 24 hours) it tries to refresh it by generating a new one
-func (r *Recorder) GetPlaylist(log *log.Entry, channel config.Channels, urlStr string, dlc chan *Segment) {
-	r.AddOnline(channel.User)
-	defer r.RemoveOnline(channel.User)
+// When m3u8 live playlist link is expired (usually 24 hours) it tries to refresh it by generating a new one.
+// Closing stop closes file at once
+func (r *Recorder) GetPlaylist(log *log.Entry, client *http.Client, channel config.Channels, st config.ChannelSettings, urlStr string, rec *recording, dlc chan *Segment, stop <-chan struct{}) {
+	defer r.RemoveOnline(channel.User) // Marked online by record
+	defer r.setState(channel.User, func(s *control.ChannelStatus) {
+		if s.State != control.StateStopped && s.State != control.StateDisabled {
+			s.State = control.StateOffline
+		}
+	})
 	defer recoverFromPanic()
+	defer r.stopRecording(channel.User)
 
 	ctxLog := log.WithField("status", "DOWNLOAD").WithField("func", "GET")
+	var ended time.Time // When stream ended, not when restart window ran out
+	defer func() {
+		if ended.IsZero() {
+			ended = time.Now()
+		}
+		r.recordOffline(ctxLog, channel.User, ended)
+	}()
+	name := "playlist/" + channel.User
+	defer r.forget(name)
 
-	var recDuration time.Duration = 0
 	var req *http.Request
+	ads := &adTracker{rec: rec, mode: st.Ads}
 
 	cache, _ := lru.New(1024)
 
+	closeFile := func(reason error) {
+		ctxLog.Infof("Closing file. Reason: '%v'", reason)
+		ads.report(ctxLog)
+		rec.update(ctxLog, func(m *sidecar.Recording) { m.Ended = ended })
+		close(dlc)
+	}
+
 	playlistUrl, err := url.Parse(urlStr)
 	if err != nil {
 		ctxLog.Error(err)
 	}
 	for {
+		select {
+		case <-stop:
+			ended = time.Now()
+			ads.end(ctxLog, ended)
+			closeFile(errStopped)
+			return
+		default:
+		}
+		r.beat(name)
 		req, err = http.NewRequest("GET", urlStr, nil)
 		if err != nil {
 			ctxLog.Error(err)
 		}
 		ctxLog.Debugf("URL: %v", urlStr[len(urlStr)-10:]) // Change it later
 
-		res, err := r.doRequestWithRetries(req)
+		res, err := r.doRequestWithRetries(ctxLog, client, req, st.Retry.Playlist)
 		if err != nil {
 			ctxLog.Error(err)
-			urlStr, err = r.RefreshPlaylist(ctxLog, channel)
+			urlStr, err = r.RefreshPlaylist(ctxLog, channel, st)
 			if err != nil {
 				ctxLog.Errorf("Failed to refresh m3u8 playlist: '%v'", err)
 			}
@@ -227,17 +663,23 @@ func (r *Recorder) GetPlaylist(log *log.Entry, channel config.Channels, urlStr s
 			continue
 		}
 
-		playlist, listType, err := m3u8.DecodeFrom(res.Body, true)
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		var playlist m3u8.Playlist
+		var listType m3u8.ListType
+		if err == nil {
+			playlist, listType, err = m3u8.Decode(*bytes.NewBuffer(body), true)
+		}
 		if err != nil {
 			ctxLog.Error(err)
-			urlStr, err = r.RefreshPlaylist(ctxLog, channel)
+			urlStr, err = r.RefreshPlaylist(ctxLog, channel, st)
 			if err != nil {
 				ctxLog.Errorf("Failed to refresh m3u8 playlist: '%v'", err)
 			}
 			time.Sleep(1 * time.Second)
 			continue
 		}
-		res.Body.Close()
+		breaks := twitch.AdBreaks(body)
 
 		if listType == m3u8.MEDIA {
 			mpl := playlist.(*m3u8.MediaPlaylist)
@@ -254,7 +696,7 @@ func (r *Recorder) GetPlaylist(log *log.Entry, channel config.Channels, urlStr s
 						msUrl, err := playlistUrl.Parse(v.URI)
 						if err != nil {
 							ctxLog.Errorf("Failed to parse m3u8: '%v'", err)
-							urlStr, err = r.RefreshPlaylist(ctxLog, channel)
+							urlStr, err = r.RefreshPlaylist(ctxLog, channel, st)
 							if err != nil {
 								ctxLog.Errorf("Failed to refresh m3u8 playlist: '%v'", err)
 							}
@@ -269,23 +711,38 @@ func (r *Recorder) GetPlaylist(log *log.Entry, channel config.Channels, urlStr s
 					_, hit := cache.Get(msURI)
 					if !hit {
 						cache.Add(msURI, nil)
-						recDuration += time.Duration(int64(v.Duration * 1000000000))
-						dlc <- &Segment{msURI, recDuration}
+						if twitch.IsAd(v.Title, v.ProgramDateTime, breaks) {
+							ads.add(ctxLog, v)
+							switch st.Ads {
+							case config.AdsSkip:
+								continue
+							case config.AdsSeparate:
+								dlc <- &Segment{URI: msURI, duration: segDuration(v), Ad: true}
+								continue
+							}
+						} else {
+							ads.end(ctxLog, v.ProgramDateTime)
+						}
+						dlc <- &Segment{URI: msURI, duration: segDuration(v)}
 					}
 				}
 			}
 			if mpl.Closed {
-				ctxLog.Info("Stream ended. Waiting 10m for stream to come online again before closing file") // Often streamers restart their translation for various reasons
-				urlStr, err = r.WaitForRestart(ctxLog, channel)
+				ads.end(ctxLog, time.Time{})
+				r.setState(channel.User, func(s *control.ChannelStatus) { s.State = control.StateRestart })
+				ctxLog.Infof("Stream ended. Waiting %v for stream to come online again before closing file", st.RestartWindow) // Often streamers restart their translation for various reasons
+				ended = time.Now()
+				urlStr, err = r.WaitForRestart(ctxLog, channel, st)
 				if err != nil {
-					ctxLog.Infof("Closing file. Reason: '%v'", err)
-					close(dlc)
+					closeFile(err)
 					return
 				}
 				ctxLog.Info("🚀 Went online again!") // Often streamers restart their translation for various reasons
+				r.setState(channel.User, func(s *control.ChannelStatus) { s.State = control.StateRecording })
+				ended = time.Time{}
 				continue
 			} else {
-				time.Sleep(time.Duration(int64(mpl.TargetDuration * 1000000000)))
+				r.sleep(channel.User, time.Duration(int64(mpl.TargetDuration*1000000000)))
 			}
 		} else {
 			ml := playlist.(*m3u8.MasterPlaylist)
@@ -295,54 +752,38 @@ func (r *Recorder) GetPlaylist(log *log.Entry, channel config.Channels, urlStr s
 }
 
 // RefreshPlaylist is used to update direct link to m3u8 live playlist
-func (r *Recorder) RefreshPlaylist(log *log.Entry, channel config.Channels) (string, error) {
+func (r *Recorder) RefreshPlaylist(log *log.Entry, channel config.Channels, st config.ChannelSettings) (string, error) {
 	ctxLog := log.WithField("func", "REFRESH")
-	var url string
 
 	ctxLog.Info("Trying to refresh m3u8 playlist")
-	pl, err := twitchpl.Get(channel.User)
+	url, err := r.PlaylistURL(channel, st)
 	if err != nil {
 		return "", err
 	}
-	switch channel.Quality {
-	case "best":
-		url = pl.Best().AsURL()
-	case "worst":
-		url = pl.Worst().AsURL()
-	case "audio_only":
-		url = pl.Audio().AsURL()
-	}
 	ctxLog.Debugf("m3u8 URL updated: %v", url)
 	return url, nil
 }
 
 // WaitForRestart is used to prevent making multiple stream files by writing stream to the same file in case of channel coming online again in a few minutes
-func (r *Recorder) WaitForRestart(log *log.Entry, channel config.Channels) (string, error) {
+func (r *Recorder) WaitForRestart(log *log.Entry, channel config.Channels, st config.ChannelSettings) (string, error) {
 	ctxLog := log.WithField("func", "WAIT")
-	var url string
-	var pl *twitchpl.PlaylistManager
-	var err error
 
-	for i := 1; i <= 20; i++ {
-		ctxLog.Infof("Sleep for 30 seconds. Try %v/20", i)
-		time.Sleep(30 * time.Second)
+	tries := int(st.RestartWindow / st.RestartInterval)
+	for i := 1; i <= tries; i++ {
+		ctxLog.Infof("Sleep for %v. Try %v/%v", st.RestartInterval, i, tries)
+		r.beat("playlist/" + channel.User)
+		if !r.sleep(channel.User, st.RestartInterval) {
+			return "", errStopped
+		}
 		ctxLog.Info("Checking if channel went online again (restart)")
-		pl, err = twitchpl.Get(channel.User)
+		url, err := r.PlaylistURL(channel, st)
 		if err != nil {
 			ctxLog.Info("Channel is still offline")
 			continue
 		}
-		switch channel.Quality {
-		case "best":
-			url = pl.Best().AsURL()
-		case "worst":
-			url = pl.Worst().AsURL()
-		case "audio_only":
-			url = pl.Audio().AsURL()
-		}
 		return url, nil
 	}
-	return "", errors.New("channel was offline for 10 minutes")
+	return "", fmt.Errorf("channel was offline for %v", st.RestartWindow)
 }
 
 // TimeIn is used to get local time
@@ -354,38 +795,50 @@ func TimeIn(t time.Time, name string) (time.Time, error) {
 	return t, err
 }
 
-// doRequestWithRetries makes GET request, if failed it retries 3 more times with backoff timer
-func (r *Recorder) doRequestWithRetries(req *http.Request) (*http.Response, error) {
+// doRequestWithRetries makes GET request, if failed it retries as stated by retry policy.
+// Requests to hosts circuit breaker holds open wait for it, so failing edge server is not hammered by every channel
+func (r *Recorder) doRequestWithRetries(log *log.Entry, client *http.Client, req *http.Request, policy retry.Policy) (*http.Response, error) {
+	return r.retryRequest(log, client.Do, req, policy)
+}
+
+// retryRequest is doRequestWithRetries sending request with do, which may fail responses it doesn't accept
+func (r *Recorder) retryRequest(log *log.Entry, do func(*http.Request) (*http.Response, error), req *http.Request, policy retry.Policy) (*http.Response, error) {
 	defer recoverFromPanic()
-	ctxLog := log.WithField("general", "GET")
-	var err error
-	var res *http.Response
+	ctxLog := log.WithField("func", "HTTP")
 
 	// req.Close = true
 	// req.Header.Set("Connection", "close") // prevent 'too many open files' error
 	req.Header.Set("User-Agent", USER_AGENT)
 
-	for _, backoff := range backoffSchedule {
-		res, err = r.Client.Do(req)
-		if err == nil {
-			break
+	return policy.Do(req.Context(), do, req, r.breaker, func(a retry.Attempt) {
+		if a.N == 0 {
+			ctxLog.Warnf("Waiting %v: '%v'", a.Wait.Round(time.Millisecond), a.Err)
+			return
 		}
-		ctxLog.Errorf("Request error: '%v' Retrying in %v", err, backoff)
-		time.Sleep(backoff)
+		ctxLog.Errorf("Request error: '%v' Retrying in %v (%v/%v)", a.Err, a.Wait.Round(time.Millisecond), a.N, policy.Attempts)
+	})
+}
 
+func (r *Recorder) cleanup(c *config.Config) {
+	ctxLog := log.WithField("general", "CLI")
+	ctxLog.Info("Interrupted! SIGTERM signal. <Ctrl>+<C> pressed. Graceful shutdown...")
+	r.closeHistory(ctxLog, time.Now())
+	if _, err := systemd.Notify(systemd.Stopping); err != nil {
+		ctxLog.Errorf("Failed to notify systemd: '%v'", err)
 	}
-	if err != nil {
-		return res, err
+	if c.PidFile != "" {
+		if err := RemovePidFile(c.PidFile); err != nil {
+			ctxLog.Errorf("Failed to remove pidfile: '%v'", err)
+		}
 	}
-	return res, err
-}
-
-func cleanup() {
-	log.WithField("general", "CLI").Info("Interrupted! SIGTERM signal. <Ctrl>+<C> pressed. Graceful shutdown...")
+	r.dropMerges(ctxLog)
+	r.closeControl()
 }
 
 // IsOnline is used to check Online struct if specified channel is being recorder right now
 func (r *Recorder) IsOnline(channel string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	for _, v := range r.Online {
 		if v == channel {
 			return true
@@ -394,18 +847,32 @@ func (r *Recorder) IsOnline(channel string) bool {
 	return false
 }
 
-// AddOnline marks channel name being recorder right now by adding it to Channel struct
-func (r *Recorder) AddOnline(u string) {
+// AddOnline marks channel name being recorder right now by adding it to Channel struct.
+// Returns false when channel is already marked
+func (r *Recorder) AddOnline(u string) bool {
+	r.mu.Lock()
+	for _, v := range r.Online {
+		if v == u {
+			r.mu.Unlock()
+			return false
+		}
+	}
 	r.Online = append(r.Online, u)
+	r.mu.Unlock()
+	r.notifyStatus()
+	return true
 }
 
 // RemoveOnline removes channel name from Online struct, usually invokes when stream ends.
 func (r *Recorder) RemoveOnline(u string) {
+	r.mu.Lock()
 	for i, v := range r.Online {
 		if v == u {
 			r.Online = append(r.Online[:i], r.Online[i+1:]...)
 		}
 	}
+	r.mu.Unlock()
+	r.notifyStatus()
 }
 
 func recoverFromPanic() {
@@ -1,9 +1,30 @@
 package recorder
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/grafov/m3u8"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/control"
+	"github.com/wmw64/rekoda/internal/library"
+	"github.com/wmw64/rekoda/internal/scheduler"
+	"github.com/wmw64/rekoda/internal/sidecar"
+	"github.com/wmw64/rekoda/internal/twitch"
+	"github.com/wmw64/rekoda/pkg/mpegts"
+	"github.com/wmw64/rekoda/pkg/retry"
 	//	"github.com/wmw9/rekoda/internal/recorder"
 )
 
@@ -26,3 +47,338 @@ func TestRemoveOnline(t *testing.T) {
 	r.RemoveOnline("test")
 	assert.Equal(t, false, r.IsOnline("test"))
 }
+
+func TestHealthy(t *testing.T) {
+	r := New()
+	r.beat("poll")
+	assert.NoError(t, r.Healthy(time.Minute))
+
+	r.beats["writer/test.ts"] = time.Now().Add(-2 * time.Minute)
+	assert.Error(t, r.Healthy(time.Minute))
+
+	r.forget("writer/test.ts")
+	assert.NoError(t, r.Healthy(time.Minute))
+}
+
+func TestPidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "rekoda.pid")
+	assert.NoError(t, WritePidFile(path))
+
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(b))
+
+	assert.NoError(t, RemovePidFile(path))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAdTracker(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "rwxrob_2021-09-08_12-57-06.ts")
+	start := time.Date(2021, 9, 8, 12, 57, 6, 0, time.UTC)
+	rec := openRecording(fpath, "rwxrob", "best", start)
+	ads := &adTracker{rec: rec, mode: config.AdsSeparate}
+	ctxLog := log.WithField("channel", "rwxrob")
+
+	ads.end(ctxLog, start) // No ad break going on
+	ads.add(ctxLog, &m3u8.MediaSegment{Duration: 2, ProgramDateTime: start})
+	ads.add(ctxLog, &m3u8.MediaSegment{Duration: 2, ProgramDateTime: start.Add(2 * time.Second)})
+	ads.end(ctxLog, start.Add(4*time.Second))
+
+	meta, err := sidecar.Load(sidecar.Path(fpath))
+	assert.NoError(t, err)
+	assert.Equal(t, "rwxrob_2021-09-08_12-57-06.ads.ts", meta.AdsFile)
+	assert.Equal(t, []sidecar.AdBreak{{Start: start, End: start.Add(4 * time.Second), Seconds: 4, Segments: 2, Ads: config.AdsSeparate}}, meta.AdBreaks)
+	assert.Equal(t, 4*time.Second, ads.removed)
+
+	// Stream appended to the same file keeps earlier ad breaks
+	assert.Len(t, openRecording(fpath, "rwxrob", "best", start.Add(time.Hour)).meta.AdBreaks, 1)
+}
+
+func TestFetchSegment(t *testing.T) {
+	segment, err := os.ReadFile(filepath.Join("testdata", "segment.ts"))
+	assert.NoError(t, err)
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.Write([]byte("<html>Bad Gateway</html>"))
+		case 2: // Connection drops after whole packets, only Content-Length tells
+			w.Header().Set("Content-Length", strconv.Itoa(len(segment)))
+			w.Write(segment[:len(segment)-mpegts.PacketSize])
+		default:
+			w.Write(segment)
+		}
+	}))
+	defer srv.Close()
+
+	r := New()
+	policy := retry.Policy{Attempts: 3, BaseDelay: time.Millisecond}
+	ctxLog := log.WithField("channel", "rwxrob")
+	b, err := r.fetchSegment(ctxLog, srv.Client(), srv.URL, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, segment, b)
+	assert.Equal(t, int32(3), requests)
+
+	policy.Attempts = 1
+	atomic.StoreInt32(&requests, 0)
+	_, err = r.fetchSegment(ctxLog, srv.Client(), srv.URL, policy)
+	assert.ErrorIs(t, err, mpegts.ErrSize)
+
+	// Failed requests and invalid segments share attempts
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("<html>Bad Gateway</html>"))
+	}))
+	defer flaky.Close()
+	policy = retry.Policy{Attempts: 3, BaseDelay: time.Millisecond, RetryOn: []int{http.StatusServiceUnavailable}}
+	atomic.StoreInt32(&requests, 0)
+	_, err = r.fetchSegment(ctxLog, flaky.Client(), flaky.URL, policy)
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), requests)
+}
+
+func TestMediaTracker(t *testing.T) {
+	segment, err := os.ReadFile(filepath.Join("testdata", "segment.ts"))
+	assert.NoError(t, err)
+	fpath := filepath.Join(t.TempDir(), "rwxrob_2021-09-08_12-57-06.ts")
+	rec := openRecording(fpath, "rwxrob", "best", time.Now())
+	ctxLog := log.WithField("channel", "rwxrob")
+
+	media := &mediaTracker{}
+	media.add(ctxLog, rec, segment, 2*time.Second) // Timestamps win over playlist
+	media.add(ctxLog, rec, segment, 2*time.Second)
+	media.add(ctxLog, rec, []byte("not a segment"), 2*time.Second)
+	assert.Equal(t, 4*time.Second, media.recorded)
+	media.save(ctxLog, rec)
+
+	meta, err := sidecar.Load(sidecar.Path(fpath))
+	assert.NoError(t, err)
+	assert.Equal(t, 4.0, meta.Seconds)
+	assert.Equal(t, &mpegts.VideoInfo{Codec: "h264", Width: 1920, Height: 1080, Profile: 100, FrameRate: 30}, meta.Video)
+	assert.Equal(t, 48000, meta.Audio.SampleRate)
+	assert.Empty(t, meta.Changes)
+
+	// Appending to the same file continues its duration
+	rec = openRecording(fpath, "rwxrob", "best", time.Now())
+	media = &mediaTracker{}
+	media.add(ctxLog, rec, segment, 2*time.Second)
+	media.save(ctxLog, rec)
+	meta, err = sidecar.Load(sidecar.Path(fpath))
+	assert.NoError(t, err)
+	assert.Equal(t, 5.0, meta.Seconds)
+}
+
+func TestActStopStart(t *testing.T) {
+	r := New()
+	c := &config.Config{}
+	sched := scheduler.New(1, 1, 0, func(string) {})
+	channels := &channelSet{m: map[string]config.Channels{"alice": {User: "alice", Enabled: true}}}
+	stop := r.watchStop("alice")
+	ctxLog := log.WithField("general", "TEST")
+
+	assert.Error(t, r.act(ctxLog, c, sched, channels, "bob", control.ActionStop))
+	assert.Error(t, r.act(ctxLog, c, sched, channels, "alice", "pause"))
+
+	assert.NoError(t, r.act(ctxLog, c, sched, channels, "alice", control.ActionStop))
+	select {
+	case <-stop:
+	default:
+		t.Fatal("recording was not stopped")
+	}
+	assert.True(t, r.isHeld("alice"))
+	assert.Equal(t, control.StateStopped, r.Status(nil).Channels[0].State)
+
+	assert.NoError(t, r.act(ctxLog, c, sched, channels, "alice", control.ActionStart))
+	assert.False(t, r.isHeld("alice"))
+	assert.Equal(t, control.StateOffline, r.Status(nil).Channels[0].State)
+}
+
+func TestSchedulerBatchesStatus(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		var req struct {
+			Variables struct {
+				Logins []string `json:"logins"`
+			} `json:"variables"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		users := make([]map[string]interface{}, len(req.Variables.Logins))
+		for i, login := range req.Variables.Logins {
+			users[i] = map[string]interface{}{"login": login, "stream": nil}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"users": users}})
+	}))
+	defer srv.Close()
+
+	const n = 250
+	r := New()
+	r.status = twitch.NewBatcher(twitch.NewClient(srv.Client(), srv.URL, ""))
+	c := &config.Config{}
+	channels := &channelSet{m: make(map[string]config.Channels)}
+	sched := r.newScheduler(log.WithField("general", "TEST"), c, channels)
+	for i := 0; i < n; i++ {
+		u := config.NewChannel(fmt.Sprintf("channel%v", i))
+		channels.set(u)
+		sched.Set(u.User, time.Hour)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go sched.Run(stop)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		checked := 0
+		for _, st := range sched.Status() {
+			if !st.LastCheck.IsZero() {
+				checked++
+			}
+		}
+		if checked == n || time.Now().After(deadline) {
+			assert.Equal(t, n, checked)
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond) // Let checks of the last batch finish
+	assert.Equal(t, int32((n+twitch.MaxLogins-1)/twitch.MaxLogins), atomic.LoadInt32(&requests))
+}
+
+func TestCloseControl(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "rekoda.sock")
+	r := New()
+	r.ServeControl(log.WithField("general", "TEST"), path, nil, func(string, string) error { return nil })
+	_, err := control.Get(path)
+	assert.NoError(t, err)
+
+	r.closeControl()
+	_, err = control.Get(path)
+	assert.ErrorIs(t, err, control.ErrNotRunning)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// Recorder which failed to open socket leaves the one of another recorder alone
+	srv, err := control.Serve(path, func() control.Status { return control.Status{} }, nil)
+	assert.NoError(t, err)
+	defer srv.Close()
+	other := New()
+	other.ServeControl(log.WithField("general", "TEST"), path, nil, nil)
+	other.closeControl()
+	_, err = control.Get(path)
+	assert.NoError(t, err)
+}
+
+func TestSleepStopped(t *testing.T) {
+	r := New()
+	assert.True(t, r.sleep("alice", time.Millisecond))
+	r.watchStop("alice")
+	go r.stopRecording("alice")
+	assert.False(t, r.sleep("alice", time.Hour))
+}
+
+func TestRecordStreamEnd(t *testing.T) {
+	segment, err := os.ReadFile(filepath.Join("testdata", "segment.ts"))
+	assert.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".ts") {
+			w.Write(segment)
+			return
+		}
+		w.Write([]byte("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:2.000,live\n0.ts\n#EXTINF:2.000,live\n1.ts\n#EXT-X-ENDLIST\n"))
+	}))
+	defer srv.Close()
+
+	r := New()
+	r.breaker = retry.NewBreaker(config.CircuitBreaker{}.Get())
+	st := config.DefaultSettings
+	st.RestartWindow = 0 // Exit as soon as stream ends
+	st.Retry.Playlist = retry.Policy{Attempts: 1}
+	st.Retry.Segment = retry.Policy{Attempts: 1}
+	fpath := filepath.Join(t.TempDir(), "event", "rwxrob.ts")
+	r.UseLibrary(filepath.Join(t.TempDir(), "library.json"))
+	done, err := r.record(log.WithField("channel", "rwxrob"), st, config.NewChannel("rwxrob"), output{File: fpath}, srv.URL+"/index.m3u8")
+	assert.NoError(t, err)
+	_, err = r.record(log.WithField("channel", "rwxrob"), st, config.NewChannel("rwxrob"), output{File: fpath + ".2"}, srv.URL+"/index.m3u8")
+	assert.Error(t, err, "channel is marked online before record returns")
+	r.noteStream(log.WithField("channel", "rwxrob"), "rwxrob", twitch.Stream{Live: true, ID: "40123456789", Title: "Coding", Game: "Science & Technology"})
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("recording did not finish once stream ended")
+	}
+	assert.False(t, r.IsOnline("rwxrob"))
+	b, err := os.ReadFile(fpath)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*len(segment), len(b))
+	entries, err := r.library.Entries()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, fpath, entries[0].Path)
+		assert.Equal(t, int64(len(b)), entries[0].Size)
+		assert.Equal(t, "Coding", entries[0].Title())
+		assert.False(t, entries[0].Ended.IsZero())
+	}
+	meta, err := sidecar.Load(sidecar.Path(fpath))
+	assert.NoError(t, err)
+	assert.Equal(t, "40123456789", meta.Broadcast)
+
+	// Streamed only, nothing is written next to recording
+	c := &slowConsumer{next: make(chan struct{})}
+	close(c.next)
+	p := newPipe(log.WithField("channel", "rwxrob"), func(<-chan struct{}) (io.WriteCloser, error) { return c, nil }, 1<<20, nil)
+	done, err = r.record(log.WithField("channel", "rwxrob"), st, config.NewChannel("rwxrob"), output{Pipe: p, PipeOnly: true}, srv.URL+"/index.m3u8")
+	assert.NoError(t, err)
+	<-done
+	assert.Equal(t, 2*len(segment), c.Len())
+	assert.True(t, c.closed)
+	files, _ := os.ReadDir(filepath.Dir(fpath))
+	assert.Len(t, files, 2) // Recording and its sidecar from before
+
+	// Stream coming back after restart window is merged with recording before
+	st.Merge = true
+	st.MergeWindow = 2 * time.Second
+	done, err = r.record(log.WithField("channel", "rwxrob"), st, config.NewChannel("rwxrob"), output{File: filepath.Join(filepath.Dir(fpath), "rwxrob_2.ts")}, srv.URL+"/index.m3u8")
+	assert.NoError(t, err)
+	<-done
+	_, err = os.Stat(filepath.Join(filepath.Dir(fpath), "rwxrob_merged.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist, "merged once merge window passes without another part")
+	assert.Eventually(t, func() bool {
+		entries, err := r.library.Entries()
+		_, found := library.Find(entries, "rwxrob_merged.ts")
+		return err == nil && found == nil
+	}, 10*time.Second, 50*time.Millisecond)
+	merged, err := sidecar.Load(filepath.Join(filepath.Dir(fpath), "rwxrob_merged.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rwxrob.ts", "rwxrob_2.ts"}, merged.Parts)
+	fi, err := os.Stat(filepath.Join(filepath.Dir(fpath), "rwxrob_merged.ts"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4*len(segment)), fi.Size())
+	entries, err = r.library.Entries()
+	assert.NoError(t, err)
+	e, err := library.Find(entries, "rwxrob_merged.ts")
+	assert.NoError(t, err)
+	assert.Equal(t, merged.Parts, e.Parts)
+}
+
+func TestParseTarget(t *testing.T) {
+	for target, want := range map[string]string{
+		"rwxrob":                          "rwxrob",
+		"https://www.twitch.tv/rwxrob":    "rwxrob",
+		"twitch.tv/rwxrob/":               "rwxrob",
+		"https://m.twitch.tv/Rwx_Rob?x=1": "Rwx_Rob",
+	} {
+		name, err := ParseTarget(target)
+		assert.NoError(t, err, target)
+		assert.Equal(t, want, name)
+	}
+	for _, target := range []string{"https://youtube.com/rwxrob", "https://www.twitch.tv/videos/123", "twitch.tv/rwxrob/clips", "not a channel"} {
+		_, err := ParseTarget(target)
+		assert.Error(t, err, target)
+	}
+}
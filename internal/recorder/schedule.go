@@ -0,0 +1,79 @@
+package recorder
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/history"
+)
+
+// PollInterval returns how long to wait before checking channel again, learned from its history if enabled.
+// Stated poll_interval caps learned one, so channel is never polled less often than configured
+func (r *Recorder) PollInterval(c *config.Config, u config.Channels, now time.Time) time.Duration {
+	st := c.Settings(u)
+	if !st.LearnSchedule || r.history == nil {
+		return st.PollInterval
+	}
+	h, err := r.history.Get(u.User)
+	if err != nil {
+		return st.PollInterval
+	}
+	min, max := st.MinPollInterval, st.MaxPollInterval
+	if st.PollIntervalSet && st.PollInterval < max {
+		max = st.PollInterval
+		if min > max {
+			min = max
+		}
+	}
+	if d := h.PollInterval(now, min, max); d > 0 {
+		return d
+	}
+	return st.PollInterval
+}
+
+// recordOnline adds channel's new session to its history
+func (r *Recorder) recordOnline(log *log.Entry, user string, t time.Time) {
+	if r.history == nil {
+		return
+	}
+	if err := r.history.Online(user, t); err != nil {
+		log.Errorf("Failed to save channel history: '%v'", err)
+	}
+	r.recordSeen(log, user, time.Now())
+}
+
+// recordSeen notes channel is still live, its session ends there if rekoda is killed
+func (r *Recorder) recordSeen(log *log.Entry, user string, t time.Time) {
+	if r.history == nil {
+		return
+	}
+	if err := r.history.Seen(user, t); err != nil {
+		log.Errorf("Failed to save channel history: '%v'", err)
+	}
+}
+
+// recordOffline ends channel's session in its history
+func (r *Recorder) recordOffline(log *log.Entry, user string, t time.Time) {
+	if r.history == nil {
+		return
+	}
+	if err := r.history.Offline(user, t); err != nil {
+		log.Errorf("Failed to save channel history: '%v'", err)
+	}
+}
+
+// UseHistory makes recorder keep and learn from channel history stored in dir
+func (r *Recorder) UseHistory(dir string) {
+	r.history = history.NewStore(dir)
+}
+
+// closeHistory ends sessions of channels still live on shutdown
+func (r *Recorder) closeHistory(log *log.Entry, t time.Time) {
+	if r.history == nil {
+		return
+	}
+	if err := r.history.Close(t); err != nil {
+		log.Errorf("Failed to save channel history: '%v'", err)
+	}
+}
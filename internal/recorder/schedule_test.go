@@ -0,0 +1,31 @@
+package recorder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/config"
+)
+
+func TestPollIntervalStatedCapsLearned(t *testing.T) {
+	r := New()
+	r.UseHistory(t.TempDir())
+	now := time.Date(2021, 9, 20, 3, 0, 0, 0, time.Local) // Far from usual start at 13:00
+	for i := 7; i > 0; i-- {
+		day := now.AddDate(0, 0, -i)
+		start := time.Date(day.Year(), day.Month(), day.Day(), 13, 0, 0, 0, time.Local)
+		assert.NoError(t, r.history.Online("rwxrob", start))
+		assert.NoError(t, r.history.Offline("rwxrob", start.Add(3*time.Hour)))
+	}
+
+	c := &config.Config{}
+	u := config.NewChannel("rwxrob")
+	assert.Equal(t, config.DefaultSettings.MaxPollInterval, r.PollInterval(c, u, now))
+
+	c.Defaults.PollInterval = config.D(2 * time.Minute)
+	assert.Equal(t, 2*time.Minute, r.PollInterval(c, u, now))
+
+	u.PollInterval = config.D(10 * time.Second) // Below min_poll_interval
+	assert.Equal(t, 10*time.Second, r.PollInterval(c, u, now))
+}
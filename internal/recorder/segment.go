@@ -0,0 +1,131 @@
+package recorder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/grafov/m3u8"
+	log "github.com/sirupsen/logrus"
+	"github.com/wmw64/rekoda/internal/sidecar"
+	"github.com/wmw64/rekoda/pkg/mpegts"
+	"github.com/wmw64/rekoda/pkg/retry"
+)
+
+// errTruncated is returned for segment body shorter than server promised
+var errTruncated = errors.New("truncated segment")
+
+// fetchSegment downloads segment and checks it's a valid transport stream before it's appended to recording.
+// Truncated and malformed segments are failed attempts of retry policy, just like request errors
+func (r *Recorder) fetchSegment(log *log.Entry, client *http.Client, uri string, policy retry.Policy) ([]byte, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	res, err := r.retryRequest(log, func(req *http.Request) (*http.Response, error) {
+		res, err := client.Do(req)
+		if err != nil || res.StatusCode != http.StatusOK {
+			return res, err
+		}
+		defer res.Body.Close()
+		if b, err = readSegment(res); err == nil {
+			err = mpegts.Validate(b)
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Body = http.NoBody
+		return res, nil
+	}, req, policy)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received HTTP %v", res.StatusCode)
+	}
+	return b, nil
+}
+
+// readSegment reads whole segment, making sure none of it is missing
+func readSegment(res *http.Response) ([]byte, error) {
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errTruncated, err)
+	}
+	if res.ContentLength >= 0 && int64(len(b)) != res.ContentLength {
+		return nil, fmt.Errorf("%w: got %v of %v bytes", errTruncated, len(b), res.ContentLength)
+	}
+	return b, nil
+}
+
+// segDuration returns duration of segment stated in playlist
+func segDuration(seg *m3u8.MediaSegment) time.Duration {
+	return time.Duration(seg.Duration * float64(time.Second))
+}
+
+// mediaSaveInterval is how often recorded duration is written into sidecar
+const mediaSaveInterval = time.Minute
+
+// mediaTracker follows what's inside segments written into recording
+type mediaTracker struct {
+	video    *mpegts.VideoInfo
+	audio    *mpegts.AudioInfo
+	recorded time.Duration // Media time written, from timestamps
+	saved    time.Time
+}
+
+// add accounts segment written into recording, noting codec or resolution changes.
+// Duration stated in playlist is used when segment has no usable timestamps
+func (m *mediaTracker) add(log *log.Entry, rec *recording, data []byte, stated time.Duration) {
+	info, err := mpegts.Analyze(bytes.NewReader(data))
+	if err != nil || info.Duration <= 0 {
+		log.Debugf("Failed to read timestamps of segment, using playlist duration: '%v'", err)
+		m.recorded += stated
+		return
+	}
+	offset := m.recorded
+	m.recorded += info.Duration
+
+	var changes []sidecar.Change
+	if info.Video != nil && (m.video == nil || m.video.Codec != info.Video.Codec || m.video.Width != info.Video.Width || m.video.Height != info.Video.Height) {
+		if m.video != nil {
+			log.Warnf("Video changed from %v to %v", m.video, info.Video)
+			changes = append(changes, sidecar.Change{At: time.Now(), Offset: rec.base + offset.Seconds(), From: m.video.String(), To: info.Video.String()})
+		} else {
+			log.Infof("Video: %v", info.Video)
+		}
+		m.video = info.Video
+	}
+	if info.Audio != nil && (m.audio == nil || *m.audio != *info.Audio) {
+		if m.audio != nil {
+			log.Warnf("Audio changed from %v to %v", m.audio, info.Audio)
+			changes = append(changes, sidecar.Change{At: time.Now(), Offset: rec.base + offset.Seconds(), From: m.audio.String(), To: info.Audio.String()})
+		} else {
+			log.Infof("Audio: %v", info.Audio)
+		}
+		m.audio = info.Audio
+	}
+	if len(changes) > 0 || time.Since(m.saved) >= mediaSaveInterval {
+		m.save(log, rec, changes...)
+	}
+}
+
+// save writes recorded duration, stream parameters and their changes into sidecar
+func (m *mediaTracker) save(log *log.Entry, rec *recording, changes ...sidecar.Change) {
+	m.saved = time.Now()
+	rec.update(log, func(s *sidecar.Recording) {
+		s.Seconds = rec.base + m.recorded.Seconds()
+		s.Changes = append(s.Changes, changes...)
+		if m.video != nil {
+			s.Video = m.video
+		}
+		if m.audio != nil {
+			s.Audio = m.audio
+		}
+	})
+}
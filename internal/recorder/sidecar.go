@@ -0,0 +1,82 @@
+package recorder
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmw64/rekoda/internal/library"
+	"github.com/wmw64/rekoda/internal/sidecar"
+	"github.com/wmw64/rekoda/internal/twitch"
+)
+
+// recording is sidecar of file being written, shared by playlist and segment goroutines
+type recording struct {
+	mu      sync.Mutex
+	path    string
+	file    string // Recording itself
+	channel string
+	lib     *library.Library // Catalog sidecar goes into too, if set
+	base    float64          // Seconds recorded into file before, when stream is appended to it
+	meta    sidecar.Recording
+}
+
+// openRecording starts sidecar of recording, continuing the existing one when stream is appended to the same file
+func openRecording(fpath, channel, quality string, now time.Time) *recording {
+	rec := &recording{channel: channel}
+	if fpath == "" {
+		rec.meta = sidecar.Recording{Channel: channel, Quality: quality, Started: now}
+		return rec
+	}
+	rec.path, rec.file = sidecar.Path(fpath), fpath
+	meta, err := sidecar.Load(rec.path)
+	if err != nil || meta.File != filepath.Base(fpath) {
+		meta = sidecar.Recording{Channel: channel, Quality: quality, File: filepath.Base(fpath), Started: now}
+	}
+	meta.Ended = time.Time{}
+	rec.meta = meta
+	rec.base = meta.Seconds
+	return rec
+}
+
+// update changes sidecar and writes it
+func (rec *recording) update(log *log.Entry, fn func(m *sidecar.Recording)) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	fn(&rec.meta)
+	if rec.path == "" { // Nothing is written when streaming only
+		return
+	}
+	if err := rec.meta.Save(rec.path); err != nil {
+		log.Errorf("Failed to write sidecar file: '%v'", err)
+	}
+	if rec.lib != nil {
+		if err := rec.lib.Update(library.NewEntry(rec.file, rec.meta)); err != nil {
+			log.Errorf("Failed to update library: '%v'", err)
+		}
+	}
+}
+
+// addStream notes broadcast, title and game of stream, writing sidecar if they changed.
+// Broadcast stays the first one seen, stream coming back during restart window may get another
+func (rec *recording) addStream(log *log.Entry, st twitch.Stream) {
+	rec.mu.Lock()
+	changed := rec.meta.AddTitle(time.Now(), st.Title, st.Game)
+	if rec.meta.Broadcast == "" && st.ID != "" {
+		rec.meta.Broadcast = st.ID
+		changed = true
+	}
+	rec.mu.Unlock()
+	if changed {
+		log.Infof("Title: %v (%v)", st.Title, st.Game)
+		rec.update(log, func(*sidecar.Recording) {})
+	}
+}
+
+// adsPath returns file ads of recording are written into, e.g. rwxrob_2021-09-08.ads.ts for rwxrob_2021-09-08.ts
+func adsPath(fpath string) string {
+	ext := filepath.Ext(fpath)
+	return strings.TrimSuffix(fpath, ext) + ".ads" + ext
+}
@@ -0,0 +1,83 @@
+package recorder
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmw64/rekoda/internal/control"
+	"github.com/wmw64/rekoda/internal/scheduler"
+)
+
+// setState changes what recorder reports it's doing with channel
+func (r *Recorder) setState(channel string, fn func(s *control.ChannelStatus)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.states == nil {
+		r.states = make(map[string]*control.ChannelStatus)
+	}
+	s, ok := r.states[channel]
+	if !ok {
+		s = &control.ChannelStatus{Channel: channel, State: control.StateOffline}
+		r.states[channel] = s
+	}
+	fn(s)
+}
+
+// setError remembers the last error of channel
+func (r *Recorder) setError(channel string, msg string) {
+	r.setState(channel, func(s *control.ChannelStatus) {
+		s.Error, s.ErrorAt = msg, time.Now()
+	})
+}
+
+// Status reports state of every channel, with check times taken from scheduler
+func (r *Recorder) Status(sched *scheduler.Scheduler) control.Status {
+	checks := make(map[string]scheduler.Status)
+	if sched != nil {
+		for _, st := range sched.Status() {
+			checks[st.Name] = st
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := control.Status{PID: os.Getpid(), Started: r.started, Channels: make([]control.ChannelStatus, 0, len(r.states))}
+	for name, s := range r.states {
+		cs := *s
+		if check, ok := checks[name]; ok {
+			cs.LastCheck, cs.NextCheck = check.LastCheck, check.NextCheck
+		}
+		st.Channels = append(st.Channels, cs)
+	}
+	sort.Slice(st.Channels, func(i, j int) bool { return st.Channels[i].Channel < st.Channels[j].Channel })
+	return st
+}
+
+// ServeControl answers 'rekoda status' and takes actions of 'rekoda top' on unix socket at path
+func (r *Recorder) ServeControl(log *log.Entry, path string, sched *scheduler.Scheduler, act func(channel, action string) error) {
+	ctxLog := log.WithField("func", "CONTROL")
+	srv, err := control.Serve(path, func() control.Status { return r.Status(sched) }, act)
+	if err != nil {
+		ctxLog.Errorf("Failed to open control socket, 'rekoda status' won't work: '%v'", err)
+		return
+	}
+	r.mu.Lock()
+	r.control, r.controlPath = srv, path
+	r.mu.Unlock()
+	ctxLog.Debugf("Control socket: %v", path)
+}
+
+// closeControl stops answering on control socket and removes it. Socket of another recorder is left alone
+func (r *Recorder) closeControl() {
+	r.mu.Lock()
+	srv, path := r.control, r.controlPath
+	r.control = nil
+	r.mu.Unlock()
+	if srv == nil {
+		return
+	}
+	srv.Close()
+	os.Remove(path)
+}
@@ -0,0 +1,124 @@
+package recorder
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wmw64/rekoda/internal/config"
+	"github.com/wmw64/rekoda/internal/twitch"
+)
+
+// tokenExpiryWarning is how long before OAuth token expires it's warned about
+const tokenExpiryWarning = 7 * 24 * time.Hour
+
+// tokenCheckInterval is how often tokens in use are validated again, as twitch asks apps to
+const tokenCheckInterval = time.Hour
+
+// LoadTokens reads OAuth tokens from tokens file and validates ones channels refer to.
+// Channels whose token is missing or invalid are recorded anonymously
+func (r *Recorder) LoadTokens(log *log.Entry, c *config.Config) error {
+	ctxLog := log.WithField("func", "TOKEN")
+	tokens, err := config.LoadTokens(c.TokensFile())
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.tokens = make(map[string]string)
+	r.mu.Unlock()
+	for name, users := range tokenUsers(c) {
+		token, ok := tokens[name]
+		if !ok {
+			ctxLog.Errorf("Token '%v' used by %v is not in %v, recording anonymously. Add it with 'rekoda token set %v'",
+				name, strings.Join(users, ", "), c.TokensFile(), name)
+			continue
+		}
+		r.mu.Lock()
+		r.tokens[name] = twitch.NormalizeToken(token)
+		r.mu.Unlock()
+		r.checkToken(ctxLog, c, name, users)
+	}
+	return nil
+}
+
+// WatchTokens validates tokens in use every hour, warning about ones about to expire
+func (r *Recorder) WatchTokens(log *log.Entry, c *config.Config) {
+	ctxLog := log.WithField("func", "TOKEN")
+	users := tokenUsers(c)
+	for range time.Tick(tokenCheckInterval) {
+		r.mu.Lock()
+		names := make([]string, 0, len(r.tokens))
+		for name := range r.tokens {
+			names = append(names, name)
+		}
+		r.mu.Unlock()
+		for _, name := range names {
+			r.checkToken(ctxLog, c, name, users[name])
+		}
+	}
+}
+
+// checkToken validates token, dropping it if it's no longer valid
+func (r *Recorder) checkToken(log *log.Entry, c *config.Config, name string, users []string) {
+	st := c.Settings(config.Channels{})
+	st.Token = name
+	tc, err := r.twitchClient(st)
+	if err != nil {
+		log.Errorf("Failed to validate token '%v': '%v'", name, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	info, err := tc.Validate(ctx)
+	switch {
+	case errors.Is(err, twitch.ErrInvalidToken):
+		log.Errorf("Token '%v' is invalid or expired, recording %v anonymously. Replace it with 'rekoda token set %v'",
+			name, strings.Join(users, ", "), name)
+		r.dropToken(name)
+		return
+	case err != nil:
+		log.Warnf("Failed to validate token '%v': '%v'", name, err) // Keep using it, twitch may be down
+		return
+	}
+
+	log.Debugf("Token '%v' belongs to %v", name, info.Login)
+	if info.ClientID != tc.ClientID {
+		log.Warnf("Token '%v' was issued for client id %v, not %v rekoda talks to twitch with. Playback may stay anonymous", name, info.ClientID, tc.ClientID)
+	}
+	if info.ExpiresIn > 0 && info.ExpiresIn < tokenExpiryWarning {
+		log.Warnf("Token '%v' of %v expires in %v, replace it with 'rekoda token set %v'", name, info.Login, info.ExpiresIn.Round(time.Minute), name)
+	}
+}
+
+// dropToken forgets invalid token and clients using it
+func (r *Recorder) dropToken(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tokens, name)
+	for key := range r.twitchClients {
+		if strings.HasSuffix(key, "|token:"+name) {
+			delete(r.twitchClients, key)
+		}
+	}
+}
+
+// tokenUsers returns enabled channels by name of token they use
+func tokenUsers(c *config.Config) map[string][]string {
+	users := make(map[string][]string)
+	for _, u := range c.Channels {
+		if !u.Enabled {
+			continue
+		}
+		if name := c.Settings(u).Token; name != "" {
+			users[name] = append(users[name], u.User)
+		}
+	}
+	for _, list := range users {
+		sort.Strings(list)
+	}
+	return users
+}
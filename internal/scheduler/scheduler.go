@@ -0,0 +1,268 @@
+package scheduler
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scheduler runs online checks of many channels concurrently, each one on its own interval.
+// Checks are spread with random jitter and all of them together stay under global rate limit.
+// Every tick of rate limit takes a batch of due channels, Prefetch may look all of them up at once
+type Scheduler struct {
+	Workers   int     // Checks running at the same time
+	Rate      float64 // Batches of checks started per second
+	Jitter    float64 // Fraction of interval every check is randomly moved by
+	Heartbeat func()  // Called on every loop iteration, lets watchdog know scheduler is alive
+
+	// Batch is the most channels one tick takes: every due one, then ones due within their jitter
+	// checked a bit early, most overdue first. 1 checks channels one by one
+	Batch int
+	// Prefetch is called with channels of every batch before their checks start, e.g. to request status of all at once
+	Prefetch func(names []string)
+
+	check func(name string)
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	wake    chan struct{}
+}
+
+type entry struct {
+	interval time.Duration
+	added    time.Time
+	next     time.Time
+	last     time.Time
+	running  bool
+	pending  bool // CheckNow came while check was running, the next one is due right after it
+}
+
+// Status is snapshot of channel's schedule
+type Status struct {
+	Name      string
+	Interval  time.Duration
+	LastCheck time.Time // Zero if never checked
+	NextCheck time.Time
+	Stale     time.Duration // Time passed since last check, or since channel was scheduled if never checked
+}
+
+// New returns scheduler calling check for every due channel
+func New(workers int, rate, jitter float64, check func(name string)) *Scheduler {
+	if workers < 1 {
+		workers = 1
+	}
+	if rate <= 0 {
+		rate = 1
+	}
+	return &Scheduler{
+		Workers: workers,
+		Rate:    rate,
+		Jitter:  jitter,
+		Batch:   1,
+		check:   check,
+		entries: make(map[string]*entry),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Set schedules channel to be checked every interval. New channel is due right away,
+// rate limit spreads channels added at once and jitter keeps them apart afterwards
+func (s *Scheduler) Set(name string, interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		now := time.Now()
+		e = &entry{added: now, next: now}
+		s.entries[name] = e
+	} else if !e.last.IsZero() {
+		e.next = e.last.Add(interval)
+	}
+	e.interval = interval
+	s.notify()
+}
+
+// Remove stops checking channel
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, name)
+}
+
+// CheckNow moves channel's next check to now, e.g. when something tells us it went online
+func (s *Scheduler) CheckNow(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[name]; ok {
+		e.next = time.Now()
+		e.pending = e.running
+		s.notify()
+	}
+}
+
+// Status returns schedule of every channel sorted by name
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	list := make([]Status, 0, len(s.entries))
+	for name, e := range s.entries {
+		st := Status{Name: name, Interval: e.interval, LastCheck: e.last, NextCheck: e.next, Stale: now.Sub(e.added)}
+		if !e.last.IsZero() {
+			st.Stale = now.Sub(e.last)
+		}
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Run starts due checks until stop is closed
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	limit := time.NewTicker(time.Duration(float64(time.Second) / s.Rate))
+	defer limit.Stop()
+	workers := make(chan struct{}, s.Workers)
+
+	for {
+		if s.Heartbeat != nil {
+			s.Heartbeat()
+		}
+
+		name, wait := s.due()
+		if wait > 0 {
+			if wait > time.Second {
+				wait = time.Second // Keep heartbeat going
+			}
+			select {
+			case <-stop:
+				return
+			case <-s.wake:
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		// Global rate limit, then free worker
+		select {
+		case <-stop:
+			return
+		case <-limit.C:
+		}
+		select {
+		case <-stop:
+			return
+		case workers <- struct{}{}:
+		}
+
+		names := s.start(name)
+		if len(names) == 0 {
+			<-workers
+			continue
+		}
+		go func() {
+			if s.Prefetch != nil {
+				s.Prefetch(names)
+			}
+			<-workers
+			for _, name := range names {
+				workers <- struct{}{}
+				go func(name string) {
+					defer func() { <-workers }()
+					defer s.done(name)
+					s.check(name)
+				}(name)
+			}
+		}()
+	}
+}
+
+// due returns channel whose check is the most overdue, or how long to wait for the next one
+func (s *Scheduler) due() (string, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var name string
+	var next time.Time
+	for n, e := range s.entries {
+		if e.running {
+			continue
+		}
+		if name == "" || e.next.Before(next) {
+			name, next = n, e.next
+		}
+	}
+	if name == "" {
+		return "", time.Second
+	}
+	return name, time.Until(next)
+}
+
+// start marks checks of channel and the rest of its batch as running, none if channel was removed meanwhile
+func (s *Scheduler) start(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok || e.running {
+		return nil
+	}
+	now := time.Now()
+	names := []string{name}
+	if s.Batch > 1 {
+		var due []string
+		for n, e := range s.entries {
+			early := time.Duration(s.Jitter * float64(e.interval))
+			if n != name && !e.running && !e.next.After(now.Add(early)) {
+				due = append(due, n)
+			}
+		}
+		sort.Slice(due, func(i, j int) bool { return s.entries[due[i]].next.Before(s.entries[due[j]].next) })
+		if len(due) > s.Batch-1 {
+			due = due[:s.Batch-1]
+		}
+		names = append(names, due...)
+	}
+	for _, n := range names {
+		s.entries[n].running = true
+		s.entries[n].last = now
+	}
+	return names
+}
+
+// done schedules channel's next check one interval after the last one started, moved by jitter,
+// or right away if CheckNow came meanwhile
+func (s *Scheduler) done(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return
+	}
+	e.running = false
+	if e.pending {
+		e.pending = false
+		e.next = time.Now()
+	} else {
+		e.next = e.last.Add(e.interval + s.jitter(e.interval))
+	}
+	s.notify()
+}
+
+// jitter returns random part of interval between -Jitter and +Jitter
+func (s *Scheduler) jitter(interval time.Duration) time.Duration {
+	if s.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration((rand.Float64()*2 - 1) * s.Jitter * float64(interval))
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
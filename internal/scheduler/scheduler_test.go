@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEveryChannelOnItsOwnInterval(t *testing.T) {
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	s := New(4, 1000, 0, func(name string) {
+		mu.Lock()
+		counts[name]++
+		mu.Unlock()
+	})
+	s.Set("fast", 20*time.Millisecond)
+	s.Set("slow", time.Hour)
+
+	stop := make(chan struct{})
+	go s.Run(stop)
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.GreaterOrEqual(t, counts["fast"], 5)
+	assert.Equal(t, 1, counts["slow"])
+}
+
+func TestWorkersLimit(t *testing.T) {
+	var running, max int32
+	s := New(2, 1000, 0, func(name string) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	})
+	for i := 0; i < 10; i++ {
+		s.Set(fmt.Sprintf("channel%v", i), time.Hour)
+	}
+
+	stop := make(chan struct{})
+	go s.Run(stop)
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&max))
+}
+
+func TestRateLimit(t *testing.T) {
+	var checks int32
+	s := New(100, 20, 0, func(name string) {
+		atomic.AddInt32(&checks, 1)
+	})
+	for i := 0; i < 100; i++ {
+		s.Set(fmt.Sprintf("channel%v", i), time.Hour)
+	}
+
+	stop := make(chan struct{})
+	go s.Run(stop)
+	time.Sleep(250 * time.Millisecond)
+	close(stop)
+
+	n := atomic.LoadInt32(&checks)
+	assert.LessOrEqual(t, n, int32(6))
+	assert.GreaterOrEqual(t, n, int32(3))
+}
+
+func TestStatusAndCheckNow(t *testing.T) {
+	checked := make(chan string, 10)
+	s := New(1, 1000, 0.5, func(name string) { checked <- name })
+	s.Set("rwxrob", time.Hour)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.Run(stop)
+	assert.Equal(t, "rwxrob", <-checked)
+
+	time.Sleep(10 * time.Millisecond)
+	st := s.Status()
+	assert.Len(t, st, 1)
+	assert.Equal(t, time.Hour, st[0].Interval)
+	assert.False(t, st[0].LastCheck.IsZero())
+	assert.Less(t, st[0].Stale, time.Second)
+	// Jitter moves next check by at most half of interval
+	assert.WithinDuration(t, st[0].LastCheck.Add(time.Hour), st[0].NextCheck, 30*time.Minute)
+
+	s.CheckNow("rwxrob")
+	select {
+	case name := <-checked:
+		assert.Equal(t, "rwxrob", name)
+	case <-time.After(time.Second):
+		t.Fatal("CheckNow did not trigger check")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var mu sync.Mutex
+	var batches []int
+	checked := make(map[string]bool)
+	s := New(4, 1000, 0, func(name string) {
+		mu.Lock()
+		checked[name] = true
+		mu.Unlock()
+	})
+	s.Batch = 10
+	s.Prefetch = func(names []string) {
+		mu.Lock()
+		batches = append(batches, len(names))
+		mu.Unlock()
+	}
+	for i := 0; i < 25; i++ {
+		s.Set(fmt.Sprintf("channel%v", i), time.Hour)
+	}
+
+	stop := make(chan struct{})
+	go s.Run(stop)
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int{10, 10, 5}, batches)
+	assert.Len(t, checked, 25)
+}
+
+func TestCheckNowWhileRunning(t *testing.T) {
+	checked := make(chan string, 10)
+	release := make(chan struct{})
+	var s *Scheduler
+	s = New(1, 1000, 0, func(name string) {
+		checked <- name
+		<-release
+	})
+	s.Set("rwxrob", time.Hour)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.Run(stop)
+	<-checked
+	s.CheckNow("rwxrob") // Arrives while check is running
+	release <- struct{}{}
+
+	select {
+	case <-checked:
+		release <- struct{}{}
+	case <-time.After(time.Second):
+		t.Fatal("CheckNow during check was lost")
+	}
+}
@@ -0,0 +1,166 @@
+package sidecar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/wmw64/rekoda/pkg/mpegts"
+)
+
+// Found is recording found on disk
+type Found struct {
+	Path string // Recording file
+	Rec  Recording
+}
+
+// fileName matches recordings named by default file template, e.g. rwxrob_2021-09-08_12-57-06.ts
+var fileName = regexp.MustCompile(`^(.+)_(\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2})\.ts$`)
+
+// guessWindow is how much of head and tail of recording Guess reads, in whole packets
+var guessWindow int64 = (4 << 20) / mpegts.PacketSize * mpegts.PacketSize
+
+// GuessSettled is how long recording must be left unmodified before Find keeps guess about it in sidecar,
+// so recording isn't read again next time
+const GuessSettled = 15 * time.Minute
+
+// Find returns recordings in dirs: ones with sidecar whose file is still there and ones named by default
+// file template without sidecar, described by Guess. Guesses about recordings not modified for GuessSettled
+// are saved as their sidecars. Dirs which don't exist are skipped
+func Find(dirs ...string) ([]Found, error) {
+	var found []Found
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if errors.Is(err, os.ErrNotExist) && path == dir {
+				return filepath.SkipDir
+			}
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			var f Found
+			switch filepath.Ext(path) {
+			case ".json":
+				rec, err := Load(path)
+				if err != nil || rec.Channel == "" || rec.File == "" {
+					return nil // Some other JSON file
+				}
+				f = Found{Path: filepath.Join(filepath.Dir(path), rec.File), Rec: rec}
+				if _, err := os.Stat(f.Path); err != nil {
+					return nil
+				}
+			case ".ts":
+				if _, err := os.Stat(Path(path)); err == nil {
+					return nil // Found by its sidecar
+				}
+				rec, err := Guess(path)
+				if err != nil {
+					return nil // Not a recording, or named by custom template
+				}
+				if fi, err := d.Info(); err == nil && time.Since(fi.ModTime()) >= GuessSettled {
+					rec.Save(Path(path)) // Guessed again next time if it can't be saved
+				}
+				f = Found{Path: path, Rec: rec}
+			default:
+				return nil
+			}
+			if !seen[f.Path] {
+				seen[f.Path] = true
+				found = append(found, f)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+// Guess describes recording without sidecar: channel and start from its name, which must follow
+// default file template, and media time covered from its contents. Only head and tail of recording are read
+// when timestamps run from one to the other without jumps, otherwise whole recording is scanned, timestamp
+// jumps left out
+func Guess(path string) (Recording, error) {
+	m := fileName.FindStringSubmatch(filepath.Base(path))
+	if m == nil {
+		return Recording{}, fmt.Errorf("'%v' is not named <user>_<date>_<time>.ts", filepath.Base(path))
+	}
+	started, err := time.ParseInLocation("2006-01-02_15-04-05", m[2], time.Local)
+	if err != nil {
+		return Recording{}, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return Recording{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return Recording{}, err
+	}
+
+	// Damaged recording is described all the same, by what could be read of it
+	head, _ := mpegts.Analyze(io.NewSectionReader(f, 0, guessWindow))
+	duration, ok := span(f, fi.Size(), head)
+	if !ok {
+		rep, _ := mpegts.Scan(io.NewSectionReader(f, 0, fi.Size()))
+		duration = rep.Duration
+	}
+	return Recording{
+		Channel: m[1],
+		File:    filepath.Base(path),
+		Started: started,
+		Ended:   started.Add(duration),
+		Seconds: duration.Seconds(),
+		Video:   head.Video,
+		Audio:   head.Audio,
+		Guessed: true,
+	}, nil
+}
+
+// span returns media time recording of size bytes covers from timestamps of its head and tail. False if
+// recording is too small to need it or timestamps may jump: within head or tail, or between them, which
+// shows as media time not matching size
+func span(f io.ReaderAt, size int64, head mpegts.Info) (time.Duration, bool) {
+	if size <= 2*guessWindow || head.Duration <= 0 {
+		return 0, false
+	}
+	off := (size - guessWindow) / mpegts.PacketSize * mpegts.PacketSize
+	tail, err := mpegts.Analyze(io.NewSectionReader(f, off, guessWindow))
+	if err != nil || tail.Duration <= 0 {
+		return 0, false
+	}
+	for _, w := range []struct {
+		off  int64
+		info mpegts.Info
+	}{{0, head}, {off, tail}} {
+		rep, err := mpegts.Scan(io.NewSectionReader(f, w.off, guessWindow))
+		if err != nil || rep.Discontinuities > 0 || rep.Has(mpegts.ProblemTimestamp) || absDuration(rep.Duration-w.info.Duration) > time.Second {
+			return 0, false
+		}
+	}
+
+	d := (tail.Start - head.Start) & (1<<33 - 1) // Rollover of 33 bit clock
+	total := time.Duration(float64(d)*float64(time.Second)/mpegts.ClockRate) + tail.Duration
+	expected := time.Duration(float64(head.Duration) * float64(size) / float64(guessWindow))
+	if total < expected*3/4 || total > expected*4/3 {
+		return 0, false
+	}
+	return total, true
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,119 @@
+package sidecar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/pkg/mpegts"
+)
+
+// longRecording writes n one second segments one after another, timestamps of segment i moved by shift(i) seconds
+// and continuity counters going on across segments
+func longRecording(t *testing.T, path string, n int, shift func(i int) int64) {
+	seg, err := os.ReadFile("../recorder/testdata/segment.ts")
+	assert.NoError(t, err)
+	var out []byte
+	counters := make(map[uint16]byte)
+	for i := 0; i < n; i++ {
+		b := append([]byte(nil), seg...)
+		for pkt := b; len(pkt) >= mpegts.PacketSize; pkt = pkt[mpegts.PacketSize:] {
+			p, err := mpegts.ParsePacket(pkt[:mpegts.PacketSize])
+			assert.NoError(t, err)
+			if !p.HasPayload {
+				continue
+			}
+			pkt[3] = pkt[3]&0xF0 | counters[p.PID]&0x0F
+			counters[p.PID]++
+			pes := p.Payload
+			if !p.PayloadStart || len(pes) < 14 || pes[0] != 0 || pes[1] != 0 || pes[2] != 1 {
+				continue
+			}
+			if pes[7]&0x80 != 0 {
+				moveTimestamp(pes[9:14], shift(i)*mpegts.ClockRate)
+			}
+			if pes[7]&0x40 != 0 {
+				moveTimestamp(pes[14:19], shift(i)*mpegts.ClockRate)
+			}
+		}
+		out = append(out, b...)
+	}
+	assert.NoError(t, os.WriteFile(path, out, 0644))
+}
+
+// moveTimestamp moves PTS or DTS of PES header by delta
+func moveTimestamp(b []byte, delta int64) {
+	ts := int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+	ts = (ts + delta) & (1<<33 - 1)
+	b[0] = b[0]&0xF1 | byte(ts>>29)&0x0E
+	b[1] = byte(ts >> 22)
+	b[2] = byte(ts>>14) | 0x01
+	b[3] = byte(ts >> 7)
+	b[4] = byte(ts<<1) | 0x01
+}
+
+func TestGuess(t *testing.T) {
+	defer func(w int64) { guessWindow = w }(guessWindow)
+	guessWindow = 3 * 93 * mpegts.PacketSize // Three segments
+	dir := t.TempDir()
+	started := time.Date(2021, 9, 8, 12, 57, 6, 0, time.Local)
+
+	path := filepath.Join(dir, "rwxrob_2021-09-08_12-57-06.ts")
+	longRecording(t, path, 20, func(i int) int64 { return int64(i) })
+	rec, err := Guess(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "rwxrob", rec.Channel)
+	assert.Equal(t, started, rec.Started)
+	assert.Equal(t, 20.0, rec.Seconds)
+	assert.Equal(t, started.Add(20*time.Second), rec.Ended)
+	assert.Equal(t, "h264 1920x1080 30fps", rec.Video.String())
+	assert.True(t, rec.Guessed)
+
+	// Stream restarted with timestamps ten minutes later, in the middle or within tail
+	for _, at := range []int{10, 18} {
+		at := at
+		longRecording(t, path, 20, func(i int) int64 {
+			if i >= at {
+				return int64(i) + 600
+			}
+			return int64(i)
+		})
+		rec, err = Guess(path)
+		assert.NoError(t, err)
+		assert.Equal(t, 20.0, rec.Seconds, "restart at %v", at)
+	}
+
+	_, err = Guess(filepath.Join(dir, "custom.ts"))
+	assert.Error(t, err)
+}
+
+func TestFindSavesGuess(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rwxrob_2021-09-08_12-57-06.ts")
+	longRecording(t, path, 3, func(i int) int64 { return int64(i) })
+
+	// Recording may still be written
+	found, err := Find(dir)
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.True(t, found[0].Rec.Guessed)
+	assert.NoFileExists(t, Path(path))
+
+	old := time.Now().Add(-GuessSettled - time.Minute)
+	assert.NoError(t, os.Chtimes(path, old, old))
+	found, err = Find(dir)
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	rec, err := Load(Path(path))
+	assert.NoError(t, err)
+	assert.True(t, rec.Guessed)
+	assert.True(t, found[0].Rec.Ended.Equal(rec.Ended))
+
+	// Found by its sidecar from now on
+	found, err = Find(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []Found{{Path: path, Rec: rec}}, found)
+	assert.Equal(t, 3.0, found[0].Rec.Seconds)
+}
@@ -0,0 +1,138 @@
+// Package sidecar keeps metadata of a recording in a JSON file next to it
+package sidecar
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	conf "github.com/wmw64/rekoda/pkg/config/toml"
+	"github.com/wmw64/rekoda/pkg/mpegts"
+)
+
+// AdBreak is ad break seen during recording
+type AdBreak struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Seconds  float64   `json:"seconds"`  // Total duration of ad segments
+	Segments int       `json:"segments"` // How many ad segments there were
+	Ads      string    `json:"ads"`      // What was done with them: keep, skip or separate
+}
+
+// Duration returns total duration of ad segments
+func (b AdBreak) Duration() time.Duration {
+	return time.Duration(b.Seconds * float64(time.Second))
+}
+
+// Gap is segment left out of recording because it couldn't be downloaded intact
+type Gap struct {
+	At      time.Time `json:"at"`
+	Seconds float64   `json:"seconds"`
+	Reason  string    `json:"reason"`
+}
+
+// Change is change of video or audio parameters in the middle of recording
+type Change struct {
+	At     time.Time `json:"at"`
+	Offset float64   `json:"offset"` // Seconds into recording
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+}
+
+// Title is title and game of stream from the moment they were seen
+type Title struct {
+	At    time.Time `json:"at"`
+	Title string    `json:"title"`
+	Game  string    `json:"game"`
+}
+
+// PostProcess is outcome of post-processing command run once recording was closed
+type PostProcess struct {
+	Command  string    `json:"command"`
+	Finished time.Time `json:"finished"`
+	Error    string    `json:"error,omitempty"` // Empty if it succeeded
+}
+
+// Recording is metadata of recorded file
+type Recording struct {
+	Channel   string    `json:"channel"`
+	Quality   string    `json:"quality"`
+	Tags      []string  `json:"tags,omitempty"`      // Labels of channel, see 'rekoda channel set'
+	Broadcast string    `json:"broadcast,omitempty"` // Twitch stream ID, the same for every recording of one broadcast
+	File      string    `json:"file"`                // Name of recording, relative to sidecar
+	AdsFile   string    `json:"ads_file,omitempty"`  // Name of file ads were written into, if any
+	Parts     []string  `json:"parts,omitempty"`     // Names of recordings merged into this one, see 'rekoda merge'
+	Started   time.Time `json:"started"`
+	Ended     time.Time `json:"ended"`             // Zero while recording
+	Seconds   float64   `json:"seconds"`           // Media time recorded, from timestamps
+	Guessed   bool      `json:"guessed,omitempty"` // Described by Guess from name and contents of file, not by recorder
+
+	Video    *mpegts.VideoInfo `json:"video,omitempty"`
+	Audio    *mpegts.AudioInfo `json:"audio,omitempty"`
+	Changes  []Change          `json:"changes"`
+	AdBreaks []AdBreak         `json:"ad_breaks"`
+	Gaps     []Gap             `json:"gaps"`
+
+	Titles      []Title      `json:"titles,omitempty"` // Oldest first
+	PostProcess *PostProcess `json:"post_process,omitempty"`
+}
+
+// AddTitle adds title and game seen at t, reporting whether they differ from the last ones
+func (r *Recording) AddTitle(t time.Time, title, game string) bool {
+	if n := len(r.Titles); n > 0 && r.Titles[n-1].Title == title && r.Titles[n-1].Game == game {
+		return false
+	}
+	r.Titles = append(r.Titles, Title{At: t, Title: title, Game: game})
+	return true
+}
+
+// Games returns games played during recording in order they were first seen
+func (r Recording) Games() []string {
+	var games []string
+	seen := make(map[string]bool)
+	for _, t := range r.Titles {
+		if t.Game != "" && !seen[t.Game] {
+			seen[t.Game] = true
+			games = append(games, t.Game)
+		}
+	}
+	return games
+}
+
+// AdTime returns total duration of ads seen during recording and how much of it was left out of recording
+func (r Recording) AdTime() (total, removed time.Duration) {
+	for _, b := range r.AdBreaks {
+		total += b.Duration()
+		if b.Ads != "keep" {
+			removed += b.Duration()
+		}
+	}
+	return total, removed
+}
+
+// Path returns sidecar path of recording, e.g. rwxrob_2021-09-08.json for rwxrob_2021-09-08.ts
+func Path(recording string) string {
+	return strings.TrimSuffix(recording, filepath.Ext(recording)) + ".json"
+}
+
+// Load reads sidecar file
+func Load(path string) (Recording, error) {
+	var r Recording
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	err = json.Unmarshal(b, &r)
+	return r, err
+}
+
+// Save writes sidecar file atomically
+func (r Recording) Save(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return conf.WriteFile(path, b, 0644)
+}
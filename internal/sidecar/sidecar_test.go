@@ -0,0 +1,48 @@
+package sidecar
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "/srv/streams/rwxrob/rwxrob_2021-09-08_12-57-06.json", Path("/srv/streams/rwxrob/rwxrob_2021-09-08_12-57-06.ts"))
+}
+
+func TestSaveLoad(t *testing.T) {
+	start := time.Date(2021, 9, 8, 12, 57, 6, 0, time.UTC)
+	r := Recording{
+		Channel: "rwxrob",
+		Quality: "best",
+		File:    "rwxrob_2021-09-08_12-57-06.ts",
+		Started: start,
+		AdBreaks: []AdBreak{
+			{Start: start, End: start.Add(30 * time.Second), Seconds: 30, Segments: 15, Ads: "skip"},
+			{Start: start.Add(time.Hour), End: start.Add(time.Hour + 15*time.Second), Seconds: 15, Segments: 8, Ads: "keep"},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "rwxrob.json")
+	assert.NoError(t, r.Save(path))
+
+	again, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, r, again)
+
+	total, removed := again.AdTime()
+	assert.Equal(t, 45*time.Second, total)
+	assert.Equal(t, 30*time.Second, removed)
+}
+
+func TestTitles(t *testing.T) {
+	start := time.Date(2021, 9, 8, 12, 57, 6, 0, time.UTC)
+	var r Recording
+	assert.True(t, r.AddTitle(start, "Coding", "Science & Technology"))
+	assert.False(t, r.AddTitle(start.Add(time.Minute), "Coding", "Science & Technology"))
+	assert.True(t, r.AddTitle(start.Add(time.Hour), "Chatting", "Just Chatting"))
+	assert.True(t, r.AddTitle(start.Add(2*time.Hour), "Coding again", "Science & Technology"))
+	assert.Len(t, r.Titles, 3)
+	assert.Equal(t, []string{"Science & Technology", "Just Chatting"}, r.Games())
+}
@@ -0,0 +1,298 @@
+// Package tui is full-screen dashboard of channels being recorded, drawn with plain ANSI escape sequences
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/wmw64/rekoda/internal/control"
+)
+
+// stallAfter is how long recording may go without a segment before it's shown as stalled
+const stallAfter = 30 * time.Second
+
+// Source is what dashboard shows and where actions are sent to
+type Source struct {
+	Status func() (control.Status, error)
+	Act    func(channel, action string) error
+	Logs   *LogBuffer // Shown below channels if not nil
+}
+
+// Keys
+const (
+	keyQuit    = "q"
+	keyCtrlC   = "\x03"
+	keyUp      = "\x1b[A"
+	keyDown    = "\x1b[B"
+	keyStart   = "s"
+	keyStop    = "x"
+	keyToggle  = "e"
+	keyRefresh = "r"
+)
+
+const help = "↑↓ select  s start  x stop  e enable/disable  r refresh  q quit"
+
+// Run draws dashboard on terminal until q or Ctrl+C is pressed or ctx is done, refreshing every interval
+func Run(ctx context.Context, in, out *os.File, src Source, interval time.Duration) error {
+	restore, err := makeRaw(in.Fd())
+	if err != nil {
+		return err
+	}
+	defer restore()
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l") // Alternate screen, hide cursor
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go readKeys(in, keys)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	d := &dashboard{src: src}
+	d.refresh()
+	for {
+		d.width, d.height = size(out.Fd())
+		io.WriteString(out, "\x1b[H"+strings.Join(d.lines(time.Now()), "\x1b[K\n")+"\x1b[K\x1b[J")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+			d.refresh()
+		case k, ok := <-keys:
+			if !ok || !d.key(k) {
+				return nil
+			}
+		}
+	}
+}
+
+// readKeys sends key presses, escape sequences of arrows arrive as one read
+func readKeys(in io.Reader, keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 16)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			return
+		}
+		keys <- string(buf[:n])
+	}
+}
+
+type dashboard struct {
+	src           Source
+	status        control.Status
+	err           error  // Of the last status request
+	selected      string // Channel
+	message       string // Outcome of the last action
+	width, height int
+}
+
+func (d *dashboard) refresh() {
+	d.status, d.err = d.src.Status()
+}
+
+// key handles key press, returning false to quit
+func (d *dashboard) key(k string) bool {
+	switch k {
+	case keyQuit, keyCtrlC:
+		return false
+	case keyUp, "k":
+		d.move(-1)
+	case keyDown, "j":
+		d.move(1)
+	case keyRefresh:
+		d.refresh()
+	case keyStart, keyStop, keyToggle:
+		ch, ok := d.current()
+		if !ok {
+			return true
+		}
+		action := map[string]string{keyStart: control.ActionStart, keyStop: control.ActionStop, keyToggle: control.ActionDisable}[k]
+		if k == keyToggle && ch.State == control.StateDisabled {
+			action = control.ActionEnable
+		}
+		if err := d.src.Act(ch.Channel, action); err != nil {
+			d.message = "✗ " + err.Error()
+		} else {
+			d.message = fmt.Sprintf("✓ %v: %v", ch.Channel, action)
+		}
+		d.refresh()
+	}
+	return true
+}
+
+// current returns selected channel, the first one if none is selected yet
+func (d *dashboard) current() (control.ChannelStatus, bool) {
+	for _, ch := range d.status.Channels {
+		if ch.Channel == d.selected {
+			return ch, true
+		}
+	}
+	if len(d.status.Channels) == 0 {
+		return control.ChannelStatus{}, false
+	}
+	d.selected = d.status.Channels[0].Channel
+	return d.status.Channels[0], true
+}
+
+func (d *dashboard) move(delta int) {
+	list := d.status.Channels
+	if len(list) == 0 {
+		return
+	}
+	i := 0
+	for n, ch := range list {
+		if ch.Channel == d.selected {
+			i = n
+		}
+	}
+	i += delta
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(list) {
+		i = len(list) - 1
+	}
+	d.selected = list[i].Channel
+}
+
+// lines renders screen, cut to terminal size
+func (d *dashboard) lines(now time.Time) []string {
+	d.current()
+	counts := make(map[string]int)
+	for _, ch := range d.status.Channels {
+		counts[ch.State]++
+	}
+	header := fmt.Sprintf("rekoda  pid %v  up %v  %v recording, %v offline, %v stopped, %v disabled",
+		d.status.PID, short(now.Sub(d.status.Started)), counts[control.StateRecording]+counts[control.StateRestart],
+		counts[control.StateOffline], counts[control.StateStopped], counts[control.StateDisabled])
+	if d.status.PID == 0 {
+		header = "rekoda"
+	}
+	header = pad(header, d.width-9) + " " + now.Format("15:04:05")
+
+	nameWidth := len("CHANNEL")
+	for _, ch := range d.status.Channels {
+		if len(ch.Channel) > nameWidth {
+			nameWidth = len(ch.Channel)
+		}
+	}
+	row := func(cols ...string) string {
+		return fmt.Sprintf("  %-*v  %-9v  %-8v  %-8v  %-10v  %-12v  %v", nameWidth, cols[0], cols[1], cols[2], cols[3], cols[4], cols[5], cols[6])
+	}
+
+	// Help and logs stay at the bottom, channels scroll to keep selected one visible
+	var bottom []string
+	if d.src.Logs != nil {
+		if logs := d.src.Logs.Lines(d.height / 3); len(logs) > 0 {
+			bottom = append([]string{strings.Repeat("─", d.width)}, logs...)
+		}
+	}
+	bottom = append(bottom, "", help, d.message)
+	top := []string{header, row("CHANNEL", "STATE", "ELAPSED", "SIZE", "BITRATE", "HEALTH", "LAST ERROR")}
+	if d.err != nil {
+		top = append(top, "  "+d.err.Error())
+	}
+
+	list := d.status.Channels
+	visible := d.height - len(top) - len(bottom)
+	if visible < 1 {
+		visible = 1
+	}
+	first := 0
+	for i, ch := range list {
+		if ch.Channel == d.selected && i >= visible {
+			first = i - visible + 1
+		}
+	}
+	list = list[first:]
+	if len(list) > visible {
+		list = list[:visible]
+	}
+
+	lines := top
+	for _, ch := range list {
+		line := row(channelColumns(ch, now)...)
+		if ch.Channel == d.selected {
+			line = ">" + line[1:]
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) < d.height-len(bottom) {
+		lines = append(lines, "")
+	}
+	lines = append(lines, bottom...)
+	for i := range lines {
+		lines[i] = cut(lines[i], d.width)
+	}
+	return lines
+}
+
+// channelColumns formats state, elapsed time, size, bitrate, health and the last error of channel
+func channelColumns(ch control.ChannelStatus, now time.Time) []string {
+	elapsed, size, bitrate, health := "-", "-", "-", "-"
+	switch ch.State {
+	case control.StateRecording, control.StateRestart:
+		elapsed = short(now.Sub(ch.Started))
+		size = humanize.Bytes(ch.Bytes)
+		if b := ch.Bitrate(); b > 0 {
+			bitrate = fmt.Sprintf("%.1f Mb/s", b/1e6)
+		}
+		switch {
+		case ch.State == control.StateRestart:
+			health = "waiting"
+		case !ch.LastSegment.IsZero() && now.Sub(ch.LastSegment) > stallAfter:
+			health = "stalled " + short(now.Sub(ch.LastSegment))
+		case ch.Gaps > 0:
+			health = fmt.Sprintf("%v gaps", ch.Gaps)
+		default:
+			health = "ok"
+		}
+	case control.StateOffline:
+		if !ch.NextCheck.IsZero() {
+			health = "check " + short(ch.NextCheck.Sub(now))
+		}
+	}
+	lastError := ""
+	if ch.Error != "" {
+		lastError = fmt.Sprintf("%v ago: %v", short(now.Sub(ch.ErrorAt)), ch.Error)
+	}
+	return []string{ch.Channel, ch.State, elapsed, size, bitrate, health, lastError}
+}
+
+// short formats duration to seconds at most, e.g. 1h02m, 3m05s, 12s
+func short(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	d = d.Round(time.Second)
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
+
+// cut shortens line to width columns
+func cut(s string, width int) string {
+	r := []rune(s)
+	if width > 0 && len(r) > width {
+		return string(r[:width])
+	}
+	return s
+}
+
+// pad extends line with spaces up to width columns
+func pad(s string, width int) string {
+	if n := width - len([]rune(s)); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
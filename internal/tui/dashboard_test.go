@@ -0,0 +1,110 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/control"
+)
+
+func testSource(acts *[]string) Source {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	st := control.Status{PID: 42, Started: now.Add(-time.Hour), Channels: []control.ChannelStatus{
+		{Channel: "alice", State: control.StateRecording, Started: now.Add(-90 * time.Second), Bytes: 3e6, LastSegment: now},
+		{Channel: "bob", State: control.StateOffline, NextCheck: now.Add(20 * time.Second), Error: "timeout", ErrorAt: now.Add(-time.Minute)},
+		{Channel: "carol", State: control.StateDisabled},
+	}}
+	return Source{
+		Status: func() (control.Status, error) { return st, nil },
+		Act: func(channel, action string) error {
+			*acts = append(*acts, channel+" "+action)
+			if channel == "carol" && action == control.ActionStart {
+				return errors.New("channel 'carol' is not checked, enable it first")
+			}
+			return nil
+		},
+	}
+}
+
+func TestDashboardLines(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	var acts []string
+	d := &dashboard{src: testSource(&acts), width: 100, height: 10}
+	d.refresh()
+	lines := d.lines(now)
+
+	assert.Len(t, lines, 10)
+	assert.Contains(t, lines[0], "pid 42  up 1h00m  1 recording, 1 offline, 0 stopped, 1 disabled")
+	assert.Contains(t, lines[1], "CHANNEL")
+	assert.True(t, strings.HasPrefix(lines[2], "> alice"), lines[2])
+	assert.Contains(t, lines[2], "1m30s")
+	assert.Contains(t, lines[2], "3.0 MB")
+	assert.Contains(t, lines[3], "check 20s")
+	assert.Contains(t, lines[3], "1m00s ago: timeout")
+	assert.Equal(t, help, lines[8])
+
+	d.width, d.height = 20, 6
+	for _, l := range d.lines(now) {
+		assert.LessOrEqual(t, len([]rune(l)), 20)
+	}
+}
+
+func TestDashboardKeys(t *testing.T) {
+	var acts []string
+	d := &dashboard{src: testSource(&acts)}
+	d.refresh()
+
+	assert.True(t, d.key(keyStop))
+	d.key(keyDown)
+	d.key(keyDown)
+	d.key(keyDown) // Stays at the last one
+	d.key(keyToggle)
+	d.key(keyStart)
+	assert.Equal(t, "✗ channel 'carol' is not checked, enable it first", d.message)
+	d.key(keyUp)
+	d.key(keyToggle)
+	assert.Equal(t, "✓ bob: disable", d.message)
+	assert.Equal(t, []string{"alice stop", "carol enable", "carol start", "bob disable"}, acts)
+
+	assert.False(t, d.key(keyQuit))
+	assert.False(t, d.key(keyCtrlC))
+}
+
+func TestChannelColumns(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	ch := control.ChannelStatus{Channel: "alice", State: control.StateRecording, Started: now.Add(-time.Minute), LastSegment: now.Add(-time.Minute)}
+	assert.Equal(t, "stalled 1m00s", channelColumns(ch, now)[5])
+	ch.LastSegment, ch.Gaps = now, 2
+	assert.Equal(t, "2 gaps", channelColumns(ch, now)[5])
+	ch.State = control.StateRestart
+	assert.Equal(t, "waiting", channelColumns(ch, now)[5])
+	assert.Equal(t, []string{"bob", control.StateStopped, "-", "-", "-", "-", ""}, channelColumns(control.ChannelStatus{Channel: "bob", State: control.StateStopped}, now))
+}
+
+func TestShort(t *testing.T) {
+	assert.Equal(t, "0s", short(-time.Second))
+	assert.Equal(t, "12s", short(12*time.Second))
+	assert.Equal(t, "3m05s", short(3*time.Minute+5*time.Second))
+	assert.Equal(t, "1h02m", short(time.Hour+2*time.Minute+30*time.Second))
+}
+
+func TestLogBuffer(t *testing.T) {
+	b := NewLogBuffer(2)
+	logger := log.New()
+	logger.AddHook(b)
+	logger.SetOutput(&strings.Builder{})
+	logger.Info("one")
+	logger.WithField("channel", "alice").Warn("two")
+	logger.Debug("hidden")
+	logger.Error("three")
+
+	lines := b.Lines(5)
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "WARNING [alice] two")
+	assert.Contains(t, lines[1], "ERROR   three")
+	assert.Len(t, b.Lines(1), 1)
+}
@@ -0,0 +1,53 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LogBuffer is logrus hook keeping the last log lines for dashboard to show below channels
+type LogBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	max   int
+}
+
+// NewLogBuffer returns hook keeping up to max lines
+func NewLogBuffer(max int) *LogBuffer {
+	return &LogBuffer{max: max}
+}
+
+// Levels implements log.Hook
+func (b *LogBuffer) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements log.Hook
+func (b *LogBuffer) Fire(e *log.Entry) error {
+	msg := e.Message
+	if ch, ok := e.Data["channel"]; ok {
+		msg = fmt.Sprintf("[%v] %v", ch, msg)
+	}
+	line := fmt.Sprintf("%v %-7v %v", e.Time.Format("15:04:05"), strings.ToUpper(e.Level.String()), strings.TrimSpace(msg))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lines = append(b.lines, line)
+	if len(b.lines) > b.max {
+		b.lines = append([]string(nil), b.lines[len(b.lines)-b.max:]...)
+	}
+	return nil
+}
+
+// Lines returns up to n last lines
+func (b *LogBuffer) Lines(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > len(b.lines) {
+		n = len(b.lines)
+	}
+	return append([]string(nil), b.lines[len(b.lines)-n:]...)
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package tui
+
+import "golang.org/x/sys/unix"
+
+// IsTerminal reports whether file descriptor is a terminal
+func IsTerminal(fd uintptr) bool {
+	_, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+	return err == nil
+}
+
+// makeRaw passes every key press through as it is typed, Ctrl+C included
+func makeRaw(fd uintptr) (restore func(), err error) {
+	old, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	raw := *old
+	raw.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Iflag &^= unix.IXON | unix.ICRNL
+	raw.Cc[unix.VMIN], raw.Cc[unix.VTIME] = 1, 0
+	if err := unix.IoctlSetTermios(int(fd), unix.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return func() { unix.IoctlSetTermios(int(fd), unix.TCSETS, old) }, nil
+}
+
+// size returns columns and rows of terminal, 80x24 if it can't tell
+func size(fd uintptr) (width, height int) {
+	ws, err := unix.IoctlGetWinsize(int(fd), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 80, 24
+	}
+	return int(ws.Col), int(ws.Row)
+}
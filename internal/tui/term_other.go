@@ -0,0 +1,19 @@
+//go:build !linux
+
+package tui
+
+import "errors"
+
+// IsTerminal reports whether file descriptor is a terminal. Dashboard is only available on linux,
+// elsewhere callers fall back to plain logs
+func IsTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (restore func(), err error) {
+	return nil, errors.New("dashboard is not supported on this system")
+}
+
+func size(fd uintptr) (width, height int) {
+	return 80, 24
+}
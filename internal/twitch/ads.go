@@ -0,0 +1,131 @@
+package twitch
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdClass is EXT-X-DATERANGE class of ad breaks twitch stitches into live playlists
+const AdClass = "twitch-stitched-ad"
+
+// AdBreak is server-side inserted ad break announced in media playlist
+type AdBreak struct {
+	ID       string
+	Start    time.Time
+	Duration time.Duration
+	RollType string // e.g. PREROLL or MIDROLL
+	Open     bool   // Duration not announced and no live segment after start in playlist yet
+}
+
+// Contains reports whether moment t of stream falls inside ad break
+func (b AdBreak) Contains(t time.Time) bool {
+	if t.IsZero() || t.Before(b.Start) {
+		return false
+	}
+	return b.Open || t.Before(b.Start.Add(b.Duration))
+}
+
+// AdBreaks returns ad breaks announced by EXT-X-DATERANGE tags of media playlist.
+// Breaks without duration end at the first segment titled 'live' after their start
+func AdBreaks(playlist []byte) []AdBreak {
+	var (
+		breaks []AdBreak
+		live   []time.Time // Start of every segment titled live
+		at     time.Time   // Start of next segment
+	)
+	s := bufio.NewScanner(bytes.NewReader(playlist))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
+			at, _ = time.Parse(time.RFC3339Nano, strings.TrimPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			inf := strings.SplitN(strings.TrimPrefix(line, "#EXTINF:"), ",", 2)
+			if len(inf) == 2 && strings.TrimSpace(inf[1]) == "live" && !at.IsZero() {
+				live = append(live, at)
+			}
+			if d, err := strconv.ParseFloat(inf[0], 64); err == nil && !at.IsZero() {
+				at = at.Add(time.Duration(d * float64(time.Second)))
+			}
+		case strings.HasPrefix(line, "#EXT-X-DATERANGE:"):
+			attrs := parseAttributes(strings.TrimPrefix(line, "#EXT-X-DATERANGE:"))
+			if attrs["CLASS"] != AdClass && !strings.HasPrefix(attrs["ID"], "stitched-ad-") {
+				continue
+			}
+			b := AdBreak{ID: attrs["ID"], RollType: attrs["X-TV-TWITCH-AD-ROLL-TYPE"]}
+			b.Start, _ = time.Parse(time.RFC3339Nano, attrs["START-DATE"])
+			if d, err := strconv.ParseFloat(attrs["DURATION"], 64); err == nil {
+				b.Duration = time.Duration(d * float64(time.Second))
+			} else if d, err := strconv.ParseFloat(attrs["PLANNED-DURATION"], 64); err == nil {
+				b.Duration = time.Duration(d * float64(time.Second))
+			} else {
+				b.Open = true
+			}
+			breaks = append(breaks, b)
+		}
+	}
+
+	for i, b := range breaks {
+		if !b.Open {
+			continue
+		}
+		for _, t := range live {
+			if !t.Before(b.Start) {
+				breaks[i].Duration, breaks[i].Open = t.Sub(b.Start), false
+				break
+			}
+		}
+	}
+	return breaks
+}
+
+// IsAd reports whether segment is an ad, either by its EXTINF title or by falling inside one of ad breaks.
+// Live segments are titled 'live', stitched ones carry the ad server's name
+func IsAd(title string, programDateTime time.Time, breaks []AdBreak) bool {
+	if strings.Contains(title, "Amazon") || strings.Contains(title, "stitched") {
+		return true
+	}
+	for _, b := range breaks {
+		if b.Contains(programDateTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAttributes splits HLS attribute list into unquoted values by name
+func parseAttributes(list string) map[string]string {
+	attrs := make(map[string]string)
+	for list != "" {
+		eq := strings.IndexByte(list, '=')
+		if eq < 0 {
+			break
+		}
+		name := strings.TrimSpace(list[:eq])
+		list = list[eq+1:]
+
+		var value string
+		if strings.HasPrefix(list, `"`) {
+			end := strings.IndexByte(list[1:], '"')
+			if end < 0 {
+				end = len(list) - 1 // Unterminated, take the rest
+				list += `"`
+			}
+			value = list[1 : end+1]
+			list = list[end+2:]
+		} else {
+			comma := strings.IndexByte(list, ',')
+			if comma < 0 {
+				comma = len(list)
+			}
+			value = list[:comma]
+			list = list[comma:]
+		}
+		attrs[name] = value
+		list = strings.TrimPrefix(list, ",")
+	}
+	return attrs
+}
@@ -0,0 +1,69 @@
+package twitch
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafov/m3u8"
+	"github.com/stretchr/testify/assert"
+)
+
+const mediaPlaylistWithAds = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-DATERANGE:ID="stitched-ad-1631105826-30",CLASS="twitch-stitched-ad",START-DATE="2021-09-08T12:57:06.000Z",DURATION=4.000,X-TV-TWITCH-AD-ROLL-TYPE="PREROLL",X-TV-TWITCH-AD-URL="https://example.com/a,b"
+#EXT-X-PROGRAM-DATE-TIME:2021-09-08T12:57:06.000Z
+#EXTINF:2.000,Amazon|123456789
+https://video-edge.example.com/ad1.ts
+#EXT-X-PROGRAM-DATE-TIME:2021-09-08T12:57:08.000Z
+#EXTINF:2.000,
+https://video-edge.example.com/ad2.ts
+#EXT-X-PROGRAM-DATE-TIME:2021-09-08T12:57:10.000Z
+#EXTINF:2.000,live
+https://video-edge.example.com/live1.ts
+#EXT-X-PROGRAM-DATE-TIME:2021-09-08T12:57:12.000Z
+#EXTINF:2.000,live
+https://video-edge.example.com/live2.ts
+`
+
+func TestAdBreaks(t *testing.T) {
+	breaks := AdBreaks([]byte(mediaPlaylistWithAds))
+	start := time.Date(2021, 9, 8, 12, 57, 6, 0, time.UTC)
+	assert.Equal(t, []AdBreak{{ID: "stitched-ad-1631105826-30", Start: start, Duration: 4 * time.Second, RollType: "PREROLL"}}, breaks)
+
+	assert.Empty(t, AdBreaks([]byte(`#EXT-X-DATERANGE:ID="source-1631105826",CLASS="twitch-session",START-DATE="2021-09-08T12:57:06.000Z"`)))
+}
+
+func TestAdBreaksWithoutDuration(t *testing.T) {
+	start := time.Date(2021, 9, 8, 12, 57, 6, 0, time.UTC)
+	unannounced := strings.Replace(mediaPlaylistWithAds, "DURATION=4.000,", "", 1)
+	breaks := AdBreaks([]byte(unannounced))
+	assert.Equal(t, []AdBreak{{ID: "stitched-ad-1631105826-30", Start: start, Duration: 4 * time.Second, RollType: "PREROLL"}}, breaks, "ends at first live segment")
+	assert.False(t, breaks[0].Contains(start.Add(6*time.Second)))
+
+	// Live segments not in playlist yet
+	breaks = AdBreaks([]byte(unannounced[:strings.Index(unannounced, "#EXTINF:2.000,live")]))
+	assert.True(t, breaks[0].Open)
+	assert.True(t, breaks[0].Contains(start.Add(time.Hour)))
+
+	breaks = AdBreaks([]byte(strings.Replace(mediaPlaylistWithAds, "DURATION=4.000,", "DURATION=0,", 1)))
+	assert.False(t, breaks[0].Contains(start), "zero duration is no break")
+}
+
+func TestIsAd(t *testing.T) {
+	playlist, _, err := m3u8.Decode(*bytes.NewBufferString(mediaPlaylistWithAds), true)
+	assert.NoError(t, err)
+	breaks := AdBreaks([]byte(mediaPlaylistWithAds))
+
+	var ads []bool
+	for _, seg := range playlist.(*m3u8.MediaPlaylist).Segments {
+		if seg != nil {
+			ads = append(ads, IsAd(seg.Title, seg.ProgramDateTime, breaks))
+		}
+	}
+	assert.Equal(t, []bool{true, true, false, false}, ads, "second ad is only known by date range")
+	assert.False(t, IsAd("live", time.Time{}, breaks))
+}
@@ -0,0 +1,77 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAuthEndpoint validates OAuth tokens
+const DefaultAuthEndpoint = "https://id.twitch.tv/oauth2"
+
+// ErrInvalidToken is returned for expired or revoked OAuth tokens
+var ErrInvalidToken = errors.New("invalid or expired OAuth token")
+
+// TokenInfo is what twitch knows about OAuth token
+type TokenInfo struct {
+	ClientID  string
+	Login     string
+	UserID    string
+	Scopes    []string
+	ExpiresIn time.Duration // Zero for tokens which don't expire
+}
+
+// NormalizeToken strips 'oauth:' and 'OAuth ' prefixes tokens are often copied with
+func NormalizeToken(token string) string {
+	token = strings.TrimSpace(token)
+	for _, prefix := range []string{"oauth:", "OAuth "} {
+		token = strings.TrimPrefix(token, prefix)
+	}
+	return token
+}
+
+// Validate asks twitch about client's OAuth token
+func (c *Client) Validate(ctx context.Context) (TokenInfo, error) {
+	if c.Token == "" {
+		return TokenInfo{}, errors.New("no OAuth token")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.AuthEndpoint+"/validate", nil)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+	req.Header.Set("Authorization", "OAuth "+c.Token)
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return TokenInfo{}, ErrInvalidToken
+	default:
+		return TokenInfo{}, fmt.Errorf("validate: received HTTP %v", res.StatusCode)
+	}
+
+	var v struct {
+		ClientID  string   `json:"client_id"`
+		Login     string   `json:"login"`
+		UserID    string   `json:"user_id"`
+		Scopes    []string `json:"scopes"`
+		ExpiresIn int64    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		return TokenInfo{}, fmt.Errorf("validate: %w", err)
+	}
+	return TokenInfo{
+		ClientID:  v.ClientID,
+		Login:     v.Login,
+		UserID:    v.UserID,
+		Scopes:    v.Scopes,
+		ExpiresIn: time.Duration(v.ExpiresIn) * time.Second,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package twitch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeToken(t *testing.T) {
+	for _, in := range []string{"abc123", "oauth:abc123", "OAuth abc123", " abc123\n"} {
+		assert.Equal(t, "abc123", NormalizeToken(in))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/validate", r.URL.Path)
+		if r.Header.Get("Authorization") != "OAuth good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"client_id":"test-client","login":"wmw","user_id":"42","scopes":[],"expires_in":3600}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), "", "test-client")
+	c.AuthEndpoint = srv.URL
+	c.Token = "good"
+	info, err := c.Validate(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "wmw", info.Login)
+	assert.Equal(t, "test-client", info.ClientID)
+	assert.Equal(t, time.Hour, info.ExpiresIn)
+
+	c.Token = "revoked"
+	_, err = c.Validate(context.Background())
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestGQLToken(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if auth == "OAuth revoked" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"users":[]}}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), srv.URL, "test-client")
+	_, err := c.LiveStatus(context.Background(), []string{"rwxrob"})
+	assert.NoError(t, err)
+	assert.Empty(t, auth, "anonymous requests carry no token")
+
+	c.Token = "revoked"
+	_, err = c.LiveStatus(context.Background(), []string{"rwxrob"})
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, "OAuth revoked", auth)
+}
+
+func TestFollowed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/channels/followed", r.URL.Path)
+		assert.Equal(t, "42", r.URL.Query().Get("user_id"))
+		assert.Equal(t, "Bearer good", r.Header.Get("Authorization"))
+		assert.Equal(t, "test-client", r.Header.Get("Client-Id"))
+		if r.URL.Query().Get("after") == "" {
+			fmt.Fprint(w, `{"data":[{"broadcaster_login":"rwxrob"}],"pagination":{"cursor":"next"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":[{"broadcaster_login":"sodapoppin"}],"pagination":{}}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), "", "test-client")
+	c.HelixEndpoint = srv.URL
+	c.Token = "good"
+	logins, err := c.Followed(context.Background(), "42")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rwxrob", "sodapoppin"}, logins)
+}
@@ -0,0 +1,74 @@
+package twitch
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PrefetchMaxAge is how long prefetched status is used for before it's looked up again
+const PrefetchMaxAge = 30 * time.Second
+
+// Batcher keeps status of channels looked up together by Prefetch, so their checks need no request of their own
+type Batcher struct {
+	Client *Client
+
+	mu      sync.Mutex
+	fetched map[string]result
+}
+
+type result struct {
+	stream Stream
+	err    error
+	at     time.Time
+}
+
+// NewBatcher returns batcher making its requests with client
+func NewBatcher(client *Client) *Batcher {
+	return &Batcher{Client: client, fetched: make(map[string]result)}
+}
+
+// Prefetch looks status of every login up at once, one LiveStatus request per MaxLogins channels
+func (b *Batcher) Prefetch(logins []string) {
+	if len(logins) == 0 {
+		return
+	}
+	lower := make([]string, len(logins))
+	for i, login := range logins {
+		lower[i] = strings.ToLower(login)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	streams, err := b.Client.LiveStatus(ctx, lower)
+
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for login := range b.fetched {
+		if now.Sub(b.fetched[login].at) > PrefetchMaxAge {
+			delete(b.fetched, login)
+		}
+	}
+	for _, login := range lower {
+		b.fetched[login] = result{streams[login], err, now}
+	}
+}
+
+// Status returns live status of channel, prefetched one if it's fresh, otherwise channel is looked up on its own.
+// Prefetched status is used once
+func (b *Batcher) Status(login string) (Stream, error) {
+	login = strings.ToLower(login)
+	b.mu.Lock()
+	r, ok := b.fetched[login]
+	delete(b.fetched, login)
+	b.mu.Unlock()
+	if ok && time.Since(r.at) <= PrefetchMaxAge {
+		return r.stream, r.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	streams, err := b.Client.LiveStatus(ctx, []string{login})
+	return streams[login], err
+}
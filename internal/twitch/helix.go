@@ -0,0 +1,62 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// DefaultHelixEndpoint is public twitch API, used for what GQL API doesn't offer
+const DefaultHelixEndpoint = "https://api.twitch.tv/helix"
+
+// Followed returns logins of channels user follows. Helix wants client id token was issued to
+// and user:read:follows scope, see Validate
+func (c *Client) Followed(ctx context.Context, userID string) ([]string, error) {
+	var logins []string
+	cursor := ""
+	for {
+		q := url.Values{"user_id": {userID}, "first": {"100"}}
+		if cursor != "" {
+			q.Set("after", cursor)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", c.HelixEndpoint+"/channels/followed?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Client-Id", c.ClientID)
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+		res, err := c.HTTP.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var v struct {
+			Data []struct {
+				BroadcasterLogin string `json:"broadcaster_login"`
+			} `json:"data"`
+			Pagination struct {
+				Cursor string `json:"cursor"`
+			} `json:"pagination"`
+			Message string `json:"message"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&v)
+		res.Body.Close()
+		switch {
+		case res.StatusCode == http.StatusUnauthorized:
+			return nil, fmt.Errorf("followed channels: %w: %v", ErrInvalidToken, v.Message)
+		case res.StatusCode != http.StatusOK:
+			return nil, fmt.Errorf("followed channels: received HTTP %v %v", res.StatusCode, v.Message)
+		case err != nil:
+			return nil, fmt.Errorf("followed channels: %w", err)
+		}
+		for _, d := range v.Data {
+			logins = append(logins, d.BroadcasterLogin)
+		}
+		if v.Pagination.Cursor == "" || len(v.Data) == 0 {
+			return logins, nil
+		}
+		cursor = v.Pagination.Cursor
+	}
+}
@@ -0,0 +1,136 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/grafov/m3u8"
+)
+
+// DefaultUsherEndpoint serves master playlists of live channels
+const DefaultUsherEndpoint = "https://usher.ttvnw.net"
+
+var (
+	// ErrOffline is returned for channels having no live playlist
+	ErrOffline = errors.New("channel is offline")
+	// ErrRestricted is returned when playlist is refused, e.g. subscriber-only stream without OAuth token or region lock
+	ErrRestricted = errors.New("playback refused, stream is subscriber-only or restricted in your region")
+)
+
+const accessTokenQuery = `query PlaybackAccessToken($login: String!) {
+  streamPlaybackAccessToken(channelName: $login, params: {platform: "web", playerBackend: "mediaplayer", playerType: "site"}) {
+    value
+    signature
+  }
+}`
+
+// AccessToken returns playback access token and its signature usher wants for channel's playlist
+func (c *Client) AccessToken(ctx context.Context, login string) (token, sig string, err error) {
+	var res struct {
+		Data struct {
+			Token *struct {
+				Value     string `json:"value"`
+				Signature string `json:"signature"`
+			} `json:"streamPlaybackAccessToken"`
+		} `json:"data"`
+	}
+	if err := c.gql(ctx, gqlRequest{Query: accessTokenQuery, Variables: map[string]interface{}{"login": login}}, &res); err != nil {
+		return "", "", err
+	}
+	if res.Data.Token == nil {
+		return "", "", fmt.Errorf("no access token for channel '%v'", login)
+	}
+	return res.Data.Token.Value, res.Data.Token.Signature, nil
+}
+
+// Playlist returns URL of channel's live media playlist in quality: best, worst or audio_only
+func (c *Client) Playlist(ctx context.Context, login, quality string) (string, error) {
+	login = strings.ToLower(login)
+	token, sig, err := c.AccessToken(ctx, login)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{
+		"token":            {token},
+		"sig":              {sig},
+		"allow_source":     {"true"},
+		"allow_audio_only": {"true"},
+		"fast_bread":       {"true"},
+		"player_backend":   {"mediaplayer"},
+		"supported_codecs": {"avc1"},
+		"p":                {strconv.Itoa(rand.Intn(1000000))},
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.UsherEndpoint+"/api/channel/hls/"+url.PathEscape(login)+".m3u8?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", ErrOffline
+	case http.StatusForbidden:
+		return "", ErrRestricted
+	default:
+		return "", fmt.Errorf("usher: received HTTP %v", res.StatusCode)
+	}
+
+	pl, listType, err := m3u8.DecodeFrom(res.Body, true)
+	if err != nil {
+		return "", fmt.Errorf("usher: %w", err)
+	}
+	if listType != m3u8.MASTER {
+		return "", errors.New("usher: not a master playlist")
+	}
+	return pickVariant(pl.(*m3u8.MasterPlaylist), quality)
+}
+
+// Qualities are stream qualities channel may be recorded in
+var Qualities = []string{"best", "worst", "audio_only"}
+
+// pickVariant chooses media playlist of quality from master playlist
+func pickVariant(master *m3u8.MasterPlaylist, quality string) (string, error) {
+	var best, worst, audio *m3u8.Variant
+	for _, v := range master.Variants {
+		if v == nil {
+			continue
+		}
+		if v.Video == "audio_only" {
+			audio = v
+			continue
+		}
+		if best == nil || v.Bandwidth > best.Bandwidth {
+			best = v
+		}
+		if worst == nil || v.Bandwidth < worst.Bandwidth {
+			worst = v
+		}
+	}
+
+	var v *m3u8.Variant
+	switch quality {
+	case "best":
+		v = best
+	case "worst":
+		v = worst
+	case "audio_only":
+		v = audio
+	default:
+		return "", fmt.Errorf("unknown quality '%v'", quality)
+	}
+	if v == nil {
+		return "", fmt.Errorf("no %v variant in playlist", quality)
+	}
+	return v.URI, nil
+}
@@ -0,0 +1,68 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const masterPlaylist = `#EXTM3U
+#EXT-X-TWITCH-INFO:NODE="video-edge-c2a4b4.fra02",CLUSTER="fra02"
+#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="chunked",NAME="1080p60 (source)",AUTOSELECT=YES,DEFAULT=YES
+#EXT-X-STREAM-INF:BANDWIDTH=6500000,RESOLUTION=1920x1080,CODECS="avc1.64002A,mp4a.40.2",VIDEO="chunked",FRAME-RATE=60.000
+https://video-weaver.fra02.hls.ttvnw.net/v1/playlist/source.m3u8
+#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="360p30",NAME="360p",AUTOSELECT=YES,DEFAULT=YES
+#EXT-X-STREAM-INF:BANDWIDTH=630000,RESOLUTION=640x360,CODECS="avc1.4D401E,mp4a.40.2",VIDEO="360p30",FRAME-RATE=30.000
+https://video-weaver.fra02.hls.ttvnw.net/v1/playlist/360p.m3u8
+#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="720p60",NAME="720p60",AUTOSELECT=YES,DEFAULT=YES
+#EXT-X-STREAM-INF:BANDWIDTH=3400000,RESOLUTION=1280x720,CODECS="avc1.4D401F,mp4a.40.2",VIDEO="720p60",FRAME-RATE=60.000
+https://video-weaver.fra02.hls.ttvnw.net/v1/playlist/720p.m3u8
+#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="audio_only",NAME="audio_only",AUTOSELECT=NO,DEFAULT=NO
+#EXT-X-STREAM-INF:BANDWIDTH=160000,CODECS="mp4a.40.2",VIDEO="audio_only"
+https://video-weaver.fra02.hls.ttvnw.net/v1/playlist/audio.m3u8
+`
+
+func fakeUsher(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gql", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"streamPlaybackAccessToken": map[string]string{"value": `{"channel":"rwxrob"}`, "signature": "abc123"},
+		}})
+	})
+	mux.HandleFunc("/api/channel/hls/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/channel/hls/rwxrob.m3u8" {
+			http.NotFound(w, r)
+			return
+		}
+		assert.Equal(t, `{"channel":"rwxrob"}`, r.URL.Query().Get("token"))
+		assert.Equal(t, "abc123", r.URL.Query().Get("sig"))
+		w.Write([]byte(masterPlaylist))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestPlaylist(t *testing.T) {
+	srv := fakeUsher(t)
+	defer srv.Close()
+	c := NewClient(srv.Client(), srv.URL+"/gql", "")
+	c.UsherEndpoint = srv.URL
+
+	for quality, want := range map[string]string{
+		"best":       "https://video-weaver.fra02.hls.ttvnw.net/v1/playlist/source.m3u8",
+		"worst":      "https://video-weaver.fra02.hls.ttvnw.net/v1/playlist/360p.m3u8",
+		"audio_only": "https://video-weaver.fra02.hls.ttvnw.net/v1/playlist/audio.m3u8",
+	} {
+		got, err := c.Playlist(context.Background(), "RWXROB", quality)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, quality)
+	}
+
+	_, err := c.Playlist(context.Background(), "rwxrob", "8k")
+	assert.EqualError(t, err, "unknown quality '8k'")
+	_, err = c.Playlist(context.Background(), "sodapoppin", "best")
+	assert.ErrorIs(t, err, ErrOffline)
+}
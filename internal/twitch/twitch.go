@@ -0,0 +1,176 @@
+package twitch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultGQLEndpoint = "https://gql.twitch.tv/gql"
+	DefaultClientID    = "kimne78kx3ncx6brgo4mv6wki5h1ko" // Public client id of twitch.tv web player
+
+	// MaxLogins is how many channels GQL API accepts in one users(logins) query
+	MaxLogins = 100
+)
+
+// Client talks to the GQL API twitch.tv website uses and to usher serving live playlists.
+// With OAuth token set playback is authenticated as its user, e.g. for subscriber-only streams without ads
+type Client struct {
+	HTTP          *http.Client
+	GQLEndpoint   string
+	ClientID      string
+	UsherEndpoint string
+	AuthEndpoint  string
+	HelixEndpoint string
+	Token         string
+}
+
+// NewClient returns client using default endpoint and client id for empty ones
+func NewClient(httpClient *http.Client, endpoint, clientID string) *Client {
+	if endpoint == "" {
+		endpoint = DefaultGQLEndpoint
+	}
+	if clientID == "" {
+		clientID = DefaultClientID
+	}
+	return &Client{HTTP: httpClient, GQLEndpoint: endpoint, ClientID: clientID, UsherEndpoint: DefaultUsherEndpoint, AuthEndpoint: DefaultAuthEndpoint, HelixEndpoint: DefaultHelixEndpoint}
+}
+
+// Stream is live status of a channel
+type Stream struct {
+	Login     string
+	Exists    bool // False for banned or not existing channels
+	Live      bool
+	ID        string
+	Type      string // live, rerun, premiere
+	Title     string
+	Game      string
+	Viewers   int
+	StartedAt time.Time
+}
+
+const liveStatusQuery = `query LiveStatus($logins: [String!]) {
+  users(logins: $logins) {
+    login
+    stream { id type title viewersCount createdAt game { name } }
+  }
+}`
+
+type gqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type gqlError struct {
+	Message string `json:"message"`
+}
+
+type liveStatusResponse struct {
+	Data struct {
+		Users []*struct {
+			Login  string `json:"login"`
+			Stream *struct {
+				ID           string    `json:"id"`
+				Type         string    `json:"type"`
+				Title        string    `json:"title"`
+				ViewersCount int       `json:"viewersCount"`
+				CreatedAt    time.Time `json:"createdAt"`
+				Game         *struct {
+					Name string `json:"name"`
+				} `json:"game"`
+			} `json:"stream"`
+		} `json:"users"`
+	} `json:"data"`
+}
+
+// LiveStatus returns status of every login, asking about up to MaxLogins channels per request
+func (c *Client) LiveStatus(ctx context.Context, logins []string) (map[string]Stream, error) {
+	streams := make(map[string]Stream, len(logins))
+	for len(logins) > 0 {
+		n := len(logins)
+		if n > MaxLogins {
+			n = MaxLogins
+		}
+		if err := c.liveStatus(ctx, logins[:n], streams); err != nil {
+			return nil, err
+		}
+		logins = logins[n:]
+	}
+	return streams, nil
+}
+
+func (c *Client) liveStatus(ctx context.Context, logins []string, streams map[string]Stream) error {
+	var res liveStatusResponse
+	if err := c.gql(ctx, gqlRequest{Query: liveStatusQuery, Variables: map[string]interface{}{"logins": logins}}, &res); err != nil {
+		return err
+	}
+
+	for _, login := range logins {
+		streams[strings.ToLower(login)] = Stream{Login: login}
+	}
+	for _, u := range res.Data.Users {
+		if u == nil { // Banned or not existing
+			continue
+		}
+		s := Stream{Login: u.Login, Exists: true}
+		if u.Stream != nil {
+			s.Live = true
+			s.ID = u.Stream.ID
+			s.Type = u.Stream.Type
+			s.Title = u.Stream.Title
+			s.Viewers = u.Stream.ViewersCount
+			s.StartedAt = u.Stream.CreatedAt
+			if u.Stream.Game != nil {
+				s.Game = u.Stream.Game.Name
+			}
+		}
+		streams[strings.ToLower(u.Login)] = s
+	}
+	return nil
+}
+
+// gql posts query and decodes response into v
+func (c *Client) gql(ctx context.Context, query interface{}, v interface{}) error {
+	body, err := json.Marshal(query)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.GQLEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Client-ID", c.ClientID)
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "OAuth "+c.Token)
+	}
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusUnauthorized && c.Token != "" {
+		return fmt.Errorf("gql: %w", ErrInvalidToken)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("gql: received HTTP %v", res.StatusCode)
+	}
+
+	raw := json.RawMessage{}
+	if err := json.NewDecoder(res.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("gql: %w", err)
+	}
+	var errs struct {
+		Errors []gqlError `json:"errors"`
+	}
+	if err := json.Unmarshal(raw, &errs); err == nil && len(errs.Errors) > 0 {
+		return fmt.Errorf("gql: %v", errs.Errors[0].Message)
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -0,0 +1,120 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGQL stands in for gql.twitch.tv answering users(logins) queries: every login starting with "live" is live,
+// "banned" does not exist and everything else is offline
+func fakeGQL(t *testing.T, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "test-client", r.Header.Get("Client-ID"))
+
+		var req struct {
+			Variables struct {
+				Logins []string `json:"logins"`
+			} `json:"variables"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.LessOrEqual(t, len(req.Variables.Logins), MaxLogins)
+
+		users := make([]interface{}, 0, len(req.Variables.Logins))
+		for _, login := range req.Variables.Logins {
+			switch {
+			case login == "banned":
+				users = append(users, nil)
+			case len(login) >= 4 && login[:4] == "live":
+				users = append(users, map[string]interface{}{
+					"login": login,
+					"stream": map[string]interface{}{
+						"id": "42", "type": "live", "title": "Coding", "viewersCount": 7,
+						"createdAt": "2021-09-08T12:57:04Z", "game": map[string]string{"name": "Science & Technology"},
+					},
+				})
+			default:
+				users = append(users, map[string]interface{}{"login": login, "stream": nil})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"users": users}})
+	}))
+}
+
+func TestLiveStatus(t *testing.T) {
+	var requests int32
+	srv := fakeGQL(t, &requests)
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), srv.URL, "test-client")
+	logins := []string{"liverwxrob", "sodapoppin", "banned"}
+	for i := 0; i < 150; i++ {
+		logins = append(logins, fmt.Sprintf("channel%v", i))
+	}
+	streams, err := c.LiveStatus(context.Background(), logins)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), requests)
+	assert.Len(t, streams, len(logins))
+
+	live := streams["liverwxrob"]
+	assert.True(t, live.Exists)
+	assert.True(t, live.Live)
+	assert.Equal(t, "Coding", live.Title)
+	assert.Equal(t, "Science & Technology", live.Game)
+	assert.Equal(t, time.Date(2021, 9, 8, 12, 57, 4, 0, time.UTC), live.StartedAt)
+
+	assert.True(t, streams["sodapoppin"].Exists)
+	assert.False(t, streams["sodapoppin"].Live)
+	assert.False(t, streams["banned"].Exists)
+}
+
+func TestLiveStatusErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/throttled" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"errors":[{"message":"service timeout"}]}`))
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.Client(), srv.URL+"/throttled", "").LiveStatus(context.Background(), []string{"rwxrob"})
+	assert.EqualError(t, err, "gql: received HTTP 429")
+	_, err = NewClient(srv.Client(), srv.URL, "").LiveStatus(context.Background(), []string{"rwxrob"})
+	assert.EqualError(t, err, "gql: service timeout")
+}
+
+func TestBatcher(t *testing.T) {
+	var requests int32
+	srv := fakeGQL(t, &requests)
+	defer srv.Close()
+
+	b := NewBatcher(NewClient(srv.Client(), srv.URL, "test-client"))
+	logins := []string{"LiveRwxrob"}
+	for i := 1; i < 20; i++ {
+		logins = append(logins, fmt.Sprintf("channel%v", i))
+	}
+	b.Prefetch(logins)
+	assert.Equal(t, int32(1), requests)
+	for i, login := range logins {
+		s, err := b.Status(login)
+		assert.NoError(t, err)
+		assert.Equal(t, i == 0, s.Live)
+	}
+	assert.Equal(t, int32(1), requests, "prefetched status needs no request")
+
+	// Prefetched status is used once, the next lookup is a request of its own
+	s, err := b.Status("LiveRwxrob")
+	assert.NoError(t, err)
+	assert.True(t, s.Live)
+	assert.Equal(t, int32(2), requests)
+}
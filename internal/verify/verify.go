@@ -0,0 +1,218 @@
+// Package verify checks recordings for corruption and compares them with their sidecars
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wmw64/rekoda/internal/sidecar"
+	"github.com/wmw64/rekoda/pkg/mpegts"
+)
+
+// MaxDrift is how far duration found may differ from duration in sidecar, at least; longer recordings get 2%
+const MaxDrift = 5 * time.Second
+
+// LiveWindow is how recently recording without end in sidecar must have changed to be taken for one still written.
+// Longer than default restart window, file is kept open without writes while stream may come back
+const LiveWindow = 15 * time.Minute
+
+// Result is what was found in recording
+type Result struct {
+	Path string `json:"path"`
+	mpegts.Report
+	Seconds  float64  `json:"seconds"`            // Media time found
+	Sidecar  string   `json:"sidecar,omitempty"`  // Sidecar compared with, empty if there's none
+	Warnings []string `json:"warnings,omitempty"` // Recording not matching its sidecar
+	Notes    []string `json:"notes,omitempty"`    // Worth knowing, but not a problem
+	Repaired bool     `json:"repaired,omitempty"` // Trailing garbage was cut off
+	Error    string   `json:"error,omitempty"`    // Recording couldn't be read
+	Failed   bool     `json:"failed"`
+}
+
+// Duration returns media time found
+func (r Result) Duration() time.Duration {
+	return r.Report.Duration
+}
+
+// Options of checking recordings
+type Options struct {
+	Workers int  // Recordings checked at once, at least one
+	Repair  bool // Truncate recordings ending with partial packet or garbage
+}
+
+// Files returns recordings at paths, dirs are walked for .ts files. Paths are sorted within dirs
+func Files(paths ...string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			if !seen[path] {
+				seen[path] = true
+				files = append(files, path)
+			}
+			continue
+		}
+		var found []string
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(p) == ".ts" && !seen[p] {
+				seen[p] = true
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// Run checks files on o.Workers at once, calling fn with results in order of files
+func Run(files []string, o Options, fn func(Result)) {
+	if o.Workers < 1 {
+		o.Workers = 1
+	}
+	results := make([]*Result, len(files))
+	var mu sync.Mutex
+	next := 0 // The first result not passed to fn yet
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < o.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := File(files[i], o.Repair)
+				mu.Lock()
+				results[i] = &r
+				for next < len(results) && results[next] != nil {
+					fn(*results[next])
+					results[next] = &Result{} // Done, let it go
+					next++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// File checks recording at path, comparing it with its sidecar if there's one.
+// Recording ending with partial packet or garbage is truncated if repair is set
+func File(path string, repair bool) Result {
+	r := Result{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		r.Error, r.Failed = err.Error(), true
+		return r
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		r.Error, r.Failed = err.Error(), true
+		return r
+	}
+	r.Report, err = mpegts.Scan(f)
+	f.Close()
+	if err != nil {
+		r.Error, r.Failed = err.Error(), true
+		return r
+	}
+	r.Seconds = r.Report.Duration.Seconds()
+
+	cuts := 0 // Segments left out on purpose, breaking continuity
+	ended := false
+	rec, err := sidecar.Load(sidecar.Path(path))
+	switch {
+	case err == nil && rec.File == filepath.Base(path):
+		r.Sidecar = sidecar.Path(path)
+		cuts = r.compare(rec)
+		ended = !rec.Ended.IsZero()
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		r.Notes = append(r.Notes, "sidecar can't be read: "+err.Error())
+	}
+	// Segment being written looks just like trailing garbage
+	live := !ended && time.Since(fi.ModTime()) < LiveWindow
+	if live && r.Trailing >= 0 {
+		r.Notes = append(r.Notes, fmt.Sprintf("%v byte(s) after the last whole packet, likely segment being written, not repaired while recording", fi.Size()-r.Trailing))
+	}
+	// Ads of separate breaks are written one after another
+	ads := strings.HasSuffix(path, ".ads.ts")
+
+	if repair && r.Trailing >= 0 && !live {
+		if err := os.Truncate(path, r.Trailing); err != nil {
+			r.Error = "repair: " + err.Error()
+		} else {
+			r.Repaired = true
+			r.Notes = append(r.Notes, fmt.Sprintf("truncated to %v bytes", r.Trailing))
+		}
+	}
+
+	switch {
+	case r.Error != "", len(r.Warnings) > 0:
+		r.Failed = true
+	case r.Has(mpegts.ProblemSync, mpegts.ProblemPacket, mpegts.ProblemTables):
+		r.Failed = true
+	case r.Has(mpegts.ProblemTrailing) && !r.Repaired && !live:
+		r.Failed = true
+	case r.Has(mpegts.ProblemContinuity, mpegts.ProblemTimestamp):
+		if ads {
+			r.Notes = append(r.Notes, "ads of separate breaks explain discontinuities")
+		} else if cuts == 0 {
+			r.Failed = true
+		} else {
+			r.Notes = append(r.Notes, fmt.Sprintf("%v segment(s) left out on purpose, as sidecar says, explain discontinuities", cuts))
+		}
+	}
+	return r
+}
+
+// compare adds warnings where recording doesn't match its sidecar, returning how many times
+// segments were left out of it on purpose: gaps and ad breaks removed
+func (r *Result) compare(rec sidecar.Recording) int {
+	if rec.Ended.IsZero() {
+		r.Notes = append(r.Notes, "sidecar has no end: still recording, or recorder was killed")
+	} else {
+		want := time.Duration(rec.Seconds * float64(time.Second))
+		drift := time.Duration(math.Max(float64(MaxDrift), float64(want)*0.02))
+		if diff := r.Report.Duration - want; diff > drift || -diff > drift {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("%v of media found, sidecar says %v", r.Report.Duration.Round(time.Second), want.Round(time.Second)))
+		}
+	}
+	cuts := len(rec.Gaps)
+	if cuts > 0 {
+		var missing float64
+		for _, g := range rec.Gaps {
+			missing += g.Seconds
+		}
+		r.Notes = append(r.Notes, fmt.Sprintf("sidecar has %v gap(s), %v missing", cuts, time.Duration(missing*float64(time.Second)).Round(time.Second)))
+	}
+	for _, b := range rec.AdBreaks {
+		if b.Ads != "keep" {
+			cuts++
+		}
+	}
+	return cuts
+}
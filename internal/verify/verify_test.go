@@ -0,0 +1,131 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wmw64/rekoda/internal/sidecar"
+	"github.com/wmw64/rekoda/pkg/mpegts"
+)
+
+// writeRecording writes second long recording changed by fn, with sidecar if rec is given
+func writeRecording(t *testing.T, path string, fn func(b []byte) []byte, rec *sidecar.Recording) {
+	segment, err := os.ReadFile(filepath.Join("..", "recorder", "testdata", "segment.ts"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0777))
+	assert.NoError(t, os.WriteFile(path, fn(segment), 0644))
+	if rec != nil {
+		rec.File = filepath.Base(path)
+		assert.NoError(t, rec.Save(sidecar.Path(path)))
+	}
+}
+
+func same(b []byte) []byte { return b }
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2021, 9, 8, 12, 57, 6, 0, time.UTC)
+	ended := &sidecar.Recording{Channel: "rwxrob", Started: start, Ended: start.Add(time.Second), Seconds: 1}
+
+	path := filepath.Join(dir, "good.ts")
+	writeRecording(t, path, same, ended)
+	r := File(path, false)
+	assert.False(t, r.Failed)
+	assert.Equal(t, sidecar.Path(path), r.Sidecar)
+	assert.Equal(t, time.Second, r.Duration())
+	assert.Empty(t, r.Warnings)
+
+	// Sidecar says it's much longer
+	long := *ended
+	long.Seconds = 60
+	writeRecording(t, path, same, &long)
+	r = File(path, false)
+	assert.True(t, r.Failed)
+	assert.Equal(t, []string{"1s of media found, sidecar says 1m0s"}, r.Warnings)
+
+	// Still being written, segment written so far is not cut off
+	path = filepath.Join(dir, "live.ts")
+	partial := func(b []byte) []byte { return append(b, b[:100]...) }
+	writeRecording(t, path, partial, &sidecar.Recording{Channel: "rwxrob", Started: start, Seconds: 1})
+	r = File(path, true)
+	assert.False(t, r.Failed)
+	assert.False(t, r.Repaired)
+	assert.Contains(t, r.Notes, "100 byte(s) after the last whole packet, likely segment being written, not repaired while recording")
+	fi, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, r.Trailing+100, fi.Size())
+
+	// Recorder killed mid-write
+	path = filepath.Join(dir, "killed.ts")
+	writeRecording(t, path, partial, &sidecar.Recording{Channel: "rwxrob", Started: start, Seconds: 1})
+	old := time.Now().Add(-2 * LiveWindow)
+	assert.NoError(t, os.Chtimes(path, old, old))
+	r = File(path, false)
+	assert.True(t, r.Failed)
+	assert.Contains(t, r.Notes, "sidecar has no end: still recording, or recorder was killed")
+	size := r.Trailing
+	r = File(path, true)
+	assert.False(t, r.Failed)
+	assert.True(t, r.Repaired)
+	fi, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, size, fi.Size())
+	assert.False(t, File(path, false).Has(mpegts.ProblemTrailing))
+
+	// Packet lost
+	lose := func(b []byte) []byte {
+		return append(append([]byte(nil), b[:20*mpegts.PacketSize]...), b[21*mpegts.PacketSize:]...)
+	}
+	path = filepath.Join(dir, "lost.ts")
+	writeRecording(t, path, lose, nil)
+	r = File(path, false)
+	assert.True(t, r.Failed)
+	assert.Empty(t, r.Sidecar)
+	assert.True(t, r.Has(mpegts.ProblemContinuity))
+
+	// Left out on purpose
+	gap := *ended
+	gap.Gaps = []sidecar.Gap{{At: start, Seconds: 2, Reason: "404"}}
+	writeRecording(t, path, lose, &gap)
+	r = File(path, false)
+	assert.False(t, r.Failed)
+	assert.Equal(t, []string{"sidecar has 1 gap(s), 2s missing", "1 segment(s) left out on purpose, as sidecar says, explain discontinuities"}, r.Notes)
+
+	// Ads of separate breaks
+	path = filepath.Join(dir, "lost.ads.ts")
+	writeRecording(t, path, lose, nil)
+	r = File(path, false)
+	assert.False(t, r.Failed)
+	assert.Contains(t, r.Notes, "ads of separate breaks explain discontinuities")
+
+	r = File(filepath.Join(dir, "nowhere.ts"), false)
+	assert.True(t, r.Failed)
+	assert.NotEmpty(t, r.Error)
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	var want []string
+	for _, name := range []string{"a/1.ts", "a/2.ts", "b/3.ts", "b/4.ts", "b/5.ts"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		writeRecording(t, path, same, nil)
+		want = append(want, path)
+	}
+	os.WriteFile(filepath.Join(dir, "a", "1.json"), []byte("{}"), 0644)
+
+	files, err := Files(filepath.Join(dir, "b"), dir, want[0])
+	assert.NoError(t, err)
+	assert.Equal(t, append(want[2:], want[:2]...), files)
+	_, err = Files(filepath.Join(dir, "nowhere"))
+	assert.Error(t, err)
+
+	var got []string
+	Run(want, Options{Workers: 3}, func(r Result) {
+		assert.False(t, r.Failed)
+		got = append(got, r.Path)
+	})
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,20 @@
+package toml
+
+import "os"
+
+// Lock takes exclusive advisory lock guarding read-modify-write of file at path, blocking until it's available.
+// Lock is held on separate path.lock file because atomic writes replace the file itself
+func Lock(path string) (unlock func() error, err error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		defer f.Close()
+		return unlockFile(f)
+	}, nil
+}
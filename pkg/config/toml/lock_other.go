@@ -0,0 +1,15 @@
+//go:build plan9 || js || wasip1
+
+package toml
+
+import "os"
+
+// Advisory locks are not available, callers still get atomic writes
+
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
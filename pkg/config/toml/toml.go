@@ -2,8 +2,13 @@ package toml
 
 import (
 	"bytes"
+	"encoding"
+	"errors"
 	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 
 	"github.com/pelletier/go-toml/v2"
 )
@@ -26,21 +31,211 @@ func Load(filepath string, config interface{}) error {
 }
 
 func Save(filepath string, config interface{}) error {
+	return SavePerm(filepath, config, 0644)
+}
+
+// SavePerm is Save with explicit file permissions
+func SavePerm(filepath string, config interface{}, perm os.FileMode) error {
+	b, err := Marshal(config)
+	if err != nil {
+		return err
+	}
+	return WriteFile(filepath, b, perm)
+}
+
+// Marshal encodes config the same way Save writes it to disk
+func Marshal(config interface{}) ([]byte, error) {
 	buf := bytes.Buffer{}
 	enc := toml.NewEncoder(&buf)
 	enc.SetIndentTables(true)
-	err := enc.Encode(config)
+	if err := enc.Encode(flatten(config)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flatten returns config with keys of embedded structs lifted into the outer table, as decoder reads them.
+// Encoder would write embedded struct as table of its own
+func flatten(config interface{}) interface{} {
+	v := reflect.ValueOf(config)
+	if !v.IsValid() {
+		return config
+	}
+	t := flatType(v.Type())
+	if t == v.Type() {
+		return config
+	}
+	return convert(v, t).Interface()
+}
+
+var textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// flatType returns type without embedded structs, t itself when it has none
+func flatType(t reflect.Type) reflect.Type {
+	switch t.Kind() {
+	case reflect.Ptr:
+		if e := flatType(t.Elem()); e != t.Elem() {
+			return reflect.PtrTo(e)
+		}
+	case reflect.Slice:
+		if e := flatType(t.Elem()); e != t.Elem() {
+			return reflect.SliceOf(e)
+		}
+	case reflect.Map:
+		if e := flatType(t.Elem()); e != t.Elem() {
+			return reflect.MapOf(t.Key(), e)
+		}
+	case reflect.Struct:
+		if t.Implements(textMarshaler) || reflect.PtrTo(t).Implements(textMarshaler) {
+			return t
+		}
+		if fields, changed := flatFields(t); changed {
+			return reflect.StructOf(fields)
+		}
+	}
+	return t
+}
+
+func flatFields(t reflect.Type) (fields []reflect.StructField, changed bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // Encoder skips unexported fields anyway
+		}
+		if isEmbedded(f) {
+			inner, _ := flatFields(f.Type)
+			fields = append(fields, inner...)
+			changed = true
+			continue
+		}
+		ft := flatType(f.Type)
+		changed = changed || ft != f.Type
+		fields = append(fields, reflect.StructField{Name: f.Name, Type: ft, Tag: f.Tag})
+	}
+	return fields, changed
+}
+
+func isEmbedded(f reflect.StructField) bool {
+	_, tagged := f.Tag.Lookup("toml")
+	return f.Anonymous && !tagged && f.Type.Kind() == reflect.Struct
+}
+
+// convert copies v into value of its flattened type t
+func convert(v reflect.Value, t reflect.Type) reflect.Value {
+	if v.Type() == t {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(convert(v.Elem(), t.Elem()))
+		return p
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		s := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s.Index(i).Set(convert(v.Index(i), t.Elem()))
+		}
+		return s
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		m := reflect.MakeMapWithSize(t, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m.SetMapIndex(iter.Key(), convert(iter.Value(), t.Elem()))
+		}
+		return m
+	}
+	out := reflect.New(t).Elem()
+	copyFields(out, v)
+	return out
+}
+
+func copyFields(out, v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		switch {
+		case f.PkgPath != "":
+		case isEmbedded(f):
+			copyFields(out, v.Field(i))
+		default:
+			dst := out.FieldByName(f.Name)
+			dst.Set(convert(v.Field(i), dst.Type()))
+		}
+	}
+}
+
+// Unmarshal decodes TOML document into config
+func Unmarshal(b []byte, config interface{}) error {
+	return toml.Unmarshal(b, config)
+}
+
+// UnknownKeys returns dotted keys of TOML document which have no matching field in config
+func UnknownKeys(b []byte, config interface{}) ([]string, error) {
+	dec := toml.NewDecoder(bytes.NewReader(b))
+	dec.SetStrict(true)
+	err := dec.Decode(config)
+	var strict *toml.StrictMissingError
+	if errors.As(err, &strict) {
+		keys := make([]string, 0, len(strict.Errors))
+		for _, e := range strict.Errors {
+			keys = append(keys, strings.Join(e.Key(), "."))
+		}
+		return keys, nil
+	}
+	return nil, err
+}
+
+// WriteFile atomically replaces file at path with already encoded TOML document.
+// Data goes into temporary file in the same directory which is synced and renamed over the original,
+// so a crash leaves either old or new file but never a truncated one
+func WriteFile(path string, b []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
 
-	err = os.WriteFile(filepath, buf.Bytes(), 0777)
-	if err != nil {
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
 		return err
 	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	syncDir(dir)
 	return nil
 }
 
+// syncDir persists rename in directory entry. Not supported everywhere (e.g. Windows), so it's best effort
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
 /*
 func CreateDefault(filepath string, config interface{}) error {
 	buf := bytes.Buffer{}
@@ -3,25 +3,29 @@ package toml
 import (
 	"io"
 	"os"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
-var filepath string = "test.toml"
+var testFile string = "test.toml"
 
 type Config struct {
 	Title string `toml:"title"`
 }
 
 func TestSave(t *testing.T) {
+	// Saved into a copy, the file replaced would lose its mode
+	path := t.TempDir() + string(os.PathSeparator) + testFile
 	c := &Config{Title: "test"}
-	err := Save(filepath, &c)
+	err := Save(path, &c)
 	if err != nil {
 		assert.Error(t, err)
 	}
 
-	tomlFile, err := os.Open(filepath)
+	tomlFile, err := os.Open(path)
 	if err != nil {
 		assert.Error(t, err)
 	}
@@ -33,9 +37,79 @@ func TestSave(t *testing.T) {
 
 func TestLoad(t *testing.T) {
 	c := &Config{}
-	err := Load(filepath, &c)
+	err := Load(testFile, &c)
 	if err != nil {
 		assert.Error(t, err)
 	}
 	assert.Equal(t, "test", c.Title)
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + string(os.PathSeparator) + "rekoda.toml"
+	assert.NoError(t, os.WriteFile(path, []byte("title = 'old'\n"), 0644))
+
+	assert.NoError(t, WriteFile(path, []byte("title = 'new'\n"), 0600))
+	b, _ := os.ReadFile(path)
+	assert.Equal(t, "title = 'new'\n", string(b))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// No temporary files left behind
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1)
+}
+
+func TestLock(t *testing.T) {
+	path := t.TempDir() + string(os.PathSeparator) + "rekoda.toml"
+	unlock, err := Lock(path)
+	assert.NoError(t, err)
+
+	locked := make(chan struct{})
+	go func() {
+		unlock, err := Lock(path)
+		assert.NoError(t, err)
+		close(locked)
+		unlock()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("second lock acquired while first one is held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.NoError(t, unlock())
+	<-locked
+}
+
+type Embedded struct {
+	Delay *time.Duration `toml:"delay"`
+	Name  string         `toml:"name"`
+}
+
+type Outer struct {
+	User string `toml:"user"`
+	Embedded
+}
+
+func TestMarshalEmbedded(t *testing.T) {
+	d := time.Second
+	v := struct {
+		Items []Outer `toml:"items"`
+	}{Items: []Outer{{User: "a", Embedded: Embedded{Delay: &d, Name: "x"}}, {User: "b"}}}
+
+	b, err := Marshal(&v)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "user = 'a'\ndelay = 1000000000\nname = 'x'\n")
+	assert.NotContains(t, string(b), "Embedded")
+
+	var again struct {
+		Items []Outer `toml:"items"`
+	}
+	assert.NoError(t, Unmarshal(b, &again))
+	assert.Equal(t, v, again)
+}
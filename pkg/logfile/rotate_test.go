@@ -0,0 +1,48 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "rekoda.log")
+	r, err := New(path, 10, 2)
+	assert.NoError(t, err)
+	defer r.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := r.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+
+	read := func(name string) string {
+		b, err := os.ReadFile(name)
+		assert.NoError(t, err)
+		return string(b)
+	}
+	assert.Equal(t, "fourth\n", read(path))
+	assert.Equal(t, "third\n", read(path+".1"))
+	assert.Equal(t, "second\n", read(path+".2"))
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAppendToExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rekoda.log")
+	assert.NoError(t, os.WriteFile(path, []byte("old\n"), 0644))
+
+	r, err := New(path, 1024, 1)
+	assert.NoError(t, err)
+	r.Write([]byte("new\n"))
+	assert.NoError(t, r.Close())
+
+	b, _ := os.ReadFile(path)
+	assert.Equal(t, "old\nnew\n", string(b))
+
+	_, err = r.Write([]byte("closed\n"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
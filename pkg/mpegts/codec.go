@@ -0,0 +1,243 @@
+package mpegts
+
+import (
+	"errors"
+)
+
+// NAL unit types of H.264
+const (
+	nalIDR = 5
+	nalSPS = 7
+)
+
+// CodecName returns short name of elementary stream type, e.g. h264 or aac
+func CodecName(streamType uint8) string {
+	switch streamType {
+	case StreamH264:
+		return "h264"
+	case StreamHEVC:
+		return "hevc"
+	case StreamAAC:
+		return "aac"
+	case StreamMPEG1Audio, StreamMPEG2Audio:
+		return "mp3"
+	case StreamID3:
+		return "id3"
+	}
+	return "unknown"
+}
+
+// SplitNALUnits splits H.264 Annex B byte stream into NAL units without start codes
+func SplitNALUnits(b []byte) [][]byte {
+	var units [][]byte
+	start := -1
+	for i := 0; i+2 < len(b); i++ {
+		if b[i] != 0 || b[i+1] != 0 || b[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			end := i
+			if end > start && b[end-1] == 0 { // Four byte start code
+				end--
+			}
+			units = append(units, b[start:end])
+		}
+		start = i + 3
+		i += 2
+	}
+	if start >= 0 && start < len(b) {
+		units = append(units, b[start:])
+	}
+	return units
+}
+
+// SPS is what matters of H.264 sequence parameter set
+type SPS struct {
+	Profile uint8
+	Level   uint8
+	Width   int
+	Height  int
+}
+
+// ParseSPS parses H.264 sequence parameter set NAL unit
+func ParseSPS(nal []byte) (SPS, error) {
+	if len(nal) < 4 || nal[0]&0x1F != nalSPS {
+		return SPS{}, errors.New("not a sequence parameter set")
+	}
+	r := &bitReader{b: unescapeRBSP(nal[1:])}
+	sps := SPS{Profile: uint8(r.bits(8))}
+	r.bits(8) // Constraint flags
+	sps.Level = uint8(r.bits(8))
+	r.ue() // seq_parameter_set_id
+
+	chroma := uint(1)
+	switch sps.Profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		if chroma = r.ue(); chroma == 3 {
+			r.bits(1) // separate_colour_plane_flag
+		}
+		r.ue()              // bit_depth_luma_minus8
+		r.ue()              // bit_depth_chroma_minus8
+		r.bits(1)           // qpprime_y_zero_transform_bypass_flag
+		if r.bits(1) == 1 { // seq_scaling_matrix_present_flag
+			lists := 8
+			if chroma == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if r.bits(1) == 1 {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					r.skipScalingList(size)
+				}
+			}
+		}
+	}
+	r.ue()          // log2_max_frame_num_minus4
+	switch r.ue() { // pic_order_cnt_type
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.bits(1) // delta_pic_order_always_zero_flag
+		r.se()    // offset_for_non_ref_pic
+		r.se()    // offset_for_top_to_bottom_field
+		for n := r.ue(); n > 0 && r.err == nil; n-- {
+			r.se()
+		}
+	}
+	r.ue()    // max_num_ref_frames
+	r.bits(1) // gaps_in_frame_num_value_allowed_flag
+	widthMbs := int(r.ue()) + 1
+	heightMaps := int(r.ue()) + 1
+	frameMbsOnly := int(r.bits(1))
+	if frameMbsOnly == 0 {
+		r.bits(1) // mb_adaptive_frame_field_flag
+	}
+	r.bits(1) // direct_8x8_inference_flag
+
+	sps.Width = widthMbs * 16
+	sps.Height = (2 - frameMbsOnly) * heightMaps * 16
+	if r.bits(1) == 1 { // frame_cropping_flag
+		left, right, top, bottom := int(r.ue()), int(r.ue()), int(r.ue()), int(r.ue())
+		cropX, cropY := 1, 2-frameMbsOnly
+		switch chroma {
+		case 1:
+			cropX, cropY = 2, 2*(2-frameMbsOnly)
+		case 2:
+			cropX = 2
+		}
+		sps.Width -= cropX * (left + right)
+		sps.Height -= cropY * (top + bottom)
+	}
+	if r.err != nil {
+		return SPS{}, r.err
+	}
+	return sps, nil
+}
+
+// unescapeRBSP removes emulation prevention bytes: 00 00 03 becomes 00 00
+func unescapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, v := range b {
+		if zeros >= 2 && v == 3 {
+			zeros = 0
+			continue
+		}
+		if v == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// bitReader reads bits and Exp-Golomb codes, remembering running past the end
+type bitReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *bitReader) bits(n int) uint {
+	var v uint
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.b)*8 {
+			r.err = errors.New("bitstream ended early")
+			return 0
+		}
+		v = v<<1 | uint(r.b[r.pos/8]>>(7-r.pos%8)&1)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) ue() uint {
+	zeros := 0
+	for r.bits(1) == 0 && r.err == nil {
+		if zeros++; zeros > 31 {
+			r.err = errors.New("invalid Exp-Golomb code")
+			return 0
+		}
+	}
+	return 1<<zeros - 1 + r.bits(zeros)
+}
+
+func (r *bitReader) se() int {
+	v := r.ue()
+	if v%2 == 1 {
+		return int(v+1) / 2
+	}
+	return -int(v / 2)
+}
+
+func (r *bitReader) skipScalingList(size int) {
+	last, next := 8, 8
+	for i := 0; i < size && r.err == nil; i++ {
+		if next != 0 {
+			next = (last + r.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+// ADTS is what matters of AAC ADTS frame header
+type ADTS struct {
+	SampleRate int
+	Channels   int
+	Frames     int // AAC frames in PES, each of 1024 samples
+}
+
+var adtsRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// ParseADTS parses ADTS headers of AAC frames PES data is made of
+func ParseADTS(b []byte) (ADTS, error) {
+	var a ADTS
+	for len(b) >= 7 {
+		if b[0] != 0xFF || b[1]&0xF0 != 0xF0 {
+			break
+		}
+		rate := int(b[2]>>2) & 0x0F
+		if rate >= len(adtsRates) {
+			return a, errors.New("invalid ADTS sample rate")
+		}
+		a.SampleRate = adtsRates[rate]
+		a.Channels = int(b[2]&0x01)<<2 | int(b[3]>>6)
+		a.Frames += int(b[6]&0x03) + 1
+		n := int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5]>>5)
+		if n < 7 || n > len(b) {
+			break
+		}
+		b = b[n:]
+	}
+	if a.Frames == 0 {
+		return a, errors.New("no ADTS header")
+	}
+	return a, nil
+}
@@ -0,0 +1,158 @@
+package mpegts
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// ClockRate is frequency of PTS and DTS
+const ClockRate = 90000
+
+// VideoInfo describes video elementary stream
+type VideoInfo struct {
+	Codec     string  `json:"codec"`
+	Width     int     `json:"width,omitempty"`
+	Height    int     `json:"height,omitempty"`
+	Profile   uint8   `json:"profile,omitempty"`
+	FrameRate float64 `json:"frame_rate,omitempty"`
+}
+
+func (v VideoInfo) String() string {
+	s := v.Codec
+	if v.Width > 0 {
+		s += fmt.Sprintf(" %vx%v", v.Width, v.Height)
+	}
+	if v.FrameRate > 0 {
+		s += fmt.Sprintf(" %vfps", math.Round(v.FrameRate))
+	}
+	return s
+}
+
+// AudioInfo describes audio elementary stream
+type AudioInfo struct {
+	Codec      string `json:"codec"`
+	SampleRate int    `json:"sample_rate,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+}
+
+func (a AudioInfo) String() string {
+	if a.SampleRate == 0 {
+		return a.Codec
+	}
+	return fmt.Sprintf("%v %v Hz %vch", a.Codec, a.SampleRate, a.Channels)
+}
+
+// Info is what's inside a piece of transport stream
+type Info struct {
+	Video     *VideoInfo
+	Audio     *AudioInfo
+	Start     int64         // First PTS of video, or audio without video
+	Duration  time.Duration // Media time covered, from PTS
+	Keyframes int
+}
+
+// timing follows PTS of one elementary stream
+type timing struct {
+	first, min, max int64
+	n               int
+}
+
+func (t *timing) add(pts int64) {
+	if t.n == 0 {
+		t.first, t.min, t.max = pts, pts, pts
+	}
+	// Unwrap 33 bit rollover relative to first timestamp
+	if pts < t.first-1<<32 {
+		pts += 1 << 33
+	} else if pts > t.first+1<<32 {
+		pts -= 1 << 33
+	}
+	if pts < t.min {
+		t.min = pts
+	}
+	if pts > t.max {
+		t.max = pts
+	}
+	t.n++
+}
+
+// interval is average time between timestamps in 90 kHz units
+func (t *timing) interval() float64 {
+	if t.n < 2 {
+		return 0
+	}
+	return float64(t.max-t.min) / float64(t.n-1)
+}
+
+// duration covers span of timestamps plus one interval the last frame lasts
+func (t *timing) duration() time.Duration {
+	return time.Duration((float64(t.max-t.min) + t.interval()) * float64(time.Second) / ClockRate)
+}
+
+// Analyze demuxes transport stream describing its video and audio and how much media time it covers
+func Analyze(r io.Reader) (Info, error) {
+	var info Info
+	d := NewDemuxer(r)
+	var video, audio timing
+	for {
+		p, err := d.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return info, err
+		}
+
+		switch p.StreamType {
+		case StreamH264, StreamHEVC:
+			if info.Video == nil {
+				info.Video = &VideoInfo{Codec: CodecName(p.StreamType)}
+			}
+			if p.StreamType == StreamH264 && info.Video.Width == 0 {
+				for _, nal := range SplitNALUnits(p.Data) {
+					if len(nal) > 0 && nal[0]&0x1F == nalSPS {
+						if sps, err := ParseSPS(nal); err == nil {
+							info.Video.Width, info.Video.Height, info.Video.Profile = sps.Width, sps.Height, sps.Profile
+						}
+						break
+					}
+				}
+			}
+			if p.Keyframe() {
+				info.Keyframes++
+			}
+			if p.PTS != NoTimestamp {
+				video.add(p.PTS)
+			}
+		case StreamAAC, StreamMPEG1Audio, StreamMPEG2Audio:
+			if info.Audio == nil {
+				info.Audio = &AudioInfo{Codec: CodecName(p.StreamType)}
+			}
+			if p.StreamType == StreamAAC && info.Audio.SampleRate == 0 {
+				if a, err := ParseADTS(p.Data); err == nil {
+					info.Audio.SampleRate, info.Audio.Channels = a.SampleRate, a.Channels
+				}
+			}
+			if p.PTS != NoTimestamp {
+				audio.add(p.PTS)
+			}
+		}
+	}
+
+	if info.Video == nil && info.Audio == nil {
+		return info, errors.New("no audio or video streams")
+	}
+	t := video
+	if t.n == 0 {
+		t = audio
+	}
+	info.Start = t.first
+	info.Duration = t.duration()
+	if iv := video.interval(); info.Video != nil && iv > 0 {
+		info.Video.FrameRate = math.Round(ClockRate/iv*100) / 100
+	}
+	return info, nil
+}
@@ -0,0 +1,137 @@
+package mpegts
+
+import (
+	"bufio"
+	"io"
+)
+
+// Joiner writes transport streams one after another as one stream. Continuity counters of every PID
+// go on across streams joined, and the first packet of each PID in every stream but the first is marked
+// discontinuous, telling players timestamps start over. Packet with no room for adaptation field carrying
+// the mark gets one, its payload overflowing into a packet following it. Partial packets and garbage
+// streams end with or lost sync in are left out
+type Joiner struct {
+	w       io.Writer
+	next    map[uint16]uint8 // Continuity counter the next packet with payload of PID gets
+	streams int
+}
+
+// NewJoiner returns joiner writing into w
+func NewJoiner(w io.Writer) *Joiner {
+	return &Joiner{w: w, next: make(map[uint16]uint8)}
+}
+
+// Append writes packets of stream r, returning how many bytes were written
+func (j *Joiner) Append(r io.Reader) (int64, error) {
+	br := bufio.NewReaderSize(r, 64*PacketSize)
+	shift := make(map[uint16]uint8) // Added to continuity counters of PID in this stream
+	marked := make(map[uint16]bool)
+	joined := j.streams > 0
+	j.streams++
+	pkt := make([]byte, PacketSize)
+	var n int64
+	for {
+		b, err := br.Peek(PacketSize)
+		if len(b) < PacketSize {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		if b[0] != SyncByte {
+			_, found, err := resync(br)
+			if err != nil || !found {
+				return n, err
+			}
+			continue
+		}
+		copy(pkt, b)
+		br.Discard(PacketSize)
+
+		pid := uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2])
+		if pid != PIDNull {
+			payload := pkt[3]&0x10 != 0
+			cc := pkt[3] & 0x0F
+			if _, ok := shift[pid]; !ok {
+				if next, seen := j.next[pid]; seen {
+					if !payload { // Counter of packet without payload repeats the last one
+						next--
+					}
+					shift[pid] = next - cc
+				} else {
+					shift[pid] = 0
+				}
+			}
+			cc = (cc + shift[pid]) & 0x0F
+			pkt[3] = pkt[3]&0xF0 | cc
+			if payload {
+				j.next[pid] = (cc + 1) & 0x0F
+			}
+			if joined && !marked[pid] {
+				marked[pid] = true
+				if extra := markDiscontinuity(pkt); extra != nil {
+					extra[3] = extra[3]&0xF0 | j.next[pid]
+					j.next[pid] = (j.next[pid] + 1) & 0x0F
+					shift[pid]++
+					if _, err := j.w.Write(pkt); err != nil {
+						return n, err
+					}
+					n += PacketSize
+					pkt = extra
+				}
+			}
+		}
+		if _, err := j.w.Write(pkt); err != nil {
+			return n, err
+		}
+		n += PacketSize
+	}
+}
+
+// markDiscontinuity sets discontinuity indicator of packet, adding adaptation field if it has none.
+// Payload which doesn't fit any more is returned in packet to be written after it, continuity counter
+// of which is left for caller to set
+func markDiscontinuity(pkt []byte) []byte {
+	adaptation, payload := pkt[3]&0x20 != 0, pkt[3]&0x10 != 0
+	if adaptation && pkt[4] > 0 {
+		pkt[5] |= 0x80
+		return nil
+	}
+
+	// No adaptation field, or an empty one without room for flags
+	var data []byte
+	if payload {
+		start := 4
+		if adaptation {
+			start = 5
+		}
+		data = append([]byte(nil), pkt[start:]...)
+	}
+	const room = PacketSize - 6 // Header, adaptation field length and flags
+	var extra []byte
+	if len(data) > room {
+		extra = make([]byte, PacketSize)
+		copy(extra, pkt[:4])
+		extra[1] &^= 0x40 // Payload unit started in packet before
+		fill(extra, 0, data[room:])
+		data = data[:room]
+	}
+	fill(pkt, 0x80, data)
+	return extra
+}
+
+// fill writes adaptation field with flags into packet, stuffed so data takes the rest of packet.
+// Data must leave room for adaptation field length and flags
+func fill(pkt []byte, flags byte, data []byte) {
+	pkt[3] = pkt[3]&0xCF | 0x20
+	if len(data) > 0 {
+		pkt[3] |= 0x10
+	}
+	n := PacketSize - 5 - len(data) // Adaptation field length
+	pkt[4] = byte(n)
+	pkt[5] = flags
+	for i := 6; i < 5+n; i++ {
+		pkt[i] = 0xFF
+	}
+	copy(pkt[5+n:], data)
+}
@@ -0,0 +1,99 @@
+// Package mpegts parses MPEG transport streams HLS segments are made of
+package mpegts
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// PacketSize is size of every transport stream packet
+	PacketSize = 188
+	// SyncByte starts every packet
+	SyncByte = 0x47
+
+	// PIDPAT carries program association table
+	PIDPAT = 0x0000
+	// PIDNull carries stuffing packets
+	PIDNull = 0x1FFF
+)
+
+var (
+	// ErrSize is returned for data not made of whole packets
+	ErrSize = errors.New("size is not a multiple of 188 bytes")
+	// ErrSync is returned for packet not starting with sync byte
+	ErrSync = errors.New("sync byte missing")
+	// ErrNoPAT is returned for stream without program association table
+	ErrNoPAT = errors.New("no program association table")
+	// ErrNoPMT is returned for stream without program map table of its program
+	ErrNoPMT = errors.New("no program map table")
+)
+
+// Packet is header and payload of transport stream packet
+type Packet struct {
+	PID           uint16
+	PayloadStart  bool // Payload unit start indicator, PES packet or PSI section begins here
+	Continuity    uint8
+	Discontinuity bool // Continuity counter is reset on purpose
+	RandomAccess  bool // Random access indicator, e.g. keyframe starts here
+	HasPayload    bool
+	PCR           int64 // Program clock reference in 27 MHz units, -1 when absent
+	Payload       []byte
+}
+
+// ParsePacket parses single packet of PacketSize bytes
+func ParsePacket(b []byte) (Packet, error) {
+	if len(b) != PacketSize {
+		return Packet{}, ErrSize
+	}
+	if b[0] != SyncByte {
+		return Packet{}, ErrSync
+	}
+	p := Packet{
+		PID:          uint16(b[1]&0x1F)<<8 | uint16(b[2]),
+		PayloadStart: b[1]&0x40 != 0,
+		Continuity:   b[3] & 0x0F,
+		HasPayload:   b[3]&0x10 != 0,
+		PCR:          -1,
+	}
+	if b[1]&0x80 != 0 {
+		return p, errors.New("transport error indicator set")
+	}
+	payload := b[4:]
+	if b[3]&0x20 != 0 { // Adaptation field
+		n := int(payload[0])
+		if n > len(payload)-1 {
+			return p, errors.New("adaptation field overflows packet")
+		}
+		if n > 0 {
+			flags := payload[1]
+			p.Discontinuity = flags&0x80 != 0
+			p.RandomAccess = flags&0x40 != 0
+			if flags&0x10 != 0 && n >= 7 {
+				pcr := payload[2:8]
+				base := int64(pcr[0])<<25 | int64(pcr[1])<<17 | int64(pcr[2])<<9 | int64(pcr[3])<<1 | int64(pcr[4])>>7
+				ext := int64(pcr[4]&0x01)<<8 | int64(pcr[5])
+				p.PCR = base*300 + ext
+			}
+		}
+		payload = payload[n+1:]
+	}
+	if p.HasPayload {
+		p.Payload = payload
+	}
+	return p, nil
+}
+
+// Error is error found at byte Offset of stream
+type Error struct {
+	Offset int64
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("mpegts: at byte %v: %v", e.Offset, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,384 @@
+package mpegts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testStream builds transport stream with a program of H.264 video on PID 0x100 and AAC audio on PID 0x101
+type testStream struct {
+	buf      bytes.Buffer
+	counters map[uint16]uint8
+}
+
+func newTestStream() *testStream {
+	s := &testStream{counters: make(map[uint16]uint8)}
+	s.psi(PIDPAT, tablePAT, 1, []byte{0x00, 0x01, 0xE0 | 0x10, 0x00}) // Program 1 -> PMT PID 0x1000
+	s.psi(0x1000, tablePMT, 1, []byte{
+		0xE1, 0x00, 0xF0, 0x00, // PCR PID 0x100, no program info
+		StreamH264, 0xE1, 0x00, 0xF0, 0x00,
+		StreamAAC, 0xE1, 0x01, 0xF0, 0x00,
+	})
+	return s
+}
+
+// psi writes section of table with CRC into a single packet
+func (s *testStream) psi(pid uint16, table uint8, id uint16, body []byte) {
+	sec := []byte{table, 0xB0, 0x00, byte(id >> 8), byte(id), 0xC1, 0x00, 0x00}
+	sec = append(sec, body...)
+	binary.BigEndian.PutUint16(sec[1:], 0xB000|uint16(len(sec)-3+4))
+	sec = append(sec, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(sec[len(sec)-4:], crc32(sec[:len(sec)-4]))
+	s.packet(pid, true, nil, append([]byte{0}, sec...))
+}
+
+// packet writes packet with optional adaptation field flags, stuffing payload to packet size
+func (s *testStream) packet(pid uint16, start bool, adaptation []byte, payload []byte) {
+	p := []byte{SyncByte, byte(pid>>8) & 0x1F, byte(pid), 0x10 | s.counters[pid]}
+	if start {
+		p[1] |= 0x40
+	}
+	s.counters[pid] = (s.counters[pid] + 1) & 0x0F
+	room := PacketSize - 4 - len(payload)
+	if adaptation != nil || room > 0 {
+		p[3] |= 0x20
+		af := append([]byte(nil), adaptation...)
+		if len(af) == 0 && room > 1 {
+			af = []byte{0} // No flags
+		}
+		for 1+len(af) < room {
+			af = append(af, 0xFF)
+		}
+		p = append(p, byte(len(af)))
+		p = append(p, af...)
+	}
+	p = append(p, payload...)
+	s.buf.Write(p[:PacketSize])
+}
+
+func TestParsePacket(t *testing.T) {
+	s := newTestStream()
+	s.packet(0x100, true, []byte{0x40}, []byte{0, 0, 1})
+	b := s.buf.Bytes()
+
+	p, err := ParsePacket(b[2*PacketSize:])
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x100), p.PID)
+	assert.True(t, p.PayloadStart)
+	assert.True(t, p.RandomAccess)
+	assert.Equal(t, []byte{0, 0, 1}, p.Payload)
+
+	_, err = ParsePacket(b[1 : PacketSize+1])
+	assert.ErrorIs(t, err, ErrSync)
+}
+
+func TestParsePMT(t *testing.T) {
+	b := newTestStream().buf.Bytes()
+	p, err := ParsePacket(b[PacketSize : 2*PacketSize])
+	assert.NoError(t, err)
+	sec, more, err := section(p.Payload)
+	assert.NoError(t, err)
+	assert.Zero(t, more)
+
+	pmt, err := ParsePMT(sec)
+	assert.NoError(t, err)
+	assert.Equal(t, PMT{Program: 1, PCRPID: 0x100, Streams: []ElementaryStream{{StreamH264, 0x100}, {StreamAAC, 0x101}}}, pmt)
+
+	sec[10] ^= 0xFF
+	_, err = ParsePMT(sec)
+	assert.EqualError(t, err, "section CRC mismatch")
+}
+
+func TestValidate(t *testing.T) {
+	s := newTestStream()
+	for i := 0; i < 20; i++ {
+		s.packet(0x100, i == 0, nil, bytes.Repeat([]byte{0xAB}, 184))
+	}
+	good := s.buf.Bytes()
+	assert.NoError(t, Validate(good))
+
+	truncated := good[:len(good)-100]
+	assert.ErrorIs(t, Validate(truncated), ErrSize)
+
+	html := []byte("<html><body>502 Bad Gateway</body></html>")
+	assert.Error(t, Validate(html))
+	assert.ErrorIs(t, Validate(bytes.Repeat(html, 10)[:2*PacketSize]), ErrSync)
+
+	// Lost packet
+	lost := append(append([]byte(nil), good[:5*PacketSize]...), good[6*PacketSize:]...)
+	err := Validate(lost)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "continuity counter of PID 256 jumped from 2 to 4")
+	var e *Error
+	assert.ErrorAs(t, err, &e)
+	assert.Equal(t, int64(5*PacketSize), e.Offset)
+
+	assert.ErrorIs(t, Validate(good[PacketSize:]), ErrNoPAT)
+	noPMT := append(append([]byte(nil), good[:PacketSize]...), good[2*PacketSize:]...)
+	assert.ErrorIs(t, Validate(noPMT), ErrNoPMT)
+}
+
+// pes writes PES packet of elementary stream split into packets
+func (s *testStream) pes(pid uint16, streamID uint8, pts int64, randomAccess bool, data []byte) {
+	ts := []byte{0x21 | byte(pts>>29)&0x0E, byte(pts >> 22), 0x01 | byte(pts>>14), byte(pts >> 7), 0x01 | byte(pts<<1)}
+	b := append([]byte{0, 0, 1, streamID, 0, 0, 0x80, 0x80, 5}, ts...)
+	b = append(b, data...)
+	var adaptation []byte
+	if randomAccess {
+		adaptation = []byte{0x40}
+	}
+	for start := true; len(b) > 0; start = false {
+		room := PacketSize - 4
+		if start && adaptation != nil {
+			room -= 1 + len(adaptation)
+		}
+		n := room
+		if n > len(b) {
+			n = len(b)
+		}
+		if start {
+			s.packet(pid, true, adaptation, b[:n])
+		} else {
+			s.packet(pid, false, nil, b[:n])
+		}
+		b = b[n:]
+	}
+}
+
+// bitWriter writes bits and Exp-Golomb codes of test SPS
+type bitWriter struct {
+	b []byte
+	n int
+}
+
+func (w *bitWriter) bits(v uint, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		w.b[len(w.b)-1] |= byte(v>>uint(i)&1) << (7 - w.n%8)
+		w.n++
+	}
+}
+
+func (w *bitWriter) ue(v uint) {
+	n := 0
+	for x := v + 1; x > 1; x >>= 1 {
+		n++
+	}
+	w.bits(0, n)
+	w.bits(v+1, n+1)
+}
+
+// testSPS returns SPS of 1920x1080 high profile stream, coded as 1088 lines cropped by 8
+func testSPS() []byte {
+	w := &bitWriter{}
+	w.bits(100, 8) // profile_idc
+	w.bits(0, 8)
+	w.bits(40, 8) // level_idc
+	w.ue(0)       // seq_parameter_set_id
+	w.ue(1)       // chroma_format_idc 4:2:0
+	w.ue(0)
+	w.ue(0)
+	w.bits(0, 1)
+	w.bits(0, 1) // no scaling matrix
+	w.ue(0)      // log2_max_frame_num_minus4
+	w.ue(2)      // pic_order_cnt_type
+	w.ue(4)      // max_num_ref_frames
+	w.bits(0, 1)
+	w.ue(119) // 120 macroblocks wide
+	w.ue(67)  // 68 macroblocks high
+	w.bits(1, 1)
+	w.bits(1, 1)
+	w.bits(1, 1) // frame_cropping_flag
+	w.ue(0)
+	w.ue(0)
+	w.ue(0)
+	w.ue(4)
+	w.bits(0, 1) // no VUI
+	w.bits(1, 1) // stop bit
+	return append([]byte{0x67}, w.b...)
+}
+
+// avStream returns second of 30 fps H.264 video starting with keyframe and 48 kHz stereo AAC audio
+func avStream(start int64) *testStream {
+	s := newTestStream()
+	frame := append(append([]byte{0, 0, 0, 1}, testSPS()...), 0, 0, 0, 1, 0x65, 0x88, 0x84)
+	adts := []byte{0xFF, 0xF1, 0x4C, 0x80, 0x01, 0x7F, 0xFC} // 48 kHz, 2 channels, one frame of 11 bytes
+	adts = append(adts, 1, 2, 3, 4)
+	for i := int64(0); i < 30; i++ {
+		if i == 0 {
+			s.pes(0x100, 0xE0, start, true, append(frame, bytes.Repeat([]byte{0xAB}, 400)...))
+		} else {
+			s.pes(0x100, 0xE0, start+i*3000, false, append([]byte{0, 0, 0, 1, 0x41, 0x9A}, bytes.Repeat([]byte{0xCD}, 200)...))
+		}
+		s.pes(0x101, 0xC0, start+i*3000, false, adts)
+	}
+	return s
+}
+
+func TestParseSPS(t *testing.T) {
+	sps, err := ParseSPS(testSPS())
+	assert.NoError(t, err)
+	assert.Equal(t, SPS{Profile: 100, Level: 40, Width: 1920, Height: 1080}, sps)
+
+	_, err = ParseSPS([]byte{0x68, 0xCE, 0x3C, 0x80})
+	assert.Error(t, err, "picture parameter set is not SPS")
+	assert.Equal(t, []byte{0, 0, 1, 0, 0}, unescapeRBSP([]byte{0, 0, 3, 1, 0, 0, 3}))
+}
+
+func TestDemuxer(t *testing.T) {
+	s := avStream(900000)
+	assert.NoError(t, Validate(s.buf.Bytes()))
+
+	d := NewDemuxer(&s.buf)
+	var video, audio int
+	for {
+		p, err := d.Next()
+		if err != nil {
+			assert.ErrorIs(t, err, io.EOF)
+			break
+		}
+		switch p.PID {
+		case 0x100:
+			assert.Equal(t, int64(900000+video*3000), p.PTS)
+			assert.Equal(t, video == 0, p.Keyframe())
+			video++
+		case 0x101:
+			assert.Equal(t, uint8(StreamAAC), p.StreamType)
+			audio++
+		}
+	}
+	assert.Equal(t, 30, video)
+	assert.Equal(t, 30, audio)
+	assert.Equal(t, PMT{Program: 1, PCRPID: 0x100, Streams: []ElementaryStream{{StreamH264, 0x100}, {StreamAAC, 0x101}}}, d.PMT)
+}
+
+func TestAnalyze(t *testing.T) {
+	info, err := Analyze(&avStream(900000).buf)
+	assert.NoError(t, err)
+	assert.Equal(t, &VideoInfo{Codec: "h264", Width: 1920, Height: 1080, Profile: 100, FrameRate: 30}, info.Video)
+	assert.Equal(t, &AudioInfo{Codec: "aac", SampleRate: 48000, Channels: 2}, info.Audio)
+	assert.Equal(t, int64(900000), info.Start)
+	assert.Equal(t, time.Second, info.Duration)
+	assert.Equal(t, 1, info.Keyframes)
+	assert.Equal(t, "h264 1920x1080 30fps", info.Video.String())
+
+	// Timestamps rolling over 33 bits
+	info, err = Analyze(&avStream(1<<33 - 45000).buf)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, info.Duration)
+}
+
+func TestScan(t *testing.T) {
+	good := avStream(900000).buf.Bytes()
+	rep, err := Scan(bytes.NewReader(good))
+	assert.NoError(t, err)
+	assert.Empty(t, rep.Problems)
+	assert.Equal(t, int64(len(good)), rep.Size)
+	assert.Equal(t, int64(len(good)/PacketSize), rep.Packets)
+	assert.Equal(t, time.Second, rep.Duration)
+	assert.Equal(t, int64(-1), rep.Trailing)
+
+	// Partial packet at the end, as left by recorder killed mid-write
+	rep, err = Scan(bytes.NewReader(append(append([]byte(nil), good...), good[:100]...)))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rep.Counts[ProblemTrailing])
+	assert.Equal(t, int64(len(good)), rep.Trailing)
+	assert.Equal(t, int64(len(good)+100), rep.Size)
+
+	// Garbage at the end
+	rep, err = Scan(bytes.NewReader(append(append([]byte(nil), good...), bytes.Repeat([]byte{0xFF}, 500)...)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(good)), rep.Trailing)
+	assert.Equal(t, int64(len(good)+500), rep.Size)
+	assert.False(t, rep.Has(ProblemSync, ProblemContinuity))
+
+	// Garbage in the middle
+	bad := append(append(append([]byte(nil), good[:5*PacketSize]...), bytes.Repeat([]byte{0}, 50)...), good[5*PacketSize:]...)
+	rep, err = Scan(bytes.NewReader(bad))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rep.Counts[ProblemSync])
+	assert.Equal(t, Problem{Offset: 5 * PacketSize, Kind: ProblemSync, Message: "lost sync for 50 bytes"}, rep.Problems[0])
+	assert.Equal(t, int64(-1), rep.Trailing)
+
+	// Packet lost
+	bad = append(append([]byte(nil), good[:10*PacketSize]...), good[11*PacketSize:]...)
+	rep, err = Scan(bytes.NewReader(bad))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rep.Counts[ProblemContinuity])
+	assert.True(t, rep.Has(ProblemContinuity))
+
+	// No PAT
+	rep, err = Scan(bytes.NewReader(good[PacketSize:]))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rep.Counts[ProblemTables])
+
+	// Stream restarted with timestamps a minute later
+	s := avStream(0)
+	s.pes(0x100, 0xE0, 90000*60, false, []byte{0, 0, 0, 1, 0x41, 0x9A})
+	s.pes(0x100, 0xE0, 90000*60+3000, false, []byte{0, 0, 0, 1, 0x41, 0x9A})
+	rep, err = Scan(&s.buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rep.Counts[ProblemTimestamp])
+	assert.Contains(t, rep.Problems[0].Message, "timestamps jump by 59.033s")
+	assert.Equal(t, time.Second+time.Second/15, rep.Duration)
+}
+
+func TestJoiner(t *testing.T) {
+	first := append(avStream(900000).buf.Bytes(), 0x47, 1, 2) // Cut off mid-packet
+	second := avStream(0).buf.Bytes()
+
+	var out bytes.Buffer
+	j := NewJoiner(&out)
+	n, err := j.Append(bytes.NewReader(first))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(first)-3), n)
+	n, err = j.Append(bytes.NewReader(second))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(second)), n)
+
+	rep, err := Scan(bytes.NewReader(out.Bytes()))
+	assert.NoError(t, err)
+	assert.Empty(t, rep.Problems)
+	assert.Equal(t, int64(len(first)-3+len(second)), rep.Size)
+	assert.Equal(t, 2*time.Second, rep.Duration)
+	assert.Equal(t, 4, rep.Discontinuities) // PAT, PMT, video and audio
+
+	// Without discontinuities marked, counters and timestamps jump
+	rep, err = Scan(io.MultiReader(bytes.NewReader(first[:len(first)-3]), bytes.NewReader(second)))
+	assert.NoError(t, err)
+	assert.True(t, rep.Has(ProblemContinuity, ProblemTimestamp))
+
+	// Video starting with packet full of payload gets adaptation field, payload overflows into next packet
+	s := newTestStream()
+	s.pes(0x100, 0xE0, 0, false, bytes.Repeat([]byte{0xCD}, 400))
+	s.pes(0x100, 0xE0, 3000, false, bytes.Repeat([]byte{0xEF}, 400))
+	third := s.buf.Bytes()
+	n, err = j.Append(bytes.NewReader(third))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(third)+PacketSize), n)
+
+	rep, err = Scan(bytes.NewReader(out.Bytes()))
+	assert.NoError(t, err)
+	assert.Empty(t, rep.Problems)
+	assert.Equal(t, 7, rep.Discontinuities)
+	all := append(append(append([]byte(nil), first[:len(first)-3]...), second...), third...)
+	assert.Equal(t, payloads(t, all), payloads(t, out.Bytes()))
+}
+
+// payloads returns payload of every PID in stream, put together
+func payloads(t *testing.T, b []byte) map[uint16][]byte {
+	m := make(map[uint16][]byte)
+	for ; len(b) >= PacketSize; b = b[PacketSize:] {
+		p, err := ParsePacket(b[:PacketSize])
+		assert.NoError(t, err)
+		m[p.PID] = append(m[p.PID], p.Payload...)
+	}
+	return m
+}
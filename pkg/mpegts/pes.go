@@ -0,0 +1,188 @@
+package mpegts
+
+import (
+	"errors"
+	"io"
+)
+
+// NoTimestamp is PTS or DTS of PES packet without one
+const NoTimestamp = -1
+
+// PES is packetized elementary stream packet, usually one video frame or a few audio frames
+type PES struct {
+	PID          uint16
+	StreamType   uint8 // From PMT, e.g. StreamH264
+	StreamID     uint8
+	PTS          int64 // Presentation time stamp in 90 kHz units, or NoTimestamp
+	DTS          int64 // Decoding time stamp in 90 kHz units, or NoTimestamp
+	RandomAccess bool  // Marked as random access point, e.g. keyframe
+	Data         []byte
+}
+
+// Keyframe reports whether PES starts a keyframe, either marked so or carrying H.264 IDR picture
+func (p *PES) Keyframe() bool {
+	if p.RandomAccess {
+		return true
+	}
+	if p.StreamType == StreamH264 {
+		for _, nal := range SplitNALUnits(p.Data) {
+			if len(nal) > 0 && nal[0]&0x1F == nalIDR {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parsePES parses PES header, filling timestamps and data
+func parsePES(p *PES, b []byte) error {
+	if len(b) < 6 || b[0] != 0 || b[1] != 0 || b[2] != 1 {
+		return errors.New("PES start code missing")
+	}
+	p.StreamID = b[3]
+	p.PTS, p.DTS = NoTimestamp, NoTimestamp
+	switch p.StreamID {
+	case 0xBC, 0xBE, 0xBF, 0xF0, 0xF1, 0xF2, 0xF8, 0xFF: // No optional header
+		p.Data = b[6:]
+		return nil
+	}
+	if len(b) < 9 {
+		return errors.New("truncated PES header")
+	}
+	n := 9 + int(b[8])
+	if n > len(b) {
+		return errors.New("PES header overflows packet")
+	}
+	flags := b[7] >> 6
+	if flags&0x2 != 0 && len(b) >= 14 {
+		p.PTS = timestamp(b[9:14])
+	}
+	if flags == 0x3 && len(b) >= 19 {
+		p.DTS = timestamp(b[14:19])
+	}
+	p.Data = b[n:]
+	return nil
+}
+
+// timestamp decodes 33 bit PTS or DTS split by marker bits
+func timestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
+
+// Demuxer reads PES packets of every elementary stream from transport stream
+type Demuxer struct {
+	r      io.Reader
+	packet [PacketSize]byte
+	offset int64
+
+	PAT   PAT
+	PMT   PMT // Of the first program, streams of other programs are skipped
+	psi   *sections
+	types map[uint16]uint8
+	pes   map[uint16]*PES // Being assembled
+	ready []*PES
+	err   error
+}
+
+// NewDemuxer returns demuxer reading transport stream from r
+func NewDemuxer(r io.Reader) *Demuxer {
+	return &Demuxer{r: r, psi: newSections(), types: make(map[uint16]uint8), pes: make(map[uint16]*PES)}
+}
+
+// Next returns next complete PES packet, io.EOF once stream is over
+func (d *Demuxer) Next() (*PES, error) {
+	for len(d.ready) == 0 {
+		if d.err != nil {
+			return nil, d.err
+		}
+		d.read()
+	}
+	p := d.ready[0]
+	d.ready = d.ready[1:]
+	return p, nil
+}
+
+// read handles one packet, queueing PES packets it completes
+func (d *Demuxer) read() {
+	if _, err := io.ReadFull(d.r, d.packet[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = &Error{Offset: d.offset, Err: ErrSize}
+		}
+		d.flush()
+		d.err = err
+		return
+	}
+	off := d.offset
+	d.offset += PacketSize
+	p, err := ParsePacket(d.packet[:])
+	if err != nil {
+		d.flush()
+		d.err = &Error{Offset: off, Err: err}
+		return
+	}
+	if !p.HasPayload || p.PID == PIDNull {
+		return
+	}
+
+	if p.PID == PIDPAT || d.isPMT(p.PID) {
+		sec, err := d.psi.add(p)
+		if err != nil || sec == nil {
+			return // Broken tables are retransmitted soon
+		}
+		if p.PID == PIDPAT {
+			if pat, err := ParsePAT(sec); err == nil {
+				d.PAT = pat
+			}
+			return
+		}
+		if pmt, err := ParsePMT(sec); err == nil && (d.PMT.Program == 0 || d.PMT.Program == pmt.Program) {
+			d.PMT = pmt
+			for _, es := range pmt.Streams {
+				d.types[es.PID] = es.Type
+			}
+		}
+		return
+	}
+
+	typ, ok := d.types[p.PID]
+	if !ok {
+		return
+	}
+	if p.PayloadStart {
+		d.finish(p.PID)
+		d.pes[p.PID] = &PES{PID: p.PID, StreamType: typ, RandomAccess: p.RandomAccess, Data: append([]byte(nil), p.Payload...)}
+		return
+	}
+	if cur, ok := d.pes[p.PID]; ok {
+		cur.Data = append(cur.Data, p.Payload...)
+	}
+}
+
+func (d *Demuxer) isPMT(pid uint16) bool {
+	for _, v := range d.PAT {
+		if v == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// finish parses PES being assembled on PID and queues it
+func (d *Demuxer) finish(pid uint16) {
+	cur, ok := d.pes[pid]
+	if !ok {
+		return
+	}
+	delete(d.pes, pid)
+	if err := parsePES(cur, cur.Data); err != nil {
+		return
+	}
+	d.ready = append(d.ready, cur)
+}
+
+// flush queues every PES being assembled once stream is over
+func (d *Demuxer) flush() {
+	for _, es := range d.PMT.Streams {
+		d.finish(es.PID)
+	}
+}
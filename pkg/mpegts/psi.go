@@ -0,0 +1,143 @@
+package mpegts
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Table ids of PSI sections
+const (
+	tablePAT = 0x00
+	tablePMT = 0x02
+)
+
+// Stream types of elementary streams found in PMT
+const (
+	StreamMPEG1Audio = 0x03
+	StreamMPEG2Audio = 0x04
+	StreamAAC        = 0x0F
+	StreamH264       = 0x1B
+	StreamHEVC       = 0x24
+	StreamID3        = 0x15 // Timed metadata
+)
+
+// PAT is program association table: PMT PID of every program number
+type PAT map[uint16]uint16
+
+// ElementaryStream is stream of a program listed in its PMT
+type ElementaryStream struct {
+	Type uint8
+	PID  uint16
+}
+
+// PMT is program map table: elementary streams of a program
+type PMT struct {
+	Program uint16
+	PCRPID  uint16
+	Streams []ElementaryStream
+}
+
+// section returns PSI section starting in payload of packet with payload unit start indicator,
+// more says how many bytes are still missing if section continues in following packets
+func section(payload []byte) (sec []byte, more int, err error) {
+	if len(payload) < 1 {
+		return nil, 0, errors.New("empty section")
+	}
+	pointer := int(payload[0])
+	if pointer+1 > len(payload) {
+		return nil, 0, errors.New("pointer field overflows packet")
+	}
+	sec = payload[pointer+1:]
+	if len(sec) < 3 {
+		return nil, 0, errors.New("truncated section header")
+	}
+	total := 3 + (int(sec[1]&0x0F)<<8 | int(sec[2]))
+	if total > len(sec) {
+		return sec, total - len(sec), nil
+	}
+	return sec[:total], 0, nil
+}
+
+// checkSection verifies CRC and returns section body between header and CRC
+func checkSection(sec []byte, table uint8) ([]byte, error) {
+	if sec[0] != table {
+		return nil, fmt.Errorf("unexpected table id 0x%02x", sec[0])
+	}
+	if len(sec) < 12 {
+		return nil, errors.New("truncated section")
+	}
+	if crc32(sec) != 0 { // CRC over whole section including CRC itself is zero
+		return nil, errors.New("section CRC mismatch")
+	}
+	return sec[8 : len(sec)-4], nil
+}
+
+// ParsePAT parses complete program association section
+func ParsePAT(sec []byte) (PAT, error) {
+	body, err := checkSection(sec, tablePAT)
+	if err != nil {
+		return nil, err
+	}
+	pat := make(PAT)
+	for ; len(body) >= 4; body = body[4:] {
+		program := uint16(body[0])<<8 | uint16(body[1])
+		pid := uint16(body[2]&0x1F)<<8 | uint16(body[3])
+		if program != 0 { // Zero is network PID
+			pat[program] = pid
+		}
+	}
+	return pat, nil
+}
+
+// ParsePMT parses complete program map section
+func ParsePMT(sec []byte) (PMT, error) {
+	body, err := checkSection(sec, tablePMT)
+	if err != nil {
+		return PMT{}, err
+	}
+	if len(body) < 4 {
+		return PMT{}, errors.New("truncated program map")
+	}
+	pmt := PMT{
+		Program: uint16(sec[3])<<8 | uint16(sec[4]),
+		PCRPID:  uint16(body[0]&0x1F)<<8 | uint16(body[1]),
+	}
+	info := int(body[2]&0x0F)<<8 | int(body[3])
+	if 4+info > len(body) {
+		return PMT{}, errors.New("program info overflows section")
+	}
+	for body = body[4+info:]; len(body) >= 5; {
+		es := ElementaryStream{Type: body[0], PID: uint16(body[1]&0x1F)<<8 | uint16(body[2])}
+		n := int(body[3]&0x0F)<<8 | int(body[4])
+		if 5+n > len(body) {
+			return PMT{}, errors.New("stream info overflows section")
+		}
+		pmt.Streams = append(pmt.Streams, es)
+		body = body[5+n:]
+	}
+	return pmt, nil
+}
+
+// crcTable is MPEG-2 CRC-32 table: polynomial 0x04C11DB7, not reflected
+var crcTable = func() (t [256]uint32) {
+	for i := range t {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04C11DB7
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}()
+
+func crc32(b []byte) uint32 {
+	c := uint32(0xFFFFFFFF)
+	for _, v := range b {
+		c = c<<8 ^ crcTable[byte(c>>24)^v]
+	}
+	return c
+}
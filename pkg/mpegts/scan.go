@@ -0,0 +1,267 @@
+package mpegts
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Kinds of problems Scan finds
+const (
+	ProblemSync       = "sync"       // Bytes not making packets in the middle of stream
+	ProblemPacket     = "packet"     // Packet marked as broken or malformed
+	ProblemContinuity = "continuity" // Packets of PID lost, continuity counter skipped
+	ProblemTables     = "tables"     // PAT or PMT missing or broken
+	ProblemTimestamp  = "timestamp"  // Timestamps jumping, e.g. stream restarted
+	ProblemTrailing   = "trailing"   // Partial packet or garbage at the end
+)
+
+// MaxProblems is how many problems of each kind Report lists, the rest are only counted
+const MaxProblems = 20
+
+// MaxJump is how far timestamps may move forward between frames before it counts as a jump
+const MaxJump = 10 * time.Second
+
+// Problem is a problem found at byte Offset of stream
+type Problem struct {
+	Offset  int64  `json:"offset"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("at byte %v: %v", p.Offset, p.Message)
+}
+
+// Report is what Scan found in transport stream
+type Report struct {
+	Size            int64          `json:"size"`
+	Packets         int64          `json:"packets"`
+	Duration        time.Duration  `json:"-"`               // Media time covered, timestamp jumps left out
+	Discontinuities int            `json:"discontinuities"` // Packets marking continuity reset on purpose
+	Problems        []Problem      `json:"problems"`        // Up to MaxProblems of each kind
+	Counts          map[string]int `json:"counts"`          // Problems of each kind
+	Trailing        int64          `json:"trailing"`        // Offset garbage at the end starts at, -1 if there's none
+}
+
+// Has reports whether problem of any of kinds was found
+func (r Report) Has(kinds ...string) bool {
+	for _, k := range kinds {
+		if r.Counts[k] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Report) add(off int64, kind, format string, args ...interface{}) {
+	r.Counts[kind]++
+	if r.Counts[kind] <= MaxProblems {
+		r.Problems = append(r.Problems, Problem{Offset: off, Kind: kind, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// Scan checks whole transport stream, unlike Validate going on past problems: packet structure,
+// continuity counters, PAT and PMT, timestamp jumps of the main elementary stream and what's left at the end
+func Scan(r io.Reader) (Report, error) {
+	rep := Report{Problems: []Problem{}, Counts: make(map[string]int), Trailing: -1}
+	br := bufio.NewReaderSize(r, 64*PacketSize)
+	var off int64
+
+	var pat PAT
+	var pmt PMT
+	counters := make(map[uint16]uint8)
+	psi := newSections()
+	var main uint16 // PID of the first video stream, or audio without video
+	var last, covered, step int64 = NoTimestamp, 0, 0
+	// cut ends run of timestamps following each other, its last frame lasts too
+	cut := func() {
+		if last != NoTimestamp {
+			covered += step
+		}
+		last = NoTimestamp
+	}
+
+	for {
+		b, err := br.Peek(PacketSize)
+		if len(b) < PacketSize {
+			if err == io.EOF {
+				if len(b) > 0 {
+					rep.add(off, ProblemTrailing, "stream ends with %v bytes of partial packet", len(b))
+					rep.Trailing = off
+					off += int64(len(b))
+				}
+				break
+			}
+			return rep, err
+		}
+
+		if b[0] != SyncByte {
+			n, found, err := resync(br)
+			if err != nil {
+				return rep, err
+			}
+			if !found { // Nothing but garbage until the end
+				rest, err := io.Copy(io.Discard, br)
+				if err != nil {
+					return rep, err
+				}
+				rep.add(off, ProblemTrailing, "stream ends with %v bytes of garbage", int64(n)+rest)
+				rep.Trailing = off
+				off += int64(n) + rest
+				break
+			}
+			rep.add(off, ProblemSync, "lost sync for %v bytes", n)
+			off += int64(n)
+			counters = make(map[uint16]uint8) // Packets were lost with garbage
+			cut()
+			continue
+		}
+
+		p, err := ParsePacket(b)
+		pktOff := off
+		rep.Packets++
+		off += PacketSize
+		if err != nil {
+			rep.add(pktOff, ProblemPacket, "%v", err)
+			delete(counters, p.PID)
+			br.Discard(PacketSize)
+			continue
+		}
+		if p.Discontinuity {
+			rep.Discontinuities++
+			if p.PID == main {
+				cut()
+			}
+		}
+		if p.PID == PIDNull || !p.HasPayload {
+			br.Discard(PacketSize)
+			continue
+		}
+		if prev, ok := counters[p.PID]; ok && !p.Discontinuity && p.Continuity != prev && p.Continuity != (prev+1)&0x0F {
+			rep.add(pktOff, ProblemContinuity, "continuity counter of PID %v jumped from %v to %v, %v packet(s) lost", p.PID, prev, p.Continuity, (p.Continuity-prev-1)&0x0F)
+		}
+		counters[p.PID] = p.Continuity
+
+		switch {
+		case p.PID == PIDPAT || pat.has(p.PID):
+			sec, err := psi.add(p)
+			if err != nil {
+				rep.add(pktOff, ProblemTables, "%v", err)
+				break
+			}
+			if sec == nil {
+				break
+			}
+			if p.PID == PIDPAT {
+				if pat, err = ParsePAT(sec); err != nil {
+					rep.add(pktOff, ProblemTables, "PAT: %v", err)
+				}
+				break
+			}
+			t, err := ParsePMT(sec)
+			if err != nil {
+				rep.add(pktOff, ProblemTables, "PMT: %v", err)
+				break
+			}
+			if pmt.Program == 0 || pmt.Program == t.Program {
+				pmt = t
+				if main == 0 {
+					main = mainStream(t)
+				}
+			}
+		case p.PID == main && p.PayloadStart:
+			var pes PES
+			if parsePES(&pes, p.Payload) != nil {
+				break
+			}
+			ts := pes.DTS
+			if ts == NoTimestamp {
+				ts = pes.PTS
+			}
+			if ts == NoTimestamp {
+				break
+			}
+			if last != NoTimestamp {
+				delta := (ts - last) & (1<<33 - 1) // Rollover of 33 bit clock
+				if delta >= 1<<32 {
+					delta -= 1 << 33
+				}
+				switch {
+				case delta < 0 || delta > int64(MaxJump.Seconds()*ClockRate):
+					rep.add(pktOff, ProblemTimestamp, "timestamps jump by %v", time.Duration(delta*int64(time.Second)/ClockRate).Round(time.Millisecond))
+					cut()
+				default:
+					covered += delta
+					if delta > 0 {
+						step = delta
+					}
+				}
+			}
+			last = ts
+		}
+		br.Discard(PacketSize)
+	}
+
+	rep.Size = off
+	if rep.Packets > 0 && len(pat) == 0 {
+		rep.add(0, ProblemTables, "no PAT")
+	} else if rep.Packets > 0 && len(pmt.Streams) == 0 {
+		rep.add(0, ProblemTables, "no PMT")
+	}
+	cut()
+	rep.Duration = time.Duration(covered * int64(time.Second) / ClockRate)
+	return rep, nil
+}
+
+// resync skips bytes until two packets in a row start with sync byte, returning how many were skipped
+// and whether packets were found before stream ends. The last packet of stream only needs to be whole
+func resync(br *bufio.Reader) (int, bool, error) {
+	n := 0
+	for {
+		if _, err := br.Discard(1); err != nil {
+			if err == io.EOF {
+				return n, false, nil
+			}
+			return n, false, err
+		}
+		n++
+		b, err := br.Peek(PacketSize + 1)
+		switch {
+		case len(b) == PacketSize+1 && b[0] == SyncByte && b[PacketSize] == SyncByte:
+			return n, true, nil
+		case len(b) == PacketSize && b[0] == SyncByte && err == io.EOF:
+			return n, true, nil
+		case len(b) < PacketSize && err == io.EOF:
+			return n, false, nil
+		case err != nil && err != io.EOF:
+			return n, false, err
+		}
+	}
+}
+
+// mainStream returns PID of the first video stream of program, or audio if it has no video
+func mainStream(pmt PMT) uint16 {
+	var audio uint16
+	for _, es := range pmt.Streams {
+		switch es.Type {
+		case StreamH264, StreamHEVC:
+			return es.PID
+		case StreamAAC, StreamMPEG1Audio, StreamMPEG2Audio:
+			if audio == 0 {
+				audio = es.PID
+			}
+		}
+	}
+	return audio
+}
+
+func (p PAT) has(pid uint16) bool {
+	for _, v := range p {
+		if v == pid {
+			return true
+		}
+	}
+	return false
+}
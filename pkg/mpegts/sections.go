@@ -0,0 +1,40 @@
+package mpegts
+
+// sections assembles PSI sections which may span several packets of their PID
+type sections struct {
+	pending map[uint16][]byte
+	missing map[uint16]int
+}
+
+func newSections() *sections {
+	return &sections{pending: make(map[uint16][]byte), missing: make(map[uint16]int)}
+}
+
+// add feeds packet of PSI PID, returning section once it's complete
+func (s *sections) add(p Packet) ([]byte, error) {
+	switch {
+	case p.PayloadStart:
+		sec, more, err := section(p.Payload)
+		if err != nil {
+			return nil, err
+		}
+		if more > 0 {
+			s.pending[p.PID], s.missing[p.PID] = append([]byte(nil), sec...), more
+			return nil, nil
+		}
+		return sec, nil
+	case s.missing[p.PID] > 0:
+		n := s.missing[p.PID]
+		if n > len(p.Payload) {
+			n = len(p.Payload)
+		}
+		s.pending[p.PID] = append(s.pending[p.PID], p.Payload[:n]...)
+		if s.missing[p.PID] -= n; s.missing[p.PID] > 0 {
+			return nil, nil
+		}
+		sec := s.pending[p.PID]
+		delete(s.pending, p.PID)
+		return sec, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,76 @@
+package mpegts
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validate checks b is a self-contained transport stream segment: whole packets all starting with sync byte,
+// PAT and PMT of its program present and parseable and continuity counters of every PID in order
+func Validate(b []byte) error {
+	if len(b)%PacketSize != 0 {
+		return &Error{Offset: int64(len(b) - len(b)%PacketSize), Err: ErrSize}
+	}
+
+	var pat PAT
+	pmts := make(map[uint16]bool) // PMT PIDs found
+	counters := make(map[uint16]uint8)
+	psi := newSections()
+
+	for off := 0; off < len(b); off += PacketSize {
+		p, err := ParsePacket(b[off : off+PacketSize])
+		if err != nil {
+			return &Error{Offset: int64(off), Err: err}
+		}
+		if p.PID == PIDNull || !p.HasPayload {
+			continue
+		}
+		if last, ok := counters[p.PID]; ok && !p.Discontinuity && p.Continuity != last && p.Continuity != (last+1)&0x0F {
+			return &Error{Offset: int64(off), Err: fmt.Errorf("continuity counter of PID %v jumped from %v to %v", p.PID, last, p.Continuity)}
+		}
+		counters[p.PID] = p.Continuity
+
+		isPMT := false
+		for _, pid := range pat {
+			isPMT = isPMT || pid == p.PID
+		}
+		if p.PID != PIDPAT && !isPMT {
+			continue
+		}
+
+		sec, err := psi.add(p)
+		if err != nil {
+			return &Error{Offset: int64(off), Err: err}
+		}
+		if sec == nil {
+			continue
+		}
+
+		if p.PID == PIDPAT {
+			if pat, err = ParsePAT(sec); err != nil {
+				return &Error{Offset: int64(off), Err: fmt.Errorf("PAT: %w", err)}
+			}
+			continue
+		}
+		if _, err := ParsePMT(sec); err != nil {
+			return &Error{Offset: int64(off), Err: fmt.Errorf("PMT: %w", err)}
+		}
+		pmts[p.PID] = true
+	}
+
+	if len(pat) == 0 {
+		return ErrNoPAT
+	}
+	for _, pid := range pat {
+		if !pmts[pid] {
+			return ErrNoPMT
+		}
+	}
+	return nil
+}
+
+// IsInvalid reports whether err was returned by Validate for malformed data
+func IsInvalid(err error) bool {
+	var e *Error
+	return errors.As(err, &e) || errors.Is(err, ErrNoPAT) || errors.Is(err, ErrNoPMT)
+}
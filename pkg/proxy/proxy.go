@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// Pool hands out proxies round-robin to requests whose host is not on no-proxy list.
+// Use its Proxy method as http.Transport.Proxy
+type Pool struct {
+	proxies []*url.URL
+	noProxy []rule
+	next    uint32
+}
+
+// rule is one no-proxy entry: IP network, or domain matching itself and its subdomains
+type rule struct {
+	network *net.IPNet
+	domain  string
+}
+
+// New parses proxy URLs with http, https, socks5 or socks5h scheme. Username and password are used
+// for proxies not stating their own credentials. No-proxy entries are hosts, domains, IPs and CIDRs,
+// '*' sends everything direct
+func New(urls, noProxy []string, username, password string) (*Pool, error) {
+	p := &Pool{}
+	for _, v := range urls {
+		u, err := url.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy '%v': %w", redact(v), err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("invalid proxy '%v': scheme must be http, https, socks5 or socks5h", redact(v))
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy '%v': missing host", redact(v))
+		}
+		if u.User == nil && username != "" {
+			u.User = url.UserPassword(username, password)
+		}
+		p.proxies = append(p.proxies, u)
+	}
+
+	for _, v := range noProxy {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(v); err == nil {
+			p.noProxy = append(p.noProxy, rule{network: network})
+			continue
+		}
+		if ip := net.ParseIP(v); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			p.noProxy = append(p.noProxy, rule{network: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}})
+			continue
+		}
+		p.noProxy = append(p.noProxy, rule{domain: strings.TrimPrefix(v, ".")})
+	}
+	return p, nil
+}
+
+// Direct reports whether requests to host bypass proxies
+func (p *Pool) Direct(host string) bool {
+	if len(p.proxies) == 0 {
+		return true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	ip := net.ParseIP(host)
+	for _, r := range p.noProxy {
+		switch {
+		case r.domain == "*":
+			return true
+		case r.network != nil:
+			if ip != nil && r.network.Contains(ip) {
+				return true
+			}
+		case host == r.domain || strings.HasSuffix(host, "."+r.domain):
+			return true
+		}
+	}
+	return false
+}
+
+// Proxy returns next proxy for request, nil for direct connection
+func (p *Pool) Proxy(req *http.Request) (*url.URL, error) {
+	if p.Direct(req.URL.Host) {
+		return nil, nil
+	}
+	i := atomic.AddUint32(&p.next, 1) - 1
+	return p.proxies[int(i)%len(p.proxies)], nil
+}
+
+// Len returns amount of proxies in pool
+func (p *Pool) Len() int {
+	return len(p.proxies)
+}
+
+// redact hides password of proxy URL in error messages
+func redact(v string) string {
+	u, err := url.Parse(v)
+	if err != nil || u.User == nil {
+		return v
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	p, err := New([]string{"http://a:8080", "socks5://user:pass@b:1080"}, nil, "default", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, p.Len())
+	assert.Equal(t, "default:secret", p.proxies[0].User.String())
+	assert.Equal(t, "user:pass", p.proxies[1].User.String())
+
+	_, err = New([]string{"ftp://a:21"}, nil, "", "")
+	assert.Error(t, err)
+	_, err = New([]string{"http://user:hunter2@"}, nil, "", "")
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "hunter2")
+}
+
+func TestRoundRobin(t *testing.T) {
+	p, err := New([]string{"http://a:8080", "https://b:8443", "socks5://c:1080"}, nil, "", "")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "https://usher.ttvnw.net/api/channel/hls/rwxrob.m3u8", nil)
+	var hosts []string
+	for i := 0; i < 4; i++ {
+		u, err := p.Proxy(req)
+		assert.NoError(t, err)
+		hosts = append(hosts, u.Host)
+	}
+	assert.Equal(t, []string{"a:8080", "b:8443", "c:1080", "a:8080"}, hosts)
+}
+
+func TestDirect(t *testing.T) {
+	p, err := New([]string{"http://a:8080"}, []string{"localhost", ".internal.example.com", "10.0.0.0/8", "192.168.1.1", "::1"}, "", "")
+	assert.NoError(t, err)
+
+	for host, direct := range map[string]bool{
+		"localhost:8080":           true,
+		"internal.example.com":     true,
+		"cdn.internal.example.com": true,
+		"notinternal.example.com":  false,
+		"10.1.2.3":                 true,
+		"192.168.1.1:443":          true,
+		"192.168.1.2":              false,
+		"[::1]:80":                 true,
+		"gql.twitch.tv":            false,
+	} {
+		assert.Equal(t, direct, p.Direct(host), host)
+	}
+
+	all, _ := New([]string{"http://a:8080"}, []string{"*"}, "", "")
+	assert.True(t, all.Direct("gql.twitch.tv"))
+	none, _ := New(nil, nil, "", "")
+	assert.True(t, none.Direct("gql.twitch.tv"))
+}
+
+func TestTransport(t *testing.T) {
+	// Plain HTTP proxy receives absolute URL with credentials in Proxy-Authorization
+	var got *http.Request
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		io.WriteString(w, "via proxy")
+	}))
+	defer proxySrv.Close()
+
+	u, _ := url.Parse(proxySrv.URL)
+	p, err := New([]string{"http://" + u.Host}, nil, "rekoda", "s3cr3t")
+	assert.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{Proxy: p.Proxy}}
+
+	res, err := client.Get("http://video-weaver.example.com/v1/playlist/1.m3u8")
+	assert.NoError(t, err)
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, "via proxy", string(b))
+	assert.Equal(t, "http://video-weaver.example.com/v1/playlist/1.m3u8", got.RequestURI)
+	assert.Equal(t, "Basic cmVrb2RhOnMzY3IzdA==", got.Header.Get("Proxy-Authorization"))
+}
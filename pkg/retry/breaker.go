@@ -0,0 +1,144 @@
+package retry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Breaker is per-host circuit breaker. After Threshold failures in a row host is held open for Cooldown
+// and every request to it waits, then a single probe is let through: success closes circuit,
+// failure opens it again for twice as long, up to MaxCooldown. Nil Breaker lets everything through
+type Breaker struct {
+	Threshold   int
+	Cooldown    time.Duration
+	MaxCooldown time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+	now   func() time.Time
+}
+
+type circuit struct {
+	failures int
+	cooldown time.Duration // Current one, grows while probes fail
+	until    time.Time     // Open until then, zero when closed
+	probing  bool          // Probe is on its way
+}
+
+// probeWait is how often requests waiting for probe's outcome ask again
+const probeWait = time.Second
+
+// OpenError is returned when request can't wait for host's circuit to close
+type OpenError struct {
+	Host string
+	Wait time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit open for %v, next try in %v", e.Host, e.Wait.Round(time.Millisecond))
+}
+
+// NewBreaker returns breaker opening after threshold consecutive failures of host
+func NewBreaker(threshold int, cooldown, maxCooldown time.Duration) *Breaker {
+	if maxCooldown < cooldown {
+		maxCooldown = cooldown
+	}
+	return &Breaker{Threshold: threshold, Cooldown: cooldown, MaxCooldown: maxCooldown, hosts: make(map[string]*circuit), now: time.Now}
+}
+
+// Wait returns how long request to host has to wait, zero if it may go right now
+func (b *Breaker) Wait(host string) time.Duration {
+	wait, _ := b.probe(host)
+	return wait
+}
+
+// probe is Wait also telling whether request let through is host's probe,
+// which must end with Success, Failure or release
+func (b *Breaker) probe(host string) (time.Duration, bool) {
+	if b == nil || b.Threshold < 1 {
+		return 0, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+	if !ok || c.until.IsZero() {
+		return 0, false
+	}
+	if wait := c.until.Sub(b.now()); wait > 0 {
+		return wait, false
+	}
+	if c.probing {
+		return probeWait, false
+	}
+	c.probing = true
+	return 0, true
+}
+
+// release lets another request probe host, when probe ended without telling whether host is fine
+func (b *Breaker) release(host string) {
+	if b == nil || b.Threshold < 1 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.hosts[host]; ok {
+		c.probing = false
+	}
+}
+
+// Success closes host's circuit
+func (b *Breaker) Success(host string) {
+	if b == nil || b.Threshold < 1 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.hosts, host)
+}
+
+// Failure counts failed request to host, opening its circuit once threshold is reached or probe failed
+func (b *Breaker) Failure(host string) {
+	if b == nil || b.Threshold < 1 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+	if !ok {
+		c = &circuit{}
+		b.hosts[host] = c
+	}
+	c.failures++
+	switch {
+	case c.probing:
+		c.probing = false
+		if c.cooldown *= 2; c.cooldown > b.MaxCooldown {
+			c.cooldown = b.MaxCooldown
+		}
+		c.until = b.now().Add(c.cooldown)
+	case c.until.IsZero() && c.failures >= b.Threshold:
+		c.cooldown = b.Cooldown
+		c.until = b.now().Add(c.cooldown)
+	}
+}
+
+// Open returns hosts whose circuit is open right now, sorted
+func (b *Breaker) Open() []string {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var hosts []string
+	for host, c := range b.hosts {
+		if !c.until.IsZero() {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
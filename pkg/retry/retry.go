@@ -0,0 +1,212 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultRetryOn are response status codes worth repeating request for
+var DefaultRetryOn = []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+	http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// Policy is how failed requests are repeated. Transport errors and responses with RetryOn status codes
+// are retried after random delay between zero and BaseDelay doubled per attempt, capped by MaxDelay ("full jitter"),
+// or after delay server asked for with Retry-After header
+type Policy struct {
+	Attempts  int // Including the first one, at least one is always made
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Budget    time.Duration // Total time all attempts and delays may take, zero for no limit
+	RetryOn   []int
+}
+
+// Attempt describes failed attempt, passed to Do's notify callback before sleeping
+type Attempt struct {
+	N    int // Attempt number starting at 1, zero while waiting for circuit breaker
+	Err  error
+	Wait time.Duration
+}
+
+// StatusError is returned when every attempt got retryable response status
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("received HTTP %v", e.Code)
+}
+
+// ErrBudget is returned when there's no time left in budget for another attempt
+var ErrBudget = errors.New("retry budget exhausted")
+
+// Retryable reports whether response with status code should be retried
+func (p Policy) Retryable(code int) bool {
+	for _, c := range p.RetryOn {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns random delay after failed attempt n (starting at 1)
+func (p Policy) Backoff(n int) time.Duration {
+	ceil := p.BaseDelay
+	for i := 1; i < n && (p.MaxDelay <= 0 || ceil < p.MaxDelay); i++ {
+		ceil *= 2
+	}
+	if p.MaxDelay > 0 && ceil > p.MaxDelay {
+		ceil = p.MaxDelay
+	}
+	if ceil <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceil) + 1))
+}
+
+// RetryAfter parses Retry-After header given either in seconds or as HTTP date
+func RetryAfter(res *http.Response, now time.Time) (time.Duration, bool) {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Do sends request until it succeeds, fails in a way not worth retrying, or attempts or budget run out.
+// Requests to hosts breaker holds open wait until it lets them through. Request body is rewound
+// with GetBody for every attempt, requests without one are sent once. Breaker and notify may be nil
+func (p Policy) Do(ctx context.Context, do func(*http.Request) (*http.Response, error), req *http.Request,
+	breaker *Breaker, notify func(Attempt)) (*http.Response, error) {
+	attempts := p.Attempts
+	if attempts < 1 || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		attempts = 1
+	}
+	var deadline time.Time
+	if p.Budget > 0 {
+		deadline = time.Now().Add(p.Budget)
+	}
+	host := req.URL.Host
+
+	// Probe cancelled or never sent tells nothing about host, let another request probe it
+	var probe bool
+	defer func() {
+		if probe {
+			breaker.release(host)
+		}
+	}()
+
+	var err error
+	for n := 1; ; n++ {
+		// Wait for circuit breaker, doesn't count as attempt
+		for {
+			var wait time.Duration
+			wait, probe = breaker.probe(host)
+			if wait <= 0 {
+				break
+			}
+			open := &OpenError{Host: host, Wait: wait}
+			if !deadline.IsZero() && time.Now().Add(wait).After(deadline) {
+				return nil, open
+			}
+			if notify != nil {
+				notify(Attempt{Err: open, Wait: wait})
+			}
+			if err := sleep(ctx, wait); err != nil {
+				return nil, err
+			}
+		}
+
+		r := req
+		if n > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+
+		var res *http.Response
+		res, err = do(r)
+		var wait time.Duration
+		switch {
+		case err == nil && !p.Retryable(res.StatusCode):
+			breaker.Success(host)
+			probe = false
+			return res, nil
+		case err == nil:
+			// Server is fine but busy or failing, drain response so connection is reused
+			breaker.Failure(host)
+			probe = false
+			var ok bool
+			wait, ok = RetryAfter(res, time.Now())
+			if backoff := p.Backoff(n); !ok || backoff > wait {
+				wait = backoff
+			}
+			res.Body.Close()
+			err = &StatusError{Code: res.StatusCode}
+		default:
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			breaker.Failure(host)
+			probe = false
+			wait = p.Backoff(n)
+		}
+
+		if n >= attempts {
+			return nil, err
+		}
+		if !deadline.IsZero() && time.Now().Add(wait).After(deadline) {
+			return nil, fmt.Errorf("%w: %v", ErrBudget, err)
+		}
+		if notify != nil {
+			notify(Attempt{N: n, Err: err, Wait: wait})
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Transport is http.RoundTripper retrying requests by Policy, handy for API clients
+type Transport struct {
+	Base    http.RoundTripper // http.DefaultTransport if nil
+	Policy  Policy
+	Breaker *Breaker
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return t.Policy.Do(req.Context(), base.RoundTrip, req, t.Breaker, nil)
+}
@@ -0,0 +1,201 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fast = Policy{Attempts: 4, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, RetryOn: DefaultRetryOn}
+
+// flaky answers with codes in order, then 200
+func flaky(codes ...int) (*httptest.Server, *int32) {
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(&n, 1)) - 1
+		if i < len(codes) {
+			w.WriteHeader(codes[i])
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	return srv, &n
+}
+
+func TestDoRetriesStatus(t *testing.T) {
+	srv, n := flaky(503, 429)
+	defer srv.Close()
+
+	var attempts []Attempt
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	res, err := fast.Do(context.Background(), srv.Client().Do, req, nil, func(a Attempt) { attempts = append(attempts, a) })
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	res.Body.Close()
+	assert.Equal(t, int32(3), *n)
+	if assert.Len(t, attempts, 2) {
+		assert.Equal(t, &StatusError{503}, attempts[0].Err)
+		assert.Equal(t, 2, attempts[1].N)
+	}
+}
+
+func TestDoGivesUp(t *testing.T) {
+	srv, n := flaky(500, 500, 500, 500, 500)
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	_, err := fast.Do(context.Background(), srv.Client().Do, req, nil, nil)
+	assert.Equal(t, &StatusError{500}, err)
+	assert.Equal(t, int32(4), *n)
+
+	// Not retryable status is a regular response
+	srv404, n404 := flaky(404)
+	defer srv404.Close()
+	req, _ = http.NewRequest("GET", srv404.URL, nil)
+	res, err := fast.Do(context.Background(), srv404.Client().Do, req, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 404, res.StatusCode)
+	assert.Equal(t, int32(1), *n404)
+}
+
+func TestDoRetryAfterAndBudget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(429)
+	}))
+	defer srv.Close()
+
+	p := fast
+	p.Budget = time.Second
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	start := time.Now()
+	_, err := p.Do(context.Background(), srv.Client().Do, req, nil, nil)
+	assert.ErrorIs(t, err, ErrBudget)
+	assert.Less(t, time.Since(start), time.Second, "must not sleep for Retry-After beyond budget")
+}
+
+func TestDoRewindsBody(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if len(bodies) == 1 {
+			w.WriteHeader(502)
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &Transport{Policy: fast}}
+	res, err := client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, []string{"payload", "payload"}, bodies)
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, p.Backoff(1), time.Second)
+		assert.LessOrEqual(t, p.Backoff(3), 4*time.Second)
+		assert.LessOrEqual(t, p.Backoff(60), 10*time.Second)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2021, 9, 8, 12, 0, 0, 0, time.UTC)
+	res := &http.Response{Header: http.Header{}}
+	_, ok := RetryAfter(res, now)
+	assert.False(t, ok)
+
+	res.Header.Set("Retry-After", "7")
+	d, ok := RetryAfter(res, now)
+	assert.True(t, ok)
+	assert.Equal(t, 7*time.Second, d)
+
+	res.Header.Set("Retry-After", now.Add(time.Minute).Format(http.TimeFormat))
+	d, ok = RetryAfter(res, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, d)
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2021, 9, 8, 12, 0, 0, 0, time.UTC)
+	b := NewBreaker(3, 10*time.Second, 30*time.Second)
+	b.now = func() time.Time { return now }
+	const host = "video-edge-1.twitch.tv"
+
+	b.Failure(host)
+	b.Failure(host)
+	assert.Zero(t, b.Wait(host))
+	b.Failure(host)
+	assert.Equal(t, 10*time.Second, b.Wait(host))
+	assert.Equal(t, []string{host}, b.Open())
+	assert.Zero(t, b.Wait("video-edge-2.twitch.tv"), "other hosts are not affected")
+
+	// Single probe after cooldown, failing doubles cooldown
+	now = now.Add(10 * time.Second)
+	assert.Zero(t, b.Wait(host))
+	assert.Equal(t, probeWait, b.Wait(host))
+	b.Failure(host)
+	assert.Equal(t, 20*time.Second, b.Wait(host))
+
+	now = now.Add(20 * time.Second)
+	assert.Zero(t, b.Wait(host))
+	b.Failure(host)
+	assert.Equal(t, 30*time.Second, b.Wait(host), "capped by max cooldown")
+
+	now = now.Add(30 * time.Second)
+	assert.Zero(t, b.Wait(host))
+	b.Success(host)
+	assert.Zero(t, b.Wait(host))
+	assert.Empty(t, b.Open())
+
+	var nilBreaker *Breaker
+	nilBreaker.Failure(host)
+	assert.Zero(t, nilBreaker.Wait(host))
+}
+
+func TestDoWaitsForBreaker(t *testing.T) {
+	srv, _ := flaky()
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+
+	b := NewBreaker(1, time.Hour, time.Hour)
+	b.Failure(req.URL.Host)
+
+	p := fast
+	p.Budget = time.Second
+	_, err := p.Do(context.Background(), srv.Client().Do, req, b, nil)
+	var open *OpenError
+	assert.True(t, errors.As(err, &open))
+	assert.Equal(t, req.URL.Host, open.Host)
+}
+
+func TestDoReleasesCancelledProbe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	host := req.URL.Host
+
+	now := time.Now()
+	b := NewBreaker(1, time.Minute, time.Minute)
+	b.now = func() time.Time { return now }
+	b.Failure(host)
+	now = now.Add(time.Minute)
+
+	_, err := fast.Do(ctx, srv.Client().Do, req.WithContext(ctx), b, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, b.Wait(host), "another request probes host")
+	assert.Equal(t, probeWait, b.Wait(host))
+}
@@ -0,0 +1,57 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotify(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets unsupported: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", sock)
+
+	sent, err := Notify(Ready + "\n" + Status("Recording 1 channel(s)"))
+	assert.NoError(t, err)
+	assert.True(t, sent)
+
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "READY=1\nSTATUS=Recording 1 channel(s)", string(buf[:n]))
+}
+
+func TestNotifyWithoutSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := Notify(Ready)
+	assert.NoError(t, err)
+	assert.False(t, sent)
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	d, err := WatchdogInterval()
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, d)
+
+	t.Setenv("WATCHDOG_PID", "1")
+	d, err = WatchdogInterval()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	t.Setenv("WATCHDOG_USEC", "")
+	d, err = WatchdogInterval()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+}